@@ -3,20 +3,59 @@ package config
 import (
 	"errors"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
 type AppConfig struct {
+	Environment        string
 	ServerPort         string
 	DSN                string
 	JWTSecret          string
+	JWTKeysDir         string
+	JWTPrivateKey      string
+	JWTSigningKeyID    string
+	JWTIssuer          string
+	JWTAudience        string
 	TwilioAccountSID   string
 	TwilioAccountToken string
 	TwilioFromPhone    string
+	SMTPHost           string
+	SMTPPort           string
+	SMTPUsername       string
+	SMTPPassword       string
+	SMTPFrom           string
 	StripeSecret       string
 	SuccessUrl         string
 	CancelUrl          string
+	AppName            string
+	AppBaseURL         string
+	AdminEmails        []string
+	TwoFactorRoles     []string
+	TwoFactorGrace     time.Duration
+	OIDCProviders      []OIDCProvider
+	DeletionGrace      time.Duration
+	UploadsDir         string
+	StorageDriver      string
+	S3Endpoint         string
+	S3Region           string
+	S3Bucket           string
+	S3AccessKeyID      string
+	S3SecretAccessKey  string
+	EncryptionKeyFile  string
+	FulfillmentPolicy  string
 }
 
 func SetupEnv(envFileName string) (cfg AppConfig, err error) {
@@ -24,6 +63,12 @@ func SetupEnv(envFileName string) (cfg AppConfig, err error) {
 		return AppConfig{}, errors.New("failed loading env file")
 	}
 
+	// development allows generated keys, any other environment must configure them
+	environment := os.Getenv("APP_ENV")
+	if len(environment) < 1 {
+		environment = "production"
+	}
+
 	httpPort := os.Getenv("HTTP_PORT")
 	if len(httpPort) < 1 {
 		return AppConfig{}, errors.New("http port variable not found")
@@ -35,7 +80,7 @@ func SetupEnv(envFileName string) (cfg AppConfig, err error) {
 	}
 
 	jwtSecret := os.Getenv("JWT_SECRET")
-	if len(dsn) < 1 {
+	if len(jwtSecret) < 1 {
 		return AppConfig{}, errors.New("jwt secret variable not found")
 	}
 
@@ -54,15 +99,175 @@ func SetupEnv(envFileName string) (cfg AppConfig, err error) {
 		return AppConfig{}, errors.New("twilio from phone variable not found")
 	}
 
+	jwtIssuer := os.Getenv("JWT_ISSUER")
+	if len(jwtIssuer) < 1 {
+		jwtIssuer = "go-ecommerce-app"
+	}
+
+	jwtAudience := os.Getenv("JWT_AUDIENCE")
+	if len(jwtAudience) < 1 {
+		jwtAudience = "go-ecommerce-app"
+	}
+
+	appName := os.Getenv("APP_NAME")
+	if len(appName) < 1 {
+		appName = "GoEcommerce"
+	}
+
+	// public url of the api, used in links sent by email
+	appBaseURL := strings.TrimSuffix(os.Getenv("APP_BASE_URL"), "/")
+	if len(appBaseURL) < 1 {
+		appBaseURL = "http://localhost" + httpPort
+	}
+
+	smtpPort := os.Getenv("SMTP_PORT")
+	if len(smtpPort) < 1 {
+		smtpPort = "587"
+	}
+
+	// data keys of encrypted columns are wrapped with the keys of this file,
+	// it is created on first start in development
+	encryptionKeyFile := os.Getenv("ENCRYPTION_KEY_FILE")
+	if len(encryptionKeyFile) < 1 {
+		encryptionKeyFile = ".keys/encryption.json"
+	}
+
+	uploadsDir := os.Getenv("UPLOADS_DIR")
+	if len(uploadsDir) < 1 {
+		uploadsDir = "uploads"
+	}
+
+	// uploads are kept below UPLOADS_DIR with the local driver, or in S3_BUCKET with s3
+	storageDriver := os.Getenv("STORAGE_DRIVER")
+	if len(storageDriver) < 1 {
+		storageDriver = "local"
+	}
+	if storageDriver != "local" && storageDriver != "s3" {
+		return AppConfig{}, errors.New("storage driver must be local or s3")
+	}
+
+	// how orders pick the warehouses they ship from, nearest or single_location
+	fulfillmentPolicy := os.Getenv("FULFILLMENT_POLICY")
+	if len(fulfillmentPolicy) < 1 {
+		fulfillmentPolicy = "nearest"
+	}
+	if fulfillmentPolicy != "nearest" && fulfillmentPolicy != "single_location" {
+		return AppConfig{}, errors.New("fulfillment policy must be nearest or single_location")
+	}
+
+	// registered users made admins on start, the first admin can't be appointed otherwise
+	adminEmails := splitList(strings.ToLower(os.Getenv("ADMIN_EMAILS")))
+
+	// roles that must use two-factor authentication, empty value disables the policy
+	twoFactorRoles, ok := os.LookupEnv("TWO_FACTOR_REQUIRED_ROLES")
+	if !ok {
+		twoFactorRoles = "seller,admin"
+	}
+
+	// days the users of those roles have to enroll, counted from their first sign in
+	twoFactorGraceDays := 14
+	if value := os.Getenv("TWO_FACTOR_GRACE_DAYS"); len(value) > 0 {
+		twoFactorGraceDays, err = strconv.Atoi(value)
+		if err != nil || twoFactorGraceDays < 0 {
+			return AppConfig{}, errors.New("two-factor grace days must be a non-negative number")
+		}
+	}
+
+	// days between an account deletion request and the anonymization, 0 deletes immediately
+	deletionGraceDays := 30
+	if value := os.Getenv("ACCOUNT_DELETION_GRACE_DAYS"); len(value) > 0 {
+		deletionGraceDays, err = strconv.Atoi(value)
+		if err != nil || deletionGraceDays < 0 {
+			return AppConfig{}, errors.New("account deletion grace days must be a non-negative number")
+		}
+	}
+
 	return AppConfig{
+		Environment:        environment,
 		ServerPort:         httpPort,
 		DSN:                dsn,
 		JWTSecret:          jwtSecret,
+		JWTKeysDir:         os.Getenv("JWT_KEYS_DIR"),
+		JWTPrivateKey:      os.Getenv("JWT_PRIVATE_KEY"),
+		JWTSigningKeyID:    os.Getenv("JWT_SIGNING_KEY_ID"),
+		JWTIssuer:          jwtIssuer,
+		JWTAudience:        jwtAudience,
 		TwilioAccountSID:   twilioAccountSID,
 		TwilioAccountToken: twilioAccountToken,
 		TwilioFromPhone:    twilioFromPhone,
+		SMTPHost:           os.Getenv("SMTP_HOST"),
+		SMTPPort:           smtpPort,
+		SMTPUsername:       os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:       os.Getenv("SMTP_PASSWORD"),
+		SMTPFrom:           os.Getenv("SMTP_FROM"),
 		StripeSecret:       os.Getenv("STRIPE_SECRET"),
 		SuccessUrl:         os.Getenv("SUCCESS_URL"),
 		CancelUrl:          os.Getenv("CANCEL_URL"),
+		AppName:            appName,
+		AppBaseURL:         appBaseURL,
+		AdminEmails:        adminEmails,
+		TwoFactorRoles:     splitList(twoFactorRoles),
+		TwoFactorGrace:     time.Duration(twoFactorGraceDays) * 24 * time.Hour,
+		OIDCProviders:      loadOIDCProviders(),
+		DeletionGrace:      time.Duration(deletionGraceDays) * 24 * time.Hour,
+		UploadsDir:         uploadsDir,
+		StorageDriver:      storageDriver,
+		S3Endpoint:         os.Getenv("S3_ENDPOINT"),
+		S3Region:           os.Getenv("S3_REGION"),
+		S3Bucket:           os.Getenv("S3_BUCKET"),
+		S3AccessKeyID:      os.Getenv("S3_ACCESS_KEY_ID"),
+		S3SecretAccessKey:  os.Getenv("S3_SECRET_ACCESS_KEY"),
+		EncryptionKeyFile:  encryptionKeyFile,
+		FulfillmentPolicy:  fulfillmentPolicy,
 	}, nil
 }
+
+// IsDevelopment reports whether the app runs as a local development setup.
+func (c AppConfig) IsDevelopment() bool {
+	return c.Environment == "development"
+}
+
+// well known issuers, other providers must set OIDC_<NAME>_ISSUER
+var defaultOIDCIssuers = map[string]string{
+	"google": "https://accounts.google.com",
+	"apple":  "https://appleid.apple.com",
+}
+
+// loadOIDCProviders reads OIDC_PROVIDERS=google,apple,corp and the
+// OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET, _REDIRECT_URL and _SCOPES variables.
+func loadOIDCProviders() []OIDCProvider {
+	var providers []OIDCProvider
+
+	for _, name := range splitList(os.Getenv("OIDC_PROVIDERS")) {
+		name = strings.ToLower(name)
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+
+		issuer := os.Getenv(prefix + "ISSUER")
+		if len(issuer) < 1 {
+			issuer = defaultOIDCIssuers[name]
+		}
+
+		providers = append(providers, OIDCProvider{
+			Name:         name,
+			Issuer:       issuer,
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		})
+	}
+
+	return providers
+}
+
+func splitList(value string) []string {
+	var items []string
+
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
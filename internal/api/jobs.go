@@ -0,0 +1,95 @@
+package api
+
+import (
+	"go-ecommerce-app/internal/api/rest"
+	"go-ecommerce-app/internal/repository"
+	"go-ecommerce-app/internal/service"
+	"log"
+	"time"
+)
+
+// startJobs runs the periodic maintenance tasks of the app in the background.
+func startJobs(rh *rest.RestHandler) {
+	privacy := service.PrivacyService{
+		Repo: repository.NewPrivacyRepository(rh.DB),
+		Users: service.UserService{
+			Repo:   repository.NewUserRepository(rh.DB),
+			Auth:   rh.Auth,
+			Config: rh.Config,
+		},
+		Config: rh.Config,
+		Audit:  service.AuditService{Repo: repository.NewAuditRepository(rh.DB)},
+		Blobs:  rh.Blobs,
+	}
+
+	go runPeriodically("account deletion", time.Hour, func() error {
+		purged, err := privacy.PurgeDueAccounts()
+		if purged > 0 {
+			log.Printf("anonymized %d deleted accounts", purged)
+		}
+		return err
+	})
+
+	encryption := service.EncryptionService{Repo: repository.NewEncryptionRepository(rh.DB)}
+
+	go runPeriodically("encryption key rotation", 24*time.Hour, func() error {
+		rotated, err := encryption.RotateKeys()
+		if rotated > 0 {
+			log.Printf("re-encrypted %d stored values", rotated)
+		}
+		return err
+	})
+
+	inventory := service.InventoryService{
+		Repo:   repository.NewInventoryRepository(rh.DB),
+		Alerts: rh.Alerts,
+	}
+
+	go runPeriodically("stock reservation release", time.Minute, func() error {
+		released, err := inventory.ReleaseExpired()
+		if released > 0 {
+			log.Printf("released stock of %d expired checkouts", released)
+		}
+		return err
+	})
+
+	catalog := service.CatalogService{Repo: repository.NewCatalogRepository(rh.DB)}
+
+	go runPeriodically("product schedules", time.Minute, func() error {
+		published, archived, err := catalog.ApplyProductSchedules()
+		if published > 0 || archived > 0 {
+			log.Printf("published %d and archived %d scheduled products", published, archived)
+		}
+		return err
+	})
+
+	imports := service.ProductImportService{Jobs: repository.NewImportRepository(rh.DB)}
+
+	go runPeriodically("stale product imports", 5*time.Minute, func() error {
+		failed, err := imports.FailStaleJobs()
+		if failed > 0 {
+			log.Printf("failed %d interrupted product imports", failed)
+		}
+		return err
+	})
+
+	go runPeriodically("product alerts", time.Minute, func() error {
+		sent, err := rh.Alerts.Flush()
+		if sent > 0 {
+			log.Printf("sent product alerts to %d users", sent)
+		}
+		return err
+	})
+}
+
+func runPeriodically(name string, interval time.Duration, job func() error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := job(); err != nil {
+			log.Printf("%s job failed: %v", name, err)
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"go-ecommerce-app/internal/api/rest"
+	"go-ecommerce-app/internal/dto"
+	"go-ecommerce-app/internal/helper"
+	"go-ecommerce-app/internal/policy"
+	"go-ecommerce-app/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type AlertHandler struct {
+	svc  *service.AlertService
+	auth helper.Auth
+}
+
+func SetupAlertRoutes(rh *rest.RestHandler) {
+	app := rh.App
+
+	handler := AlertHandler{
+		svc:  rh.Alerts,
+		auth: rh.Auth,
+	}
+
+	manageAlerts := policy.Require(policy.CartManage)
+
+	// Private endpoint
+	app.Post("/products/:id/alerts", rh.Auth.Authorize, manageAlerts, handler.Subscribe)
+
+	alertRoutes := app.Group("/users/alerts", rh.Auth.Authorize, manageAlerts)
+	alertRoutes.Get("/", handler.GetAlerts)
+	alertRoutes.Delete("/:id", handler.Unsubscribe)
+}
+
+func (h AlertHandler) Subscribe(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+	req := dto.CreateAlertRequest{}
+
+	if err := ctx.BodyParser(&req); err != nil {
+		return rest.BadRequestResponse(ctx, "alert request is not valid")
+	}
+
+	user := h.auth.GetCurrentUser(ctx)
+
+	alert, err := h.svc.Subscribe(uint(id), user, req)
+	if err != nil {
+		return rest.BadRequestResponse(ctx, err.Error())
+	}
+
+	return rest.SuccessCreated(ctx, "alert created", alert)
+}
+
+func (h AlertHandler) GetAlerts(ctx *fiber.Ctx) error {
+	user := h.auth.GetCurrentUser(ctx)
+
+	alerts, err := h.svc.GetAlerts(user)
+	if err != nil {
+		return rest.InternalError(ctx, err)
+	}
+
+	return rest.SuccessResponse(ctx, "success", alerts)
+}
+
+func (h AlertHandler) Unsubscribe(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+	user := h.auth.GetCurrentUser(ctx)
+
+	if err := h.svc.Unsubscribe(uint(id), user); err != nil {
+		return rest.NotFoundResponse(ctx, err.Error())
+	}
+
+	return rest.NoContentResponse(ctx)
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"go-ecommerce-app/internal/api/rest"
+	"go-ecommerce-app/internal/dto"
+	"go-ecommerce-app/internal/policy"
+	"go-ecommerce-app/internal/repository"
+	"go-ecommerce-app/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ApiKeyHandler struct {
+	svc service.ApiKeyService
+}
+
+func newApiKeyService(rh *rest.RestHandler) service.ApiKeyService {
+	return service.ApiKeyService{
+		Repo:     repository.NewApiKeyRepository(rh.DB),
+		UserRepo: repository.NewUserRepository(rh.DB),
+		Auth:     rh.Auth,
+		Audit:    newAuditService(rh),
+	}
+}
+
+func SetupApiKeyRoutes(rh *rest.RestHandler) {
+	app := rh.App
+
+	handler := ApiKeyHandler{
+		svc: newApiKeyService(rh),
+	}
+
+	// no scope grants api_keys.manage, so keys are managed with a token only
+	keyRoutes := app.Group("/seller/api-keys", rh.Auth.AuthorizePrivileged, policy.Require(policy.ApiKeysManage))
+	keyRoutes.Post("/", handler.CreateApiKey)
+	keyRoutes.Get("/", handler.GetApiKeys)
+	keyRoutes.Delete("/:id", handler.RevokeApiKey)
+}
+
+func (h ApiKeyHandler) CreateApiKey(ctx *fiber.Ctx) error {
+	req := dto.CreateApiKeyRequest{}
+
+	if err := ctx.BodyParser(&req); err != nil {
+		return rest.BadRequestResponse(ctx, "create api key request is not valid")
+	}
+
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	key, plaintext, err := h.svc.CreateApiKey(req, user, rest.RequestMeta(ctx))
+	if err != nil {
+		return rest.BadRequestResponse(ctx, err.Error())
+	}
+
+	return rest.SuccessCreated(ctx, "store the key safely, it will not be shown again", &fiber.Map{
+		"api_key": key,
+		"key":     plaintext,
+	})
+}
+
+func (h ApiKeyHandler) GetApiKeys(ctx *fiber.Ctx) error {
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	keys, err := h.svc.GetApiKeys(user)
+	if err != nil {
+		return rest.InternalError(ctx, err)
+	}
+
+	return rest.SuccessResponse(ctx, "success", keys)
+}
+
+func (h ApiKeyHandler) RevokeApiKey(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	if err := h.svc.RevokeApiKey(uint(id), user, rest.RequestMeta(ctx)); err != nil {
+		return rest.NotFoundResponse(ctx, err.Error())
+	}
+
+	return rest.NoContentResponse(ctx)
+}
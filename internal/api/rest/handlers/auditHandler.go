@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"bufio"
+	"fmt"
+	"go-ecommerce-app/internal/api/rest"
+	"go-ecommerce-app/internal/dto"
+	"go-ecommerce-app/internal/policy"
+	"go-ecommerce-app/internal/repository"
+	"go-ecommerce-app/internal/service"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type AuditHandler struct {
+	svc service.AuditService
+}
+
+func newAuditService(rh *rest.RestHandler) service.AuditService {
+	return service.AuditService{
+		Repo: repository.NewAuditRepository(rh.DB),
+	}
+}
+
+func SetupAuditRoutes(rh *rest.RestHandler) {
+	app := rh.App
+
+	handler := AuditHandler{
+		svc: newAuditService(rh),
+	}
+
+	// Admin endpoint
+	auditRoutes := app.Group("/admin/audit-events", rh.Auth.AuthorizePrivileged, policy.Require(policy.AuditRead))
+	auditRoutes.Get("/", handler.GetEvents)
+	auditRoutes.Get("/export", handler.ExportEvents)
+}
+
+// auditFilter reads the query, from and to accept RFC 3339 timestamps or dates.
+func auditFilter(ctx *fiber.Ctx) (dto.AuditEventFilter, error) {
+	filter := dto.AuditEventFilter{}
+
+	if err := ctx.QueryParser(&filter); err != nil {
+		return filter, err
+	}
+
+	for param, target := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		value := ctx.Query(param)
+		if value == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			if t, err = time.Parse(time.DateOnly, value); err != nil {
+				return filter, fmt.Errorf("%s must be a date or an RFC 3339 timestamp", param)
+			}
+		}
+		*target = t
+	}
+
+	return filter, nil
+}
+
+func (h AuditHandler) GetEvents(ctx *fiber.Ctx) error {
+	filter, err := auditFilter(ctx)
+	if err != nil {
+		return rest.BadRequestResponse(ctx, err.Error())
+	}
+
+	events, total, err := h.svc.FindEvents(filter)
+	if err != nil {
+		return rest.InternalError(ctx, err)
+	}
+
+	return ctx.Status(http.StatusOK).JSON(&fiber.Map{
+		"message": "success",
+		"data":    events,
+		"total":   total,
+	})
+}
+
+func (h AuditHandler) ExportEvents(ctx *fiber.Ctx) error {
+	filter, err := auditFilter(ctx)
+	if err != nil {
+		return rest.BadRequestResponse(ctx, err.Error())
+	}
+
+	ctx.Attachment(fmt.Sprintf("audit-events-%s.csv", time.Now().Format("20060102-150405")))
+	ctx.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+
+	// streamed, an export can cover a long period
+	ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := h.svc.ExportCSV(filter, w); err != nil {
+			log.Printf("audit export failed: %v", err)
+		}
+	})
+
+	return nil
+}
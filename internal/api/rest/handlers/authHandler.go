@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"errors"
+	"go-ecommerce-app/internal/api/rest"
+	"go-ecommerce-app/internal/helper"
+	"go-ecommerce-app/internal/repository"
+	"go-ecommerce-app/internal/service"
+	"go-ecommerce-app/pkg/oidc"
+	"go-ecommerce-app/pkg/ratelimit"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// oidcBindingCookie ties a pending authorization request to the browser that
+// started it.
+const oidcBindingCookie = "oidc_binding"
+
+type AuthHandler struct {
+	auth helper.Auth
+	svc  service.IdentityService
+	// cookies need Secure and SameSite=None to survive the form_post callback
+	secureCookies bool
+}
+
+func SetupAuthRoutes(rh *rest.RestHandler) {
+	app := rh.App
+
+	providers := map[string]*oidc.Provider{}
+	for _, p := range rh.Config.OIDCProviders {
+		providers[p.Name] = oidc.NewProvider(oidc.ProviderConfig{
+			Name:         p.Name,
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  p.RedirectURL,
+			Scopes:       p.Scopes,
+		})
+	}
+
+	svc := service.IdentityService{
+		Repo: repository.NewIdentityRepository(rh.DB),
+		Users: service.UserService{
+			Repo:   repository.NewUserRepository(rh.DB),
+			CRepo:  repository.NewCatalogRepository(rh.DB),
+			Auth:   rh.Auth,
+			Config: rh.Config,
+		},
+		Providers: providers,
+	}
+
+	handler := AuthHandler{
+		auth:          rh.Auth,
+		svc:           svc,
+		secureCookies: strings.HasPrefix(rh.Config.AppBaseURL, "https://"),
+	}
+
+	oidcLimit := rest.RateLimit(rh.Limiter, rest.RateLimitPolicy{
+		Name:  "oidc",
+		Limit: ratelimit.Limit{Requests: 20, Period: time.Minute},
+		Key:   rest.KeyByIP,
+	})
+
+	// Public endpoint
+	app.Get("/.well-known/jwks.json", handler.GetJWKS)
+
+	oidcRoutes := app.Group("/auth/oidc", oidcLimit)
+	oidcRoutes.Get("/:provider/login", handler.OIDCLogin)
+	// form_post is used by providers such as apple
+	oidcRoutes.Get("/:provider/callback", handler.OIDCCallback)
+	oidcRoutes.Post("/:provider/callback", handler.OIDCCallback)
+
+	// Private endpoint
+	identityRoutes := app.Group("/users/identities", rh.Auth.Authorize)
+	identityRoutes.Get("/", handler.GetIdentities)
+	identityRoutes.Post("/:provider/link", handler.LinkIdentity)
+	identityRoutes.Delete("/:id", handler.UnlinkIdentity)
+}
+
+func (h *AuthHandler) GetJWKS(ctx *fiber.Ctx) error {
+	ctx.Set(fiber.HeaderCacheControl, "public, max-age=300")
+
+	return ctx.Status(http.StatusOK).JSON(&fiber.Map{
+		"keys": h.auth.Keys.JWKS(),
+	})
+}
+
+func (h *AuthHandler) OIDCLogin(ctx *fiber.Ctx) error {
+	url, binding, err := h.svc.StartLogin(ctx.Context(), ctx.Params("provider"), 0)
+	if err != nil {
+		if errors.Is(err, service.ErrProviderNotFound) {
+			return rest.NotFoundResponse(ctx, err.Error())
+		}
+		return rest.InternalError(ctx, err)
+	}
+
+	h.setBindingCookie(ctx, binding, time.Now().Add(service.OAuthStateTTL))
+
+	return ctx.Redirect(url, http.StatusFound)
+}
+
+// setBindingCookie stores the binding for the callback, an expired cookie clears it.
+func (h *AuthHandler) setBindingCookie(ctx *fiber.Ctx, binding string, expires time.Time) {
+	sameSite := fiber.CookieSameSiteLaxMode
+	if h.secureCookies {
+		sameSite = fiber.CookieSameSiteNoneMode
+	}
+
+	ctx.Cookie(&fiber.Cookie{
+		Name:     oidcBindingCookie,
+		Value:    binding,
+		Path:     "/auth/oidc",
+		Expires:  expires,
+		HTTPOnly: true,
+		Secure:   h.secureCookies,
+		SameSite: sameSite,
+	})
+}
+
+func (h *AuthHandler) OIDCCallback(ctx *fiber.Ctx) error {
+	code := ctx.FormValue("code")
+	state := ctx.FormValue("state")
+
+	if code == "" || state == "" {
+		return rest.BadRequestResponse(ctx, "authorization code is missing")
+	}
+
+	binding := ctx.Cookies(oidcBindingCookie)
+	h.setBindingCookie(ctx, "", time.Unix(0, 0))
+
+	result, err := h.svc.FinishLogin(ctx.Context(), ctx.Params("provider"), code, state, binding, rest.RequestMeta(ctx))
+	if err != nil {
+		if errors.Is(err, service.ErrProviderNotFound) {
+			return rest.NotFoundResponse(ctx, err.Error())
+		}
+		return ctx.Status(http.StatusUnauthorized).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	return ctx.Status(http.StatusOK).JSON(result)
+}
+
+func (h *AuthHandler) GetIdentities(ctx *fiber.Ctx) error {
+	user := h.auth.GetCurrentUser(ctx)
+
+	identities, err := h.svc.GetIdentities(user.ID)
+	if err != nil {
+		return rest.InternalError(ctx, err)
+	}
+
+	return rest.SuccessResponse(ctx, "success", identities)
+}
+
+func (h *AuthHandler) LinkIdentity(ctx *fiber.Ctx) error {
+	user := h.auth.GetCurrentUser(ctx)
+
+	url, binding, err := h.svc.StartLogin(ctx.Context(), ctx.Params("provider"), user.ID)
+	if err != nil {
+		if errors.Is(err, service.ErrProviderNotFound) {
+			return rest.NotFoundResponse(ctx, err.Error())
+		}
+		return rest.InternalError(ctx, err)
+	}
+
+	// the client must send this request with credentials, so the browser keeps
+	// the cookie for the callback
+	h.setBindingCookie(ctx, binding, time.Now().Add(service.OAuthStateTTL))
+
+	return rest.SuccessResponse(ctx, "continue with the authorization url", &fiber.Map{
+		"authorization_url": url,
+	})
+}
+
+func (h *AuthHandler) UnlinkIdentity(ctx *fiber.Ctx) error {
+	user := h.auth.GetCurrentUser(ctx)
+	id, _ := ctx.ParamsInt("id")
+
+	if err := h.svc.Unlink(uint(id), user.ID); err != nil {
+		return rest.BadRequestResponse(ctx, err.Error())
+	}
+
+	return rest.NoContentResponse(ctx)
+}
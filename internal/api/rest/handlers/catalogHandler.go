@@ -1,11 +1,20 @@
 package handlers
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
 	"go-ecommerce-app/internal/api/rest"
 	"go-ecommerce-app/internal/domain"
 	"go-ecommerce-app/internal/dto"
+	"go-ecommerce-app/internal/policy"
 	"go-ecommerce-app/internal/repository"
 	"go-ecommerce-app/internal/service"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -16,7 +25,8 @@ const (
 )
 
 type CatalogHandler struct {
-	svc service.CatalogService
+	svc     service.CatalogService
+	imports service.ProductImportService
 }
 
 func SetupCatalogRoutes(rh *rest.RestHandler) {
@@ -26,32 +36,64 @@ func SetupCatalogRoutes(rh *rest.RestHandler) {
 		Repo:   repository.NewCatalogRepository(rh.DB),
 		Auth:   rh.Auth,
 		Config: rh.Config,
+		Audit:  newAuditService(rh),
+		Blobs:  rh.Blobs,
+		Alerts: rh.Alerts,
+		// stock changes go through the ledger
+		Inventory: newInventoryService(rh),
 	}
 
 	handler := CatalogHandler{
 		svc: svc,
+		imports: service.ProductImportService{
+			Repo:      svc.Repo,
+			Jobs:      repository.NewImportRepository(rh.DB),
+			Audit:     svc.Audit,
+			Alerts:    rh.Alerts,
+			Inventory: svc.Inventory,
+		},
 	}
 
 	// Public routes
 	app.Get("/products", handler.GetProducts)
+	app.Get("/products/by-slug/:slug", handler.GetProductBySlug)
 	app.Get("/products/:id", handler.GetProduct)
 	app.Get("/categories", handler.GetCategories)
+	app.Get("/categories/by-slug/:slug", handler.GetCategoryBySlug)
 	app.Get("/categories/:id", handler.GetCategoryByID)
+	app.Get("/categories/:id/attributes", handler.GetCategoryAttributes)
 
 	// Private routes
-	selRoutes := app.Group("/seller", rh.Auth.AuthorizeSeller)
+	selRoutes := app.Group("/seller", rh.Auth.AuthorizePrivilegedOrKey(newApiKeyService(rh)))
 	// categories
-	selRoutes.Post("/categories", handler.CreateCategory)
-	selRoutes.Patch("/categories/:id", handler.EditCategory)
-	selRoutes.Delete("/categories/:id", handler.DeleteCategory)
+	manageCategories := policy.Require(policy.CatalogCategoryManage)
+
+	selRoutes.Post("/categories", manageCategories, handler.CreateCategory)
+	selRoutes.Patch("/categories/:id", manageCategories, handler.EditCategory)
+	selRoutes.Delete("/categories/:id", manageCategories, handler.DeleteCategory)
+	// attribute schema of the products of a category
+	selRoutes.Post("/categories/:id/attributes", manageCategories, handler.CreateCategoryAttribute)
+	selRoutes.Put("/categories/:id/attributes/:attributeId", manageCategories, handler.UpdateCategoryAttribute)
+	selRoutes.Delete("/categories/:id/attributes/:attributeId", manageCategories, handler.DeleteCategoryAttribute)
 
 	// products
-	selRoutes.Post("/products", handler.CreateProduct)
-	selRoutes.Get("/products", handler.GetProducts)
-	selRoutes.Get("/products/:id", handler.GetProduct)
-	selRoutes.Patch("/products/:id", handler.UpdateProductStock) // update stock
-	selRoutes.Put("/products/:id", handler.EditProduct)
-	selRoutes.Delete("/products/:id", handler.DeleteProduct)
+	readProducts := policy.Require(policy.CatalogProductRead)
+	manageProducts := policy.Require(policy.CatalogProductManage)
+
+	selRoutes.Post("/products", manageProducts, handler.CreateProduct)
+	selRoutes.Get("/products", readProducts, handler.GetSellerProducts)
+	// bulk import and export, registered before the :id routes
+	selRoutes.Post("/products/import", manageProducts, handler.ImportProducts)
+	selRoutes.Get("/products/import/:jobId", readProducts, handler.GetImportJob)
+	selRoutes.Get("/products/export", readProducts, handler.ExportProducts)
+	selRoutes.Get("/products/:id", readProducts, handler.GetSellerProduct)
+	selRoutes.Patch("/products/:id", manageProducts, handler.UpdateProductStock) // update stock
+	selRoutes.Put("/products/:id", manageProducts, handler.EditProduct)
+	selRoutes.Delete("/products/:id", manageProducts, handler.DeleteProduct)
+	// product images
+	selRoutes.Post("/products/:id/images", manageProducts, handler.AddProductImages)
+	selRoutes.Put("/products/:id/images/order", manageProducts, handler.ReorderProductImages)
+	selRoutes.Delete("/products/:id/images/:imageId", manageProducts, handler.DeleteProductImage)
 }
 
 // Categories
@@ -80,6 +122,20 @@ func (h CatalogHandler) GetCategoryByID(ctx *fiber.Ctx) error {
 	return rest.SuccessResponse(ctx, "success", category)
 }
 
+// GetCategoryBySlug redirects former slugs to the canonical url.
+func (h CatalogHandler) GetCategoryBySlug(ctx *fiber.Ctx) error {
+	category, moved, err := h.svc.GetCategoryBySlug(ctx.Params("slug"))
+	if err != nil {
+		return rest.NotFoundResponse(ctx, err.Error())
+	}
+
+	if moved {
+		return ctx.Redirect(category.CanonicalUrl, http.StatusMovedPermanently)
+	}
+
+	return rest.SuccessResponse(ctx, "success", category)
+}
+
 func (h CatalogHandler) CreateCategory(ctx *fiber.Ctx) error {
 	req := dto.CreateCategoryRequest{}
 
@@ -88,7 +144,7 @@ func (h CatalogHandler) CreateCategory(ctx *fiber.Ctx) error {
 	}
 
 	// create category
-	if err := h.svc.CreateCategory(req); err != nil {
+	if err := h.svc.CreateCategory(req, rest.RequestMeta(ctx)); err != nil {
 		return rest.InternalError(ctx, err)
 	}
 
@@ -104,7 +160,7 @@ func (h CatalogHandler) EditCategory(ctx *fiber.Ctx) error {
 	}
 
 	// update category
-	category, err := h.svc.EditCategory(id, req)
+	category, err := h.svc.EditCategory(id, req, rest.RequestMeta(ctx))
 	if err != nil {
 		switch {
 		case err.Error() == errorNotFound:
@@ -120,13 +176,77 @@ func (h CatalogHandler) EditCategory(ctx *fiber.Ctx) error {
 func (h CatalogHandler) DeleteCategory(ctx *fiber.Ctx) error {
 	id, _ := ctx.ParamsInt("id")
 
-	if err := h.svc.DeleteCategory(id); err != nil {
+	if err := h.svc.DeleteCategory(id, rest.RequestMeta(ctx)); err != nil {
 		return rest.InternalError(ctx, err)
 	}
 
 	return rest.NoContentResponse(ctx)
 }
 
+// Category attributes
+func (h CatalogHandler) GetCategoryAttributes(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+
+	attributes, err := h.svc.GetCategoryAttributes(id)
+	if err != nil {
+		return rest.NotFoundResponse(ctx, err.Error())
+	}
+
+	return rest.SuccessResponse(ctx, "success", attributes)
+}
+
+func (h CatalogHandler) CreateCategoryAttribute(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+	req := dto.CategoryAttributeRequest{}
+
+	if err := ctx.BodyParser(&req); err != nil {
+		return rest.BadRequestResponse(ctx, "attribute request is not valid")
+	}
+
+	attribute, err := h.svc.CreateCategoryAttribute(id, req, rest.RequestMeta(ctx))
+	if err != nil {
+		return rest.BadRequestResponse(ctx, err.Error())
+	}
+
+	return rest.SuccessCreated(ctx, "attribute created", attribute)
+}
+
+func (h CatalogHandler) UpdateCategoryAttribute(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+	attributeID, _ := ctx.ParamsInt("attributeId")
+	req := dto.CategoryAttributeRequest{}
+
+	if err := ctx.BodyParser(&req); err != nil {
+		return rest.BadRequestResponse(ctx, "attribute request is not valid")
+	}
+
+	attribute, err := h.svc.UpdateCategoryAttribute(id, attributeID, req, rest.RequestMeta(ctx))
+	if err != nil {
+		return attributeErrorResponse(ctx, err)
+	}
+
+	return rest.SuccessResponse(ctx, "attribute updated", attribute)
+}
+
+func (h CatalogHandler) DeleteCategoryAttribute(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+	attributeID, _ := ctx.ParamsInt("attributeId")
+
+	if err := h.svc.DeleteCategoryAttribute(id, attributeID, rest.RequestMeta(ctx)); err != nil {
+		return attributeErrorResponse(ctx, err)
+	}
+
+	return rest.NoContentResponse(ctx)
+}
+
+func attributeErrorResponse(ctx *fiber.Ctx, err error) error {
+	if errors.Is(err, service.ErrAttributeNotFound) {
+		return rest.NotFoundResponse(ctx, err.Error())
+	}
+
+	return rest.BadRequestResponse(ctx, err.Error())
+}
+
 // Products
 func (h CatalogHandler) CreateProduct(ctx *fiber.Ctx) error {
 	req := dto.CreateProductRequest{}
@@ -137,7 +257,7 @@ func (h CatalogHandler) CreateProduct(ctx *fiber.Ctx) error {
 
 	user := h.svc.Auth.GetCurrentUser(ctx)
 
-	if err := h.svc.CreateProduct(req, user); err != nil {
+	if err := h.svc.CreateProduct(req, user, rest.RequestMeta(ctx)); err != nil {
 		return rest.InternalError(ctx, err)
 	}
 
@@ -149,14 +269,69 @@ func (h CatalogHandler) GetProduct(ctx *fiber.Ctx) error {
 
 	product, err := h.svc.GetProductByID(id)
 	if err != nil {
-		return rest.InternalError(ctx, err)
+		return rest.NotFoundResponse(ctx, err.Error())
+	}
+
+	return rest.SuccessResponse(ctx, "success", product)
+}
+
+// GetProductBySlug redirects former slugs to the canonical url.
+func (h CatalogHandler) GetProductBySlug(ctx *fiber.Ctx) error {
+	product, moved, err := h.svc.GetProductBySlug(ctx.Params("slug"))
+	if err != nil {
+		return rest.NotFoundResponse(ctx, err.Error())
+	}
+
+	if moved {
+		return ctx.Redirect(product.CanonicalUrl, http.StatusMovedPermanently)
+	}
+
+	return rest.SuccessResponse(ctx, "success", product)
+}
+
+func (h CatalogHandler) GetSellerProduct(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	product, err := h.svc.GetSellerProduct(id, user)
+	if err != nil {
+		return rest.NotFoundResponse(ctx, err.Error())
 	}
 
 	return rest.SuccessResponse(ctx, "success", product)
 }
 
+// GetProducts takes the sort and category_id parameters, attributes of the
+// category are filtered with attr.<key>=a,b or attr.<key>.min and .max.
 func (h CatalogHandler) GetProducts(ctx *fiber.Ctx) error {
-	products, err := h.svc.GetProducts()
+	query := dto.ProductQuery{
+		Sort:       ctx.Query("sort"),
+		CategoryID: uint(ctx.QueryInt("category_id")),
+		Attributes: map[string]string{},
+	}
+
+	for param, value := range ctx.Queries() {
+		if key, ok := strings.CutPrefix(param, "attr."); ok {
+			query.Attributes[key] = value
+		}
+	}
+
+	products, facets, err := h.svc.GetProducts(query)
+	if err != nil {
+		return rest.BadRequestResponse(ctx, err.Error())
+	}
+
+	return ctx.Status(http.StatusOK).JSON(&fiber.Map{
+		"message": "success",
+		"data":    products,
+		"facets":  facets,
+	})
+}
+
+func (h CatalogHandler) GetSellerProducts(ctx *fiber.Ctx) error {
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	products, err := h.svc.GetSellerProducts(int(user.ID))
 	if err != nil {
 		return rest.InternalError(ctx, err)
 	}
@@ -174,7 +349,7 @@ func (h CatalogHandler) EditProduct(ctx *fiber.Ctx) error {
 
 	user := h.svc.Auth.GetCurrentUser(ctx)
 
-	updated, err := h.svc.EditProduct(id, req, user)
+	updated, err := h.svc.EditProduct(id, req, user, rest.RequestMeta(ctx))
 	if err != nil {
 		return rest.InternalError(ctx, err)
 	}
@@ -190,15 +365,18 @@ func (h CatalogHandler) UpdateProductStock(ctx *fiber.Ctx) error {
 		return rest.BadRequestResponse(ctx, "update stock request is not valid")
 	}
 
+	if req.Stock < 0 {
+		return rest.BadRequestResponse(ctx, "stock must not be negative")
+	}
+
 	user := h.svc.Auth.GetCurrentUser(ctx)
 
 	product := domain.Product{
-		ID:     uint(id),
-		Stock:  uint(req.Stock),
-		UserID: user.ID,
+		ID:    uint(id),
+		Stock: uint(req.Stock),
 	}
 
-	updated, err := h.svc.UpdateProductStock(product)
+	updated, err := h.svc.UpdateProductStock(product, user, rest.RequestMeta(ctx))
 	if err != nil {
 		return rest.InternalError(ctx, err)
 	}
@@ -210,9 +388,149 @@ func (h CatalogHandler) DeleteProduct(ctx *fiber.Ctx) error {
 	id, _ := ctx.ParamsInt("id")
 	user := h.svc.Auth.GetCurrentUser(ctx)
 
-	if err := h.svc.DeleteProduct(id, user); err != nil {
+	if err := h.svc.DeleteProduct(id, user, rest.RequestMeta(ctx)); err != nil {
 		return rest.InternalError(ctx, err)
 	}
 
 	return rest.NoContentResponse(ctx)
 }
+
+// Product images
+func (h CatalogHandler) AddProductImages(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+
+	form, err := ctx.MultipartForm()
+	if err != nil {
+		return rest.BadRequestResponse(ctx, "please upload the images as multipart form data")
+	}
+
+	// several files under "images", a single one may use "image"
+	files := append(form.File["images"], form.File["image"]...)
+
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	images, err := h.svc.AddProductImages(id, files, user, rest.RequestMeta(ctx))
+	if err != nil {
+		return rest.BadRequestResponse(ctx, err.Error())
+	}
+
+	return rest.SuccessCreated(ctx, "images uploaded", images)
+}
+
+func (h CatalogHandler) ReorderProductImages(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+	req := dto.ReorderImagesRequest{}
+
+	if err := ctx.BodyParser(&req); err != nil {
+		return rest.BadRequestResponse(ctx, "reorder images request is not valid")
+	}
+
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	images, err := h.svc.ReorderProductImages(id, req, user, rest.RequestMeta(ctx))
+	if err != nil {
+		return rest.BadRequestResponse(ctx, err.Error())
+	}
+
+	return rest.SuccessResponse(ctx, "success", images)
+}
+
+func (h CatalogHandler) DeleteProductImage(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+	imageID, _ := ctx.ParamsInt("imageId")
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	if err := h.svc.DeleteProductImage(id, imageID, user, rest.RequestMeta(ctx)); err != nil {
+		return rest.BadRequestResponse(ctx, err.Error())
+	}
+
+	return rest.NoContentResponse(ctx)
+}
+
+// Bulk import and export
+
+// importFormat takes the format query parameter, or the extension of the file name.
+func importFormat(ctx *fiber.Ctx, fileName string) string {
+	format := strings.ToLower(ctx.Query("format"))
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(fileName)), ".")
+	}
+
+	if format == "ndjson" || format == "jsonlines" {
+		format = service.ImportFormatJSONL
+	}
+
+	return format
+}
+
+func (h CatalogHandler) ImportProducts(ctx *fiber.Ctx) error {
+	file, err := ctx.FormFile("file")
+	if err != nil {
+		return rest.BadRequestResponse(ctx, "please upload the file as multipart form data")
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return rest.InternalError(ctx, err)
+	}
+	defer src.Close()
+
+	user := h.svc.Auth.GetCurrentUser(ctx)
+	dryRun := ctx.QueryBool("dry_run")
+
+	job, err := h.imports.Import(user, importFormat(ctx, file.Filename), dryRun, src, rest.RequestMeta(ctx))
+	if err != nil {
+		return rest.BadRequestResponse(ctx, err.Error())
+	}
+
+	if job.Status != domain.ImportCompleted {
+		return ctx.Status(http.StatusAccepted).JSON(&fiber.Map{
+			"message": "import started",
+			"data":    job,
+		})
+	}
+
+	return rest.SuccessResponse(ctx, "import finished", job)
+}
+
+func (h CatalogHandler) GetImportJob(ctx *fiber.Ctx) error {
+	jobID, _ := ctx.ParamsInt("jobId")
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	job, err := h.imports.GetJob(uint(jobID), user.ID)
+	if err != nil {
+		return rest.NotFoundResponse(ctx, err.Error())
+	}
+
+	return rest.SuccessResponse(ctx, "success", job)
+}
+
+func (h CatalogHandler) ExportProducts(ctx *fiber.Ctx) error {
+	format := importFormat(ctx, "")
+	if format == "" {
+		format = service.ImportFormatCSV
+	}
+
+	contentType := "text/csv; charset=utf-8"
+	switch format {
+	case service.ImportFormatCSV:
+	case service.ImportFormatJSONL:
+		contentType = "application/x-ndjson"
+	default:
+		return rest.BadRequestResponse(ctx, "format must be csv or jsonl")
+	}
+
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	ctx.Attachment(fmt.Sprintf("products-%s.%s", time.Now().Format("20060102-150405"), format))
+	ctx.Set(fiber.HeaderContentType, contentType)
+
+	// streamed, a catalog can be large
+	ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := h.imports.Export(user.ID, format, w); err != nil {
+			log.Printf("product export of user %d failed: %v", user.ID, err)
+		}
+	})
+
+	return nil
+}
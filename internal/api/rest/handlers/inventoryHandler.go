@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"go-ecommerce-app/internal/api/rest"
+	"go-ecommerce-app/internal/dto"
+	"go-ecommerce-app/internal/helper"
+	"go-ecommerce-app/internal/policy"
+	"go-ecommerce-app/internal/repository"
+	"go-ecommerce-app/internal/service"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type InventoryHandler struct {
+	svc  service.InventoryService
+	auth helper.Auth
+}
+
+func newInventoryService(rh *rest.RestHandler) service.InventoryService {
+	return service.InventoryService{
+		Repo:        repository.NewInventoryRepository(rh.DB),
+		Catalog:     repository.NewCatalogRepository(rh.DB),
+		Warehouses:  repository.NewWarehouseRepository(rh.DB),
+		Audit:       newAuditService(rh),
+		Alerts:      rh.Alerts,
+		Fulfillment: rh.Config.FulfillmentPolicy,
+	}
+}
+
+func SetupInventoryRoutes(rh *rest.RestHandler) {
+	app := rh.App
+
+	handler := InventoryHandler{
+		svc:  newInventoryService(rh),
+		auth: rh.Auth,
+	}
+
+	// Seller endpoint
+	selRoutes := app.Group("/seller", rh.Auth.AuthorizePrivilegedOrKey(newApiKeyService(rh)))
+	selRoutes.Post("/products/:id/inventory", policy.Require(policy.CatalogProductManage), handler.RecordMovement)
+	selRoutes.Get("/products/:id/stock-history", policy.Require(policy.CatalogProductRead), handler.GetStockHistory)
+}
+
+func (h InventoryHandler) RecordMovement(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+	req := dto.StockMovementRequest{}
+
+	if err := ctx.BodyParser(&req); err != nil {
+		return rest.BadRequestResponse(ctx, "stock movement request is not valid")
+	}
+
+	user := h.auth.GetCurrentUser(ctx)
+
+	level, err := h.svc.RecordMovement(id, user, req, rest.RequestMeta(ctx))
+	if err != nil {
+		return rest.BadRequestResponse(ctx, err.Error())
+	}
+
+	return rest.SuccessCreated(ctx, "stock updated", level)
+}
+
+func (h InventoryHandler) GetStockHistory(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+
+	filter := dto.StockHistoryFilter{}
+	if err := ctx.QueryParser(&filter); err != nil {
+		return rest.BadRequestResponse(ctx, "")
+	}
+
+	user := h.auth.GetCurrentUser(ctx)
+
+	history, err := h.svc.GetStockHistory(id, user, filter)
+	if err != nil {
+		return rest.BadRequestResponse(ctx, err.Error())
+	}
+
+	return ctx.Status(http.StatusOK).JSON(&fiber.Map{
+		"message":   "success",
+		"stock":     history.Stock,
+		"locations": history.Locations,
+		"data":      history.Movements,
+		"total":     history.Total,
+	})
+}
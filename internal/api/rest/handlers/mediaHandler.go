@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"errors"
+	"go-ecommerce-app/internal/api/rest"
+	"go-ecommerce-app/pkg/blobstore"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// publicMediaPrefixes are the blob key prefixes served without authentication,
+// other uploads such as seller documents stay private.
+var publicMediaPrefixes = []string{"products/", "reviews/"}
+
+type MediaHandler struct {
+	blobs blobstore.BlobStore
+}
+
+func SetupMediaRoutes(rh *rest.RestHandler) {
+	app := rh.App
+
+	handler := MediaHandler{
+		blobs: rh.Blobs,
+	}
+
+	// Public endpoint
+	app.Get("/media/*", handler.GetMedia)
+}
+
+func (h MediaHandler) GetMedia(ctx *fiber.Ctx) error {
+	key, err := blobstore.CleanKey(ctx.Params("*"))
+	if err != nil || !isPublicMedia(key) {
+		return rest.NotFoundResponse(ctx, "file not found")
+	}
+
+	reader, info, err := h.blobs.Get(ctx.Context(), key)
+	if errors.Is(err, blobstore.ErrNotFound) {
+		return rest.NotFoundResponse(ctx, "file not found")
+	}
+	if err != nil {
+		return rest.InternalError(ctx, err)
+	}
+
+	ctx.Set(fiber.HeaderContentType, info.ContentType)
+	// keys contain a random segment, a changed image gets a new url
+	ctx.Set(fiber.HeaderCacheControl, "public, max-age=31536000, immutable")
+	ctx.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+
+	return ctx.SendStream(reader, int(info.Size))
+}
+
+func isPublicMedia(key string) bool {
+	for _, prefix := range publicMediaPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"go-ecommerce-app/internal/api/rest"
+	"go-ecommerce-app/internal/dto"
+	"go-ecommerce-app/internal/policy"
+	"go-ecommerce-app/internal/repository"
+	"go-ecommerce-app/internal/service"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type PrivacyHandler struct {
+	svc service.PrivacyService
+}
+
+func newPrivacyService(rh *rest.RestHandler) service.PrivacyService {
+	return service.PrivacyService{
+		Repo: repository.NewPrivacyRepository(rh.DB),
+		Users: service.UserService{
+			Repo:   repository.NewUserRepository(rh.DB),
+			CRepo:  repository.NewCatalogRepository(rh.DB),
+			Auth:   rh.Auth,
+			Config: rh.Config,
+			Audit:  newAuditService(rh),
+		},
+		Config: rh.Config,
+		Audit:  newAuditService(rh),
+		Blobs:  rh.Blobs,
+	}
+}
+
+func SetupPrivacyRoutes(rh *rest.RestHandler) {
+	app := rh.App
+
+	handler := PrivacyHandler{
+		svc: newPrivacyService(rh),
+	}
+
+	// Private endpoint
+	meRoutes := app.Group("/users/me", rh.Auth.Authorize)
+	meRoutes.Get("/export", handler.ExportData)
+	meRoutes.Delete("/", handler.DeleteAccount)
+	meRoutes.Post("/restore", handler.CancelDeletion)
+
+	// Admin endpoint
+	adminRoutes := app.Group("/admin/users", rh.Auth.AuthorizePrivileged, policy.Require(policy.UsersManage))
+	adminRoutes.Delete("/:id", handler.AdminDeleteUser)
+	adminRoutes.Post("/:id/restore", handler.AdminCancelDeletion)
+}
+
+// ExportData returns a zip archive by default, ?format=json returns a single document.
+func (h *PrivacyHandler) ExportData(ctx *fiber.Ctx) error {
+	user := h.svc.Users.Auth.GetCurrentUser(ctx)
+	stamp := time.Now().Format("20060102")
+
+	if ctx.Query("format") == "json" {
+		export, err := h.svc.ExportData(user.ID)
+		if err != nil {
+			return rest.InternalError(ctx, err)
+		}
+
+		ctx.Attachment(fmt.Sprintf("account-export-%s.json", stamp))
+		return ctx.Status(http.StatusOK).JSON(export)
+	}
+
+	archive, err := h.svc.ExportArchive(user.ID)
+	if err != nil {
+		return rest.InternalError(ctx, err)
+	}
+
+	ctx.Attachment(fmt.Sprintf("account-export-%s.zip", stamp))
+	return ctx.Status(http.StatusOK).Send(archive)
+}
+
+func (h *PrivacyHandler) DeleteAccount(ctx *fiber.Ctx) error {
+	user := h.svc.Users.Auth.GetCurrentUser(ctx)
+
+	input := dto.DeleteAccountInput{}
+	if err := ctx.BodyParser(&input); err != nil {
+		return rest.BadRequestResponse(ctx, "")
+	}
+
+	dueAt, err := h.svc.RequestDeletion(user.ID, input, rest.RequestMeta(ctx))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCredentials) || errors.Is(err, service.ErrInvalidTwoFactor) {
+			return ctx.Status(http.StatusUnauthorized).JSON(&fiber.Map{
+				"message": err.Error(),
+			})
+		}
+		return rest.BadRequestResponse(ctx, err.Error())
+	}
+
+	return deletionResponse(ctx, dueAt)
+}
+
+func (h *PrivacyHandler) CancelDeletion(ctx *fiber.Ctx) error {
+	user := h.svc.Users.Auth.GetCurrentUser(ctx)
+
+	if err := h.svc.CancelDeletion(user.ID, rest.RequestMeta(ctx)); err != nil {
+		return rest.BadRequestResponse(ctx, err.Error())
+	}
+
+	return rest.SuccessResponse(ctx, "account deletion cancelled", nil)
+}
+
+func (h *PrivacyHandler) AdminDeleteUser(ctx *fiber.Ctx) error {
+	id, err := strconv.Atoi(ctx.Params("id"))
+	if err != nil {
+		return rest.BadRequestResponse(ctx, "please provide a valid user id")
+	}
+
+	input := dto.AdminDeleteUserInput{}
+	if len(ctx.Body()) > 0 {
+		if err = ctx.BodyParser(&input); err != nil {
+			return rest.BadRequestResponse(ctx, "")
+		}
+	}
+
+	dueAt, err := h.svc.AdminDeleteUser(uint(id), input, rest.RequestMeta(ctx))
+	if err != nil {
+		return rest.BadRequestResponse(ctx, err.Error())
+	}
+
+	return deletionResponse(ctx, dueAt)
+}
+
+func (h *PrivacyHandler) AdminCancelDeletion(ctx *fiber.Ctx) error {
+	id, err := strconv.Atoi(ctx.Params("id"))
+	if err != nil {
+		return rest.BadRequestResponse(ctx, "please provide a valid user id")
+	}
+
+	if err = h.svc.CancelDeletion(uint(id), rest.RequestMeta(ctx)); err != nil {
+		return rest.BadRequestResponse(ctx, err.Error())
+	}
+
+	return rest.SuccessResponse(ctx, "account deletion cancelled", nil)
+}
+
+func deletionResponse(ctx *fiber.Ctx, dueAt *time.Time) error {
+	if dueAt == nil {
+		return rest.SuccessResponse(ctx, "account deleted", nil)
+	}
+
+	return ctx.Status(http.StatusAccepted).JSON(&fiber.Map{
+		"message":         "account scheduled for deletion",
+		"deletion_due_at": dueAt,
+	})
+}
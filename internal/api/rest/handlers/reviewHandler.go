@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"errors"
+	"go-ecommerce-app/internal/api/rest"
+	"go-ecommerce-app/internal/dto"
+	"go-ecommerce-app/internal/policy"
+	"go-ecommerce-app/internal/repository"
+	"go-ecommerce-app/internal/service"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ReviewHandler struct {
+	svc service.ReviewService
+}
+
+func SetupReviewRoutes(rh *rest.RestHandler) {
+	app := rh.App
+
+	svc := service.ReviewService{
+		Repo:    repository.NewReviewRepository(rh.DB),
+		Catalog: repository.NewCatalogRepository(rh.DB),
+		Auth:    rh.Auth,
+		Blobs:   rh.Blobs,
+		Config:  rh.Config,
+		Audit:   newAuditService(rh),
+	}
+
+	handler := ReviewHandler{
+		svc: svc,
+	}
+
+	writeReviews := policy.Require(policy.ReviewsWrite)
+
+	// Public endpoint
+	app.Get("/products/:id/reviews", handler.GetProductReviews)
+
+	// Private endpoint
+	app.Post("/products/:id/reviews", rh.Auth.Authorize, writeReviews, handler.CreateReview)
+
+	reviewRoutes := app.Group("/reviews", rh.Auth.Authorize, writeReviews)
+	reviewRoutes.Post("/:id/images", handler.AddReviewImages)
+	reviewRoutes.Delete("/:id", handler.DeleteReview)
+	reviewRoutes.Put("/:id/helpful", handler.MarkHelpful)
+	reviewRoutes.Delete("/:id/helpful", handler.UnmarkHelpful)
+
+	// Seller endpoint
+	sellerRoutes := app.Group("/seller", rh.Auth.AuthorizePrivilegedOrKey(newApiKeyService(rh)))
+	sellerRoutes.Post("/reviews/:id/response", policy.Require(policy.CatalogProductManage), handler.Respond)
+
+	// Admin endpoint
+	moderationRoutes := app.Group("/admin/reviews", rh.Auth.AuthorizePrivileged, policy.Require(policy.ReviewsModerate))
+	moderationRoutes.Get("/", handler.GetModerationQueue)
+	moderationRoutes.Post("/:id/approve", handler.Approve)
+	moderationRoutes.Post("/:id/reject", handler.Reject)
+	moderationRoutes.Delete("/:id", handler.DeleteReview)
+}
+
+func reviewErrorResponse(ctx *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrReviewNotFound):
+		return rest.NotFoundResponse(ctx, err.Error())
+	case errors.Is(err, service.ErrReviewNotAllowed):
+		return ctx.Status(http.StatusForbidden).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	case errors.Is(err, service.ErrReviewState):
+		return ctx.Status(http.StatusConflict).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	default:
+		return rest.BadRequestResponse(ctx, err.Error())
+	}
+}
+
+func reviewFilter(ctx *fiber.Ctx) (dto.ReviewFilter, error) {
+	filter := dto.ReviewFilter{}
+	err := ctx.QueryParser(&filter)
+	return filter, err
+}
+
+func (h ReviewHandler) GetProductReviews(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+
+	filter, err := reviewFilter(ctx)
+	if err != nil {
+		return rest.BadRequestResponse(ctx, "")
+	}
+
+	reviews, total, err := h.svc.GetProductReviews(uint(id), filter)
+	if err != nil {
+		return rest.InternalError(ctx, err)
+	}
+
+	return ctx.Status(http.StatusOK).JSON(&fiber.Map{
+		"message": "success",
+		"data":    reviews,
+		"total":   total,
+	})
+}
+
+func (h ReviewHandler) CreateReview(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+	req := dto.CreateReviewRequest{}
+
+	if err := ctx.BodyParser(&req); err != nil {
+		return rest.BadRequestResponse(ctx, "review request is not valid")
+	}
+
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	review, err := h.svc.CreateReview(uint(id), user, req)
+	if err != nil {
+		return reviewErrorResponse(ctx, err)
+	}
+
+	return rest.SuccessCreated(ctx, "review submitted for moderation", review)
+}
+
+func (h ReviewHandler) AddReviewImages(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+
+	form, err := ctx.MultipartForm()
+	if err != nil {
+		return rest.BadRequestResponse(ctx, "please upload the images as multipart form data")
+	}
+
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	review, err := h.svc.AddReviewImages(uint(id), user, append(form.File["images"], form.File["image"]...))
+	if err != nil {
+		return reviewErrorResponse(ctx, err)
+	}
+
+	return rest.SuccessResponse(ctx, "images uploaded, the review is back in moderation", review)
+}
+
+func (h ReviewHandler) DeleteReview(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	if err := h.svc.DeleteReview(uint(id), user); err != nil {
+		return reviewErrorResponse(ctx, err)
+	}
+
+	return rest.NoContentResponse(ctx)
+}
+
+func (h ReviewHandler) MarkHelpful(ctx *fiber.Ctx) error {
+	return h.vote(ctx, true)
+}
+
+func (h ReviewHandler) UnmarkHelpful(ctx *fiber.Ctx) error {
+	return h.vote(ctx, false)
+}
+
+func (h ReviewHandler) vote(ctx *fiber.Ctx, helpful bool) error {
+	id, _ := ctx.ParamsInt("id")
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	review, err := h.svc.Vote(uint(id), user, helpful)
+	if err != nil {
+		return reviewErrorResponse(ctx, err)
+	}
+
+	return rest.SuccessResponse(ctx, "success", review)
+}
+
+func (h ReviewHandler) Respond(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+	req := dto.ReviewResponseRequest{}
+
+	if err := ctx.BodyParser(&req); err != nil {
+		return rest.BadRequestResponse(ctx, "response request is not valid")
+	}
+
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	review, err := h.svc.Respond(uint(id), user, req)
+	if err != nil {
+		return reviewErrorResponse(ctx, err)
+	}
+
+	return rest.SuccessResponse(ctx, "success", review)
+}
+
+// Moderation
+func (h ReviewHandler) GetModerationQueue(ctx *fiber.Ctx) error {
+	filter, err := reviewFilter(ctx)
+	if err != nil {
+		return rest.BadRequestResponse(ctx, "")
+	}
+
+	reviews, total, err := h.svc.GetModerationQueue(filter)
+	if err != nil {
+		return rest.InternalError(ctx, err)
+	}
+
+	return ctx.Status(http.StatusOK).JSON(&fiber.Map{
+		"message": "success",
+		"data":    reviews,
+		"total":   total,
+	})
+}
+
+func (h ReviewHandler) Approve(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+	moderator := h.svc.Auth.GetCurrentUser(ctx)
+
+	review, err := h.svc.Approve(uint(id), moderator, rest.RequestMeta(ctx))
+	if err != nil {
+		return reviewErrorResponse(ctx, err)
+	}
+
+	return rest.SuccessResponse(ctx, "review approved", review)
+}
+
+func (h ReviewHandler) Reject(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+	req := dto.RejectReviewRequest{}
+
+	if err := ctx.BodyParser(&req); err != nil {
+		return rest.BadRequestResponse(ctx, "reject request is not valid")
+	}
+
+	moderator := h.svc.Auth.GetCurrentUser(ctx)
+
+	review, err := h.svc.Reject(uint(id), moderator, req, rest.RequestMeta(ctx))
+	if err != nil {
+		return reviewErrorResponse(ctx, err)
+	}
+
+	return rest.SuccessResponse(ctx, "review rejected", review)
+}
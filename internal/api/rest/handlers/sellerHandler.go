@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"errors"
+	"go-ecommerce-app/internal/api/rest"
+	"go-ecommerce-app/internal/dto"
+	"go-ecommerce-app/internal/policy"
+	"go-ecommerce-app/internal/repository"
+	"go-ecommerce-app/internal/service"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type SellerHandler struct {
+	svc service.SellerService
+}
+
+func SetupSellerRoutes(rh *rest.RestHandler) {
+	app := rh.App
+
+	svc := service.SellerService{
+		Repo:   repository.NewSellerRepository(rh.DB),
+		Users:  repository.NewUserRepository(rh.DB),
+		Auth:   rh.Auth,
+		Config: rh.Config,
+		Audit:  newAuditService(rh),
+		Blobs:  rh.Blobs,
+	}
+
+	handler := SellerHandler{
+		svc: svc,
+	}
+
+	// Private endpoint
+	applyRoutes := app.Group("/users/seller-application", rh.Auth.Authorize, policy.Require(policy.SellerApply))
+	applyRoutes.Post("/", handler.Apply)
+	applyRoutes.Get("/", handler.GetApplication)
+	applyRoutes.Post("/documents", handler.UploadDocument)
+	// the former instant upgrade answered with a seller token, which an
+	// application can't give, so its clients get a clear error instead
+	app.Post("/users/become-seller", rh.Auth.Authorize, policy.Require(policy.SellerApply), handler.BecomeSeller)
+
+	// Admin endpoint
+	reviewRoutes := app.Group("/admin/seller-applications", rh.Auth.AuthorizePrivileged, policy.Require(policy.SellersReview))
+	reviewRoutes.Get("/", handler.GetApplications)
+	reviewRoutes.Get("/:id", handler.GetApplicationByID)
+	reviewRoutes.Get("/:id/documents/:docId", handler.GetDocument)
+	reviewRoutes.Post("/:id/review", handler.StartReview)
+	reviewRoutes.Post("/:id/approve", handler.Approve)
+	reviewRoutes.Post("/:id/reject", handler.Reject)
+}
+
+func applicationErrorResponse(ctx *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrApplicationNotFound):
+		return rest.NotFoundResponse(ctx, err.Error())
+	case errors.Is(err, service.ErrApplicationState), errors.Is(err, repository.ErrPendingApplication),
+		errors.Is(err, repository.ErrApplicantNotBuyer):
+		return ctx.Status(http.StatusConflict).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	default:
+		return rest.BadRequestResponse(ctx, err.Error())
+	}
+}
+
+func (h SellerHandler) Apply(ctx *fiber.Ctx) error {
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	req := dto.SellerApplicationInput{}
+	if err := ctx.BodyParser(&req); err != nil {
+		return rest.BadRequestResponse(ctx, "")
+	}
+
+	application, err := h.svc.Apply(user.ID, req, rest.RequestMeta(ctx))
+	if err != nil {
+		return applicationErrorResponse(ctx, err)
+	}
+
+	return rest.SuccessCreated(ctx, "seller application submitted", application)
+}
+
+// BecomeSeller answers 410 Gone, sellers apply through POST /users/seller-application.
+func (h SellerHandler) BecomeSeller(ctx *fiber.Ctx) error {
+	ctx.Set(fiber.HeaderLink, "</users/seller-application>; rel=\"successor-version\"")
+
+	return ctx.Status(http.StatusGone).JSON(&fiber.Map{
+		"message": "sellers are approved through an application, please submit it to /users/seller-application",
+	})
+}
+
+func (h SellerHandler) GetApplication(ctx *fiber.Ctx) error {
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	application, err := h.svc.GetApplication(user.ID)
+	if err != nil {
+		return applicationErrorResponse(ctx, err)
+	}
+
+	return rest.SuccessResponse(ctx, "success", application)
+}
+
+func (h SellerHandler) UploadDocument(ctx *fiber.Ctx) error {
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	file, err := ctx.FormFile("file")
+	if err != nil {
+		return rest.BadRequestResponse(ctx, "please attach the document as file")
+	}
+
+	document, err := h.svc.UploadDocument(user.ID, ctx.FormValue("type"), file)
+	if err != nil {
+		return applicationErrorResponse(ctx, err)
+	}
+
+	return rest.SuccessCreated(ctx, "document uploaded", document)
+}
+
+func (h SellerHandler) GetApplications(ctx *fiber.Ctx) error {
+	applications, total, err := h.svc.GetApplications(ctx.Query("status"), ctx.QueryInt("page", 1), ctx.QueryInt("limit"))
+	if err != nil {
+		return rest.InternalError(ctx, err)
+	}
+
+	return ctx.Status(http.StatusOK).JSON(&fiber.Map{
+		"message": "success",
+		"data":    applications,
+		"total":   total,
+	})
+}
+
+func (h SellerHandler) GetApplicationByID(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+
+	application, err := h.svc.GetApplicationByID(uint(id))
+	if err != nil {
+		return applicationErrorResponse(ctx, err)
+	}
+
+	return rest.SuccessResponse(ctx, "success", application)
+}
+
+func (h SellerHandler) GetDocument(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+	docID, _ := ctx.ParamsInt("docId")
+
+	document, reader, err := h.svc.GetDocument(uint(id), uint(docID))
+	if err != nil {
+		return rest.NotFoundResponse(ctx, err.Error())
+	}
+
+	ctx.Attachment(document.FileName)
+	ctx.Set(fiber.HeaderContentType, document.ContentType)
+	ctx.Set(fiber.HeaderCacheControl, "no-store")
+
+	return ctx.SendStream(reader, int(document.Size))
+}
+
+func (h SellerHandler) StartReview(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+	reviewer := h.svc.Auth.GetCurrentUser(ctx)
+
+	application, err := h.svc.StartReview(uint(id), reviewer, rest.RequestMeta(ctx))
+	if err != nil {
+		return applicationErrorResponse(ctx, err)
+	}
+
+	return rest.SuccessResponse(ctx, "seller application under review", application)
+}
+
+func (h SellerHandler) Approve(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+	reviewer := h.svc.Auth.GetCurrentUser(ctx)
+
+	application, err := h.svc.Approve(uint(id), reviewer, rest.RequestMeta(ctx))
+	if err != nil {
+		return applicationErrorResponse(ctx, err)
+	}
+
+	return rest.SuccessResponse(ctx, "seller application approved", application)
+}
+
+func (h SellerHandler) Reject(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+	reviewer := h.svc.Auth.GetCurrentUser(ctx)
+
+	req := dto.RejectApplicationInput{}
+	if err := ctx.BodyParser(&req); err != nil {
+		return rest.BadRequestResponse(ctx, "")
+	}
+
+	application, err := h.svc.Reject(uint(id), req, reviewer, rest.RequestMeta(ctx))
+	if err != nil {
+		return applicationErrorResponse(ctx, err)
+	}
+
+	return rest.SuccessResponse(ctx, "seller application rejected", application)
+}
@@ -3,13 +3,18 @@ package handlers
 import (
 	"errors"
 	"go-ecommerce-app/internal/api/rest"
+	"go-ecommerce-app/internal/dto"
 	"go-ecommerce-app/internal/helper"
+	"go-ecommerce-app/internal/policy"
 	"go-ecommerce-app/internal/repository"
 	"go-ecommerce-app/internal/service"
 	"go-ecommerce-app/pkg/payment"
+	"go-ecommerce-app/pkg/ratelimit"
+	"log"
+	"net/http"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"gorm.io/gorm"
 )
 
 type TransactionHandler struct {
@@ -18,16 +23,18 @@ type TransactionHandler struct {
 	paymentClient payment.PaymentClient
 }
 
-func initTransactionService(db *gorm.DB, auth helper.Auth) service.TransactionService {
+func initTransactionService(rh *rest.RestHandler) service.TransactionService {
 	return service.TransactionService{
-		Repo: repository.NewTransactionRepository(db),
-		Auth: auth,
+		Repo:      repository.NewTransactionRepository(rh.DB),
+		Auth:      rh.Auth,
+		Audit:     newAuditService(rh),
+		Inventory: newInventoryService(rh),
 	}
 }
 
 func SetupTransactionRoutes(as *rest.RestHandler) {
 	app := as.App
-	svc := initTransactionService(as.DB, as.Auth)
+	svc := initTransactionService(as)
 	userSvc := service.UserService{
 		Repo:   repository.NewUserRepository(as.DB),
 		CRepo:  repository.NewCatalogRepository(as.DB),
@@ -41,12 +48,26 @@ func SetupTransactionRoutes(as *rest.RestHandler) {
 		paymentClient: as.PC,
 	}
 
-	secRoutes := app.Group("/", as.Auth.Authorize)
-	secRoutes.Get("/payment", handler.MakePayment)
+	paymentLimit := rest.RateLimit(as.Limiter, rest.RateLimitPolicy{
+		Name:  "payment",
+		Limit: ratelimit.Limit{Requests: 10, Period: time.Minute},
+		Key:   rest.KeyByUser(as.Auth),
+	})
+
+	secRoutes := app.Group("/payment", as.Auth.Authorize, paymentLimit)
+	secRoutes.Get("/", policy.Require(policy.PaymentsCreate), handler.MakePayment)
+
+	readOrders := policy.Require(policy.OrdersRead)
+
+	sellerRoutes := app.Group("/seller", as.Auth.AuthorizePrivilegedOrKey(newApiKeyService(as)))
+	sellerRoutes.Get("/orders", readOrders, handler.GetOrders)
+	sellerRoutes.Get("/orders/:id", readOrders, handler.GetOrderDetails)
+	// orders with items of the seller only, others are moved by an admin
+	sellerRoutes.Patch("/orders/:id/status", policy.Require(policy.OrdersFulfil), handler.UpdateOrderStatus)
 
-	sellerRoutes := app.Group("/seller", as.Auth.AuthorizeSeller)
-	sellerRoutes.Get("/orders", handler.GetOrders)
-	sellerRoutes.Get("/orders/:id", handler.GetOrderDetails)
+	adminRoutes := app.Group("/admin/orders", as.Auth.AuthorizePrivileged)
+	adminRoutes.Get("/:id", policy.Require(policy.OrdersReadAny), handler.GetAnyOrder)
+	adminRoutes.Patch("/:id/status", policy.Require(policy.OrdersManage), handler.UpdateOrderStatus)
 }
 
 func (h *TransactionHandler) MakePayment(ctx *fiber.Ctx) error {
@@ -59,7 +80,7 @@ func (h *TransactionHandler) MakePayment(ctx *fiber.Ctx) error {
 	}
 
 	// get total amount
-	_, amount, err := h.userSvc.FindCart(user.ID)
+	cartItems, amount, err := h.userSvc.FindCart(user.ID)
 	if err != nil {
 		return rest.InternalError(ctx, err)
 	}
@@ -69,15 +90,27 @@ func (h *TransactionHandler) MakePayment(ctx *fiber.Ctx) error {
 		return rest.InternalError(ctx, errors.New("error generating order id"))
 	}
 
+	// hold the stock while the buyer pays, expired reservations are released by a job
+	if err = h.svc.Inventory.Reserve(user.ID, orderID, cartItems); err != nil {
+		if errors.Is(err, service.ErrOutOfStock) || errors.Is(err, service.ErrProductUnavailable) {
+			return ctx.Status(http.StatusConflict).JSON(&fiber.Map{
+				"message": err.Error(),
+			})
+		}
+		return rest.InternalError(ctx, err)
+	}
+
 	// create a new payment session on stripe
 	result, err := h.paymentClient.CreatePayment(amount, user.ID, orderID)
 	if err != nil {
+		h.releaseReservations(orderID)
 		return rest.BadRequestResponse(ctx, err.Error())
 	}
 
 	// create a new payment session to database
 	err = h.svc.StoreCreatePayment(user.ID, result, amount, orderID)
 	if err != nil {
+		h.releaseReservations(orderID)
 		return rest.BadRequestResponse(ctx, err.Error())
 	}
 
@@ -87,6 +120,12 @@ func (h *TransactionHandler) MakePayment(ctx *fiber.Ctx) error {
 	})
 }
 
+func (h *TransactionHandler) releaseReservations(orderID string) {
+	if err := h.svc.Inventory.Release(orderID); err != nil {
+		log.Printf("releasing reservations of checkout %s failed: %v", orderID, err)
+	}
+}
+
 func (h *TransactionHandler) GetOrders(ctx *fiber.Ctx) error {
 	return rest.SuccessResponse(ctx, "get order", nil)
 }
@@ -94,3 +133,42 @@ func (h *TransactionHandler) GetOrders(ctx *fiber.Ctx) error {
 func (h *TransactionHandler) GetOrderDetails(ctx *fiber.Ctx) error {
 	return rest.SuccessResponse(ctx, "order details", nil)
 }
+
+func (h *TransactionHandler) GetAnyOrder(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+
+	order, err := h.svc.GetOrder(uint(id))
+	if err != nil {
+		return rest.NotFoundResponse(ctx, err.Error())
+	}
+
+	return rest.SuccessResponse(ctx, "order details", order)
+}
+
+func (h *TransactionHandler) UpdateOrderStatus(ctx *fiber.Ctx) error {
+	user := h.svc.Auth.GetCurrentUser(ctx)
+	id, _ := ctx.ParamsInt("id")
+	req := dto.OrderStatusRequest{}
+
+	if err := ctx.BodyParser(&req); err != nil {
+		return rest.BadRequestResponse(ctx, "order status request is not valid")
+	}
+
+	order, err := h.svc.UpdateOrderStatus(uint(id), req.Status, user, rest.RequestMeta(ctx))
+	switch {
+	case errors.Is(err, service.ErrOrderNotFound):
+		return rest.NotFoundResponse(ctx, err.Error())
+	case errors.Is(err, service.ErrOrderNotOwned):
+		return ctx.Status(http.StatusForbidden).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	case errors.Is(err, service.ErrOrderTransition):
+		return ctx.Status(http.StatusConflict).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	case err != nil:
+		return rest.InternalError(ctx, err)
+	}
+
+	return rest.SuccessResponse(ctx, "order status updated", order)
+}
@@ -4,9 +4,15 @@ import (
 	"errors"
 	"go-ecommerce-app/internal/api/rest"
 	"go-ecommerce-app/internal/dto"
+	"go-ecommerce-app/internal/policy"
 	"go-ecommerce-app/internal/repository"
 	"go-ecommerce-app/internal/service"
+	"go-ecommerce-app/pkg/ratelimit"
+	"html/template"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -23,34 +29,94 @@ func SetupUserRoutes(rh *rest.RestHandler) {
 		CRepo:  repository.NewCatalogRepository(rh.DB),
 		Auth:   rh.Auth,
 		Config: rh.Config,
+		Audit:  newAuditService(rh),
+		// orders take their items off the stock
+		Inventory: newInventoryService(rh),
 	}
 
 	handler := UserHandler{
 		svc: svc,
 	}
 
+	// rate limits
+	registerLimit := rest.RateLimit(rh.Limiter, rest.RateLimitPolicy{
+		Name:  "register",
+		Limit: ratelimit.Limit{Requests: 5, Period: time.Hour},
+		Key:   rest.KeyByIP,
+	})
+	loginIPLimit := rest.RateLimit(rh.Limiter, rest.RateLimitPolicy{
+		Name:  "login-ip",
+		Limit: ratelimit.Limit{Requests: 20, Period: time.Minute},
+		Key:   rest.KeyByIP,
+	})
+	loginEmailLimit := rest.RateLimit(rh.Limiter, rest.RateLimitPolicy{
+		Name:  "login-email",
+		Limit: ratelimit.Limit{Requests: 5, Period: 15 * time.Minute},
+		Key:   rest.KeyByEmail,
+	})
+	verifyLimit := rest.RateLimit(rh.Limiter, rest.RateLimitPolicy{
+		Name:  "verify",
+		Limit: ratelimit.Limit{Requests: 10, Period: 10 * time.Minute},
+		Key:   rest.KeyByUser(rh.Auth),
+	})
+	confirmLimit := rest.RateLimit(rh.Limiter, rest.RateLimitPolicy{
+		Name:  "email-confirm",
+		Limit: ratelimit.Limit{Requests: 10, Period: 10 * time.Minute},
+		Key:   rest.KeyByIP,
+	})
+
 	pubRoutes := app.Group("/users")
 	// Public endpoint
-	pubRoutes.Post("/register", handler.Register)
-	pubRoutes.Post("/login", handler.Login)
+	pubRoutes.Post("/register", registerLimit, handler.Register)
+	pubRoutes.Post("/login", loginIPLimit, loginEmailLimit, handler.Login)
+	pubRoutes.Post("/login/2fa", loginIPLimit, handler.LoginTwoFactor)
+	// the emailed link opens a page that posts the token, scanners
+	// prefetching the link don't change the address
+	pubRoutes.Get("/email/confirm", handler.ConfirmEmailPage)
+	pubRoutes.Post("/email/confirm", confirmLimit, handler.ConfirmEmailChange)
 
 	pvtRoutes := pubRoutes.Group("/", rh.Auth.Authorize)
 	// Private endpoint
-	pvtRoutes.Get("/verify", handler.GetVerificationCode)
-	pvtRoutes.Post("/verify", handler.Verify)
+	pvtRoutes.Get("/verify", verifyLimit, handler.GetVerificationCode)
+	pvtRoutes.Post("/verify", verifyLimit, handler.Verify)
+
+	pvtRoutes.Post("/email", verifyLimit, handler.RequestEmailChange)
+	pvtRoutes.Post("/phone", verifyLimit, handler.RequestPhoneChange)
+	pvtRoutes.Post("/phone/confirm", verifyLimit, handler.ConfirmPhoneChange)
 
 	pvtRoutes.Post("/profile", handler.CreateProfile)
 	pvtRoutes.Get("/profile", handler.GetProfile)
 	pvtRoutes.Patch("/profile", handler.UpdateProfile)
 
-	pvtRoutes.Post("/cart", handler.AddToCart)
-	pvtRoutes.Get("/cart", handler.GetCart)
+	pvtRoutes.Get("/addresses", handler.GetAddresses)
+	pvtRoutes.Post("/addresses", handler.CreateAddress)
+	pvtRoutes.Get("/addresses/:id", handler.GetAddress)
+	pvtRoutes.Patch("/addresses/:id", handler.UpdateAddress)
+	pvtRoutes.Delete("/addresses/:id", handler.DeleteAddress)
+	pvtRoutes.Post("/addresses/:id/default", handler.SetDefaultAddress)
 
-	pvtRoutes.Post("/order", handler.CreateOrder)
-	pvtRoutes.Get("/order", handler.GetOrders)
-	pvtRoutes.Get("/order/:id", handler.GetOrder)
+	manageCart := policy.Require(policy.CartManage)
+	placeOrders := policy.Require(policy.OrdersPlace)
 
-	pvtRoutes.Post("/become-seller", handler.BecomeSeller)
+	pvtRoutes.Post("/cart", manageCart, handler.AddToCart)
+	pvtRoutes.Get("/cart", manageCart, handler.GetCart)
+	pvtRoutes.Post("/cart/:id/save-for-later", manageCart, handler.SaveForLater)
+	pvtRoutes.Get("/saved-items", manageCart, handler.GetSavedItems)
+	pvtRoutes.Post("/saved-items/:id/move-to-cart", manageCart, handler.MoveSavedToCart)
+
+	pvtRoutes.Post("/order", placeOrders, handler.CreateOrder)
+	pvtRoutes.Get("/order", placeOrders, handler.GetOrders)
+	pvtRoutes.Get("/order/:id", placeOrders, handler.GetOrder)
+
+	pvtRoutes.Get("/security/logins", handler.GetLoginHistory)
+
+	pvtRoutes.Post("/2fa/setup", handler.SetupTwoFactor)
+	pvtRoutes.Post("/2fa/enable", verifyLimit, handler.EnableTwoFactor)
+	pvtRoutes.Post("/2fa/disable", verifyLimit, handler.DisableTwoFactor)
+	pvtRoutes.Post("/2fa/recovery-codes", verifyLimit, handler.RegenerateRecoveryCodes)
+
+	// Admin endpoint
+	app.Patch("/admin/users/:id/role", rh.Auth.AuthorizePrivileged, policy.Require(policy.UsersManage), handler.ChangeRole)
 }
 
 func (h *UserHandler) Register(ctx *fiber.Ctx) error {
@@ -84,12 +150,23 @@ func (h *UserHandler) Login(ctx *fiber.Ctx) error {
 		})
 	}
 
-	token, err := h.svc.Login(input.Email, input.Password)
+	result, err := h.svc.Login(input.Email, input.Password, rest.RequestMeta(ctx))
 	if err != nil {
-		return ctx.Status(http.StatusUnauthorized).JSON(&fiber.Map{
-			"message": "invalid email or password",
-			"error":   err.Error(),
-		})
+		return loginErrorResponse(ctx, err)
+	}
+
+	return ctx.Status(http.StatusOK).JSON(result)
+}
+
+func (h *UserHandler) LoginTwoFactor(ctx *fiber.Ctx) error {
+	var input dto.TwoFactorLoginInput
+	if err := ctx.BodyParser(&input); err != nil {
+		return rest.BadRequestResponse(ctx, "")
+	}
+
+	token, err := h.svc.LoginTwoFactor(input, rest.RequestMeta(ctx))
+	if err != nil {
+		return loginErrorResponse(ctx, err)
 	}
 
 	return ctx.Status(http.StatusOK).JSON(&fiber.Map{
@@ -97,13 +174,43 @@ func (h *UserHandler) Login(ctx *fiber.Ctx) error {
 	})
 }
 
+func loginErrorResponse(ctx *fiber.Ctx, err error) error {
+	var throttled service.LoginThrottledError
+	switch {
+	case errors.As(err, &throttled):
+		ctx.Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		return ctx.Status(http.StatusTooManyRequests).JSON(&fiber.Map{
+			"message": throttled.Error(),
+		})
+	case errors.Is(err, service.ErrInvalidCredentials):
+		return ctx.Status(http.StatusUnauthorized).JSON(&fiber.Map{
+			"message": "invalid email or password",
+		})
+	case errors.Is(err, service.ErrInvalidTwoFactor):
+		return ctx.Status(http.StatusUnauthorized).JSON(&fiber.Map{
+			"message": err.Error(),
+		})
+	default:
+		return ctx.Status(http.StatusUnauthorized).JSON(&fiber.Map{
+			"message": "authentication failed",
+		})
+	}
+}
+
 func (h *UserHandler) GetVerificationCode(ctx *fiber.Ctx) error {
 	user := h.svc.Auth.GetCurrentUser(ctx)
 
 	if err := h.svc.GetVerificationCode(user); err != nil {
-		ctx.Status(http.StatusInternalServerError).JSON(&fiber.Map{
-			"error": err,
-		})
+		switch {
+		case errors.Is(err, service.ErrOtpCooldown), errors.Is(err, service.ErrOtpDailyLimit):
+			return ctx.Status(http.StatusTooManyRequests).JSON(&fiber.Map{
+				"message": err.Error(),
+			})
+		default:
+			return ctx.Status(http.StatusInternalServerError).JSON(&fiber.Map{
+				"message": err.Error(),
+			})
+		}
 	}
 
 	return ctx.Status(http.StatusOK).JSON(&fiber.Map{
@@ -124,6 +231,12 @@ func (h *UserHandler) Verify(ctx *fiber.Ctx) error {
 	}
 
 	if err := h.svc.VerifyCode(user.ID, req.Code); err != nil {
+		if errors.Is(err, service.ErrOtpTooManyAttempts) {
+			return ctx.Status(http.StatusTooManyRequests).JSON(&fiber.Map{
+				"message": err.Error(),
+			})
+		}
+
 		return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
 			"message": err.Error(),
 		})
@@ -134,6 +247,102 @@ func (h *UserHandler) Verify(ctx *fiber.Ctx) error {
 	})
 }
 
+func (h *UserHandler) RequestEmailChange(ctx *fiber.Ctx) error {
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	var input dto.ChangeEmailInput
+	if err := ctx.BodyParser(&input); err != nil {
+		return rest.BadRequestResponse(ctx, "")
+	}
+
+	if err := h.svc.RequestEmailChange(user.ID, input); err != nil {
+		return contactChangeErrorResponse(ctx, err)
+	}
+
+	return rest.SuccessResponse(ctx, "confirmation link sent to the new email address", nil)
+}
+
+var confirmEmailPage = template.Must(template.New("confirm").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Confirm your email address</title></head>
+<body>
+<form method="post" action="confirm">
+<input type="hidden" name="token" value="{{.}}">
+<button type="submit">Confirm the new email address</button>
+</form>
+</body>
+</html>
+`))
+
+func (h *UserHandler) ConfirmEmailPage(ctx *fiber.Ctx) error {
+	ctx.Type("html", "utf-8")
+	return confirmEmailPage.Execute(ctx, ctx.Query("token"))
+}
+
+func (h *UserHandler) ConfirmEmailChange(ctx *fiber.Ctx) error {
+	var input dto.ConfirmEmailInput
+	if err := ctx.BodyParser(&input); err != nil {
+		return rest.BadRequestResponse(ctx, "")
+	}
+
+	if err := h.svc.ConfirmEmailChange(input.Token, rest.RequestMeta(ctx)); err != nil {
+		return contactChangeErrorResponse(ctx, err)
+	}
+
+	return rest.SuccessResponse(ctx, "email address updated, please sign in with it", nil)
+}
+
+func (h *UserHandler) RequestPhoneChange(ctx *fiber.Ctx) error {
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	var input dto.ChangePhoneInput
+	if err := ctx.BodyParser(&input); err != nil {
+		return rest.BadRequestResponse(ctx, "")
+	}
+
+	if err := h.svc.RequestPhoneChange(user.ID, input); err != nil {
+		return contactChangeErrorResponse(ctx, err)
+	}
+
+	return rest.SuccessResponse(ctx, "verification code sent to the new phone number", nil)
+}
+
+func (h *UserHandler) ConfirmPhoneChange(ctx *fiber.Ctx) error {
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	var input dto.VerificationCodeInput
+	if err := ctx.BodyParser(&input); err != nil {
+		return rest.BadRequestResponse(ctx, "")
+	}
+
+	token, err := h.svc.ConfirmPhoneChange(user, input.Code, rest.RequestMeta(ctx))
+	if err != nil {
+		return contactChangeErrorResponse(ctx, err)
+	}
+
+	return ctx.Status(http.StatusOK).JSON(&fiber.Map{
+		"message": "phone number updated",
+		"token":   token,
+	})
+}
+
+func contactChangeErrorResponse(ctx *fiber.Ctx, err error) error {
+	status := http.StatusBadRequest
+
+	switch {
+	case errors.Is(err, service.ErrOtpCooldown), errors.Is(err, service.ErrOtpDailyLimit), errors.Is(err, service.ErrOtpTooManyAttempts):
+		status = http.StatusTooManyRequests
+	case errors.Is(err, service.ErrInvalidCredentials):
+		status = http.StatusUnauthorized
+	case errors.Is(err, service.ErrEmailTaken):
+		status = http.StatusConflict
+	}
+
+	return ctx.Status(status).JSON(&fiber.Map{
+		"message": err.Error(),
+	})
+}
+
 func (h *UserHandler) CreateProfile(ctx *fiber.Ctx) error {
 	user := h.svc.Auth.GetCurrentUser(ctx)
 
@@ -177,6 +386,90 @@ func (h *UserHandler) UpdateProfile(ctx *fiber.Ctx) error {
 	return rest.SuccessResponse(ctx, "profile updated", nil)
 }
 
+func (h *UserHandler) GetAddresses(ctx *fiber.Ctx) error {
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	addresses, err := h.svc.GetAddresses(user.ID)
+	if err != nil {
+		return rest.InternalError(ctx, err)
+	}
+
+	return rest.SuccessResponse(ctx, "success", addresses)
+}
+
+func (h *UserHandler) GetAddress(ctx *fiber.Ctx) error {
+	user := h.svc.Auth.GetCurrentUser(ctx)
+	id, _ := ctx.ParamsInt("id")
+
+	address, err := h.svc.GetAddress(user.ID, uint(id))
+	if err != nil {
+		return rest.NotFoundResponse(ctx, err.Error())
+	}
+
+	return rest.SuccessResponse(ctx, "success", address)
+}
+
+func (h *UserHandler) CreateAddress(ctx *fiber.Ctx) error {
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	req := dto.AddressInput{}
+	if err := ctx.BodyParser(&req); err != nil {
+		return rest.BadRequestResponse(ctx, "")
+	}
+
+	address, err := h.svc.CreateAddress(user.ID, req)
+	if err != nil {
+		return rest.BadRequestResponse(ctx, err.Error())
+	}
+
+	return rest.SuccessCreated(ctx, "address created", address)
+}
+
+func (h *UserHandler) UpdateAddress(ctx *fiber.Ctx) error {
+	user := h.svc.Auth.GetCurrentUser(ctx)
+	id, _ := ctx.ParamsInt("id")
+
+	req := dto.AddressInput{}
+	if err := ctx.BodyParser(&req); err != nil {
+		return rest.BadRequestResponse(ctx, "")
+	}
+
+	address, err := h.svc.UpdateAddress(user.ID, uint(id), req)
+	if err != nil {
+		return rest.BadRequestResponse(ctx, err.Error())
+	}
+
+	return rest.SuccessResponse(ctx, "address updated", address)
+}
+
+func (h *UserHandler) SetDefaultAddress(ctx *fiber.Ctx) error {
+	user := h.svc.Auth.GetCurrentUser(ctx)
+	id, _ := ctx.ParamsInt("id")
+
+	req := dto.DefaultAddressInput{}
+	if err := ctx.BodyParser(&req); err != nil {
+		return rest.BadRequestResponse(ctx, "")
+	}
+
+	address, err := h.svc.SetDefaultAddress(user.ID, uint(id), req)
+	if err != nil {
+		return rest.BadRequestResponse(ctx, err.Error())
+	}
+
+	return rest.SuccessResponse(ctx, "default address updated", address)
+}
+
+func (h *UserHandler) DeleteAddress(ctx *fiber.Ctx) error {
+	user := h.svc.Auth.GetCurrentUser(ctx)
+	id, _ := ctx.ParamsInt("id")
+
+	if err := h.svc.DeleteAddress(user.ID, uint(id)); err != nil {
+		return rest.BadRequestResponse(ctx, err.Error())
+	}
+
+	return rest.NoContentResponse(ctx)
+}
+
 func (h *UserHandler) AddToCart(ctx *fiber.Ctx) error {
 	req := dto.CreateCartRequest{}
 
@@ -208,11 +501,57 @@ func (h *UserHandler) GetCart(ctx *fiber.Ctx) error {
 	})
 }
 
+func (h *UserHandler) SaveForLater(ctx *fiber.Ctx) error {
+	user := h.svc.Auth.GetCurrentUser(ctx)
+	id, _ := ctx.ParamsInt("id")
+
+	cartItems, err := h.svc.SaveForLater(user, uint(id))
+	if err != nil {
+		return rest.NotFoundResponse(ctx, err.Error())
+	}
+
+	return rest.SuccessResponse(ctx, "success", cartItems)
+}
+
+func (h *UserHandler) GetSavedItems(ctx *fiber.Ctx) error {
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	items, err := h.svc.GetSavedItems(user)
+	if err != nil {
+		return rest.InternalError(ctx, err)
+	}
+
+	return rest.SuccessResponse(ctx, "success", items)
+}
+
+func (h *UserHandler) MoveSavedToCart(ctx *fiber.Ctx) error {
+	user := h.svc.Auth.GetCurrentUser(ctx)
+	id, _ := ctx.ParamsInt("id")
+
+	cartItems, err := h.svc.MoveSavedToCart(user, uint(id))
+	if err != nil {
+		return rest.BadRequestResponse(ctx, err.Error())
+	}
+
+	return rest.SuccessResponse(ctx, "success", cartItems)
+}
+
 func (h *UserHandler) CreateOrder(ctx *fiber.Ctx) error {
 	user := h.svc.Auth.GetCurrentUser(ctx)
 
-	orderRef, err := h.svc.CreateOrder(user)
+	// addresses are optional, the defaults are used otherwise
+	req := dto.CreateOrderRequest{}
+	if len(ctx.Body()) > 0 {
+		if err := ctx.BodyParser(&req); err != nil {
+			return rest.BadRequestResponse(ctx, "")
+		}
+	}
+
+	orderRef, err := h.svc.CreateOrder(user, req)
 	if err != nil {
+		if errors.Is(err, service.ErrShippingAddress) || errors.Is(err, service.ErrBillingAddress) {
+			return rest.BadRequestResponse(ctx, err.Error())
+		}
 		return rest.InternalError(ctx, err)
 	}
 
@@ -242,26 +581,98 @@ func (h *UserHandler) GetOrder(ctx *fiber.Ctx) error {
 	return rest.SuccessResponse(ctx, "success", order)
 }
 
-func (h *UserHandler) BecomeSeller(ctx *fiber.Ctx) error {
+func (h *UserHandler) GetLoginHistory(ctx *fiber.Ctx) error {
 	user := h.svc.Auth.GetCurrentUser(ctx)
 
-	req := dto.SellerInput{}
+	logins, err := h.svc.GetLoginHistory(user.ID)
+	if err != nil {
+		return rest.InternalError(ctx, err)
+	}
+
+	return rest.SuccessResponse(ctx, "success", logins)
+}
+
+func (h *UserHandler) SetupTwoFactor(ctx *fiber.Ctx) error {
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	secret, uri, err := h.svc.SetupTwoFactor(user.ID)
+	if err != nil {
+		return rest.BadRequestResponse(ctx, err.Error())
+	}
+
+	return rest.SuccessResponse(ctx, "scan the provisioning uri with your authenticator app", &fiber.Map{
+		"secret":           secret,
+		"provisioning_uri": uri,
+	})
+}
+
+func (h *UserHandler) EnableTwoFactor(ctx *fiber.Ctx) error {
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	req := dto.TwoFactorCodeInput{}
 	if err := ctx.BodyParser(&req); err != nil {
-		return ctx.Status(http.StatusBadRequest).JSON(&fiber.Map{
-			"message": "request paramiters are not valid",
-		})
+		return rest.BadRequestResponse(ctx, "")
 	}
 
-	token, err := h.svc.BecomeSeller(user.ID, req)
+	token, codes, err := h.svc.EnableTwoFactor(user.ID, req.Code, rest.RequestMeta(ctx))
 	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(&fiber.Map{
-			"message": "fail to become seller",
-			"error":   err,
-		})
+		return rest.BadRequestResponse(ctx, err.Error())
 	}
 
-	return ctx.Status(http.StatusOK).JSON(&fiber.Map{
-		"message": "success",
-		"token":   token,
+	return rest.SuccessResponse(ctx, "two-factor authentication enabled, store your recovery codes safely", &fiber.Map{
+		"token":          token,
+		"recovery_codes": codes,
 	})
 }
+
+func (h *UserHandler) DisableTwoFactor(ctx *fiber.Ctx) error {
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	req := dto.TwoFactorLoginInput{}
+	if err := ctx.BodyParser(&req); err != nil {
+		return rest.BadRequestResponse(ctx, "")
+	}
+
+	if err := h.svc.DisableTwoFactor(user.ID, req, rest.RequestMeta(ctx)); err != nil {
+		return rest.BadRequestResponse(ctx, err.Error())
+	}
+
+	return rest.SuccessResponse(ctx, "two-factor authentication disabled", nil)
+}
+
+func (h *UserHandler) RegenerateRecoveryCodes(ctx *fiber.Ctx) error {
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	req := dto.TwoFactorCodeInput{}
+	if err := ctx.BodyParser(&req); err != nil {
+		return rest.BadRequestResponse(ctx, "")
+	}
+
+	codes, err := h.svc.RegenerateRecoveryCodes(user.ID, req.Code)
+	if err != nil {
+		return rest.BadRequestResponse(ctx, err.Error())
+	}
+
+	return rest.SuccessResponse(ctx, "success", &fiber.Map{
+		"recovery_codes": codes,
+	})
+}
+
+func (h *UserHandler) ChangeRole(ctx *fiber.Ctx) error {
+	id, err := strconv.Atoi(ctx.Params("id"))
+	if err != nil {
+		return rest.BadRequestResponse(ctx, "please provide a valid user id")
+	}
+
+	req := dto.ChangeRoleInput{}
+	if err = ctx.BodyParser(&req); err != nil {
+		return rest.BadRequestResponse(ctx, "please provide a valid role")
+	}
+
+	user, err := h.svc.ChangeRole(uint(id), req.Role, rest.RequestMeta(ctx))
+	if err != nil {
+		return rest.BadRequestResponse(ctx, err.Error())
+	}
+
+	return rest.SuccessResponse(ctx, "role updated", user)
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+	"go-ecommerce-app/internal/api/rest"
+	"go-ecommerce-app/internal/dto"
+	"go-ecommerce-app/internal/policy"
+	"go-ecommerce-app/internal/repository"
+	"go-ecommerce-app/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type WarehouseHandler struct {
+	svc service.WarehouseService
+}
+
+func SetupWarehouseRoutes(rh *rest.RestHandler) {
+	app := rh.App
+
+	handler := WarehouseHandler{
+		svc: service.WarehouseService{
+			Repo: repository.NewWarehouseRepository(rh.DB),
+			Auth: rh.Auth,
+		},
+	}
+
+	// Seller endpoint
+	selRoutes := app.Group("/seller/warehouses", rh.Auth.AuthorizePrivilegedOrKey(newApiKeyService(rh)))
+	selRoutes.Get("/", policy.Require(policy.CatalogProductRead), handler.GetWarehouses)
+	selRoutes.Post("/", policy.Require(policy.CatalogProductManage), handler.CreateWarehouse)
+	selRoutes.Put("/:id", policy.Require(policy.CatalogProductManage), handler.UpdateWarehouse)
+	selRoutes.Delete("/:id", policy.Require(policy.CatalogProductManage), handler.DeleteWarehouse)
+}
+
+func warehouseErrorResponse(ctx *fiber.Ctx, err error) error {
+	if errors.Is(err, service.ErrWarehouseNotFound) {
+		return rest.NotFoundResponse(ctx, err.Error())
+	}
+
+	return rest.BadRequestResponse(ctx, err.Error())
+}
+
+func (h WarehouseHandler) GetWarehouses(ctx *fiber.Ctx) error {
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	warehouses, err := h.svc.GetWarehouses(user)
+	if err != nil {
+		return rest.InternalError(ctx, err)
+	}
+
+	return rest.SuccessResponse(ctx, "success", warehouses)
+}
+
+func (h WarehouseHandler) CreateWarehouse(ctx *fiber.Ctx) error {
+	req := dto.WarehouseInput{}
+
+	if err := ctx.BodyParser(&req); err != nil {
+		return rest.BadRequestResponse(ctx, "warehouse request is not valid")
+	}
+
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	warehouse, err := h.svc.CreateWarehouse(user, req)
+	if err != nil {
+		return rest.BadRequestResponse(ctx, err.Error())
+	}
+
+	return rest.SuccessCreated(ctx, "warehouse created", warehouse)
+}
+
+func (h WarehouseHandler) UpdateWarehouse(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+	req := dto.WarehouseInput{}
+
+	if err := ctx.BodyParser(&req); err != nil {
+		return rest.BadRequestResponse(ctx, "warehouse request is not valid")
+	}
+
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	warehouse, err := h.svc.UpdateWarehouse(uint(id), user, req)
+	if err != nil {
+		return warehouseErrorResponse(ctx, err)
+	}
+
+	return rest.SuccessResponse(ctx, "warehouse updated", warehouse)
+}
+
+func (h WarehouseHandler) DeleteWarehouse(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	if err := h.svc.DeleteWarehouse(uint(id), user); err != nil {
+		return warehouseErrorResponse(ctx, err)
+	}
+
+	return rest.NoContentResponse(ctx)
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"errors"
+	"go-ecommerce-app/internal/api/rest"
+	"go-ecommerce-app/internal/dto"
+	"go-ecommerce-app/internal/policy"
+	"go-ecommerce-app/internal/repository"
+	"go-ecommerce-app/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type WishlistHandler struct {
+	svc service.WishlistService
+}
+
+func SetupWishlistRoutes(rh *rest.RestHandler) {
+	app := rh.App
+
+	svc := service.WishlistService{
+		Repo:    repository.NewWishlistRepository(rh.DB),
+		Users:   repository.NewUserRepository(rh.DB),
+		Catalog: repository.NewCatalogRepository(rh.DB),
+		Auth:    rh.Auth,
+		Config:  rh.Config,
+	}
+
+	handler := WishlistHandler{
+		svc: svc,
+	}
+
+	// Public endpoint
+	app.Get("/wishlists/shared/:token", handler.GetSharedWishlist)
+
+	// Private endpoint
+	pvtRoutes := app.Group("/users/wishlists", rh.Auth.Authorize, policy.Require(policy.CartManage))
+	pvtRoutes.Get("/", handler.GetWishlists)
+	pvtRoutes.Post("/", handler.CreateWishlist)
+	pvtRoutes.Get("/:id", handler.GetWishlist)
+	pvtRoutes.Patch("/:id", handler.UpdateWishlist)
+	pvtRoutes.Delete("/:id", handler.DeleteWishlist)
+	pvtRoutes.Post("/:id/items", handler.AddItem)
+	pvtRoutes.Delete("/:id/items/:itemId", handler.RemoveItem)
+	pvtRoutes.Post("/:id/items/:itemId/move-to-cart", handler.MoveToCart)
+}
+
+func wishlistErrorResponse(ctx *fiber.Ctx, err error) error {
+	if errors.Is(err, service.ErrWishlistNotFound) {
+		return rest.NotFoundResponse(ctx, err.Error())
+	}
+
+	return rest.BadRequestResponse(ctx, err.Error())
+}
+
+func (h WishlistHandler) GetSharedWishlist(ctx *fiber.Ctx) error {
+	wishlist, err := h.svc.GetSharedWishlist(ctx.Params("token"))
+	if err != nil {
+		return wishlistErrorResponse(ctx, err)
+	}
+
+	return rest.SuccessResponse(ctx, "success", wishlist)
+}
+
+func (h WishlistHandler) GetWishlists(ctx *fiber.Ctx) error {
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	wishlists, err := h.svc.GetWishlists(user)
+	if err != nil {
+		return rest.InternalError(ctx, err)
+	}
+
+	return rest.SuccessResponse(ctx, "success", wishlists)
+}
+
+func (h WishlistHandler) CreateWishlist(ctx *fiber.Ctx) error {
+	req := dto.CreateWishlistRequest{}
+
+	if err := ctx.BodyParser(&req); err != nil {
+		return rest.BadRequestResponse(ctx, "create wishlist request is not valid")
+	}
+
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	wishlist, err := h.svc.CreateWishlist(user, req)
+	if err != nil {
+		return rest.BadRequestResponse(ctx, err.Error())
+	}
+
+	return rest.SuccessCreated(ctx, "wishlist created", wishlist)
+}
+
+func (h WishlistHandler) GetWishlist(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	wishlist, err := h.svc.GetWishlist(uint(id), user)
+	if err != nil {
+		return wishlistErrorResponse(ctx, err)
+	}
+
+	return rest.SuccessResponse(ctx, "success", wishlist)
+}
+
+func (h WishlistHandler) UpdateWishlist(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+	req := dto.UpdateWishlistRequest{}
+
+	if err := ctx.BodyParser(&req); err != nil {
+		return rest.BadRequestResponse(ctx, "update wishlist request is not valid")
+	}
+
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	wishlist, err := h.svc.UpdateWishlist(uint(id), user, req)
+	if err != nil {
+		return wishlistErrorResponse(ctx, err)
+	}
+
+	return rest.SuccessResponse(ctx, "wishlist updated", wishlist)
+}
+
+func (h WishlistHandler) DeleteWishlist(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	if err := h.svc.DeleteWishlist(uint(id), user); err != nil {
+		return wishlistErrorResponse(ctx, err)
+	}
+
+	return rest.NoContentResponse(ctx)
+}
+
+func (h WishlistHandler) AddItem(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+	req := dto.AddWishlistItemRequest{}
+
+	if err := ctx.BodyParser(&req); err != nil {
+		return rest.BadRequestResponse(ctx, "add item request is not valid")
+	}
+
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	wishlist, err := h.svc.AddItem(uint(id), user, req)
+	if err != nil {
+		return wishlistErrorResponse(ctx, err)
+	}
+
+	return rest.SuccessResponse(ctx, "item added", wishlist)
+}
+
+func (h WishlistHandler) RemoveItem(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+	itemID, _ := ctx.ParamsInt("itemId")
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	if err := h.svc.RemoveItem(uint(id), uint(itemID), user); err != nil {
+		return wishlistErrorResponse(ctx, err)
+	}
+
+	return rest.NoContentResponse(ctx)
+}
+
+func (h WishlistHandler) MoveToCart(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+	itemID, _ := ctx.ParamsInt("itemId")
+
+	// the quantity is optional, one item is moved otherwise
+	req := dto.MoveToCartRequest{}
+	if len(ctx.Body()) > 0 {
+		if err := ctx.BodyParser(&req); err != nil {
+			return rest.BadRequestResponse(ctx, "move to cart request is not valid")
+		}
+	}
+
+	user := h.svc.Auth.GetCurrentUser(ctx)
+
+	cartItems, err := h.svc.MoveToCart(uint(id), uint(itemID), user, req)
+	if err != nil {
+		return wishlistErrorResponse(ctx, err)
+	}
+
+	return rest.SuccessResponse(ctx, "moved to cart", cartItems)
+}
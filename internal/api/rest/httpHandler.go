@@ -3,16 +3,22 @@ package rest
 import (
 	"go-ecommerce-app/config"
 	"go-ecommerce-app/internal/helper"
+	"go-ecommerce-app/internal/service"
+	"go-ecommerce-app/pkg/blobstore"
 	"go-ecommerce-app/pkg/payment"
+	"go-ecommerce-app/pkg/ratelimit"
 
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 )
 
 type RestHandler struct {
-	App    *fiber.App
-	DB     *gorm.DB
-	Auth   helper.Auth
-	Config config.AppConfig
-	PC     payment.PaymentClient
+	App     *fiber.App
+	DB      *gorm.DB
+	Auth    helper.Auth
+	Config  config.AppConfig
+	PC      payment.PaymentClient
+	Limiter ratelimit.Store
+	Blobs   blobstore.BlobStore
+	Alerts  *service.AlertService
 }
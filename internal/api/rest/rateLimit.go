@@ -0,0 +1,81 @@
+package rest
+
+import (
+	"encoding/json"
+	"go-ecommerce-app/internal/helper"
+	"go-ecommerce-app/pkg/ratelimit"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// KeyFunc returns the identity a request is throttled by.
+type KeyFunc func(ctx *fiber.Ctx) string
+
+type RateLimitPolicy struct {
+	Name  string
+	Limit ratelimit.Limit
+	Key   KeyFunc
+}
+
+func RateLimit(store ratelimit.Store, policy RateLimitPolicy) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		key := policy.Key(ctx)
+		if key == "" {
+			key = KeyByIP(ctx)
+		}
+
+		result, err := store.Take(policy.Name+":"+key, policy.Limit)
+		if err != nil {
+			// fail open, throttling must not take the api down
+			log.Printf("rate limit store error: %v", err)
+			return ctx.Next()
+		}
+
+		ctx.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		ctx.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		ctx.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+
+		if !result.Allowed {
+			ctx.Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			return ctx.Status(http.StatusTooManyRequests).JSON(&fiber.Map{
+				"message": "too many requests, please try again later",
+			})
+		}
+
+		return ctx.Next()
+	}
+}
+
+func KeyByIP(ctx *fiber.Ctx) string {
+	return "ip:" + ctx.IP()
+}
+
+// KeyByUser must run after auth.Authorize.
+func KeyByUser(auth helper.Auth) KeyFunc {
+	return func(ctx *fiber.Ctx) string {
+		user := auth.GetCurrentUser(ctx)
+		return "user:" + strconv.FormatUint(uint64(user.ID), 10)
+	}
+}
+
+func KeyByEmail(ctx *fiber.Ctx) string {
+	var body struct {
+		Email string `json:"email"`
+	}
+
+	if err := json.Unmarshal(ctx.Body(), &body); err != nil || body.Email == "" {
+		return ""
+	}
+
+	return "email:" + strings.ToLower(strings.TrimSpace(body.Email))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
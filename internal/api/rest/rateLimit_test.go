@@ -0,0 +1,135 @@
+package rest
+
+import (
+	"go-ecommerce-app/pkg/ratelimit"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// newKeyApp answers with the key the request is throttled by. The client
+// address is taken from X-Forwarded-For so the tests can vary it.
+func newKeyApp(key KeyFunc) *fiber.App {
+	app := fiber.New(fiber.Config{ProxyHeader: fiber.HeaderXForwardedFor})
+	app.Post("/", func(ctx *fiber.Ctx) error {
+		return ctx.SendString(key(ctx))
+	})
+	return app
+}
+
+func requestKey(t *testing.T, app *fiber.App, ip, body string) string {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(fiber.HeaderXForwardedFor, ip)
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	key, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(key)
+}
+
+func TestKeyByIP(t *testing.T) {
+	app := newKeyApp(KeyByIP)
+
+	a := requestKey(t, app, "1.2.3.4", `{"email":"a@example.com"}`)
+	if a != "ip:1.2.3.4" {
+		t.Errorf("key = %q, want ip:1.2.3.4", a)
+	}
+
+	// the body does not matter, only the address
+	if b := requestKey(t, app, "1.2.3.4", `{"email":"b@example.com"}`); b != a {
+		t.Errorf("same address, other email: key %q, want %q", b, a)
+	}
+
+	if c := requestKey(t, app, "5.6.7.8", `{"email":"a@example.com"}`); c == a {
+		t.Errorf("other address shares the key %q", c)
+	}
+}
+
+func TestKeyByEmail(t *testing.T) {
+	app := newKeyApp(KeyByEmail)
+
+	tests := []struct {
+		name string
+		ip   string
+		body string
+		want string
+	}{
+		{name: "email", ip: "1.2.3.4", body: `{"email":"a@example.com"}`, want: "email:a@example.com"},
+		{name: "other address", ip: "5.6.7.8", body: `{"email":"a@example.com"}`, want: "email:a@example.com"},
+		{name: "case and spaces", ip: "1.2.3.4", body: `{"email":"  A@Example.COM "}`, want: "email:a@example.com"},
+		{name: "other email", ip: "1.2.3.4", body: `{"email":"b@example.com"}`, want: "email:b@example.com"},
+		// empty keys fall back to the address in RateLimit
+		{name: "no email", ip: "1.2.3.4", body: `{"password":"secret"}`, want: ""},
+		{name: "not json", ip: "1.2.3.4", body: `email=a@example.com`, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := requestKey(t, app, tt.ip, tt.body); got != tt.want {
+				t.Errorf("key = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitSeparatesKeys(t *testing.T) {
+	store := ratelimit.NewMemoryStore(time.Hour)
+	limit := ratelimit.Limit{Requests: 1, Period: time.Hour}
+
+	app := fiber.New(fiber.Config{ProxyHeader: fiber.HeaderXForwardedFor})
+	ok := func(ctx *fiber.Ctx) error { return ctx.SendStatus(http.StatusNoContent) }
+	app.Post("/login", RateLimit(store, RateLimitPolicy{Name: "login", Limit: limit, Key: KeyByEmail}), ok)
+	app.Post("/register", RateLimit(store, RateLimitPolicy{Name: "register", Limit: limit, Key: KeyByIP}), ok)
+
+	tests := []struct {
+		name       string
+		path       string
+		ip         string
+		body       string
+		wantStatus int
+	}{
+		{name: "first login", path: "/login", ip: "1.2.3.4", body: `{"email":"a@example.com"}`, wantStatus: http.StatusNoContent},
+		{name: "same email from another address", path: "/login", ip: "5.6.7.8", body: `{"email":"A@example.com"}`, wantStatus: http.StatusTooManyRequests},
+		{name: "other email", path: "/login", ip: "1.2.3.4", body: `{"email":"b@example.com"}`, wantStatus: http.StatusNoContent},
+		{name: "no email, keyed by address", path: "/login", ip: "1.2.3.4", body: `{}`, wantStatus: http.StatusNoContent},
+		{name: "no email again", path: "/login", ip: "1.2.3.4", body: `{}`, wantStatus: http.StatusTooManyRequests},
+		{name: "other policy, same address", path: "/register", ip: "1.2.3.4", body: `{}`, wantStatus: http.StatusNoContent},
+		{name: "other policy again", path: "/register", ip: "1.2.3.4", body: `{}`, wantStatus: http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(fiber.HeaderXForwardedFor, tt.ip)
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("%s: status %d, want %d", tt.name, resp.StatusCode, tt.wantStatus)
+		}
+
+		// the wait is rounded up to whole seconds
+		if retryAfter := resp.Header.Get("Retry-After"); tt.wantStatus == http.StatusTooManyRequests && retryAfter != "3600" {
+			t.Errorf("%s: Retry-After %q, want 3600", tt.name, retryAfter)
+		}
+	}
+}
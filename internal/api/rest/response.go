@@ -1,6 +1,8 @@
 package rest
 
 import (
+	"go-ecommerce-app/internal/domain"
+	"go-ecommerce-app/internal/dto"
 	"net/http"
 
 	"github.com/gofiber/fiber/v2"
@@ -46,4 +48,22 @@ func SuccessCreated(ctx *fiber.Ctx, msg string, data any) error {
 
 func NoContentResponse(ctx *fiber.Ctx) error {
 	return ctx.Status(http.StatusNoContent).JSON(nil)
-}
\ No newline at end of file
+}
+
+func RequestMeta(ctx *fiber.Ctx) dto.RequestMeta {
+	meta := dto.RequestMeta{
+		IP:        ctx.IP(),
+		UserAgent: ctx.Get(fiber.HeaderUserAgent),
+	}
+
+	meta.RequestID, _ = ctx.Locals("requestid").(string)
+
+	if user, ok := ctx.Locals("user").(domain.User); ok {
+		meta.ActorID = user.ID
+		meta.ActorRole = user.UserType
+	}
+
+	_, meta.ApiKey = ctx.Locals("scopes").([]string)
+
+	return meta
+}
@@ -0,0 +1,248 @@
+package api
+
+import (
+	"encoding/json"
+	"go-ecommerce-app/internal/api/rest"
+	"go-ecommerce-app/internal/domain"
+	"go-ecommerce-app/internal/helper"
+	"go-ecommerce-app/internal/policy"
+	"go-ecommerce-app/pkg/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+)
+
+const (
+	// no credentials needed
+	public policy.Permission = "public"
+	// any signed in user, no permission checked
+	authenticated policy.Permission = "authenticated"
+)
+
+// routePermissions is what every route requires, a new route must be added here.
+var routePermissions = map[string]policy.Permission{
+	"GET /.well-known/jwks.json":                            public,
+	"GET /admin/audit-events/":                              policy.AuditRead,
+	"GET /admin/audit-events/export":                        policy.AuditRead,
+	"GET /admin/orders/:id":                                 policy.OrdersReadAny,
+	"PATCH /admin/orders/:id/status":                        policy.OrdersManage,
+	"GET /admin/reviews/":                                   policy.ReviewsModerate,
+	"DELETE /admin/reviews/:id":                             policy.ReviewsModerate,
+	"POST /admin/reviews/:id/approve":                       policy.ReviewsModerate,
+	"POST /admin/reviews/:id/reject":                        policy.ReviewsModerate,
+	"GET /admin/seller-applications/":                       policy.SellersReview,
+	"GET /admin/seller-applications/:id":                    policy.SellersReview,
+	"POST /admin/seller-applications/:id/approve":           policy.SellersReview,
+	"GET /admin/seller-applications/:id/documents/:docId":   policy.SellersReview,
+	"POST /admin/seller-applications/:id/reject":            policy.SellersReview,
+	"POST /admin/seller-applications/:id/review":            policy.SellersReview,
+	"DELETE /admin/users/:id":                               policy.UsersManage,
+	"POST /admin/users/:id/restore":                         policy.UsersManage,
+	"PATCH /admin/users/:id/role":                           policy.UsersManage,
+	"GET /auth/oidc/:provider/callback":                     public,
+	"POST /auth/oidc/:provider/callback":                    public,
+	"GET /auth/oidc/:provider/login":                        public,
+	"GET /categories":                                       public,
+	"GET /categories/:id":                                   public,
+	"GET /categories/:id/attributes":                        public,
+	"GET /categories/by-slug/:slug":                         public,
+	"GET /media/*":                                          public,
+	"GET /payment/":                                         policy.PaymentsCreate,
+	"GET /products":                                         public,
+	"GET /products/:id":                                     public,
+	"POST /products/:id/alerts":                             policy.CartManage,
+	"GET /products/:id/reviews":                             public,
+	"POST /products/:id/reviews":                            policy.ReviewsWrite,
+	"GET /products/by-slug/:slug":                           public,
+	"DELETE /reviews/:id":                                   policy.ReviewsWrite,
+	"DELETE /reviews/:id/helpful":                           policy.ReviewsWrite,
+	"PUT /reviews/:id/helpful":                              policy.ReviewsWrite,
+	"POST /reviews/:id/images":                              policy.ReviewsWrite,
+	"GET /seller/api-keys/":                                 policy.ApiKeysManage,
+	"POST /seller/api-keys/":                                policy.ApiKeysManage,
+	"DELETE /seller/api-keys/:id":                           policy.ApiKeysManage,
+	"POST /seller/categories":                               policy.CatalogCategoryManage,
+	"DELETE /seller/categories/:id":                         policy.CatalogCategoryManage,
+	"PATCH /seller/categories/:id":                          policy.CatalogCategoryManage,
+	"POST /seller/categories/:id/attributes":                policy.CatalogCategoryManage,
+	"DELETE /seller/categories/:id/attributes/:attributeId": policy.CatalogCategoryManage,
+	"PUT /seller/categories/:id/attributes/:attributeId":    policy.CatalogCategoryManage,
+	"GET /seller/orders":                                    policy.OrdersRead,
+	"GET /seller/orders/:id":                                policy.OrdersRead,
+	"PATCH /seller/orders/:id/status":                       policy.OrdersFulfil,
+	"GET /seller/products":                                  policy.CatalogProductRead,
+	"POST /seller/products":                                 policy.CatalogProductManage,
+	"DELETE /seller/products/:id":                           policy.CatalogProductManage,
+	"GET /seller/products/:id":                              policy.CatalogProductRead,
+	"PATCH /seller/products/:id":                            policy.CatalogProductManage,
+	"PUT /seller/products/:id":                              policy.CatalogProductManage,
+	"POST /seller/products/:id/images":                      policy.CatalogProductManage,
+	"DELETE /seller/products/:id/images/:imageId":           policy.CatalogProductManage,
+	"PUT /seller/products/:id/images/order":                 policy.CatalogProductManage,
+	"POST /seller/products/:id/inventory":                   policy.CatalogProductManage,
+	"GET /seller/products/:id/stock-history":                policy.CatalogProductRead,
+	"GET /seller/products/export":                           policy.CatalogProductRead,
+	"POST /seller/products/import":                          policy.CatalogProductManage,
+	"GET /seller/products/import/:jobId":                    policy.CatalogProductRead,
+	"POST /seller/reviews/:id/response":                     policy.CatalogProductManage,
+	"GET /seller/warehouses/":                               policy.CatalogProductRead,
+	"POST /seller/warehouses/":                              policy.CatalogProductManage,
+	"DELETE /seller/warehouses/:id":                         policy.CatalogProductManage,
+	"PUT /seller/warehouses/:id":                            policy.CatalogProductManage,
+	"POST /users/2fa/disable":                               authenticated,
+	"POST /users/2fa/enable":                                authenticated,
+	"POST /users/2fa/recovery-codes":                        authenticated,
+	"POST /users/2fa/setup":                                 authenticated,
+	"GET /users/addresses":                                  authenticated,
+	"POST /users/addresses":                                 authenticated,
+	"DELETE /users/addresses/:id":                           authenticated,
+	"GET /users/addresses/:id":                              authenticated,
+	"PATCH /users/addresses/:id":                            authenticated,
+	"POST /users/addresses/:id/default":                     authenticated,
+	"GET /users/alerts/":                                    policy.CartManage,
+	"DELETE /users/alerts/:id":                              policy.CartManage,
+	"POST /users/become-seller":                             policy.SellerApply,
+	"GET /users/cart":                                       policy.CartManage,
+	"POST /users/cart":                                      policy.CartManage,
+	"POST /users/cart/:id/save-for-later":                   policy.CartManage,
+	"POST /users/email":                                     authenticated,
+	"GET /users/email/confirm":                              public,
+	"POST /users/email/confirm":                             public,
+	"GET /users/identities/":                                authenticated,
+	"DELETE /users/identities/:id":                          authenticated,
+	"POST /users/identities/:provider/link":                 authenticated,
+	"POST /users/login":                                     public,
+	"POST /users/login/2fa":                                 public,
+	"DELETE /users/me/":                                     authenticated,
+	"GET /users/me/export":                                  authenticated,
+	"POST /users/me/restore":                                authenticated,
+	"GET /users/order":                                      policy.OrdersPlace,
+	"POST /users/order":                                     policy.OrdersPlace,
+	"GET /users/order/:id":                                  policy.OrdersPlace,
+	"POST /users/phone":                                     authenticated,
+	"POST /users/phone/confirm":                             authenticated,
+	"GET /users/profile":                                    authenticated,
+	"PATCH /users/profile":                                  authenticated,
+	"POST /users/profile":                                   authenticated,
+	"POST /users/register":                                  public,
+	"GET /users/saved-items":                                policy.CartManage,
+	"POST /users/saved-items/:id/move-to-cart":              policy.CartManage,
+	"GET /users/security/logins":                            authenticated,
+	"GET /users/seller-application/":                        policy.SellerApply,
+	"POST /users/seller-application/":                       policy.SellerApply,
+	"POST /users/seller-application/documents":              policy.SellerApply,
+	"GET /users/verify":                                     authenticated,
+	"POST /users/verify":                                    authenticated,
+	"GET /users/wishlists/":                                 policy.CartManage,
+	"POST /users/wishlists/":                                policy.CartManage,
+	"DELETE /users/wishlists/:id":                           policy.CartManage,
+	"GET /users/wishlists/:id":                              policy.CartManage,
+	"PATCH /users/wishlists/:id":                            policy.CartManage,
+	"POST /users/wishlists/:id/items":                       policy.CartManage,
+	"DELETE /users/wishlists/:id/items/:itemId":             policy.CartManage,
+	"POST /users/wishlists/:id/items/:itemId/move-to-cart":  policy.CartManage,
+	"GET /wishlists/shared/:token":                          public,
+}
+
+var (
+	routeParam        = regexp.MustCompile(`:[A-Za-z]+`)
+	missingPermission = regexp.MustCompile(`^missing permission (\S+)$`)
+)
+
+// TestRoutePermissions calls every registered route twice: without a token to
+// tell public routes apart, then as a user whose role grants nothing, which
+// policy.Require answers with the missing permission. The handlers of
+// authenticated routes run without a database and fail, which is recovered.
+func TestRoutePermissions(t *testing.T) {
+	keys, err := helper.LoadKeySet("", "", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth := helper.Auth{Secret: "secret", Keys: keys, Issuer: "test", Audience: "test"}
+
+	app := fiber.New()
+	app.Use(recover.New())
+	setupRoutes(&rest.RestHandler{
+		App:     app,
+		Auth:    auth,
+		Limiter: ratelimit.NewMemoryStore(time.Hour),
+	})
+
+	token, err := auth.GenerateToken(domain.User{ID: 1, Email: "nobody@example.com", UserType: "nobody"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]bool{}
+
+	for _, route := range app.GetRoutes(true) {
+		if route.Method == http.MethodHead {
+			continue
+		}
+
+		name := route.Method + " " + route.Path
+		seen[name] = true
+
+		want, ok := routePermissions[name]
+		if !ok {
+			t.Errorf("%s is not listed in routePermissions", name)
+			continue
+		}
+
+		if got := requiredPermission(t, app, route, token); got != want {
+			t.Errorf("%s requires %q, want %q", name, got, want)
+		}
+	}
+
+	for name := range routePermissions {
+		if !seen[name] {
+			t.Errorf("%s is listed in routePermissions but not registered", name)
+		}
+	}
+}
+
+func requiredPermission(t *testing.T, app *fiber.App, route fiber.Route, token string) policy.Permission {
+	path := strings.ReplaceAll(routeParam.ReplaceAllString(route.Path, "1"), "*", "file")
+
+	resp, err := app.Test(httptest.NewRequest(route.Method, path, nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		return public
+	}
+
+	req := httptest.NewRequest(route.Method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err = app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusForbidden {
+		return authenticated
+	}
+
+	var body struct {
+		Error string `json:"error"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	match := missingPermission.FindStringSubmatch(body.Error)
+	if match == nil {
+		t.Fatalf("%s %s: unexpected forbidden response %q", route.Method, route.Path, body.Error)
+	}
+
+	return policy.Permission(match[1])
+}
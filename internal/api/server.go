@@ -6,16 +6,35 @@ import (
 	"go-ecommerce-app/internal/api/rest/handlers"
 	"go-ecommerce-app/internal/domain"
 	"go-ecommerce-app/internal/helper"
+	"go-ecommerce-app/internal/repository"
+	"go-ecommerce-app/internal/service"
+	"go-ecommerce-app/pkg/blobstore"
+	"go-ecommerce-app/pkg/fieldcrypt"
+	"go-ecommerce-app/pkg/notification"
 	"go-ecommerce-app/pkg/payment"
+	"go-ecommerce-app/pkg/ratelimit"
 	"log"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
 func StartServer(config config.AppConfig) {
-	app := fiber.New()
+	app := fiber.New(fiber.Config{
+		BodyLimit: 32 << 20, // document and image uploads
+	})
+	// sets X-Request-ID, the id is stored with audit events
+	app.Use(requestid.New())
+
+	// encrypted columns need the keys before the first query
+	keys, err := fieldcrypt.NewLocalKeyProvider(config.EncryptionKeyFile, config.IsDevelopment())
+	if err != nil {
+		log.Fatalf("encryption keys setup failed: %v", err)
+	}
+	fieldcrypt.SetKeyProvider(keys)
 
 	// database
 	db, err := gorm.Open(postgres.Open(config.DSN), &gorm.Config{})
@@ -25,34 +44,122 @@ func StartServer(config config.AppConfig) {
 	log.Println("database connected...")
 
 	// migrations
+	if err = repository.MigrateLegacyAddresses(db); err != nil {
+		log.Fatalf("error migrations %v", err)
+	}
+
+	if err = repository.MigrateVerificationCodes(db); err != nil {
+		log.Fatalf("error migrations %v", err)
+	}
+
+	if err = repository.MigrateLegacyBankAccounts(db); err != nil {
+		log.Fatalf("error migrations %v", err)
+	}
+
 	if err = db.AutoMigrate(
 		&domain.User{},
 		&domain.Address{},
 		&domain.BankAccount{},
+		&domain.SellerApplication{},
+		&domain.SellerDocument{},
+		&domain.VerificationCode{},
+		&domain.LoginAttempt{},
+		&domain.RecoveryCode{},
+		&domain.UserIdentity{},
+		&domain.OAuthState{},
+		&domain.ApiKey{},
 		&domain.Category{},
+		&domain.CategoryAttribute{},
 		&domain.Product{},
+		&domain.ProductImage{},
+		&domain.ProductAttribute{},
+		&domain.SlugRedirect{},
+		&domain.ImportJob{},
+		&domain.Review{},
+		&domain.ReviewVote{},
+		&domain.Wishlist{},
+		&domain.WishlistItem{},
+		&domain.ProductAlert{},
+		&domain.ProductAlertChange{},
+		&domain.InventoryMovement{},
+		&domain.StockReservation{},
+		&domain.Warehouse{},
 		&domain.Cart{},
 		&domain.Order{},
 		&domain.OrderItem{},
+		&domain.OrderItemAllocation{},
 		&domain.Payment{},
+		&domain.AuditEvent{},
 	); err != nil {
 		log.Fatalf("error migrations %v", err)
 	}
+
+	if err = repository.MigrateUsers(db); err != nil {
+		log.Fatalf("error migrations %v", err)
+	}
+
+	if err = repository.MigrateSellers(db); err != nil {
+		log.Fatalf("error migrations %v", err)
+	}
+
+	promoted, err := repository.PromoteAdmins(db, config.AdminEmails)
+	if err != nil {
+		log.Fatalf("admin setup failed: %v", err)
+	}
+	if promoted > 0 {
+		log.Printf("made %d users admins", promoted)
+	}
+
+	if err = repository.MigrateAuditLog(db); err != nil {
+		log.Fatalf("error migrations %v", err)
+	}
+
+	if err = repository.MigrateCatalog(db); err != nil {
+		log.Fatalf("error migrations %v", err)
+	}
+
+	if err = repository.MigrateOrders(db); err != nil {
+		log.Fatalf("error migrations %v", err)
+	}
 	log.Println("migration successful")
 
-	auth := helper.SetupAuth(config.JWTSecret)
+	auth, err := helper.SetupAuth(config)
+	if err != nil {
+		log.Fatalf("auth setup failed: %v", err)
+	}
+	// tokens of deleted accounts stop working before they expire
+	auth.Revocations = repository.NewUserRepository(db)
 
 	paymentClient := payment.NewPaymentClient(config.StripeSecret, config.SuccessUrl, config.CancelUrl)
 
+	limiter := ratelimit.NewMemoryStore(10 * time.Minute)
+
+	blobs, err := newBlobStore(config)
+	if err != nil {
+		log.Fatalf("storage setup failed: %v", err)
+	}
+
+	// the catalog reports stock and price changes, the alerts go out in batches
+	alerts := service.NewAlertService(
+		repository.NewAlertRepository(db),
+		repository.NewCatalogRepository(db),
+		notification.NewNotificationClient(config),
+		config,
+	)
+
 	rh := &rest.RestHandler{
-		App:    app,
-		DB:     db,
-		Auth:   auth,
-		Config: config,
-		PC:     paymentClient,
+		App:     app,
+		DB:      db,
+		Auth:    auth,
+		Config:  config,
+		PC:      paymentClient,
+		Limiter: limiter,
+		Blobs:   blobs,
+		Alerts:  alerts,
 	}
 
 	setupRoutes(rh)
+	startJobs(rh)
 
 	if err := app.Listen(config.ServerPort); err != nil {
 		log.Fatal(err)
@@ -60,10 +167,46 @@ func StartServer(config config.AppConfig) {
 }
 
 func setupRoutes(rh *rest.RestHandler) {
+	// auth
+	handlers.SetupAuthRoutes(rh)
 	// user
 	handlers.SetupUserRoutes(rh)
 	// catalog
 	handlers.SetupCatalogRoutes(rh)
 	// transaction
 	handlers.SetupTransactionRoutes(rh)
+	// seller api keys
+	handlers.SetupApiKeyRoutes(rh)
+	// data export and account deletion
+	handlers.SetupPrivacyRoutes(rh)
+	// audit log
+	handlers.SetupAuditRoutes(rh)
+	// seller onboarding
+	handlers.SetupSellerRoutes(rh)
+	// product reviews
+	handlers.SetupReviewRoutes(rh)
+	// wishlists
+	handlers.SetupWishlistRoutes(rh)
+	// back in stock and price drop alerts
+	handlers.SetupAlertRoutes(rh)
+	// inventory ledger
+	handlers.SetupInventoryRoutes(rh)
+	// warehouses
+	handlers.SetupWarehouseRoutes(rh)
+	// uploaded images
+	handlers.SetupMediaRoutes(rh)
+}
+
+func newBlobStore(config config.AppConfig) (blobstore.BlobStore, error) {
+	if config.StorageDriver == "s3" {
+		return blobstore.NewS3Store(blobstore.S3Config{
+			Endpoint:        config.S3Endpoint,
+			Region:          config.S3Region,
+			Bucket:          config.S3Bucket,
+			AccessKeyID:     config.S3AccessKeyID,
+			SecretAccessKey: config.S3SecretAccessKey,
+		})
+	}
+
+	return blobstore.NewLocalStore(config.UploadsDir), nil
 }
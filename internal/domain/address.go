@@ -1,15 +1,36 @@
 package domain
 
-import "time"
+import (
+	"go-ecommerce-app/pkg/fieldcrypt"
+	"time"
+)
 
 type Address struct {
-	ID            uint      `json:"id"`
-	AddressInput1 string    `json:"address1"`
-	AddressInput2 string    `json:"address2"`
-	City          string    `json:"city"`
-	PostCode      uint      `json:"post_code"`
-	Country       string    `json:"country"`
-	UserID        uint      `json:"user_id"`
-	CreatedAt     time.Time `json:"created_at" gorm:"default:current_timestamp"`
-	UpdatedAt     time.Time `json:"updated_at" gorm:"default:current_timestamp"`
+	ID                uint              `json:"id"`
+	Label             string            `json:"label"`
+	AddressInput1     string            `json:"address1"`
+	AddressInput2     string            `json:"address2"`
+	City              string            `json:"city"`
+	PostCode          string            `json:"post_code"`
+	Subdivision       string            `json:"subdivision"`
+	Country           string            `json:"country" gorm:"size:2"`
+	Phone             fieldcrypt.Secret `json:"phone" gorm:"serializer:encrypted"`
+	IsDefaultShipping bool              `json:"is_default_shipping" gorm:"default:false"`
+	IsDefaultBilling  bool              `json:"is_default_billing" gorm:"default:false"`
+	UserID            uint              `json:"user_id" gorm:"index"`
+	CreatedAt         time.Time         `json:"created_at" gorm:"default:current_timestamp"`
+	UpdatedAt         time.Time         `json:"updated_at" gorm:"default:current_timestamp"`
+}
+
+// OrderAddress is a copy of the address taken when the order is placed, so later
+// edits of the address book do not rewrite order history.
+type OrderAddress struct {
+	Name          string            `json:"name"`
+	Phone         fieldcrypt.Secret `json:"phone" gorm:"serializer:encrypted"`
+	AddressInput1 string            `json:"address1"`
+	AddressInput2 string            `json:"address2"`
+	City          string            `json:"city"`
+	PostCode      string            `json:"post_code"`
+	Subdivision   string            `json:"subdivision"`
+	Country       string            `json:"country"`
 }
@@ -0,0 +1,25 @@
+package domain
+
+import "time"
+
+const (
+	ScopeProductsRead  = "products:read"
+	ScopeProductsWrite = "products:write"
+	ScopeOrdersRead    = "orders:read"
+)
+
+var ApiKeyScopes = []string{ScopeProductsRead, ScopeProductsWrite, ScopeOrdersRead}
+
+type ApiKey struct {
+	ID         uint       `json:"id" gorm:"PrimaryKey"`
+	UserID     uint       `json:"user_id" gorm:"index"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix" gorm:"uniqueIndex;not null"`
+	KeyHash    string     `json:"-" gorm:"not null"`
+	Scopes     []string   `json:"scopes" gorm:"serializer:json"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"default:current_timestamp"`
+	UpdatedAt  time.Time  `json:"updated_at" gorm:"default:current_timestamp"`
+}
@@ -0,0 +1,117 @@
+package domain
+
+import (
+	"go-ecommerce-app/pkg/fieldcrypt"
+	"time"
+)
+
+const (
+	AuditCategoryCreate = "category.create"
+	AuditCategoryUpdate = "category.update"
+	AuditCategoryDelete = "category.delete"
+
+	AuditCategoryAttributeCreate = "category.attribute_create"
+	AuditCategoryAttributeUpdate = "category.attribute_update"
+	AuditCategoryAttributeDelete = "category.attribute_delete"
+
+	AuditProductCreate = "product.create"
+	AuditProductUpdate = "product.update"
+	AuditProductStock  = "product.stock_update"
+	AuditProductDelete = "product.delete"
+
+	AuditProductImageAdd    = "product.image_add"
+	AuditProductImageDelete = "product.image_delete"
+	AuditProductImageOrder  = "product.image_reorder"
+
+	AuditSellerApply       = "seller_application.submit"
+	AuditSellerReview      = "seller_application.review"
+	AuditSellerApprove     = "seller_application.approve"
+	AuditSellerReject      = "seller_application.reject"
+	AuditBankAccountCreate = "bank_account.create"
+
+	AuditOrderStatus = "order.status_update"
+
+	AuditReviewApprove = "review.approve"
+	AuditReviewReject  = "review.reject"
+
+	AuditApiKeyCreate = "api_key.create"
+	AuditApiKeyRevoke = "api_key.revoke"
+
+	AuditTwoFactorEnable  = "user.2fa_enable"
+	AuditTwoFactorDisable = "user.2fa_disable"
+	AuditEmailChange      = "user.email_change"
+	AuditPhoneChange      = "user.phone_change"
+
+	AuditRoleChange = "user.role_update"
+
+	AuditDeletionRequest = "user.deletion_request"
+	AuditDeletionCancel  = "user.deletion_cancel"
+	AuditAccountDelete   = "user.anonymize"
+)
+
+type AuditChange struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// AuditPersonalFields are masked in the recorded changes, the log is kept for
+// good and can't be scrubbed when the account is deleted.
+var AuditPersonalFields = map[string]bool{
+	"email":               true,
+	"first_name":          true,
+	"last_name":           true,
+	"phone":               true,
+	"address1":            true,
+	"address2":            true,
+	"city":                true,
+	"post_code":           true,
+	"account_holder":      true,
+	"bank_account":        true,
+	"routing_number":      true,
+	"swift_code":          true,
+	"tax_id":              true,
+	"registration_number": true,
+	"business_name":       true,
+}
+
+// MaskAuditChanges masks the personal fields of the changes, nested objects included.
+func MaskAuditChanges(changes map[string]AuditChange) {
+	for key, change := range changes {
+		changes[key] = AuditChange{From: maskAuditValue(key, change.From), To: maskAuditValue(key, change.To)}
+	}
+}
+
+func maskAuditValue(key string, value any) any {
+	switch v := value.(type) {
+	case string:
+		if AuditPersonalFields[key] {
+			return fieldcrypt.Mask(v)
+		}
+	case map[string]any:
+		for k, nested := range v {
+			v[k] = maskAuditValue(k, nested)
+		}
+	case []any:
+		for i, nested := range v {
+			v[i] = maskAuditValue(key, nested)
+		}
+	}
+
+	return value
+}
+
+// AuditEvent rows are never updated or deleted, a database trigger rejects it.
+type AuditEvent struct {
+	ID           uint                   `json:"id" gorm:"PrimaryKey"`
+	ActorID      uint                   `json:"actor_id" gorm:"index"`
+	ActorRole    string                 `json:"actor_role"`
+	ApiKey       bool                   `json:"api_key"`
+	Action       string                 `json:"action" gorm:"index;not null"`
+	ResourceType string                 `json:"resource_type" gorm:"index:idx_audit_resource"`
+	ResourceID   string                 `json:"resource_id" gorm:"index:idx_audit_resource"`
+	Changes      map[string]AuditChange `json:"changes" gorm:"serializer:json"`
+	IP           fieldcrypt.Secret      `json:"-" gorm:"column:client_ip;serializer:encrypted"`
+	IPHash       string                 `json:"ip_hash" gorm:"index"` // blind index of the IP, for filtering
+	RequestID    string                 `json:"request_id" gorm:"index"`
+	CreatedAt    time.Time              `json:"created_at" gorm:"index;default:current_timestamp"`
+}
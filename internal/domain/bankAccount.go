@@ -1,13 +1,22 @@
 package domain
 
-import "time"
+import (
+	"go-ecommerce-app/pkg/fieldcrypt"
+	"time"
+)
 
 type BankAccount struct {
-	ID          uint      `json:"id" gorm:"PrimaryKey"`
-	UserID      uint      `json:"user_id"`
-	BankAccount uint      `json:"bank_account" gorm:"index;unique;not null"`
-	SwiftCode   string    `json:"switf_code"`
-	PaymentType string    `json:"payment_type"`
-	CreatedAt   time.Time `json:"created_at" gorm:"default:current_timestamp"`
-	UpdatedAt   time.Time `json:"updated_at" gorm:"default:current_timestamp"`
+	ID            uint              `json:"id" gorm:"PrimaryKey"`
+	UserID        uint              `json:"user_id" gorm:"index"`
+	AccountHolder string            `json:"account_holder"`
+	BankAccount   fieldcrypt.Secret `json:"bank_account" gorm:"serializer:encrypted;not null"` // iban, or the domestic account number
+	AccountIndex  string            `json:"-" gorm:"index"`                                    // blind index of BankAccount
+	RoutingNumber fieldcrypt.Secret `json:"routing_number" gorm:"serializer:encrypted"`
+	SwiftCode     fieldcrypt.Secret `json:"swift_code" gorm:"serializer:encrypted"`
+	Country       string            `json:"country" gorm:"size:2"`
+	PaymentType   string            `json:"payment_type"`
+	Verified      bool              `json:"verified" gorm:"default:false"`
+	VerifiedAt    *time.Time        `json:"verified_at"`
+	CreatedAt     time.Time         `json:"created_at" gorm:"default:current_timestamp"`
+	UpdatedAt     time.Time         `json:"updated_at" gorm:"default:current_timestamp"`
 }
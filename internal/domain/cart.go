@@ -3,14 +3,15 @@ package domain
 import "time"
 
 type Cart struct {
-	ID        uint      `gorm:"PrimaryKey" json:"id"`
-	UserID    uint      `json:"user_id"`
-	ProductID uint      `json:"product_id"`
-	Name      string    `json:"name"`
-	ImageUrl  string    `json:"image_url"`
-	SellerID  uint      `json:"seller_id"`
-	Price     float64   `json:"price"`
-	Qty       uint      `json:"qty"`
-	CreatedAt time.Time `gorm:"default:current_timestamp"`
-	UpdatedAt time.Time `gorm:"default:current_timestamp"`
+	ID            uint      `gorm:"PrimaryKey" json:"id"`
+	UserID        uint      `json:"user_id"`
+	ProductID     uint      `json:"product_id"`
+	Name          string    `json:"name"`
+	ImageUrl      string    `json:"image_url"`
+	SellerID      uint      `json:"seller_id"`
+	Price         float64   `json:"price"`
+	Qty           uint      `json:"qty"`
+	SavedForLater bool      `json:"saved_for_later" gorm:"default:false"` // kept out of checkout
+	CreatedAt     time.Time `gorm:"default:current_timestamp"`
+	UpdatedAt     time.Time `gorm:"default:current_timestamp"`
 }
@@ -5,6 +5,8 @@ import "time"
 type Category struct {
 	ID           uint      `json:"id" gorm:"PrimaryKey"`
 	Name         string    `json:"name" gorm:"index;"`
+	Slug         string    `json:"slug" gorm:"size:100;uniqueIndex:idx_category_slug,where:slug <> ''"`
+	CanonicalUrl string    `json:"canonical_url" gorm:"-"`
 	ParentID     string    `json:"parent_id"`
 	ImageUrl     string    `json:"image_url"`
 	Products     []Product `json:"products"`
@@ -0,0 +1,39 @@
+package domain
+
+import "time"
+
+const (
+	AttributeText    = "text"
+	AttributeNumber  = "number"
+	AttributeBoolean = "boolean"
+	AttributeEnum    = "enum" // text limited to Options
+)
+
+// CategoryAttribute is a field of the attribute schema of a category, the
+// products of the category hold typed values for it.
+type CategoryAttribute struct {
+	ID         uint      `json:"id" gorm:"PrimaryKey"`
+	CategoryID uint      `json:"category_id" gorm:"uniqueIndex:idx_category_attribute_key;not null"`
+	Key        string    `json:"key" gorm:"size:50;uniqueIndex:idx_category_attribute_key;not null"`
+	Name       string    `json:"name" gorm:"size:100;not null"`
+	Type       string    `json:"type" gorm:"size:20;not null"`
+	Unit       string    `json:"unit" gorm:"size:20"`
+	Options    []string  `json:"options" gorm:"serializer:json"`
+	Required   bool      `json:"required"`
+	Filterable bool      `json:"filterable"` // listed in the facets of /products
+	Position   int       `json:"position"`
+	CreatedAt  time.Time `json:"created_at" gorm:"default:current_timestamp"`
+	UpdatedAt  time.Time `json:"updated_at" gorm:"default:current_timestamp"`
+}
+
+// ProductAttribute is the value of a product for an attribute of its category,
+// the column of the attribute type is set.
+type ProductAttribute struct {
+	ID          uint     `json:"-" gorm:"PrimaryKey"`
+	ProductID   uint     `json:"-" gorm:"uniqueIndex:idx_product_attribute;not null"`
+	AttributeID uint     `json:"attribute_id" gorm:"index;not null"`
+	Key         string   `json:"key" gorm:"size:50;uniqueIndex:idx_product_attribute;not null"`
+	TextValue   *string  `json:"text_value,omitempty"`
+	NumberValue *float64 `json:"number_value,omitempty" gorm:"index"`
+	BoolValue   *bool    `json:"bool_value,omitempty"`
+}
@@ -0,0 +1,37 @@
+package domain
+
+import "time"
+
+const (
+	ImportPending   = "pending"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed" // interrupted, e.g. by a restart
+)
+
+type ImportRowError struct {
+	Row     int    `json:"row"` // line of the file, the csv header is line 1
+	Sku     string `json:"sku,omitempty"`
+	Message string `json:"message"`
+}
+
+// ImportJob tracks a bulk product import, a dry run validates the rows
+// without writing products.
+type ImportJob struct {
+	ID         uint             `json:"id" gorm:"PrimaryKey"`
+	UserID     uint             `json:"user_id" gorm:"index"`
+	Format     string           `json:"format"`
+	DryRun     bool             `json:"dry_run"`
+	Status     string           `json:"status" gorm:"index"`
+	TotalRows  int              `json:"total_rows"`
+	Processed  int              `json:"processed"`
+	Created    int              `json:"created"`
+	Updated    int              `json:"updated"`
+	Failed     int              `json:"failed"`
+	Errors     []ImportRowError `json:"errors" gorm:"serializer:json"`
+	Message    string           `json:"message,omitempty"` // why the job failed
+	StartedAt  *time.Time       `json:"started_at"`
+	FinishedAt *time.Time       `json:"finished_at"`
+	CreatedAt  time.Time        `json:"created_at" gorm:"default:current_timestamp"`
+	UpdatedAt  time.Time        `json:"updated_at" gorm:"default:current_timestamp"`
+}
@@ -0,0 +1,63 @@
+package domain
+
+import "time"
+
+const (
+	MovementReceipt     = "receipt"
+	MovementSale        = "sale"
+	MovementReturn      = "return"
+	MovementAdjustment  = "adjustment"
+	MovementReservation = "reservation"
+	MovementRelease     = "release"
+)
+
+const (
+	ReservationActive   = "active"
+	ReservationReleased = "released"
+	ReservationConsumed = "consumed"
+)
+
+// InventoryMovement is an entry of the append only stock ledger of a product.
+// On hand stock is the sum of OnHandDelta, reserved stock the sum of
+// ReservedDelta, Product.Stock caches the available difference.
+type InventoryMovement struct {
+	ID            uint      `json:"id" gorm:"PrimaryKey"`
+	ProductID     uint      `json:"product_id" gorm:"index:idx_movement_product;not null"`
+	WarehouseID   *uint     `json:"warehouse_id,omitempty" gorm:"index"` // nil for the unassigned pool
+	Kind          string    `json:"kind" gorm:"size:20;not null"`
+	OnHandDelta   int       `json:"on_hand_delta"`
+	ReservedDelta int       `json:"reserved_delta"`
+	ReservationID *uint     `json:"reservation_id,omitempty" gorm:"index"`
+	Reference     string    `json:"reference"` // order or payment the movement belongs to
+	ActorID       uint      `json:"actor_id"`
+	Note          string    `json:"note"`
+	CreatedAt     time.Time `json:"created_at" gorm:"index:idx_movement_product;default:current_timestamp"`
+}
+
+// StockReservation holds stock for a checkout until the order is placed or
+// the reservation expires.
+type StockReservation struct {
+	ID        uint      `json:"id" gorm:"PrimaryKey"`
+	ProductID uint      `json:"product_id" gorm:"index;not null"`
+	UserID    uint      `json:"user_id" gorm:"index;not null"`
+	Reference string    `json:"reference" gorm:"index"`
+	Qty       int       `json:"qty"`
+	Status    string    `json:"status" gorm:"index;default:active"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt time.Time `json:"created_at" gorm:"default:current_timestamp"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"default:current_timestamp"`
+}
+
+type StockLevel struct {
+	OnHand    int `json:"on_hand"`
+	Reserved  int `json:"reserved"`
+	Available int `json:"available"`
+}
+
+// LocationStock is the on hand stock of a product in a warehouse, reservations
+// are held on the product and allocated to a location when the order is placed.
+type LocationStock struct {
+	ProductID   uint  `json:"product_id"`
+	WarehouseID *uint `json:"warehouse_id"`
+	OnHand      int   `json:"on_hand"`
+}
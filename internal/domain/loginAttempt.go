@@ -0,0 +1,13 @@
+package domain
+
+import "time"
+
+type LoginAttempt struct {
+	ID        uint      `json:"id" gorm:"PrimaryKey"`
+	UserID    uint      `json:"user_id" gorm:"index"`
+	Email     string    `json:"-" gorm:"index"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Success   bool      `json:"success"`
+	CreatedAt time.Time `json:"created_at" gorm:"index;default:current_timestamp"`
+}
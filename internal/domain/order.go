@@ -2,15 +2,33 @@ package domain
 
 import "time"
 
+const (
+	OrderStatusPending   = "pending"
+	OrderStatusPaid      = "paid"
+	OrderStatusShipped   = "shipped"
+	OrderStatusDelivered = "delivered"
+	OrderStatusCancelled = "cancelled"
+)
+
+// OrderStatusTransitions lists the statuses an order can move to.
+var OrderStatusTransitions = map[string][]string{
+	OrderStatusPending: {OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusPaid:    {OrderStatusShipped, OrderStatusCancelled},
+	OrderStatusShipped: {OrderStatusDelivered},
+}
+
 type Order struct {
-	ID             uint        `gorm:"PrimaryKey" json:"id"`
-	UserID         uint        `json:"user_id"`
-	Status         string      `json:"status"`
-	Amount         float64     `json:"amount"`
-	TransactionID  string      `json:"transaction_id"`
-	OrderRefNumber string      `json:"order_ref_number"`
-	PaymentID      string      `json:"payment_id"`
-	Items          []OrderItem `json:"items"`
-	CreatedAt      time.Time   `gorm:"default:current_timestamp"`
-	UpdatedAt      time.Time   `gorm:"default:current_timestamp"`
+	ID              uint         `gorm:"PrimaryKey" json:"id"`
+	UserID          uint         `json:"user_id"`
+	Status          string       `json:"status" gorm:"index;default:pending"`
+	Amount          float64      `json:"amount"`
+	TransactionID   string       `json:"transaction_id"`
+	OrderRefNumber  string       `json:"order_ref_number"`
+	PaymentID       string       `json:"payment_id"`
+	ShippingAddress OrderAddress `json:"shipping_address" gorm:"embedded;embeddedPrefix:shipping_"`
+	BillingAddress  OrderAddress `json:"billing_address" gorm:"embedded;embeddedPrefix:billing_"`
+	Items           []OrderItem  `json:"items"`
+	DeliveredAt     *time.Time   `json:"delivered_at"`
+	CreatedAt       time.Time    `gorm:"default:current_timestamp"`
+	UpdatedAt       time.Time    `gorm:"default:current_timestamp"`
 }
@@ -11,6 +11,7 @@ type OrderItem struct {
 	SellerID  uint      `json:"seller_id"`
 	Price     float64    `json:"price"`
 	Qty       uint      `json:"qty"`
+	Allocations []OrderItemAllocation `json:"allocations"` // warehouses the item ships from
 	CreatedAt time.Time `gorm:"default:current_timestamp"`
 	UpdatedAt time.Time `gorm:"default:current_timestamp"`
 }
@@ -1,16 +1,41 @@
 package domain
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// product lifecycle, only active products are listed and sold
+const (
+	ProductStatusDraft     = "draft"
+	ProductStatusActive    = "active"
+	ProductStatusScheduled = "scheduled" // becomes active at PublishAt
+	ProductStatusArchived  = "archived"
+)
 
 type Product struct {
-	ID          uint      `json:"id" gorm:"PrimaryKey"`
-	Name        string    `json:"name" gorm:"index;"`
-	Description string    `json:"description"`
-	CategoryID  uint      `json:"category_id"`
-	ImageUrl    string    `json:"image_url"`
-	Price       float64   `json:"price"`
-	UserID      uint      `json:"user_id"`
-	Stock       uint      `json:"stock"`
-	CreatedAt   time.Time `json:"created_at" gorm:"default:current_timestamp"`
-	UpdatedAt   time.Time `json:"updated_at" gorm:"default:current_timestamp"`
+	ID           uint               `json:"id" gorm:"PrimaryKey"`
+	Name         string             `json:"name" gorm:"index;"`
+	Slug         string             `json:"slug" gorm:"size:100;uniqueIndex:idx_product_slug,where:slug <> '' AND deleted_at IS NULL"`
+	CanonicalUrl string             `json:"canonical_url" gorm:"-"`
+	Description  string             `json:"description"`
+	CategoryID   uint               `json:"category_id"`
+	ImageUrl     string             `json:"image_url"`
+	Price        float64            `json:"price"`
+	UserID       uint               `json:"user_id" gorm:"uniqueIndex:idx_product_seller_live_sku,where:sku <> '' AND deleted_at IS NULL"`
+	Sku          string             `json:"sku" gorm:"size:64;uniqueIndex:idx_product_seller_live_sku,where:sku <> '' AND deleted_at IS NULL"` // unique per seller when set
+	Stock        uint               `json:"stock"`
+	Images       []ProductImage     `json:"images"`
+	Attributes   []ProductAttribute `json:"attributes"` // values for the attribute schema of the category
+	Status       string             `json:"status" gorm:"size:20;index;default:active"`
+	PublishAt    *time.Time         `json:"publish_at"`
+	UnpublishAt  *time.Time         `json:"unpublish_at"` // active products are archived at this time
+	// approved reviews, kept up to date by the review service
+	RatingAverage float64   `json:"rating_average" gorm:"default:0"`
+	RatingCount   int       `json:"rating_count" gorm:"default:0"`
+	CreatedAt     time.Time `json:"created_at" gorm:"default:current_timestamp"`
+	UpdatedAt     time.Time `json:"updated_at" gorm:"default:current_timestamp"`
+	// deleted products stay referenced by carts, wishlists and orders
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 }
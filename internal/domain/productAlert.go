@@ -0,0 +1,30 @@
+package domain
+
+import "time"
+
+const (
+	AlertBackInStock = "back_in_stock"
+	AlertPriceDrop   = "price_drop"
+)
+
+// ProductAlert subscribes a user to a product. Back in stock alerts are sent
+// once, price drop alerts whenever the price goes below the last notified one.
+type ProductAlert struct {
+	ID                uint       `json:"id" gorm:"PrimaryKey"`
+	UserID            uint       `json:"user_id" gorm:"uniqueIndex:idx_alert_user_product_kind;not null"`
+	ProductID         uint       `json:"product_id" gorm:"uniqueIndex:idx_alert_user_product_kind;index;not null"`
+	Kind              string     `json:"kind" gorm:"uniqueIndex:idx_alert_user_product_kind;size:20;not null"`
+	TargetPrice       float64    `json:"target_price"` // price drop only, 0 alerts on any drop
+	LastNotifiedPrice float64    `json:"last_notified_price"`
+	LastNotifiedAt    *time.Time `json:"last_notified_at"`
+	CreatedAt         time.Time  `json:"created_at" gorm:"default:current_timestamp"`
+}
+
+// ProductAlertChange queues the alert work of a changed product until the next
+// batch, repeated changes are merged into the one row.
+type ProductAlertChange struct {
+	ProductID   uint      `json:"product_id" gorm:"PrimaryKey;autoIncrement:false"`
+	BackInStock bool      `json:"back_in_stock" gorm:"not null;default:false"`
+	PriceDrop   bool      `json:"price_drop" gorm:"not null;default:false"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
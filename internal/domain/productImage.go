@@ -0,0 +1,19 @@
+package domain
+
+import "time"
+
+// ProductImage is an uploaded picture of a product, Urls holds the original
+// and the generated sizes keyed by size name.
+type ProductImage struct {
+	ID          uint              `json:"id" gorm:"PrimaryKey"`
+	ProductID   uint              `json:"product_id" gorm:"index;not null"`
+	Position    int               `json:"position"`
+	ContentType string            `json:"content_type"`
+	Width       int               `json:"width"`
+	Height      int               `json:"height"`
+	Size        int64             `json:"size"`
+	Checksum    string            `json:"checksum"`
+	StorageKeys []string          `json:"-" gorm:"serializer:json"`
+	Urls        map[string]string `json:"urls" gorm:"serializer:json"`
+	CreatedAt   time.Time         `json:"created_at" gorm:"default:current_timestamp"`
+}
@@ -0,0 +1,11 @@
+package domain
+
+import "time"
+
+type RecoveryCode struct {
+	ID        uint       `json:"id" gorm:"PrimaryKey"`
+	UserID    uint       `json:"user_id" gorm:"index"`
+	CodeHash  string     `json:"-" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at" gorm:"default:current_timestamp"`
+}
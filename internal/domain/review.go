@@ -0,0 +1,40 @@
+package domain
+
+import "time"
+
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+// Review of a product by a buyer with a delivered order of it. Only approved
+// reviews are listed and counted in the product rating.
+type Review struct {
+	ID               uint                `json:"id" gorm:"PrimaryKey"`
+	ProductID        uint                `json:"product_id" gorm:"uniqueIndex:idx_review_product_user;not null"`
+	UserID           uint                `json:"user_id" gorm:"uniqueIndex:idx_review_product_user;not null"`
+	OrderItemID      uint                `json:"-"`
+	VerifiedPurchase bool                `json:"verified_purchase"`
+	Rating           int                 `json:"rating" gorm:"not null"`
+	Title            string              `json:"title"`
+	Body             string              `json:"body"`
+	Images           []map[string]string `json:"images" gorm:"serializer:json"` // urls by size
+	ImageKeys        []string            `json:"-" gorm:"serializer:json"`
+	HelpfulCount     int                 `json:"helpful_count" gorm:"default:0"`
+	Status           string              `json:"status" gorm:"index;default:pending"`
+	ModeratorID      uint                `json:"moderator_id,omitempty"`
+	RejectionReason  string              `json:"rejection_reason,omitempty"`
+	ModeratedAt      *time.Time          `json:"moderated_at"`
+	SellerResponse   string              `json:"seller_response"`
+	RespondedAt      *time.Time          `json:"responded_at"`
+	CreatedAt        time.Time           `json:"created_at" gorm:"default:current_timestamp"`
+	UpdatedAt        time.Time           `json:"updated_at" gorm:"default:current_timestamp"`
+}
+
+// ReviewVote marks a review as helpful, one vote per user.
+type ReviewVote struct {
+	ReviewID  uint      `json:"review_id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at" gorm:"default:current_timestamp"`
+}
@@ -0,0 +1,72 @@
+package domain
+
+import (
+	"go-ecommerce-app/pkg/fieldcrypt"
+	"time"
+)
+
+const (
+	ApplicationSubmitted   = "submitted"
+	ApplicationUnderReview = "under_review"
+	ApplicationApproved    = "approved"
+	ApplicationRejected    = "rejected"
+)
+
+const (
+	BusinessIndividual = "individual"
+	BusinessCompany    = "company"
+)
+
+const (
+	DocumentIdentity             = "identity"
+	DocumentBusinessRegistration = "business_registration"
+	DocumentProofOfAddress       = "proof_of_address"
+	DocumentBankStatement        = "bank_statement"
+)
+
+var SellerDocumentTypes = []string{
+	DocumentIdentity,
+	DocumentBusinessRegistration,
+	DocumentProofOfAddress,
+	DocumentBankStatement,
+}
+
+type SellerApplication struct {
+	ID                 uint              `json:"id" gorm:"PrimaryKey"`
+	UserID             uint              `json:"user_id" gorm:"index"`
+	Status             string            `json:"status" gorm:"index;default:submitted"`
+	FirstName          string            `json:"first_name"`
+	LastName           string            `json:"last_name"`
+	BusinessName       string            `json:"business_name"`
+	BusinessType       string            `json:"business_type"`
+	RegistrationNumber string            `json:"registration_number"`
+	TaxID              fieldcrypt.Secret `json:"tax_id" gorm:"serializer:encrypted"`
+	Website            string            `json:"website"`
+	AddressInput1      string            `json:"address1"`
+	AddressInput2      string            `json:"address2"`
+	City               string            `json:"city"`
+	PostCode           string            `json:"post_code"`
+	Subdivision        string            `json:"subdivision"`
+	Country            string            `json:"country" gorm:"size:2"`
+	BankAccountID      uint              `json:"bank_account_id"`
+	BankAccount        BankAccount       `json:"bank_account"` // relation
+	Documents          []SellerDocument  `json:"documents" gorm:"foreignKey:ApplicationID"`
+	ReviewerID         uint              `json:"reviewer_id"`
+	RejectionReason    string            `json:"rejection_reason"`
+	ReviewedAt         *time.Time        `json:"reviewed_at"`
+	CreatedAt          time.Time         `json:"created_at" gorm:"default:current_timestamp"`
+	UpdatedAt          time.Time         `json:"updated_at" gorm:"default:current_timestamp"`
+}
+
+// SellerDocument is a KYC upload, the file itself is kept out of the database.
+type SellerDocument struct {
+	ID            uint      `json:"id" gorm:"PrimaryKey"`
+	ApplicationID uint      `json:"application_id" gorm:"index"`
+	Type          string    `json:"type"`
+	FileName      string    `json:"file_name"`
+	ContentType   string    `json:"content_type"`
+	Size          int64     `json:"size"`
+	Checksum      string    `json:"checksum"` // sha256
+	StoragePath   string    `json:"-"`        // blob store key
+	CreatedAt     time.Time `json:"created_at" gorm:"default:current_timestamp"`
+}
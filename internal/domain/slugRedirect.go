@@ -0,0 +1,18 @@
+package domain
+
+import "time"
+
+const (
+	SlugProduct  = "product"
+	SlugCategory = "category"
+)
+
+// SlugRedirect keeps a former slug of a product or category, lookups by it
+// redirect to the current slug.
+type SlugRedirect struct {
+	ID           uint      `json:"id" gorm:"PrimaryKey"`
+	ResourceType string    `json:"resource_type" gorm:"size:20;uniqueIndex:idx_slug_redirect;not null"`
+	Slug         string    `json:"slug" gorm:"size:100;uniqueIndex:idx_slug_redirect;not null"`
+	ResourceID   uint      `json:"resource_id" gorm:"index;not null"`
+	CreatedAt    time.Time `json:"created_at" gorm:"default:current_timestamp"`
+}
@@ -1,27 +1,39 @@
 package domain
 
-import "time"
+import (
+	"go-ecommerce-app/pkg/fieldcrypt"
+	"time"
+)
 
 const (
 	SELLER = "seller"
 	BUYER  = "buyer"
+	ADMIN  = "admin"
 )
 
 type User struct {
-	ID        uint      `json:"id" gorm:"PrimaryKey"`
-	FirstName string    `json:"first_name"`
-	LastName  string    `json:"last_name"`
-	Email     string    `json:"email" gorm:"index;unique;not null"`
-	Phone     string    `json:"phone"`
-	Password  string    `json:"password"`
-	Code      string    `json:"code"`
-	Expiry    time.Time `json:"expiry"`
-	Address   Address   `json:"address"` // relation
-	Cart      Cart      `json:"cart"`    // relation
-	Orders    []Order   `json:"order"`   // relation
-	Payment   []Payment `json:"payment"` // relation
-	Verified  bool      `json:"verified" gorm:"default:false"`
-	UserType  string    `json:"user_type" gorm:"default:buyer"`
-	CreatedAt time.Time `json:"created_at" gorm:"default:current_timestamp"`
-	UpdatedAt time.Time `json:"updated_at" gorm:"default:current_timestamp"`
+	ID                uint              `json:"id" gorm:"PrimaryKey"`
+	FirstName         string            `json:"first_name"`
+	LastName          string            `json:"last_name"`
+	Email             string            `json:"email" gorm:"index;unique;not null"`
+	Phone             fieldcrypt.Secret `json:"phone" gorm:"serializer:encrypted"`
+	Password          string            `json:"-"`
+	Addresses         []Address         `json:"addresses"` // relation
+	Cart              Cart              `json:"cart"`      // relation
+	Orders            []Order           `json:"order"`     // relation
+	Payment           []Payment         `json:"payment"`   // relation
+	Verified          bool              `json:"verified" gorm:"default:false"`
+	UserType          string            `json:"user_type" gorm:"default:buyer"`
+	TwoFactorEnabled  bool              `json:"two_factor_enabled" gorm:"default:false"`
+	TwoFactorSecret   fieldcrypt.Secret `json:"-" gorm:"serializer:encrypted"`
+	TwoFactorLastStep int64             `json:"-"`
+	TwoFactorDueAt    *time.Time        `json:"two_factor_due_at,omitempty"` // end of the enrolment grace period
+	DeletionDueAt     *time.Time        `json:"deletion_due_at,omitempty" gorm:"index"`
+	AnonymizedAt      *time.Time        `json:"anonymized_at,omitempty"`
+	TokensRevokedAt   *time.Time        `json:"-"` // access tokens issued until then are rejected
+	CreatedAt         time.Time         `json:"created_at" gorm:"default:current_timestamp"`
+	UpdatedAt         time.Time         `json:"updated_at" gorm:"default:current_timestamp"`
+
+	// set from the access token, the session passed two-factor authentication
+	SessionMFA bool `json:"-" gorm:"-"`
 }
@@ -0,0 +1,26 @@
+package domain
+
+import "time"
+
+type UserIdentity struct {
+	ID        uint      `json:"id" gorm:"PrimaryKey"`
+	UserID    uint      `json:"user_id" gorm:"index"`
+	Provider  string    `json:"provider" gorm:"uniqueIndex:idx_identity_provider_subject;not null"`
+	Subject   string    `json:"-" gorm:"uniqueIndex:idx_identity_provider_subject;not null"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at" gorm:"default:current_timestamp"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"default:current_timestamp"`
+}
+
+// OAuthState keeps the PKCE verifier and nonce of a pending authorization request.
+type OAuthState struct {
+	ID        uint      `gorm:"PrimaryKey"`
+	State     string    `gorm:"uniqueIndex;not null"`
+	Provider  string    `gorm:"not null"`
+	Verifier  string    `gorm:"not null"`
+	Nonce     string    `gorm:"not null"`
+	UserID    uint      // set when linking a provider to a signed in user
+	Binding   string    `gorm:"not null;default:''"` // hash of the browser cookie that started the request
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time `gorm:"default:current_timestamp"`
+}
@@ -0,0 +1,25 @@
+package domain
+
+import (
+	"go-ecommerce-app/pkg/fieldcrypt"
+	"time"
+)
+
+const (
+	PurposeVerifyPhone = "verify_phone"
+	PurposeChangePhone = "change_phone"
+	PurposeChangeEmail = "change_email"
+)
+
+type VerificationCode struct {
+	ID          uint              `json:"id" gorm:"PrimaryKey"`
+	UserID      uint              `json:"user_id" gorm:"index"`
+	Purpose     string            `json:"purpose" gorm:"index"`
+	Target      fieldcrypt.Secret `json:"-" gorm:"serializer:encrypted"` // phone or email the code was sent to
+	TargetIndex string            `json:"-" gorm:"index"`                // blind index of Target
+	CodeHash    string            `json:"-" gorm:"index;not null"`
+	Attempts    int               `json:"attempts" gorm:"default:0"`
+	ExpiresAt   time.Time         `json:"expires_at"`
+	UsedAt      *time.Time        `json:"used_at"`
+	CreatedAt   time.Time         `json:"created_at" gorm:"default:current_timestamp"`
+}
@@ -0,0 +1,31 @@
+package domain
+
+import "time"
+
+// Warehouse is a location a seller ships from. Stock without a warehouse is
+// kept in the unassigned pool of the product.
+type Warehouse struct {
+	ID            uint      `json:"id" gorm:"PrimaryKey"`
+	UserID        uint      `json:"user_id" gorm:"index;not null"`
+	Name          string    `json:"name" gorm:"size:100;not null"`
+	AddressInput1 string    `json:"address1"`
+	AddressInput2 string    `json:"address2"`
+	City          string    `json:"city"`
+	PostCode      string    `json:"post_code"`
+	Subdivision   string    `json:"subdivision"`
+	Country       string    `json:"country" gorm:"size:2"`
+	Priority      int       `json:"priority" gorm:"default:0"` // lower ships first among equally near locations
+	Active        bool      `json:"active" gorm:"not null"`
+	CreatedAt     time.Time `json:"created_at" gorm:"default:current_timestamp"`
+	UpdatedAt     time.Time `json:"updated_at" gorm:"default:current_timestamp"`
+}
+
+// OrderItemAllocation is the part of an order item shipped from a warehouse,
+// WarehouseID is nil for the unassigned pool.
+type OrderItemAllocation struct {
+	ID          uint      `json:"id" gorm:"PrimaryKey"`
+	OrderItemID uint      `json:"order_item_id" gorm:"index;not null"`
+	WarehouseID *uint     `json:"warehouse_id" gorm:"index"`
+	Qty         uint      `json:"qty"`
+	CreatedAt   time.Time `json:"created_at" gorm:"default:current_timestamp"`
+}
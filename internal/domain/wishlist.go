@@ -0,0 +1,29 @@
+package domain
+
+import "time"
+
+// Wishlist is a named list of products of a user, public lists can be opened
+// by anyone with the share token.
+type Wishlist struct {
+	ID         uint           `json:"id" gorm:"PrimaryKey"`
+	UserID     uint           `json:"user_id" gorm:"index;not null"`
+	Name       string         `json:"name" gorm:"size:100;not null"`
+	IsPublic   bool           `json:"is_public" gorm:"default:false"`
+	ShareToken string         `json:"-" gorm:"size:40;uniqueIndex:idx_wishlist_share_token,where:share_token <> ''"`
+	Items      []WishlistItem `json:"items"`
+	CreatedAt  time.Time      `json:"created_at" gorm:"default:current_timestamp"`
+	UpdatedAt  time.Time      `json:"updated_at" gorm:"default:current_timestamp"`
+}
+
+// WishlistItem keeps the price of the product when it was saved to show
+// price drops later.
+type WishlistItem struct {
+	ID         uint      `json:"id" gorm:"PrimaryKey"`
+	WishlistID uint      `json:"wishlist_id" gorm:"uniqueIndex:idx_wishlist_product;not null"`
+	ProductID  uint      `json:"product_id" gorm:"uniqueIndex:idx_wishlist_product;not null"`
+	Name       string    `json:"name"`
+	ImageUrl   string    `json:"image_url"`
+	SellerID   uint      `json:"seller_id"`
+	SavedPrice float64   `json:"saved_price"`
+	CreatedAt  time.Time `json:"created_at" gorm:"default:current_timestamp"`
+}
@@ -0,0 +1,6 @@
+package dto
+
+type CreateAlertRequest struct {
+	Kind        string  `json:"kind"`
+	TargetPrice float64 `json:"target_price"`
+}
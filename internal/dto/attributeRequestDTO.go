@@ -0,0 +1,38 @@
+package dto
+
+type CategoryAttributeRequest struct {
+	Key        string   `json:"key"`
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	Unit       string   `json:"unit"`
+	Options    []string `json:"options"`
+	Required   bool     `json:"required"`
+	Filterable bool     `json:"filterable"`
+	Position   int      `json:"position"`
+}
+
+// ProductQuery is the query of the product listing, Attributes holds the
+// attr.<key>, attr.<key>.min and attr.<key>.max parameters without the prefix.
+type ProductQuery struct {
+	Sort       string
+	CategoryID uint
+	Attributes map[string]string
+}
+
+// ProductFilter is a product query checked against the attribute schema.
+type ProductFilter struct {
+	Sort       string
+	CategoryID uint
+	Attributes []AttributeFilter
+}
+
+// AttributeFilter matches the products with any of the values, or a number
+// within Min and Max.
+type AttributeFilter struct {
+	Key    string
+	Type   string
+	Values []string
+	Bool   *bool
+	Min    *float64
+	Max    *float64
+}
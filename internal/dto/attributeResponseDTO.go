@@ -0,0 +1,29 @@
+package dto
+
+type FacetValue struct {
+	Value any   `json:"value"`
+	Count int64 `json:"count"`
+}
+
+// AttributeFacet counts the listed products by their values of the
+// attribute, numbers report their range instead.
+type AttributeFacet struct {
+	Key    string       `json:"key"`
+	Name   string       `json:"name"`
+	Type   string       `json:"type"`
+	Unit   string       `json:"unit,omitempty"`
+	Count  int64        `json:"count"`
+	Values []FacetValue `json:"values,omitempty"`
+	Min    *float64     `json:"min,omitempty"`
+	Max    *float64     `json:"max,omitempty"`
+}
+
+type CategoryFacet struct {
+	CategoryID uint  `json:"category_id"`
+	Count      int64 `json:"count"`
+}
+
+type ProductFacets struct {
+	Categories []CategoryFacet  `json:"categories"`
+	Attributes []AttributeFacet `json:"attributes"`
+}
@@ -0,0 +1,35 @@
+package dto
+
+import (
+	"go-ecommerce-app/internal/domain"
+	"time"
+)
+
+type AuditEventFilter struct {
+	ActorID      uint      `query:"actor_id"`
+	Action       string    `query:"action"`
+	ResourceType string    `query:"resource_type"`
+	ResourceID   string    `query:"resource_id"`
+	RequestID    string    `query:"request_id"`
+	IP           string    `query:"ip"`
+	From         time.Time `query:"-"`
+	To           time.Time `query:"-"`
+	Page         int       `query:"page"`
+	Limit        int       `query:"limit"`
+}
+
+// AuditEventDetails is an event as admins see it, with the client IP in plain text.
+type AuditEventDetails struct {
+	ID           uint                          `json:"id"`
+	ActorID      uint                          `json:"actor_id"`
+	ActorRole    string                        `json:"actor_role"`
+	ApiKey       bool                          `json:"api_key"`
+	Action       string                        `json:"action"`
+	ResourceType string                        `json:"resource_type"`
+	ResourceID   string                        `json:"resource_id"`
+	Changes      map[string]domain.AuditChange `json:"changes"`
+	IP           string                        `json:"ip"`
+	IPHash       string                        `json:"ip_hash"`
+	RequestID    string                        `json:"request_id"`
+	CreatedAt    time.Time                     `json:"created_at"`
+}
@@ -2,6 +2,7 @@ package dto
 
 type CreateCategoryRequest struct {
 	Name         string `json:"name"`
+	Slug         string `json:"slug"` // made from the name when empty
 	ParentID     int   `json:"parent_id"`
 	ImageUrl     string `json:"image_url"`
 	DisplayOrder int    `json:"display_order"`
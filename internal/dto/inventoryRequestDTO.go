@@ -0,0 +1,38 @@
+package dto
+
+import "go-ecommerce-app/internal/domain"
+
+type StockMovementRequest struct {
+	Kind        string `json:"kind"`
+	Quantity    int    `json:"quantity"`
+	WarehouseID *uint  `json:"warehouse_id"`
+	Note        string `json:"note"`
+}
+
+type StockHistoryFilter struct {
+	Page  int `query:"page"`
+	Limit int `query:"limit"`
+}
+
+// StockItem is a quantity of a product to reserve or sell, sold items name
+// the warehouse they ship from.
+type StockItem struct {
+	ProductID   uint
+	WarehouseID *uint
+	Qty         int
+}
+
+// StockChange is the stock of a product before and after a ledger update.
+type StockChange struct {
+	ProductID uint
+	Before    domain.StockLevel
+	After     domain.StockLevel
+}
+
+// StockHistory is a page of the ledger of a product with its current stock.
+type StockHistory struct {
+	Stock     domain.StockLevel
+	Locations []domain.LocationStock
+	Movements []domain.InventoryMovement
+	Total     int64
+}
@@ -0,0 +1,84 @@
+package dto
+
+import (
+	"go-ecommerce-app/internal/domain"
+	"time"
+)
+
+type DeleteAccountInput struct {
+	Password     string `json:"password"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type AdminDeleteUserInput struct {
+	Immediate bool `json:"immediate"`
+}
+
+// UserExport is everything the store keeps about a user. Encrypted fields
+// are written in plain text, the rest of the api shows them masked.
+type UserExport struct {
+	ExportedAt   time.Time             `json:"exported_at"`
+	Profile      ExportProfile         `json:"profile"`
+	Addresses    []ExportAddress       `json:"addresses"`
+	Orders       []ExportOrder         `json:"orders"`
+	Payments     []domain.Payment      `json:"payments"`
+	LoginHistory []domain.LoginAttempt `json:"login_history"`
+	Identities   []domain.UserIdentity `json:"identities"`
+	Wishlists    []domain.Wishlist     `json:"wishlists"`
+}
+
+type ExportProfile struct {
+	ID               uint       `json:"id"`
+	FirstName        string     `json:"first_name"`
+	LastName         string     `json:"last_name"`
+	Email            string     `json:"email"`
+	Phone            string     `json:"phone"`
+	Verified         bool       `json:"verified"`
+	UserType         string     `json:"user_type"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	DeletionDueAt    *time.Time `json:"deletion_due_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+type ExportAddress struct {
+	ID                uint      `json:"id"`
+	Label             string    `json:"label"`
+	AddressInput1     string    `json:"address1"`
+	AddressInput2     string    `json:"address2"`
+	City              string    `json:"city"`
+	PostCode          string    `json:"post_code"`
+	Subdivision       string    `json:"subdivision"`
+	Country           string    `json:"country"`
+	Phone             string    `json:"phone"`
+	IsDefaultShipping bool      `json:"is_default_shipping"`
+	IsDefaultBilling  bool      `json:"is_default_billing"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+type ExportOrder struct {
+	ID              uint               `json:"id"`
+	Status          string             `json:"status"`
+	Amount          float64            `json:"amount"`
+	TransactionID   string             `json:"transaction_id"`
+	OrderRefNumber  string             `json:"order_ref_number"`
+	PaymentID       string             `json:"payment_id"`
+	ShippingAddress ExportOrderAddress `json:"shipping_address"`
+	BillingAddress  ExportOrderAddress `json:"billing_address"`
+	Items           []domain.OrderItem `json:"items"`
+	DeliveredAt     *time.Time         `json:"delivered_at"`
+	CreatedAt       time.Time          `json:"created_at"`
+}
+
+type ExportOrderAddress struct {
+	Name          string `json:"name"`
+	Phone         string `json:"phone"`
+	AddressInput1 string `json:"address1"`
+	AddressInput2 string `json:"address2"`
+	City          string `json:"city"`
+	PostCode      string `json:"post_code"`
+	Subdivision   string `json:"subdivision"`
+	Country       string `json:"country"`
+}
@@ -1,14 +1,43 @@
 package dto
 
+import "time"
+
 type CreateProductRequest struct {
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	CategoryID  uint    `json:"category_id"`
-	ImageUrl    string  `json:"image_url"`
-	Price       float64 `json:"price"`
-	Stock       int     `json:"stock"`
+	Name        string     `json:"name"`
+	Slug        string     `json:"slug"` // made from the name when empty
+	Sku         string     `json:"sku"`
+	Description string     `json:"description"`
+	CategoryID  uint       `json:"category_id"`
+	ImageUrl    string     `json:"image_url"`
+	Price       float64    `json:"price"`
+	Stock       int        `json:"stock"`
+	Status      string     `json:"status"` // new products are drafts unless set
+	PublishAt   *time.Time `json:"publish_at"`
+	UnpublishAt *time.Time `json:"unpublish_at"`
+	// values by attribute key, validated against the category schema. Edits
+	// change the given keys only, null removes a value.
+	Attributes map[string]any `json:"attributes"`
 }
 
 type UpdateStockRequest struct {
 	Stock int `json:"stock"`
 }
+
+type ReorderImagesRequest struct {
+	ImageIDs []uint `json:"image_ids"`
+}
+
+// ProductImportRow is one line of an import file, nil fields keep the current
+// value of an existing product.
+type ProductImportRow struct {
+	Sku         string   `json:"sku"`
+	Name        *string  `json:"name"`
+	Description *string  `json:"description"`
+	CategoryID  *uint    `json:"category_id"`
+	ImageUrl    *string  `json:"image_url"`
+	Price       *float64 `json:"price"`
+	Stock       *int     `json:"stock"`
+	Status      *string  `json:"status"` // new products are drafts unless set
+	// values by attribute key of the category, jsonl files only
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
@@ -0,0 +1,10 @@
+package dto
+
+type RequestMeta struct {
+	IP        string
+	UserAgent string
+	RequestID string
+	ActorID   uint // zero on public endpoints
+	ActorRole string
+	ApiKey    bool // the actor authenticated with a seller api key
+}
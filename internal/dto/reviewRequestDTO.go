@@ -0,0 +1,22 @@
+package dto
+
+type CreateReviewRequest struct {
+	Rating int    `json:"rating"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+}
+
+type ReviewResponseRequest struct {
+	Response string `json:"response"`
+}
+
+type RejectReviewRequest struct {
+	Reason string `json:"reason"`
+}
+
+type ReviewFilter struct {
+	Status string `query:"status"`
+	Sort   string `query:"sort"` // newest, oldest, helpful, rating_desc or rating_asc
+	Page   int    `query:"page"`
+	Limit  int    `query:"limit"`
+}
@@ -0,0 +1,32 @@
+package dto
+
+type PayoutAccountInput struct {
+	AccountHolder string `json:"account_holder"`
+	IBAN          string `json:"iban"`
+	AccountNumber string `json:"account_number"`
+	RoutingNumber string `json:"routing_number"`
+	SwiftCode     string `json:"swift_code"`
+	Country       string `json:"country"`
+	PaymentType   string `json:"payment_type"`
+}
+
+type SellerApplicationInput struct {
+	FirstName          string             `json:"first_name"`
+	LastName           string             `json:"last_name"`
+	BusinessType       string             `json:"business_type"`
+	BusinessName       string             `json:"business_name"`
+	RegistrationNumber string             `json:"registration_number"`
+	TaxID              string             `json:"tax_id"`
+	Website            string             `json:"website"`
+	AddressInput1      string             `json:"address1"`
+	AddressInput2      string             `json:"address2"`
+	City               string             `json:"city"`
+	PostCode           string             `json:"post_code"`
+	Subdivision        string             `json:"subdivision"`
+	Country            string             `json:"country"`
+	PayoutAccount      PayoutAccountInput `json:"payout_account"`
+}
+
+type RejectApplicationInput struct {
+	Reason string `json:"reason"`
+}
@@ -4,3 +4,12 @@ type CreateCartRequest struct {
 	ProductID uint `json:"product_id"`
 	Qty       uint `json:"qty"`
 }
+
+type CreateOrderRequest struct {
+	ShippingAddressID uint `json:"shipping_address_id"`
+	BillingAddressID  uint `json:"billing_address_id"`
+}
+
+type OrderStatusRequest struct {
+	Status string `json:"status"`
+}
@@ -14,21 +14,38 @@ type VerificationCodeInput struct {
 	Code string `json:"code"`
 }
 
-type SellerInput struct {
-	FirstName         string `json:"first_name"`
-	LastName          string `json:"last_name"`
-	Phone             string `json:"phone"`
-	BankAccountNumber uint   `json:"bank_account_number"`
-	SwiftCode         string `json:"swift_code"`
-	PaymentType       string `json:"payment_type"`
+type TwoFactorCodeInput struct {
+	Code string `json:"code"`
+}
+
+type TwoFactorLoginInput struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+}
+
+type LoginResult struct {
+	Token             string `json:"token,omitempty"`
+	TwoFactorRequired bool   `json:"two_factor_required,omitempty"`
+	ChallengeToken    string `json:"challenge_token,omitempty"`
 }
 
 type AddressInput struct {
-	AddressInput1 string `json:"address1"`
-	AddressInput2 string `json:"address2"`
-	City          string `json:"city"`
-	PostCode      uint   `json:"post_code"`
-	Country       string `json:"country"`
+	Label             string `json:"label"`
+	AddressInput1     string `json:"address1"`
+	AddressInput2     string `json:"address2"`
+	City              string `json:"city"`
+	PostCode          string `json:"post_code"`
+	Subdivision       string `json:"subdivision"`
+	Country           string `json:"country"`
+	Phone             string `json:"phone"`
+	IsDefaultShipping bool   `json:"is_default_shipping"`
+	IsDefaultBilling  bool   `json:"is_default_billing"`
+}
+
+type DefaultAddressInput struct {
+	Shipping bool `json:"shipping"`
+	Billing  bool `json:"billing"`
 }
 
 type ProfileInput struct {
@@ -36,3 +53,20 @@ type ProfileInput struct {
 	LastName     string       `json:"last_name"`
 	AddressInput AddressInput `json:"address"`
 }
+
+type ChangeEmailInput struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type ConfirmEmailInput struct {
+	Token string `json:"token" form:"token"`
+}
+
+type ChangePhoneInput struct {
+	Phone string `json:"phone"`
+}
+
+type ChangeRoleInput struct {
+	Role string `json:"role"`
+}
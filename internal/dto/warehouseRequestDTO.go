@@ -0,0 +1,13 @@
+package dto
+
+type WarehouseInput struct {
+	Name          string `json:"name"`
+	AddressInput1 string `json:"address1"`
+	AddressInput2 string `json:"address2"`
+	City          string `json:"city"`
+	PostCode      string `json:"post_code"`
+	Subdivision   string `json:"subdivision"`
+	Country       string `json:"country"`
+	Priority      *int   `json:"priority"`
+	Active        *bool  `json:"active"`
+}
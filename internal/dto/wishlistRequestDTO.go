@@ -0,0 +1,19 @@
+package dto
+
+type CreateWishlistRequest struct {
+	Name     string `json:"name"`
+	IsPublic bool   `json:"is_public"`
+}
+
+type UpdateWishlistRequest struct {
+	Name     *string `json:"name"`
+	IsPublic *bool   `json:"is_public"`
+}
+
+type AddWishlistItemRequest struct {
+	ProductID uint `json:"product_id"`
+}
+
+type MoveToCartRequest struct {
+	Qty uint `json:"qty"`
+}
@@ -0,0 +1,37 @@
+package dto
+
+import (
+	"go-ecommerce-app/internal/domain"
+	"time"
+)
+
+// PriceDrop compares the price when an item was saved with the current price
+// of the product, Available is false once the product is gone.
+type PriceDrop struct {
+	CurrentPrice     float64 `json:"current_price"`
+	PriceDrop        float64 `json:"price_drop"`
+	PriceDropPercent float64 `json:"price_drop_percent"`
+	PriceDropped     bool    `json:"price_dropped"`
+	Available        bool    `json:"available"`
+}
+
+type WishlistItemDetails struct {
+	domain.WishlistItem
+	PriceDrop
+}
+
+type WishlistDetails struct {
+	ID        uint                  `json:"id"`
+	UserID    uint                  `json:"user_id,omitempty"`
+	Name      string                `json:"name"`
+	IsPublic  bool                  `json:"is_public"`
+	ShareUrl  string                `json:"share_url,omitempty"`
+	Items     []WishlistItemDetails `json:"items"`
+	CreatedAt time.Time             `json:"created_at"`
+	UpdatedAt time.Time             `json:"updated_at"`
+}
+
+type SavedItemDetails struct {
+	domain.Cart
+	PriceDrop
+}
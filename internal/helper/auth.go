@@ -1,10 +1,14 @@
 package helper
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
-	"fmt"
+	"go-ecommerce-app/config"
 	"go-ecommerce-app/internal/domain"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,14 +17,57 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	purposeTwoFactor  = "2fa"
+	accessTokenTTL    = 30 * 24 * time.Hour
+	challengeTokenTTL = 5 * time.Minute
+	tokenLeeway       = 30 * time.Second
+)
+
 type Auth struct {
-	Secret string
+	Secret         string // hashes one-time codes, tokens are signed with Keys
+	Keys           *KeySet
+	Issuer         string
+	Audience       string
+	TwoFactorRoles []string
+	Revocations    TokenRevocations // optional, tokens are not checked for revocation without it
 }
 
-func SetupAuth(secret string) Auth {
-	return Auth{
-		Secret: secret,
+// TokenRevocations reports since when the access tokens of a user are revoked.
+type TokenRevocations interface {
+	TokensRevokedAt(userID uint) (*time.Time, error)
+}
+
+// APIKeyVerifier resolves a seller api key to its owner and granted scopes.
+type APIKeyVerifier interface {
+	VerifyAPIKey(key string) (domain.User, []string, error)
+}
+
+type Claims struct {
+	UserID  uint   `json:"user_id"`
+	Email   string `json:"email,omitempty"`
+	Role    string `json:"role,omitempty"`
+	MFA     bool   `json:"mfa,omitempty"`
+	Purpose string `json:"purpose,omitempty"`
+	// when the two-factor policy starts to apply to the session, set on every
+	// token of a role the policy covers
+	MFADue *jwt.NumericDate `json:"mfa_due,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func SetupAuth(config config.AppConfig) (Auth, error) {
+	keys, err := LoadKeySet(config.JWTKeysDir, config.JWTPrivateKey, config.JWTSigningKeyID, config.IsDevelopment())
+	if err != nil {
+		return Auth{}, err
 	}
+
+	return Auth{
+		Secret:         config.JWTSecret,
+		Keys:           keys,
+		Issuer:         config.JWTIssuer,
+		Audience:       config.JWTAudience,
+		TwoFactorRoles: config.TwoFactorRoles,
+	}, nil
 }
 
 func (a Auth) GenerateHashedPassword(password string) (string, error) {
@@ -36,19 +83,47 @@ func (a Auth) GenerateHashedPassword(password string) (string, error) {
 	return string(hashed), nil
 }
 
-func (a Auth) GenerateToken(id uint, email, role string) (string, error) {
-	if id == 0 || email == "" || role == "" {
+// GenerateToken issues an access token; mfa marks a session that passed two-factor authentication.
+func (a Auth) GenerateToken(user domain.User, mfa bool) (string, error) {
+	if user.ID == 0 || user.Email == "" || user.UserType == "" {
 		return "", errors.New("required input are missing")
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": id,
-		"email":   email,
-		"role":    role,
-		"exp":     time.Now().Add(time.Hour * 24 * 30).Unix(),
-	})
+	claims := Claims{
+		UserID: user.ID,
+		Email:  user.Email,
+		Role:   user.UserType,
+		MFA:    mfa,
+	}
+
+	if a.RequiresTwoFactor(user.UserType) {
+		due := time.Now()
+		if user.TwoFactorDueAt != nil {
+			due = *user.TwoFactorDueAt
+		}
+		claims.MFADue = jwt.NewNumericDate(due)
+	}
+
+	return a.signToken(claims, accessTokenTTL)
+}
+
+func (a Auth) signToken(claims Claims, ttl time.Duration) (string, error) {
+	now := time.Now()
+	key := a.Keys.Signing()
 
-	tokenStr, err := token.SignedString([]byte(a.Secret))
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    a.Issuer,
+		Subject:   strconv.FormatUint(uint64(claims.UserID), 10),
+		Audience:  jwt.ClaimStrings{a.Audience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+
+	tokenStr, err := token.SignedString(key.Private)
 	if err != nil {
 		return "", errors.New("signed token failed")
 	}
@@ -56,6 +131,40 @@ func (a Auth) GenerateToken(id uint, email, role string) (string, error) {
 	return tokenStr, nil
 }
 
+// parseToken verifies signature, kid, iss, aud, exp and nbf.
+func (a Auth) parseToken(t string) (*Claims, error) {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods(a.Keys.Methods()),
+		jwt.WithIssuer(a.Issuer),
+		jwt.WithAudience(a.Audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(tokenLeeway),
+	)
+
+	claims := &Claims{}
+
+	_, err := parser.ParseWithClaims(t, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+
+		key, ok := a.Keys.Key(kid)
+		if !ok {
+			return nil, errors.New("unknown signing key")
+		}
+
+		if t.Method.Alg() != key.Method.Alg() {
+			return nil, errors.New("unexpected signing method")
+		}
+
+		return key.Public, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
 func (a Auth) VerifyPassword(password, hashedPassword string) error {
 	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 	if err != nil {
@@ -75,30 +184,39 @@ func (a Auth) VerifyToken(t string) (domain.User, error) {
 		return domain.User{}, errors.New("invalid token")
 	}
 
-	token, err := jwt.Parse(tokenArr[1], func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unknow signing method: %v", t.Header)
-		}
-		return []byte(a.Secret), nil
-	})
+	claims, err := a.parseToken(tokenArr[1])
 	if err != nil {
-		return domain.User{}, errors.New("invalid signing method")
-	}
-
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		if float64(time.Now().Unix()) > claims["exp"].(float64) {
+		if errors.Is(err, jwt.ErrTokenExpired) {
 			return domain.User{}, errors.New("token is expired")
 		}
+		return domain.User{}, errors.New("token verification failed")
+	}
 
-		user := domain.User{}
-		user.ID = uint(claims["user_id"].(float64))
-		user.Email = claims["email"].(string)
-		user.UserType = claims["role"].(string)
+	// challenge tokens are only valid for the second login step
+	if claims.Purpose != "" || claims.UserID == 0 {
+		return domain.User{}, errors.New("invalid token")
+	}
+
+	if a.Revocations != nil {
+		revokedAt, err := a.Revocations.TokensRevokedAt(claims.UserID)
+		if err != nil {
+			return domain.User{}, errors.New("token verification failed")
+		}
+		if revokedAt != nil && (claims.IssuedAt == nil || !claims.IssuedAt.After(*revokedAt)) {
+			return domain.User{}, errors.New("token is revoked")
+		}
+	}
 
-		return user, nil
+	user := domain.User{}
+	user.ID = claims.UserID
+	user.Email = claims.Email
+	user.UserType = claims.Role
+	user.SessionMFA = claims.MFA
+	if claims.MFADue != nil {
+		user.TwoFactorDueAt = &claims.MFADue.Time
 	}
 
-	return domain.User{}, errors.New("token verification failed")
+	return user, nil
 }
 
 func (a Auth) Authorize(ctx *fiber.Ctx) error {
@@ -131,8 +249,52 @@ func (a Auth) GenerateCode() (string, error) {
 	return RandomNumbers(6)
 }
 
-// Seller
-func (a Auth) AuthorizeSeller(ctx *fiber.Ctx) error {
+// HashCode returns a keyed hash of a one-time code so it is never stored in plaintext.
+func (a Auth) HashCode(code string) string {
+	mac := hmac.New(sha256.New, []byte(a.Secret))
+	mac.Write([]byte(code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyCode compares a one-time code against its stored hash in constant time.
+func (a Auth) VerifyCode(code, hashedCode string) bool {
+	return hmac.Equal([]byte(a.HashCode(code)), []byte(hashedCode))
+}
+
+// GenerateChallengeToken issues a short lived token that proves the password step of a two-factor login.
+func (a Auth) GenerateChallengeToken(id uint) (string, error) {
+	return a.signToken(Claims{
+		UserID:  id,
+		Purpose: purposeTwoFactor,
+	}, challengeTokenTTL)
+}
+
+func (a Auth) VerifyChallengeToken(t string) (uint, error) {
+	claims, err := a.parseToken(t)
+	if err != nil || claims.Purpose != purposeTwoFactor || claims.UserID == 0 {
+		return 0, errors.New("invalid or expired challenge token")
+	}
+
+	return claims.UserID, nil
+}
+
+// RequiresTwoFactor reports whether the two-factor policy applies to the role.
+func (a Auth) RequiresTwoFactor(role string) bool {
+	for _, r := range a.TwoFactorRoles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AuthorizePrivileged authenticates seller and admin areas. It also enforces the
+// two-factor policy, which Authorize does not so users can still enroll. Until
+// the grace period of the user ends the session is let through with an
+// X-Two-Factor-Due header, tokens issued before the policy carry no due date
+// and pass until they expire. Permissions are checked by policy.Require.
+func (a Auth) AuthorizePrivileged(ctx *fiber.Ctx) error {
 	authHeader := ctx.GetReqHeaders()["Authorization"]
 
 	if authHeader == nil {
@@ -142,19 +304,45 @@ func (a Auth) AuthorizeSeller(ctx *fiber.Ctx) error {
 	}
 
 	user, err := a.VerifyToken(authHeader[0])
-
-	if err != nil {
+	if err != nil || user.ID == 0 {
 		return ctx.Status(http.StatusUnauthorized).JSON(&fiber.Map{
 			"message": "authorization failed",
 			"error":   err,
 		})
-	} else if user.ID > 0 && user.UserType == domain.SELLER {
+	}
+
+	if a.RequiresTwoFactor(user.UserType) && !user.SessionMFA && user.TwoFactorDueAt != nil {
+		if time.Now().After(*user.TwoFactorDueAt) {
+			return ctx.Status(http.StatusForbidden).JSON(&fiber.Map{
+				"message": "two-factor authentication is required for " + user.UserType + " accounts",
+			})
+		}
+		ctx.Set("X-Two-Factor-Due", user.TwoFactorDueAt.UTC().Format(time.RFC3339))
+	}
+
+	ctx.Locals("user", user)
+	return ctx.Next()
+}
+
+// AuthorizePrivilegedOrKey also accepts a seller api key sent in the X-Api-Key
+// header. Api key requests are limited to the permissions of their scopes.
+func (a Auth) AuthorizePrivilegedOrKey(keys APIKeyVerifier) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		apiKey := ctx.Get("X-Api-Key")
+		if apiKey == "" {
+			return a.AuthorizePrivileged(ctx)
+		}
+
+		user, scopes, err := keys.VerifyAPIKey(apiKey)
+		if err != nil {
+			return ctx.Status(http.StatusUnauthorized).JSON(&fiber.Map{
+				"message": "authorization failed",
+				"error":   err.Error(),
+			})
+		}
+
 		ctx.Locals("user", user)
+		ctx.Locals("scopes", scopes)
 		return ctx.Next()
-	} else {
-		return ctx.Status(http.StatusUnauthorized).JSON(&fiber.Map{
-			"message": "authorization failed",
-			"error":   errors.New("please join seller program to manage products"),
-		})
 	}
 }
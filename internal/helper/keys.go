@@ -0,0 +1,236 @@
+package helper
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+// KeySet holds the key tokens are signed with plus every key that is still
+// accepted for verification, so retired keys keep working until their tokens expire.
+type KeySet struct {
+	signing *SigningKey
+	keys    map[string]*SigningKey
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// LoadKeySet reads <kid>.pem files from dir (private keys, or public keys of
+// retired signing keys) and an optional inline PEM private key. The signing key is
+// signingKeyID, or the only private key found. Without any keys an ephemeral
+// Ed25519 key is generated if allowEphemeral is set, which only suits local
+// development: every restart and every other instance would reject the tokens.
+func LoadKeySet(dir, inlinePEM, signingKeyID string, allowEphemeral bool) (*KeySet, error) {
+	ks := &KeySet{keys: map[string]*SigningKey{}}
+
+	if dir != "" {
+		files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+		if err != nil {
+			return nil, err
+		}
+
+		sort.Strings(files)
+
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+
+			kid := strings.TrimSuffix(filepath.Base(file), ".pem")
+			key, err := parseKey(kid, data)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %w", file, err)
+			}
+
+			ks.keys[kid] = key
+		}
+	}
+
+	if inlinePEM != "" {
+		kid := signingKeyID
+		if kid == "" {
+			kid = "default"
+		}
+
+		key, err := parseKey(kid, []byte(inlinePEM))
+		if err != nil {
+			return nil, fmt.Errorf("inline key: %w", err)
+		}
+
+		ks.keys[kid] = key
+	}
+
+	if len(ks.keys) == 0 {
+		if !allowEphemeral {
+			return nil, errors.New("no jwt signing keys configured, set JWT_KEYS_DIR or JWT_PRIVATE_KEY")
+		}
+
+		log.Println("no jwt signing keys configured, using an ephemeral key")
+
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+
+		key := &SigningKey{ID: "ephemeral", Method: jwt.SigningMethodEdDSA, Private: private, Public: private.Public()}
+		ks.keys[key.ID] = key
+		ks.signing = key
+
+		return ks, nil
+	}
+
+	if signingKeyID != "" {
+		key, ok := ks.keys[signingKeyID]
+		if !ok || key.Private == nil {
+			return nil, fmt.Errorf("signing key %q not found", signingKeyID)
+		}
+		ks.signing = key
+
+		return ks, nil
+	}
+
+	for _, key := range ks.keys {
+		if key.Private == nil {
+			continue
+		}
+		if ks.signing != nil {
+			return nil, errors.New("multiple private keys found, please set the signing key id")
+		}
+		ks.signing = key
+	}
+
+	if ks.signing == nil {
+		return nil, errors.New("no private signing key found")
+	}
+
+	return ks, nil
+}
+
+func parseKey(kid string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid pem data")
+	}
+
+	key := &SigningKey{ID: kid}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("unsupported private key")
+		}
+		key.Private = signer
+		key.Public = signer.Public()
+	case "RSA PRIVATE KEY":
+		parsed, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key.Private = parsed
+		key.Public = parsed.Public()
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key.Public = parsed
+	default:
+		return nil, fmt.Errorf("unsupported pem block %q", block.Type)
+	}
+
+	switch key.Public.(type) {
+	case *rsa.PublicKey:
+		key.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, errors.New("only RSA and Ed25519 keys are supported")
+	}
+
+	return key, nil
+}
+
+func (ks *KeySet) Signing() *SigningKey {
+	return ks.signing
+}
+
+func (ks *KeySet) Key(kid string) (*SigningKey, bool) {
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+func (ks *KeySet) Methods() []string {
+	methods := map[string]bool{}
+	for _, key := range ks.keys {
+		methods[key.Method.Alg()] = true
+	}
+
+	var algs []string
+	for alg := range methods {
+		algs = append(algs, alg)
+	}
+
+	return algs
+}
+
+func (ks *KeySet) JWKS() []JWK {
+	var jwks []JWK
+
+	for _, key := range ks.keys {
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+
+		switch pub := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+
+		jwks = append(jwks, jwk)
+	}
+
+	sort.Slice(jwks, func(i, j int) bool { return jwks[i].Kid < jwks[j].Kid })
+
+	return jwks
+}
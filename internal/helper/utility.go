@@ -21,3 +21,28 @@ func RandomNumbers(length int) (string, error) {
 
 	return string(buffer), nil
 }
+
+func RandomString(length int) (string, error) {
+	const chars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+	buffer := make([]byte, length)
+	_, err := rand.Read(buffer)
+	if err != nil {
+		return "", err
+	}
+
+	// 248 is the largest multiple of 62 below 256, rejecting above it avoids modulo bias
+	for i := 0; i < length; {
+		if buffer[i] < 248 {
+			buffer[i] = chars[int(buffer[i])%len(chars)]
+			i++
+			continue
+		}
+
+		if _, err = rand.Read(buffer[i : i+1]); err != nil {
+			return "", err
+		}
+	}
+
+	return string(buffer), nil
+}
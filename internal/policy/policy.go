@@ -0,0 +1,138 @@
+package policy
+
+import (
+	"go-ecommerce-app/internal/domain"
+	"net/http"
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type Permission string
+
+const (
+	CartManage     Permission = "cart.manage"
+	OrdersPlace    Permission = "orders.place"
+	PaymentsCreate Permission = "payments.create"
+	SellerApply    Permission = "seller.apply"
+	ReviewsWrite   Permission = "reviews.write"
+
+	CatalogCategoryManage   Permission = "catalog.category.manage"
+	CatalogProductRead      Permission = "catalog.product.read"
+	CatalogProductManage    Permission = "catalog.product.manage"
+	CatalogProductManageAny Permission = "catalog.product.manage.any"
+
+	OrdersRead    Permission = "orders.read"
+	OrdersReadAny Permission = "orders.read.any"
+	OrdersFulfil  Permission = "orders.fulfil" // moves own orders along
+	OrdersManage  Permission = "orders.manage"
+
+	ApiKeysManage Permission = "api_keys.manage"
+	UsersManage   Permission = "users.manage"
+	SellersReview Permission = "sellers.review"
+	AuditRead     Permission = "audit.read"
+
+	ReviewsModerate Permission = "reviews.moderate"
+)
+
+var buyerPermissions = []Permission{
+	CartManage,
+	OrdersPlace,
+	PaymentsCreate,
+	SellerApply,
+	ReviewsWrite,
+}
+
+var sellerPermissions = []Permission{
+	CartManage,
+	OrdersPlace,
+	PaymentsCreate,
+	ReviewsWrite,
+	CatalogProductRead,
+	CatalogProductManage,
+	OrdersRead,
+	OrdersFulfil,
+	ApiKeysManage,
+}
+
+var rolePermissions = map[string][]Permission{
+	domain.BUYER:  buyerPermissions,
+	domain.SELLER: sellerPermissions,
+	domain.ADMIN: append(slices.Clone(sellerPermissions),
+		CatalogCategoryManage,
+		CatalogProductManageAny,
+		OrdersReadAny,
+		OrdersManage,
+		UsersManage,
+		SellersReview,
+		AuditRead,
+		ReviewsModerate,
+	),
+}
+
+// scopePermissions limits api key requests, a key never gets more than its owner's role.
+var scopePermissions = map[string][]Permission{
+	domain.ScopeProductsRead:  {CatalogProductRead},
+	domain.ScopeProductsWrite: {CatalogProductRead, CatalogProductManage},
+	domain.ScopeOrdersRead:    {OrdersRead},
+}
+
+// ownership rules: the permission applies to own resources, the mapped one to any resource
+var anyPermissions = map[Permission]Permission{
+	CatalogProductManage: CatalogProductManageAny,
+	OrdersRead:           OrdersReadAny,
+	OrdersFulfil:         OrdersManage,
+}
+
+// Can reports whether the role grants the permission.
+func Can(user domain.User, p Permission) bool {
+	return slices.Contains(rolePermissions[user.UserType], p)
+}
+
+// CanManage applies the ownership rule for a resource owned by ownerID.
+func CanManage(user domain.User, p Permission, ownerID uint) bool {
+	if anyPermission, ok := anyPermissions[p]; ok && Can(user, anyPermission) {
+		return true
+	}
+
+	return Can(user, p) && user.ID == ownerID
+}
+
+// Permissions returns every permission granted to the role.
+func Permissions(role string) []Permission {
+	return slices.Clone(rolePermissions[role])
+}
+
+func allowed(ctx *fiber.Ctx, p Permission) bool {
+	user, ok := ctx.Locals("user").(domain.User)
+	if !ok || !Can(user, p) {
+		return false
+	}
+
+	scopes, isKey := ctx.Locals("scopes").([]string)
+	if !isKey {
+		return true
+	}
+
+	for _, scope := range scopes {
+		if slices.Contains(scopePermissions[scope], p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Require must run after one of the auth middlewares.
+func Require(p Permission) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if allowed(ctx, p) {
+			return ctx.Next()
+		}
+
+		return ctx.Status(http.StatusForbidden).JSON(&fiber.Map{
+			"message": "you do not have permission to perform this action",
+			"error":   "missing permission " + string(p),
+		})
+	}
+}
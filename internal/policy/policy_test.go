@@ -0,0 +1,70 @@
+package policy
+
+import (
+	"go-ecommerce-app/internal/domain"
+	"testing"
+)
+
+func TestRolePermissions(t *testing.T) {
+	all := []Permission{
+		CartManage, OrdersPlace, PaymentsCreate, SellerApply, ReviewsWrite,
+		CatalogCategoryManage, CatalogProductRead, CatalogProductManage, CatalogProductManageAny,
+		OrdersRead, OrdersReadAny, OrdersFulfil, OrdersManage,
+		ApiKeysManage, UsersManage, SellersReview, AuditRead, ReviewsModerate,
+	}
+
+	granted := map[string][]Permission{
+		domain.BUYER: {CartManage, OrdersPlace, PaymentsCreate, SellerApply, ReviewsWrite},
+		domain.SELLER: {CartManage, OrdersPlace, PaymentsCreate, ReviewsWrite,
+			CatalogProductRead, CatalogProductManage, OrdersRead, OrdersFulfil, ApiKeysManage},
+		domain.ADMIN: {CartManage, OrdersPlace, PaymentsCreate, ReviewsWrite,
+			CatalogProductRead, CatalogProductManage, OrdersRead, OrdersFulfil, ApiKeysManage,
+			CatalogCategoryManage, CatalogProductManageAny, OrdersReadAny, OrdersManage,
+			UsersManage, SellersReview, AuditRead, ReviewsModerate},
+		"unknown": nil,
+	}
+
+	for role, permissions := range granted {
+		want := map[Permission]bool{}
+		for _, p := range permissions {
+			want[p] = true
+		}
+
+		for _, p := range all {
+			if got := Can(domain.User{UserType: role}, p); got != want[p] {
+				t.Errorf("%s %s = %v, want %v", role, p, got, want[p])
+			}
+		}
+	}
+}
+
+func TestCanManage(t *testing.T) {
+	seller := domain.User{ID: 1, UserType: domain.SELLER}
+	admin := domain.User{ID: 2, UserType: domain.ADMIN}
+	buyer := domain.User{ID: 3, UserType: domain.BUYER}
+
+	tests := []struct {
+		name    string
+		user    domain.User
+		p       Permission
+		ownerID uint
+		want    bool
+	}{
+		{"seller own product", seller, CatalogProductManage, 1, true},
+		{"seller other product", seller, CatalogProductManage, 9, false},
+		{"admin any product", admin, CatalogProductManage, 9, true},
+		{"buyer own product", buyer, CatalogProductManage, 3, false},
+		{"seller own orders", seller, OrdersRead, 1, true},
+		{"seller other orders", seller, OrdersRead, 9, false},
+		{"admin any orders", admin, OrdersRead, 9, true},
+		{"seller fulfils own orders", seller, OrdersFulfil, 1, true},
+		{"seller fulfils other orders", seller, OrdersFulfil, 9, false},
+		{"admin fulfils any orders", admin, OrdersFulfil, 9, true},
+	}
+
+	for _, tt := range tests {
+		if got := CanManage(tt.user, tt.p, tt.ownerID); got != tt.want {
+			t.Errorf("%s: CanManage = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"go-ecommerce-app/internal/domain"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type AlertRepository interface {
+	CreateAlert(e *domain.ProductAlert) error
+	FindUserAlerts(userID uint) ([]domain.ProductAlert, error)
+	DeleteAlert(id, userID uint) (bool, error)
+	FindProductAlerts(productID uint, kind string) ([]domain.ProductAlert, error)
+	FindUserEmails(userIDs []uint) (map[uint]string, error)
+	MarkNotified(ids []uint, price float64, at time.Time) error
+	DeleteAlerts(ids []uint) error
+	QueueProductChange(change domain.ProductAlertChange) error
+	TakeProductChanges() ([]domain.ProductAlertChange, error)
+}
+
+type alertRepository struct {
+	db *gorm.DB
+}
+
+func NewAlertRepository(db *gorm.DB) AlertRepository {
+	return &alertRepository{
+		db: db,
+	}
+}
+
+// CreateAlert replaces the target price when the user already subscribed.
+func (r *alertRepository) CreateAlert(e *domain.ProductAlert) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "product_id"}, {Name: "kind"}},
+		DoUpdates: clause.AssignmentColumns([]string{"target_price", "last_notified_price"}),
+	}).Create(e).Error
+}
+
+func (r *alertRepository) FindUserAlerts(userID uint) ([]domain.ProductAlert, error) {
+	var alerts []domain.ProductAlert
+
+	err := r.db.Where("user_id=?", userID).Order("created_at desc").Find(&alerts).Error
+
+	return alerts, err
+}
+
+func (r *alertRepository) DeleteAlert(id, userID uint) (bool, error) {
+	result := r.db.Where("id=? AND user_id=?", id, userID).Delete(&domain.ProductAlert{})
+
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *alertRepository) FindProductAlerts(productID uint, kind string) ([]domain.ProductAlert, error) {
+	var alerts []domain.ProductAlert
+
+	err := r.db.Where("product_id=? AND kind=?", productID, kind).Find(&alerts).Error
+
+	return alerts, err
+}
+
+// FindUserEmails skips deleted accounts, their email is cleared.
+func (r *alertRepository) FindUserEmails(userIDs []uint) (map[uint]string, error) {
+	emails := map[uint]string{}
+	if len(userIDs) == 0 {
+		return emails, nil
+	}
+
+	var users []domain.User
+	err := r.db.Select("id", "email").Where("id IN ? AND anonymized_at IS NULL", userIDs).Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, u := range users {
+		emails[u.ID] = u.Email
+	}
+
+	return emails, nil
+}
+
+func (r *alertRepository) MarkNotified(ids []uint, price float64, at time.Time) error {
+	return r.db.Model(&domain.ProductAlert{}).Where("id IN ?", ids).Updates(map[string]any{
+		"last_notified_price": price,
+		"last_notified_at":    at,
+	}).Error
+}
+
+func (r *alertRepository) DeleteAlerts(ids []uint) error {
+	return r.db.Where("id IN ?", ids).Delete(&domain.ProductAlert{}).Error
+}
+
+// QueueProductChange merges the change into the queued one of the product.
+func (r *alertRepository) QueueProductChange(change domain.ProductAlertChange) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "product_id"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"back_in_stock": gorm.Expr("product_alert_changes.back_in_stock OR excluded.back_in_stock"),
+			"price_drop":    gorm.Expr("product_alert_changes.price_drop OR excluded.price_drop"),
+			"updated_at":    gorm.Expr("excluded.updated_at"),
+		}),
+	}).Create(&change).Error
+}
+
+// TakeProductChanges removes the queued changes and returns them, every
+// change is taken by one instance only.
+func (r *alertRepository) TakeProductChanges() ([]domain.ProductAlertChange, error) {
+	var changes []domain.ProductAlertChange
+
+	err := r.db.Clauses(clause.Returning{}).Where("1 = 1").Delete(&changes).Error
+
+	return changes, err
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"go-ecommerce-app/internal/domain"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ApiKeyRepository interface {
+	CreateApiKey(e *domain.ApiKey) error
+	FindApiKeyByPrefix(prefix string) (domain.ApiKey, error)
+	FindUserApiKeys(userID uint) ([]domain.ApiKey, error)
+	RevokeApiKey(id, userID uint) error
+	TouchApiKey(id uint, usedAt time.Time) error
+}
+
+type apiKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewApiKeyRepository(db *gorm.DB) ApiKeyRepository {
+	return &apiKeyRepository{
+		db: db,
+	}
+}
+
+func (r *apiKeyRepository) CreateApiKey(e *domain.ApiKey) error {
+	return r.db.Create(e).Error
+}
+
+func (r *apiKeyRepository) FindApiKeyByPrefix(prefix string) (domain.ApiKey, error) {
+	var key domain.ApiKey
+
+	err := r.db.Where("prefix=?", prefix).First(&key).Error
+
+	return key, err
+}
+
+func (r *apiKeyRepository) FindUserApiKeys(userID uint) ([]domain.ApiKey, error) {
+	var keys []domain.ApiKey
+
+	err := r.db.Where("user_id=?", userID).Order("created_at desc").Find(&keys).Error
+
+	return keys, err
+}
+
+func (r *apiKeyRepository) RevokeApiKey(id, userID uint) error {
+	result := r.db.Model(&domain.ApiKey{}).
+		Where("id=? AND user_id=? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (r *apiKeyRepository) TouchApiKey(id uint, usedAt time.Time) error {
+	return r.db.Model(&domain.ApiKey{}).Where("id=?", id).UpdateColumn("last_used_at", usedAt).Error
+}
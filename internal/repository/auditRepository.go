@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"go-ecommerce-app/internal/domain"
+	"go-ecommerce-app/internal/dto"
+	"go-ecommerce-app/pkg/fieldcrypt"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+type AuditRepository interface {
+	CreateAuditEvent(e *domain.AuditEvent) error
+	FindAuditEvents(filter dto.AuditEventFilter) ([]domain.AuditEvent, int64, error)
+	FindAuditEventsInBatches(filter dto.AuditEventFilter, batch func([]domain.AuditEvent) error) error
+}
+
+type auditRepository struct {
+	db *gorm.DB
+}
+
+func NewAuditRepository(db *gorm.DB) AuditRepository {
+	return &auditRepository{
+		db: db,
+	}
+}
+
+// appendOnlyAuditSQL makes the database reject changes to recorded events, so
+// neither a bug nor a stray query can rewrite the history.
+const appendOnlyAuditSQL = `
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_no_change ON audit_events;
+CREATE TRIGGER audit_events_no_change BEFORE UPDATE OR DELETE ON audit_events
+	FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+DROP TRIGGER IF EXISTS audit_events_no_truncate ON audit_events;
+CREATE TRIGGER audit_events_no_truncate BEFORE TRUNCATE ON audit_events
+	FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
+`
+
+// MigrateAuditLog installs the append-only triggers, run it after AutoMigrate.
+// Events recorded before personal data was kept out of the log are scrubbed
+// once, before the triggers are back in place.
+func MigrateAuditLog(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if tx.Migrator().HasColumn(&domain.AuditEvent{}, "ip") {
+			if err := scrubLegacyAuditEvents(tx); err != nil {
+				return err
+			}
+		}
+
+		return tx.Exec(appendOnlyAuditSQL).Error
+	})
+}
+
+// scrubLegacyAuditEvents encrypts the client addresses and adds their blind
+// index, drops the user agents and masks the personal fields of the changes.
+func scrubLegacyAuditEvents(tx *gorm.DB) error {
+	if err := tx.Exec("DROP TRIGGER IF EXISTS audit_events_no_change ON audit_events").Error; err != nil {
+		return err
+	}
+
+	var ips []string
+	if err := tx.Table("audit_events").Distinct("ip").Where("ip <> ''").Pluck("ip", &ips).Error; err != nil {
+		return err
+	}
+
+	for _, ip := range ips {
+		encrypted, err := fieldcrypt.Encrypt(ip)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Table("audit_events").Where("ip=?", ip).UpdateColumns(map[string]any{
+			"client_ip": encrypted,
+			"ip_hash":   fieldcrypt.BlindIndex(ip),
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	var events []domain.AuditEvent
+	scrubbed := 0
+
+	err := tx.Where("changes IS NOT NULL").FindInBatches(&events, 500, func(batch *gorm.DB, _ int) error {
+		for _, e := range events {
+			if len(e.Changes) == 0 {
+				continue
+			}
+
+			domain.MaskAuditChanges(e.Changes)
+
+			err := tx.Model(&domain.AuditEvent{ID: e.ID}).Select("changes").
+				Updates(domain.AuditEvent{Changes: e.Changes}).Error
+			if err != nil {
+				return err
+			}
+			scrubbed++
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	for _, column := range []string{"ip", "user_agent"} {
+		if err = tx.Migrator().DropColumn(&domain.AuditEvent{}, column); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("scrubbed the personal data of %d audit events", scrubbed)
+
+	return nil
+}
+
+func (r *auditRepository) CreateAuditEvent(e *domain.AuditEvent) error {
+	return r.db.Create(e).Error
+}
+
+func (r *auditRepository) filtered(filter dto.AuditEventFilter) *gorm.DB {
+	query := r.db.Model(&domain.AuditEvent{})
+
+	if filter.ActorID > 0 {
+		query = query.Where("actor_id=?", filter.ActorID)
+	}
+
+	if filter.Action != "" {
+		query = query.Where("action=?", filter.Action)
+	}
+
+	if filter.ResourceType != "" {
+		query = query.Where("resource_type=?", filter.ResourceType)
+	}
+
+	if filter.ResourceID != "" {
+		query = query.Where("resource_id=?", filter.ResourceID)
+	}
+
+	if filter.RequestID != "" {
+		query = query.Where("request_id=?", filter.RequestID)
+	}
+
+	if filter.IP != "" {
+		query = query.Where("ip_hash=?", fieldcrypt.BlindIndex(filter.IP))
+	}
+
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+
+	return query
+}
+
+func (r *auditRepository) FindAuditEvents(filter dto.AuditEventFilter) ([]domain.AuditEvent, int64, error) {
+	var events []domain.AuditEvent
+	var total int64
+
+	if err := r.filtered(filter).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := r.filtered(filter).
+		Order("created_at desc, id desc").
+		Offset((filter.Page - 1) * filter.Limit).
+		Limit(filter.Limit).
+		Find(&events).Error
+
+	return events, total, err
+}
+
+func (r *auditRepository) FindAuditEventsInBatches(filter dto.AuditEventFilter, batch func([]domain.AuditEvent) error) error {
+	var events []domain.AuditEvent
+
+	return r.filtered(filter).FindInBatches(&events, 500, func(tx *gorm.DB, _ int) error {
+		return batch(events)
+	}).Error
+}
@@ -2,23 +2,67 @@ package repository
 
 import (
 	"go-ecommerce-app/internal/domain"
+	"go-ecommerce-app/internal/dto"
+	"go-ecommerce-app/pkg/slug"
+	"log"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// text facets list the most used values only
+const facetValueLimit = 50
+
+var productOrders = map[string]string{
+	"newest":     "created_at desc, id desc",
+	"rating":     "rating_average desc, rating_count desc, id",
+	"price_asc":  "price, id",
+	"price_desc": "price desc, id",
+}
+
 type CatalogRepository interface {
 	CreateCategory(e *domain.Category) error
 	FindCategories() ([]*domain.Category, error)
 	FindCategoryByID(id int) (*domain.Category, error)
+	FindCategoryBySlug(slug string) (*domain.Category, error)
 	EditCategory(e *domain.Category) (*domain.Category, error)
 	DeleteCategory(id int) error
 
+	CreateCategoryAttribute(e *domain.CategoryAttribute) error
+	FindCategoryAttributes(categoryID uint) ([]domain.CategoryAttribute, error)
+	FindCategoryAttribute(categoryID, id uint) (*domain.CategoryAttribute, error)
+	UpdateCategoryAttribute(e *domain.CategoryAttribute) error
+	DeleteCategoryAttribute(id uint) error
+	CountAttributeValues(attributeID uint) (int64, error)
+
 	CreateProduct(e *domain.Product) error
-	FindProducts() ([]*domain.Product, error)
+	FindProducts(filter dto.ProductFilter) ([]*domain.Product, error)
+	FindProductFacets(filter dto.ProductFilter, attributes []domain.CategoryAttribute) (dto.ProductFacets, error)
 	FindProductByID(id int) (*domain.Product, error)
+	FindPublicProductByID(id int) (*domain.Product, error)
+	FindPublicProductBySlug(slug string) (*domain.Product, error)
+	CountPublicProducts(productIDs []uint) (int64, error)
 	FindSellerProducts(id int) ([]*domain.Product, error)
+	FindProductPrices(productIDs []uint) (map[uint]float64, error)
+	FindProductBySku(userID uint, sku string) (*domain.Product, error)
+	FindSellerProductsInBatches(userID uint, batch func([]domain.Product) error) error
 	EditProduct(e *domain.Product) (*domain.Product, error)
+	UpdateProductStatus(e *domain.Product, from string) (bool, error)
+	ReplaceProductAttributes(productID uint, attributes []domain.ProductAttribute) error
 	DeleteProduct(e *domain.Product) error
+	ApplyProductSchedules(now time.Time) (int64, int64, error)
+
+	CreateProductImage(e *domain.ProductImage) error
+	FindProductImage(productID, id uint) (*domain.ProductImage, error)
+	FindProductImages(productID uint) ([]domain.ProductImage, error)
+	DeleteProductImage(id uint) error
+	UpdateImagePositions(productID uint, ids []uint) error
+
+	SlugTaken(resourceType, slug string, id uint) (bool, error)
+	SlugUsage(resourceType, base, prefix string, id uint) (bool, int, error)
+	FindSlugRedirect(resourceType, slug string) (*domain.SlugRedirect, error)
+	RecordSlugChange(resourceType string, id uint, from, to string) error
 }
 
 type catalogRepository struct {
@@ -58,6 +102,16 @@ func (c catalogRepository) FindCategoryByID(id int) (*domain.Category, error) {
 	return category, nil
 }
 
+func (c catalogRepository) FindCategoryBySlug(slug string) (*domain.Category, error) {
+	var category *domain.Category
+
+	if err := c.db.Where("slug=?", slug).First(&category).Error; err != nil {
+		return nil, err
+	}
+
+	return category, nil
+}
+
 func (c catalogRepository) EditCategory(e *domain.Category) (*domain.Category, error) {
 	if err := c.db.Save(&e).Error; err != nil {
 		return nil, err
@@ -66,8 +120,65 @@ func (c catalogRepository) EditCategory(e *domain.Category) (*domain.Category, e
 }
 
 func (c catalogRepository) DeleteCategory(id int) error {
-	err := c.db.Delete(&domain.Category{}, id).Error
-	return err
+	return c.db.Transaction(func(tx *gorm.DB) error {
+		attributeIDs := tx.Model(&domain.CategoryAttribute{}).Select("id").Where("category_id=?", id)
+		if err := tx.Where("attribute_id IN (?)", attributeIDs).Delete(&domain.ProductAttribute{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("category_id=?", id).Delete(&domain.CategoryAttribute{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("resource_type=? AND resource_id=?", domain.SlugCategory, id).Delete(&domain.SlugRedirect{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&domain.Category{}, id).Error
+	})
+}
+
+// Category attributes
+func (c catalogRepository) CreateCategoryAttribute(e *domain.CategoryAttribute) error {
+	return c.db.Create(e).Error
+}
+
+func (c catalogRepository) FindCategoryAttributes(categoryID uint) ([]domain.CategoryAttribute, error) {
+	var attributes []domain.CategoryAttribute
+
+	err := c.db.Where("category_id=?", categoryID).Order("position, id").Find(&attributes).Error
+
+	return attributes, err
+}
+
+func (c catalogRepository) FindCategoryAttribute(categoryID, id uint) (*domain.CategoryAttribute, error) {
+	var attribute *domain.CategoryAttribute
+
+	if err := c.db.Where("category_id=?", categoryID).First(&attribute, id).Error; err != nil {
+		return nil, err
+	}
+
+	return attribute, nil
+}
+
+func (c catalogRepository) UpdateCategoryAttribute(e *domain.CategoryAttribute) error {
+	// Select keeps the false flags and the zero position
+	return c.db.Model(e).Select("*").Omit("id", "category_id", "key", "created_at").Updates(e).Error
+}
+
+// DeleteCategoryAttribute removes the attribute with the values of the products.
+func (c catalogRepository) DeleteCategoryAttribute(id uint) error {
+	return c.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("attribute_id=?", id).Delete(&domain.ProductAttribute{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&domain.CategoryAttribute{}, id).Error
+	})
+}
+
+func (c catalogRepository) CountAttributeValues(attributeID uint) (int64, error) {
+	var count int64
+
+	err := c.db.Model(&domain.ProductAttribute{}).Where("attribute_id=?", attributeID).Count(&count).Error
+
+	return count, err
 }
 
 // Products
@@ -79,10 +190,81 @@ func (c *catalogRepository) CreateProduct(e *domain.Product) error {
 	return nil
 }
 
-func (c *catalogRepository) FindProducts() ([]*domain.Product, error) {
+// legacySkuSQL gives the products created before skus existed one, the
+// import matches rows by sku so they could not be exported and imported again.
+const legacySkuSQL = `
+UPDATE products p SET sku = 'P-' || p.id
+WHERE COALESCE(p.sku, '') = '' AND NOT EXISTS (
+	SELECT 1 FROM products q WHERE q.user_id = p.user_id AND q.sku = 'P-' || p.id AND q.deleted_at IS NULL
+)`
+
+// MigrateCatalog drops the sku index that also covered deleted products, gives
+// products without a sku one and gives the products and categories created
+// before slugs existed a slug.
+func MigrateCatalog(db *gorm.DB) error {
+	if err := db.Exec("DROP INDEX IF EXISTS idx_product_seller_sku").Error; err != nil {
+		return err
+	}
+
+	result := db.Exec(legacySkuSQL)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("gave %d products without a sku one", result.RowsAffected)
+	}
+
+	c := &catalogRepository{db: db}
+	if err := c.backfillSlugs(&domain.Product{}, domain.SlugProduct); err != nil {
+		return err
+	}
+
+	return c.backfillSlugs(&domain.Category{}, domain.SlugCategory)
+}
+
+func (c *catalogRepository) backfillSlugs(model any, resourceType string) error {
+	var rows []struct {
+		ID   uint
+		Name string
+	}
+
+	err := c.db.Model(model).Select("id", "name").Where("slug IS NULL OR slug = ''").Order("id").Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		base := slug.Make(row.Name)
+		if base == "" {
+			base = resourceType
+		}
+
+		value, err := slug.Unique(base, func(base, prefix string) (bool, int, error) {
+			return c.SlugUsage(resourceType, base, prefix, row.ID)
+		})
+		if err != nil {
+			return err
+		}
+
+		if err = c.db.Model(model).Where("id=?", row.ID).Update("slug", value).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FindProducts lists the active products matching the filter, unknown sort
+// orders keep the insertion order.
+func (c *catalogRepository) FindProducts(filter dto.ProductFilter) ([]*domain.Product, error) {
 	var products []*domain.Product
 
-	if err := c.db.Find(&products).Error; err != nil {
+	query := c.filteredProducts(filter, "").Preload("Images", orderedImages).Preload("Attributes", orderedAttributes)
+	if order, ok := productOrders[filter.Sort]; ok {
+		query = query.Order(order)
+	}
+
+	if err := query.Find(&products).Error; err != nil {
 		return nil, err
 	}
 
@@ -92,17 +274,164 @@ func (c *catalogRepository) FindProducts() ([]*domain.Product, error) {
 func (c *catalogRepository) FindProductByID(id int) (*domain.Product, error) {
 	var product *domain.Product
 
-	if err := c.db.First(&product, id).Error; err != nil {
+	if err := c.db.Preload("Images", orderedImages).Preload("Attributes", orderedAttributes).First(&product, id).Error; err != nil {
+		return nil, err
+	}
+
+	return product, nil
+}
+
+// FindProductFacets counts the products of the filter by category and by the
+// values of the given attributes. The filter on an attribute is left out of
+// its own facet, so the other values can still be selected.
+func (c *catalogRepository) FindProductFacets(filter dto.ProductFilter, attributes []domain.CategoryAttribute) (dto.ProductFacets, error) {
+	facets := dto.ProductFacets{
+		Categories: []dto.CategoryFacet{},
+		Attributes: []dto.AttributeFacet{},
+	}
+
+	anyCategory := filter
+	anyCategory.CategoryID = 0
+
+	err := c.filteredProducts(anyCategory, "").
+		Select("category_id, COUNT(*) AS count").
+		Group("category_id").Order("count DESC, category_id").
+		Scan(&facets.Categories).Error
+	if err != nil {
+		return facets, err
+	}
+
+	for _, attribute := range attributes {
+		productIDs := c.filteredProducts(filter, attribute.Key).Select("products.id")
+		values := c.db.Model(&domain.ProductAttribute{}).Where("key=? AND product_id IN (?)", attribute.Key, productIDs)
+
+		facet := dto.AttributeFacet{
+			Key:  attribute.Key,
+			Name: attribute.Name,
+			Type: attribute.Type,
+			Unit: attribute.Unit,
+		}
+
+		switch attribute.Type {
+		case domain.AttributeNumber:
+			var numbers struct {
+				Min   *float64
+				Max   *float64
+				Count int64
+			}
+			err = values.Select("MIN(number_value) AS min, MAX(number_value) AS max, COUNT(*) AS count").Scan(&numbers).Error
+			facet.Min, facet.Max, facet.Count = numbers.Min, numbers.Max, numbers.Count
+		case domain.AttributeBoolean:
+			var rows []struct {
+				Value bool
+				Count int64
+			}
+			err = values.Select("bool_value AS value, COUNT(*) AS count").Group("bool_value").Order("value DESC").Scan(&rows).Error
+			for _, row := range rows {
+				facet.Values = append(facet.Values, dto.FacetValue{Value: row.Value, Count: row.Count})
+				facet.Count += row.Count
+			}
+		default:
+			var rows []struct {
+				Value string
+				Count int64
+			}
+			err = values.Select("text_value AS value, COUNT(*) AS count").Group("text_value").
+				Order("count DESC, value").Limit(facetValueLimit).Scan(&rows).Error
+			for _, row := range rows {
+				facet.Values = append(facet.Values, dto.FacetValue{Value: row.Value, Count: row.Count})
+				facet.Count += row.Count
+			}
+		}
+		if err != nil {
+			return facets, err
+		}
+
+		facets.Attributes = append(facets.Attributes, facet)
+	}
+
+	return facets, nil
+}
+
+// filteredProducts selects the active products of the filter, the filter on
+// the skipped attribute key is left out.
+func (c *catalogRepository) filteredProducts(filter dto.ProductFilter, skipKey string) *gorm.DB {
+	query := c.db.Model(&domain.Product{}).Where("products.status=?", domain.ProductStatusActive)
+
+	if filter.CategoryID > 0 {
+		query = query.Where("products.category_id=?", filter.CategoryID)
+	}
+
+	for _, f := range filter.Attributes {
+		if f.Key == skipKey {
+			continue
+		}
+
+		values := c.db.Model(&domain.ProductAttribute{}).Select("1").
+			Where("product_attributes.product_id = products.id AND product_attributes.key=?", f.Key)
+
+		switch f.Type {
+		case domain.AttributeNumber:
+			if f.Min != nil {
+				values = values.Where("product_attributes.number_value >= ?", *f.Min)
+			}
+			if f.Max != nil {
+				values = values.Where("product_attributes.number_value <= ?", *f.Max)
+			}
+		case domain.AttributeBoolean:
+			values = values.Where("product_attributes.bool_value=?", *f.Bool)
+		default:
+			values = values.Where("product_attributes.text_value IN ?", f.Values)
+		}
+
+		query = query.Where("EXISTS (?)", values)
+	}
+
+	return query
+}
+
+// FindPublicProductByID finds the product when it is active.
+func (c *catalogRepository) FindPublicProductByID(id int) (*domain.Product, error) {
+	var product *domain.Product
+
+	err := c.db.Preload("Images", orderedImages).Preload("Attributes", orderedAttributes).
+		Where("status=?", domain.ProductStatusActive).First(&product, id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return product, nil
+}
+
+// FindPublicProductBySlug finds the product by its current slug when it is active.
+func (c *catalogRepository) FindPublicProductBySlug(slug string) (*domain.Product, error) {
+	var product *domain.Product
+
+	err := c.db.Preload("Images", orderedImages).Preload("Attributes", orderedAttributes).
+		Where("slug=? AND status=?", slug, domain.ProductStatusActive).First(&product).Error
+	if err != nil {
 		return nil, err
 	}
 
 	return product, nil
 }
 
+// CountPublicProducts counts the active products among the ids.
+func (c *catalogRepository) CountPublicProducts(productIDs []uint) (int64, error) {
+	var count int64
+
+	err := c.db.Model(&domain.Product{}).
+		Where("id IN ? AND status=?", productIDs, domain.ProductStatusActive).
+		Count(&count).Error
+
+	return count, err
+}
+
 func (c *catalogRepository) FindSellerProducts(id int) ([]*domain.Product, error) {
 	var products []*domain.Product
 
-	err := c.db.Where("user_id=?", id).Find(&products).Error
+	err := c.db.Preload("Images", orderedImages).Preload("Attributes", orderedAttributes).
+		Where("user_id=?", id).Find(&products).Error
 	if err != nil {
 		return nil, err
 	}
@@ -110,16 +439,251 @@ func (c *catalogRepository) FindSellerProducts(id int) ([]*domain.Product, error
 	return products, nil
 }
 
+// FindProductPrices returns the current prices by product id, deleted products are missing.
+func (c *catalogRepository) FindProductPrices(productIDs []uint) (map[uint]float64, error) {
+	prices := map[uint]float64{}
+	if len(productIDs) == 0 {
+		return prices, nil
+	}
+
+	var products []domain.Product
+	if err := c.db.Select("id", "price").Where("id IN ?", productIDs).Find(&products).Error; err != nil {
+		return nil, err
+	}
+
+	for _, p := range products {
+		prices[p.ID] = p.Price
+	}
+
+	return prices, nil
+}
+
+// FindProductBySku returns nil without an error when the seller has no product
+// with the sku, so a failed query is not mistaken for a new sku.
+func (c *catalogRepository) FindProductBySku(userID uint, sku string) (*domain.Product, error) {
+	var products []domain.Product
+
+	err := c.db.Preload("Attributes", orderedAttributes).
+		Where("user_id=? AND sku=?", userID, sku).Limit(1).Find(&products).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if len(products) == 0 {
+		return nil, nil
+	}
+
+	return &products[0], nil
+}
+
+func (c *catalogRepository) FindSellerProductsInBatches(userID uint, batch func([]domain.Product) error) error {
+	var products []domain.Product
+
+	return c.db.Preload("Attributes", orderedAttributes).Where("user_id=?", userID).FindInBatches(&products, 500, func(tx *gorm.DB, _ int) error {
+		return batch(products)
+	}).Error
+}
+
+// EditProduct saves the fields the seller edits and returns the product as
+// stored. Images and attributes are changed through their own methods, stock
+// through the inventory ledger, the status with UpdateProductStatus and the
+// rating by the review service.
 func (c *catalogRepository) EditProduct(e *domain.Product) (*domain.Product, error) {
-	if err := c.db.Save(&e).Error; err != nil {
+	err := c.db.Model(e).
+		Select("name", "description", "category_id", "image_url", "price", "sku", "slug", "updated_at").
+		Updates(e).Error
+	if err != nil {
 		return nil, err
 	}
-	return e, nil
+
+	return c.FindProductByID(int(e.ID))
 }
 
+// UpdateProductStatus saves the status and its times while the product still
+// has the from status, false reports that it changed meanwhile, e.g. by the
+// schedule.
+func (c *catalogRepository) UpdateProductStatus(e *domain.Product, from string) (bool, error) {
+	result := c.db.Model(&domain.Product{}).Where("id=? AND status=?", e.ID, from).Updates(map[string]any{
+		"status":       e.Status,
+		"publish_at":   e.PublishAt,
+		"unpublish_at": e.UnpublishAt,
+		"updated_at":   time.Now(),
+	})
+
+	return result.RowsAffected > 0, result.Error
+}
+
+// ReplaceProductAttributes stores the attribute values of the product in place
+// of the current ones.
+func (c *catalogRepository) ReplaceProductAttributes(productID uint, attributes []domain.ProductAttribute) error {
+	return c.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("product_id=?", productID).Delete(&domain.ProductAttribute{}).Error; err != nil {
+			return err
+		}
+		if len(attributes) == 0 {
+			return nil
+		}
+
+		for i := range attributes {
+			attributes[i].ID = 0
+			attributes[i].ProductID = productID
+		}
+		return tx.Create(&attributes).Error
+	})
+}
+
+// DeleteProduct soft deletes the product, its images stay for the carts and
+// orders showing them.
 func (c *catalogRepository) DeleteProduct(e *domain.Product) error {
-	if err := c.db.Delete(&domain.Product{}, e.ID).Error; err != nil {
-		return err
+	return c.db.Delete(&domain.Product{}, e.ID).Error
+}
+
+// ApplyProductSchedules publishes the scheduled products that are due and
+// archives the active products past their unpublish time.
+func (c *catalogRepository) ApplyProductSchedules(now time.Time) (int64, int64, error) {
+	published := c.db.Model(&domain.Product{}).
+		Where("status=? AND publish_at <= ?", domain.ProductStatusScheduled, now).
+		Update("status", domain.ProductStatusActive)
+	if published.Error != nil {
+		return 0, 0, published.Error
 	}
-	return nil
+
+	archived := c.db.Model(&domain.Product{}).
+		Where("status=? AND unpublish_at <= ?", domain.ProductStatusActive, now).
+		Update("status", domain.ProductStatusArchived)
+	if archived.Error != nil {
+		return published.RowsAffected, 0, archived.Error
+	}
+
+	return published.RowsAffected, archived.RowsAffected, nil
+}
+
+func orderedAttributes(db *gorm.DB) *gorm.DB {
+	return db.Order("key")
+}
+
+// Product images
+func orderedImages(db *gorm.DB) *gorm.DB {
+	return db.Order("position, id")
+}
+
+func (c *catalogRepository) CreateProductImage(e *domain.ProductImage) error {
+	return c.db.Create(e).Error
+}
+
+func (c *catalogRepository) FindProductImage(productID, id uint) (*domain.ProductImage, error) {
+	var image *domain.ProductImage
+
+	if err := c.db.Where("product_id=?", productID).First(&image, id).Error; err != nil {
+		return nil, err
+	}
+
+	return image, nil
+}
+
+func (c *catalogRepository) FindProductImages(productID uint) ([]domain.ProductImage, error) {
+	var images []domain.ProductImage
+
+	err := orderedImages(c.db).Where("product_id=?", productID).Find(&images).Error
+
+	return images, err
+}
+
+func (c *catalogRepository) DeleteProductImage(id uint) error {
+	return c.db.Delete(&domain.ProductImage{}, id).Error
+}
+
+// UpdateImagePositions numbers the images in the order of ids.
+func (c *catalogRepository) UpdateImagePositions(productID uint, ids []uint) error {
+	return c.db.Transaction(func(tx *gorm.DB) error {
+		for position, id := range ids {
+			err := tx.Model(&domain.ProductImage{}).
+				Where("id=? AND product_id=?", id, productID).
+				Update("position", position).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Slugs
+
+// SlugTaken reports whether another product or category than id uses the slug,
+// now or as a former slug.
+func (c *catalogRepository) SlugTaken(resourceType, slug string, id uint) (bool, error) {
+	var model any = &domain.Product{}
+	if resourceType == domain.SlugCategory {
+		model = &domain.Category{}
+	}
+
+	var count int64
+	if err := c.db.Model(model).Where("slug=? AND id<>?", slug, id).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return true, nil
+	}
+
+	err := c.db.Model(&domain.SlugRedirect{}).
+		Where("resource_type=? AND slug=? AND resource_id<>?", resourceType, slug, id).
+		Count(&count).Error
+
+	return count > 0, err
+}
+
+// SlugUsage reports whether another product or category than id uses base,
+// now or as a former slug, and the highest number used after prefix. Slugs
+// only hold letters, digits and hyphens, so prefix needs no escaping.
+func (c *catalogRepository) SlugUsage(resourceType, base, prefix string, id uint) (bool, int, error) {
+	var model any = &domain.Product{}
+	if resourceType == domain.SlugCategory {
+		model = &domain.Category{}
+	}
+
+	current := c.db.Model(model).Select("slug").
+		Where("(slug=? OR slug LIKE ?) AND id<>?", base, prefix+"%", id)
+	former := c.db.Model(&domain.SlugRedirect{}).Select("slug").
+		Where("resource_type=? AND (slug=? OR slug LIKE ?) AND resource_id<>?", resourceType, base, prefix+"%", id)
+
+	var usage struct {
+		Taken  bool
+		Suffix int
+	}
+
+	err := c.db.Raw(`SELECT COALESCE(BOOL_OR(slug = ?), false) AS taken,
+		COALESCE(MAX(CASE WHEN slug ~ ? THEN CAST(substr(slug, ?) AS integer) END), 0) AS suffix
+		FROM (? UNION ALL ?) AS used`,
+		base, "^"+prefix+"[0-9]{1,9}$", len(prefix)+1, current, former).Scan(&usage).Error
+
+	return usage.Taken, usage.Suffix, err
+}
+
+func (c *catalogRepository) FindSlugRedirect(resourceType, slug string) (*domain.SlugRedirect, error) {
+	var redirect *domain.SlugRedirect
+
+	if err := c.db.Where("resource_type=? AND slug=?", resourceType, slug).First(&redirect).Error; err != nil {
+		return nil, err
+	}
+
+	return redirect, nil
+}
+
+// RecordSlugChange keeps the former slug for redirects, a former slug taken
+// back becomes current again.
+func (c *catalogRepository) RecordSlugChange(resourceType string, id uint, from, to string) error {
+	return c.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("resource_type=? AND slug=? AND resource_id=?", resourceType, to, id).
+			Delete(&domain.SlugRedirect{}).Error
+		if err != nil || from == "" {
+			return err
+		}
+
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&domain.SlugRedirect{
+			ResourceType: resourceType,
+			Slug:         from,
+			ResourceID:   id,
+		}).Error
+	})
 }
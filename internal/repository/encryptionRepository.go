@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+)
+
+// EncryptedColumn is a column written through the encrypted serializer. Index
+// names the column holding its blind index, if there is one.
+type EncryptedColumn struct {
+	Table  string
+	Column string
+	Index  string
+}
+
+// StoredValue is the raw ciphertext (or legacy plaintext) of a row.
+type StoredValue struct {
+	ID    uint
+	Value string
+	Index string
+}
+
+type EncryptionRepository interface {
+	FindStoredValues(column EncryptedColumn, afterID uint, limit int) ([]StoredValue, error)
+	UpdateStoredValue(column EncryptedColumn, stored StoredValue, value string, index string) (bool, error)
+}
+
+type encryptionRepository struct {
+	db *gorm.DB
+}
+
+func NewEncryptionRepository(db *gorm.DB) EncryptionRepository {
+	return &encryptionRepository{
+		db: db,
+	}
+}
+
+// FindStoredValues reads the column without the serializer, in id order.
+func (r encryptionRepository) FindStoredValues(column EncryptedColumn, afterID uint, limit int) ([]StoredValue, error) {
+	var values []StoredValue
+
+	index := "''"
+	if column.Index != "" {
+		index = "COALESCE(" + column.Index + ", '')"
+	}
+
+	err := r.db.Table(column.Table).
+		Select("id, COALESCE("+column.Column+", '') AS value, "+index+" AS index").
+		Where("id > ?", afterID).
+		Order("id").
+		Limit(limit).
+		Scan(&values).Error
+
+	return values, err
+}
+
+// UpdateStoredValue writes the value as it is, it must already be encrypted.
+// The row is only written while it still holds the stored value that was read,
+// false reports that it changed in between.
+func (r encryptionRepository) UpdateStoredValue(column EncryptedColumn, stored StoredValue, value string, index string) (bool, error) {
+	fields := map[string]any{column.Column: value}
+	if column.Index != "" {
+		fields[column.Index] = index
+	}
+
+	result := r.db.Table(column.Table).
+		Where("id=? AND "+column.Column+"=?", stored.ID, stored.Value).
+		UpdateColumns(fields)
+
+	return result.RowsAffected > 0, result.Error
+}
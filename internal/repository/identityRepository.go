@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"go-ecommerce-app/internal/domain"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IdentityRepository interface {
+	CreateIdentity(e *domain.UserIdentity) error
+	FindIdentity(provider, subject string) (domain.UserIdentity, error)
+	FindUserIdentities(userID uint) ([]domain.UserIdentity, error)
+	DeleteIdentity(id, userID uint) error
+
+	CreateState(e *domain.OAuthState) error
+	ConsumeState(state string) (domain.OAuthState, error)
+}
+
+type identityRepository struct {
+	db *gorm.DB
+}
+
+func NewIdentityRepository(db *gorm.DB) IdentityRepository {
+	return &identityRepository{
+		db: db,
+	}
+}
+
+func (r *identityRepository) CreateIdentity(e *domain.UserIdentity) error {
+	return r.db.Create(e).Error
+}
+
+func (r *identityRepository) FindIdentity(provider, subject string) (domain.UserIdentity, error) {
+	var identity domain.UserIdentity
+
+	err := r.db.Where("provider=? AND subject=?", provider, subject).First(&identity).Error
+
+	return identity, err
+}
+
+func (r *identityRepository) FindUserIdentities(userID uint) ([]domain.UserIdentity, error) {
+	var identities []domain.UserIdentity
+
+	err := r.db.Where("user_id=?", userID).Find(&identities).Error
+
+	return identities, err
+}
+
+func (r *identityRepository) DeleteIdentity(id, userID uint) error {
+	result := r.db.Where("id=? AND user_id=?", id, userID).Delete(&domain.UserIdentity{})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (r *identityRepository) CreateState(e *domain.OAuthState) error {
+	// drop expired requests on the way
+	if err := r.db.Where("expires_at < ?", time.Now()).Delete(&domain.OAuthState{}).Error; err != nil {
+		return err
+	}
+
+	return r.db.Create(e).Error
+}
+
+// ConsumeState deletes and returns the state so it can only be used once.
+func (r *identityRepository) ConsumeState(state string) (domain.OAuthState, error) {
+	var states []domain.OAuthState
+
+	err := r.db.Clauses(clause.Returning{}).Where("state=? AND expires_at > ?", state, time.Now()).Delete(&states).Error
+	if err != nil {
+		return domain.OAuthState{}, err
+	}
+
+	if len(states) == 0 {
+		return domain.OAuthState{}, gorm.ErrRecordNotFound
+	}
+
+	return states[0], nil
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"go-ecommerce-app/internal/domain"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ImportRepository interface {
+	CreateImportJob(e *domain.ImportJob) error
+	FindImportJob(id, userID uint) (domain.ImportJob, error)
+	UpdateImportJob(e *domain.ImportJob) error
+	FailStaleImportJobs(updatedBefore time.Time, message string) (int64, error)
+}
+
+type importRepository struct {
+	db *gorm.DB
+}
+
+func NewImportRepository(db *gorm.DB) ImportRepository {
+	return &importRepository{
+		db: db,
+	}
+}
+
+func (r *importRepository) CreateImportJob(e *domain.ImportJob) error {
+	return r.db.Create(e).Error
+}
+
+func (r *importRepository) FindImportJob(id, userID uint) (domain.ImportJob, error) {
+	var job domain.ImportJob
+
+	err := r.db.Where("id=? AND user_id=?", id, userID).First(&job).Error
+
+	return job, err
+}
+
+func (r *importRepository) UpdateImportJob(e *domain.ImportJob) error {
+	return r.db.Save(e).Error
+}
+
+// FailStaleImportJobs fails the unfinished jobs without progress since
+// updatedBefore, their import stopped with the process that ran it.
+func (r *importRepository) FailStaleImportJobs(updatedBefore time.Time, message string) (int64, error) {
+	result := r.db.Model(&domain.ImportJob{}).
+		Where("status IN ? AND updated_at < ?", []string{domain.ImportPending, domain.ImportRunning}, updatedBefore).
+		Updates(map[string]any{
+			"status":      domain.ImportFailed,
+			"message":     message,
+			"finished_at": time.Now(),
+		})
+
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,523 @@
+package repository
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"go-ecommerce-app/internal/domain"
+	"go-ecommerce-app/internal/dto"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInsufficientStock = errors.New("not enough stock")
+	ErrStockInWarehouses = errors.New("the stock is kept in warehouses, please book the change as a movement of a warehouse")
+)
+
+type InventoryRepository interface {
+	AddMovement(m domain.InventoryMovement) (dto.StockChange, error)
+	SetAvailable(productID uint, available int, actorID uint, note string) (dto.StockChange, error)
+	Reserve(userID uint, reference string, items []dto.StockItem, expiresAt time.Time) ([]dto.StockChange, error)
+	ReleaseReservations(reference string) ([]dto.StockChange, error)
+	FindExpiredReservations(now time.Time) ([]string, error)
+	CommitSale(userID uint, reference string, items []dto.StockItem) ([]dto.StockChange, error)
+	ReverseSale(reference string, actorID uint) ([]dto.StockChange, error)
+	FindStockLevel(productID uint) (domain.StockLevel, error)
+	FindLocationStock(productIDs []uint) ([]domain.LocationStock, error)
+	FindMovements(productID uint, filter dto.StockHistoryFilter) ([]domain.InventoryMovement, int64, error)
+}
+
+type inventoryRepository struct {
+	db *gorm.DB
+}
+
+func NewInventoryRepository(db *gorm.DB) InventoryRepository {
+	return &inventoryRepository{
+		db: db,
+	}
+}
+
+// AddMovement appends the movement, it fails with ErrInsufficientStock when the
+// movement would take more stock than is available.
+func (r *inventoryRepository) AddMovement(m domain.InventoryMovement) (dto.StockChange, error) {
+	var change dto.StockChange
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		change, err = applyMovement(tx, m)
+		return err
+	})
+
+	return change, err
+}
+
+// SetAvailable adjusts the on hand stock so the given quantity is available.
+func (r *inventoryRepository) SetAvailable(productID uint, available int, actorID uint, note string) (dto.StockChange, error) {
+	var change dto.StockChange
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		level, err := lockStockLevel(tx, productID)
+		if err != nil {
+			return err
+		}
+
+		change = dto.StockChange{ProductID: productID, Before: level, After: level}
+		if available == level.Available {
+			return nil
+		}
+
+		// the adjustment is booked to the unassigned pool, a decrease must not
+		// take stock the warehouses hold
+		delta := available - level.Available
+		if delta < 0 {
+			pool, err := locationOnHand(tx, productID, nil)
+			if err != nil {
+				return err
+			}
+			if pool+delta < 0 {
+				return ErrStockInWarehouses
+			}
+		}
+
+		change, err = applyMovement(tx, domain.InventoryMovement{
+			ProductID:   productID,
+			Kind:        domain.MovementAdjustment,
+			OnHandDelta: delta,
+			ActorID:     actorID,
+			Note:        note,
+		})
+		return err
+	})
+
+	return change, err
+}
+
+// Reserve holds the items for a checkout, either all of them or none.
+func (r *inventoryRepository) Reserve(userID uint, reference string, items []dto.StockItem, expiresAt time.Time) ([]dto.StockChange, error) {
+	var changes []dto.StockChange
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		for _, item := range sortedStockItems(items) {
+			reservation := domain.StockReservation{
+				ProductID: item.ProductID,
+				UserID:    userID,
+				Reference: reference,
+				Qty:       item.Qty,
+				Status:    domain.ReservationActive,
+				ExpiresAt: expiresAt,
+			}
+			if err := tx.Create(&reservation).Error; err != nil {
+				return err
+			}
+
+			change, err := applyMovement(tx, domain.InventoryMovement{
+				ProductID:     item.ProductID,
+				Kind:          domain.MovementReservation,
+				ReservedDelta: item.Qty,
+				ReservationID: &reservation.ID,
+				Reference:     reference,
+				ActorID:       userID,
+			})
+			if err != nil {
+				return err
+			}
+			changes = append(changes, change)
+		}
+		return nil
+	})
+
+	return changes, err
+}
+
+// ReleaseReservations gives back the stock held for a checkout and fails its
+// open payment session, the session cannot be completed without the stock.
+func (r *inventoryRepository) ReleaseReservations(reference string) ([]dto.StockChange, error) {
+	var changes []dto.StockChange
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var reservations []domain.StockReservation
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("reference=? AND status=?", reference, domain.ReservationActive).
+			Order("product_id").Find(&reservations).Error
+		if err != nil {
+			return err
+		}
+
+		for _, reservation := range reservations {
+			change, err := applyMovement(tx, domain.InventoryMovement{
+				ProductID:     reservation.ProductID,
+				Kind:          domain.MovementRelease,
+				ReservedDelta: -reservation.Qty,
+				ReservationID: &reservation.ID,
+				Reference:     reference,
+			})
+			if err != nil {
+				return err
+			}
+			changes = append(changes, change)
+		}
+
+		if len(reservations) > 0 {
+			err = tx.Model(&domain.StockReservation{}).
+				Where("reference=? AND status=?", reference, domain.ReservationActive).
+				Update("status", domain.ReservationReleased).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&domain.Payment{}).
+			Where("order_id=? AND status=?", reference, domain.PaymentStatusInitial).
+			Update("status", domain.PaymentStatusFailed).Error
+	})
+
+	return changes, err
+}
+
+// FindExpiredReservations returns the references of checkouts holding expired reservations.
+func (r *inventoryRepository) FindExpiredReservations(now time.Time) ([]string, error) {
+	var references []string
+
+	err := r.db.Model(&domain.StockReservation{}).
+		Where("status=? AND expires_at <= ?", domain.ReservationActive, now).
+		Distinct().Pluck("reference", &references).Error
+
+	return references, err
+}
+
+// CommitSale takes the sold items off the stock of their warehouses, the
+// active reservations of the user are used first and the rest must be available.
+func (r *inventoryRepository) CommitSale(userID uint, reference string, items []dto.StockItem) ([]dto.StockChange, error) {
+	var changes []dto.StockChange
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		consumed := map[uint]bool{}
+
+		for _, item := range sortedStockItems(items) {
+			var reservations []domain.StockReservation
+			reserved := 0
+
+			// the whole reservation is consumed with the first location of the
+			// product, any surplus goes back to available
+			if !consumed[item.ProductID] {
+				consumed[item.ProductID] = true
+
+				err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+					Where("user_id=? AND product_id=? AND status=?", userID, item.ProductID, domain.ReservationActive).
+					Order("created_at").Find(&reservations).Error
+				if err != nil {
+					return err
+				}
+
+				for _, reservation := range reservations {
+					reserved += reservation.Qty
+				}
+			}
+
+			change, err := applyMovement(tx, domain.InventoryMovement{
+				ProductID:     item.ProductID,
+				WarehouseID:   item.WarehouseID,
+				Kind:          domain.MovementSale,
+				OnHandDelta:   -item.Qty,
+				ReservedDelta: -reserved,
+				Reference:     reference,
+				ActorID:       userID,
+			})
+			if err != nil {
+				return err
+			}
+			changes = append(changes, change)
+
+			if len(reservations) > 0 {
+				ids := make([]uint, 0, len(reservations))
+				for _, reservation := range reservations {
+					ids = append(ids, reservation.ID)
+				}
+				err = tx.Model(&domain.StockReservation{}).Where("id IN ?", ids).
+					Update("status", domain.ReservationConsumed).Error
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+
+	return changes, err
+}
+
+// ReverseSale books the sale movements of the reference back as returns, a
+// sale is only reversed once.
+func (r *inventoryRepository) ReverseSale(reference string, actorID uint) ([]dto.StockChange, error) {
+	var changes []dto.StockChange
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var sales []domain.InventoryMovement
+		err := tx.Where("reference=? AND kind=?", reference, domain.MovementSale).Order("product_id").Find(&sales).Error
+		if err != nil {
+			return err
+		}
+
+		for _, sale := range sales {
+			var returned int64
+			query := tx.Model(&domain.InventoryMovement{}).
+				Where("reference=? AND kind=? AND product_id=?", reference, domain.MovementReturn, sale.ProductID)
+			if sale.WarehouseID != nil {
+				query = query.Where("warehouse_id=?", *sale.WarehouseID)
+			} else {
+				query = query.Where("warehouse_id IS NULL")
+			}
+			err = query.Count(&returned).Error
+			if err != nil {
+				return err
+			}
+			if returned > 0 {
+				continue
+			}
+
+			change, err := applyMovement(tx, domain.InventoryMovement{
+				ProductID:   sale.ProductID,
+				WarehouseID: sale.WarehouseID,
+				Kind:        domain.MovementReturn,
+				OnHandDelta: -sale.OnHandDelta,
+				Reference:   reference,
+				ActorID:     actorID,
+				Note:        "order cancelled",
+			})
+			if err != nil {
+				return err
+			}
+			changes = append(changes, change)
+		}
+		return nil
+	})
+
+	return changes, err
+}
+
+func (r *inventoryRepository) FindStockLevel(productID uint) (domain.StockLevel, error) {
+	var product domain.Product
+	if err := r.db.Select("id", "stock").First(&product, productID).Error; err != nil {
+		return domain.StockLevel{}, err
+	}
+
+	var count int64
+	if err := r.db.Model(&domain.InventoryMovement{}).Where("product_id=?", productID).Count(&count).Error; err != nil {
+		return domain.StockLevel{}, err
+	}
+
+	// products without ledger entries only have the stock column so far
+	if count == 0 {
+		stock := int(product.Stock)
+		return domain.StockLevel{OnHand: stock, Available: stock}, nil
+	}
+
+	return sumStockLevel(r.db, productID)
+}
+
+// FindLocationStock returns the on hand stock of the products by warehouse,
+// stock booked before warehouses were used is in the unassigned pool.
+func (r *inventoryRepository) FindLocationStock(productIDs []uint) ([]domain.LocationStock, error) {
+	var stock []domain.LocationStock
+	if len(productIDs) == 0 {
+		return stock, nil
+	}
+
+	err := r.db.Model(&domain.InventoryMovement{}).
+		Select("product_id, warehouse_id, SUM(on_hand_delta) AS on_hand").
+		Where("product_id IN ?", productIDs).
+		Group("product_id, warehouse_id").
+		Order("product_id, warehouse_id").
+		Scan(&stock).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// products without ledger entries only have the stock column so far
+	var products []domain.Product
+	err = r.db.Select("id", "stock").
+		Where("id IN ? AND stock > 0 AND NOT EXISTS (SELECT 1 FROM inventory_movements m WHERE m.product_id = products.id)", productIDs).
+		Find(&products).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range products {
+		stock = append(stock, domain.LocationStock{ProductID: p.ID, OnHand: int(p.Stock)})
+	}
+
+	return stock, nil
+}
+
+func (r *inventoryRepository) FindMovements(productID uint, filter dto.StockHistoryFilter) ([]domain.InventoryMovement, int64, error) {
+	var movements []domain.InventoryMovement
+	var total int64
+
+	query := r.db.Model(&domain.InventoryMovement{}).Where("product_id=?", productID)
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := query.Order("created_at desc, id desc").
+		Offset((filter.Page - 1) * filter.Limit).Limit(filter.Limit).Find(&movements).Error
+
+	return movements, total, err
+}
+
+// lockStockLevel locks the product for the rest of the transaction and
+// returns its stock. The stock column of a product without ledger entries is
+// booked as the opening balance first.
+func lockStockLevel(tx *gorm.DB, productID uint) (domain.StockLevel, error) {
+	var product domain.Product
+	// deleted products still get their sales reversed
+	err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "stock").First(&product, productID).Error
+	if err != nil {
+		return domain.StockLevel{}, err
+	}
+
+	var count int64
+	if err = tx.Model(&domain.InventoryMovement{}).Where("product_id=?", productID).Count(&count).Error; err != nil {
+		return domain.StockLevel{}, err
+	}
+
+	if count == 0 && product.Stock > 0 {
+		err = tx.Create(&domain.InventoryMovement{
+			ProductID:   productID,
+			Kind:        domain.MovementAdjustment,
+			OnHandDelta: int(product.Stock),
+			Note:        "opening balance",
+		}).Error
+		if err != nil {
+			return domain.StockLevel{}, err
+		}
+	}
+
+	return sumStockLevel(tx, productID)
+}
+
+func sumStockLevel(db *gorm.DB, productID uint) (domain.StockLevel, error) {
+	var level domain.StockLevel
+
+	err := db.Model(&domain.InventoryMovement{}).
+		Select("COALESCE(SUM(on_hand_delta), 0) AS on_hand, COALESCE(SUM(reserved_delta), 0) AS reserved").
+		Where("product_id=?", productID).Scan(&level).Error
+
+	level.Available = level.OnHand - level.Reserved
+
+	return level, err
+}
+
+// applyMovement books the movement and refreshes the cached stock column of
+// the product, the caller runs it in a transaction.
+func applyMovement(tx *gorm.DB, m domain.InventoryMovement) (dto.StockChange, error) {
+	before, err := lockStockLevel(tx, m.ProductID)
+	if err != nil {
+		return dto.StockChange{}, err
+	}
+
+	after := domain.StockLevel{
+		OnHand:   before.OnHand + m.OnHandDelta,
+		Reserved: max(before.Reserved+m.ReservedDelta, 0),
+	}
+	after.Available = after.OnHand - after.Reserved
+	// releases never fail, the reserved stock cannot go below zero
+	m.ReservedDelta = after.Reserved - before.Reserved
+
+	if after.OnHand < 0 || (after.Available < 0 && after.Available < before.Available) {
+		return dto.StockChange{}, fmt.Errorf("%w for product %d", ErrInsufficientStock, m.ProductID)
+	}
+
+	// a warehouse, or the unassigned pool, cannot ship more than it holds
+	if m.OnHandDelta < 0 {
+		onHand, err := locationOnHand(tx, m.ProductID, m.WarehouseID)
+		if err != nil {
+			return dto.StockChange{}, err
+		}
+		if onHand+m.OnHandDelta < 0 {
+			if m.WarehouseID == nil {
+				return dto.StockChange{}, fmt.Errorf("%w for product %d in the unassigned pool", ErrInsufficientStock, m.ProductID)
+			}
+			return dto.StockChange{}, fmt.Errorf("%w for product %d in warehouse %d", ErrInsufficientStock, m.ProductID, *m.WarehouseID)
+		}
+	}
+
+	if err = tx.Create(&m).Error; err != nil {
+		return dto.StockChange{}, err
+	}
+
+	err = tx.Unscoped().Model(&domain.Product{}).Where("id=?", m.ProductID).
+		UpdateColumn("stock", max(after.Available, 0)).Error
+	if err != nil {
+		return dto.StockChange{}, err
+	}
+
+	return dto.StockChange{ProductID: m.ProductID, Before: before, After: after}, nil
+}
+
+// locationOnHand sums the on hand stock of the product in the warehouse, a nil
+// warehouse is the unassigned pool.
+func locationOnHand(tx *gorm.DB, productID uint, warehouseID *uint) (int, error) {
+	query := tx.Model(&domain.InventoryMovement{}).Select("COALESCE(SUM(on_hand_delta), 0)").
+		Where("product_id=?", productID)
+	if warehouseID == nil {
+		query = query.Where("warehouse_id IS NULL")
+	} else {
+		query = query.Where("warehouse_id=?", *warehouseID)
+	}
+
+	var onHand int
+	err := query.Scan(&onHand).Error
+
+	return onHand, err
+}
+
+// sortedStockItems merges the items by product and warehouse and orders them
+// by product id, the products are always locked in the same order.
+func sortedStockItems(items []dto.StockItem) []dto.StockItem {
+	type key struct {
+		productID   uint
+		warehouseID uint // 0 for the unassigned pool
+	}
+
+	merged := map[key]*dto.StockItem{}
+	var sorted []dto.StockItem
+
+	for _, item := range items {
+		k := key{productID: item.ProductID}
+		if item.WarehouseID != nil {
+			k.warehouseID = *item.WarehouseID
+		}
+
+		if existing, ok := merged[k]; ok {
+			existing.Qty += item.Qty
+			continue
+		}
+
+		merged[k] = &dto.StockItem{ProductID: item.ProductID, WarehouseID: item.WarehouseID, Qty: item.Qty}
+	}
+
+	for _, item := range merged {
+		sorted = append(sorted, *item)
+	}
+
+	slices.SortFunc(sorted, func(a, b dto.StockItem) int {
+		if c := cmp.Compare(a.ProductID, b.ProductID); c != 0 {
+			return c
+		}
+		return cmp.Compare(warehouseKey(a.WarehouseID), warehouseKey(b.WarehouseID))
+	})
+
+	return sorted
+}
+
+func warehouseKey(id *uint) uint {
+	if id == nil {
+		return 0
+	}
+	return *id
+}
@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"fmt"
+	"go-ecommerce-app/internal/domain"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type PrivacyRepository interface {
+	FindOrdersWithItems(userID uint) ([]domain.Order, error)
+	FindPayments(userID uint) ([]domain.Payment, error)
+	FindIdentities(userID uint) ([]domain.UserIdentity, error)
+	FindWishlists(userID uint) ([]domain.Wishlist, error)
+	FindLoginAttempts(userID uint) ([]domain.LoginAttempt, error)
+	FindUsersDueForDeletion(now time.Time) ([]domain.User, error)
+	AnonymizeUser(userID uint) ([]string, error)
+}
+
+type privacyRepository struct {
+	db *gorm.DB
+}
+
+func NewPrivacyRepository(db *gorm.DB) PrivacyRepository {
+	return &privacyRepository{
+		db: db,
+	}
+}
+
+func (r privacyRepository) FindOrdersWithItems(userID uint) ([]domain.Order, error) {
+	var orders []domain.Order
+
+	err := r.db.Preload("Items").Where("user_id=?", userID).Order("created_at").Find(&orders).Error
+
+	return orders, err
+}
+
+func (r privacyRepository) FindPayments(userID uint) ([]domain.Payment, error) {
+	var payments []domain.Payment
+
+	err := r.db.Where("user_id=?", userID).Order("created_at").Find(&payments).Error
+
+	return payments, err
+}
+
+func (r privacyRepository) FindIdentities(userID uint) ([]domain.UserIdentity, error) {
+	var identities []domain.UserIdentity
+
+	err := r.db.Where("user_id=?", userID).Find(&identities).Error
+
+	return identities, err
+}
+
+func (r privacyRepository) FindWishlists(userID uint) ([]domain.Wishlist, error) {
+	var wishlists []domain.Wishlist
+
+	err := r.db.Preload("Items").Where("user_id=?", userID).Order("created_at").Find(&wishlists).Error
+
+	return wishlists, err
+}
+
+// FindLoginAttempts returns the failed attempts too, unlike the login history.
+func (r privacyRepository) FindLoginAttempts(userID uint) ([]domain.LoginAttempt, error) {
+	var attempts []domain.LoginAttempt
+
+	err := r.db.Where("user_id=?", userID).Order("created_at").Find(&attempts).Error
+
+	return attempts, err
+}
+
+func (r privacyRepository) FindUsersDueForDeletion(now time.Time) ([]domain.User, error) {
+	var users []domain.User
+
+	err := r.db.Where("deletion_due_at <= ? AND anonymized_at IS NULL", now).Find(&users).Error
+
+	return users, err
+}
+
+// AnonymizeUser strips personal data from the account in one transaction.
+// Orders, order items and payments are kept for accounting, only the personal
+// part of their address snapshots is cleared. It returns the blob store keys of
+// the removed KYC documents and review images, the caller deletes the files.
+// Access tokens issued before are revoked.
+func (r privacyRepository) AnonymizeUser(userID uint) ([]string, error) {
+	var blobs []string
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		err := tx.Model(&domain.User{}).Where("id=?", userID).Updates(map[string]any{
+			"first_name":           "",
+			"last_name":            "",
+			"email":                fmt.Sprintf("deleted-%d@users.invalid", userID),
+			"phone":                "",
+			"password":             "",
+			"verified":             false,
+			"two_factor_enabled":   false,
+			"two_factor_secret":    "",
+			"two_factor_last_step": 0,
+			"deletion_due_at":      nil,
+			"anonymized_at":        now,
+			"tokens_revoked_at":    now,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		// country and subdivision stay on the snapshots for tax reporting
+		snapshot := map[string]any{}
+		for _, prefix := range []string{"shipping_", "billing_"} {
+			for _, column := range []string{"name", "phone", "address_input1", "address_input2", "city", "post_code"} {
+				snapshot[prefix+column] = ""
+			}
+		}
+		if err = tx.Model(&domain.Order{}).Where("user_id=?", userID).Updates(snapshot).Error; err != nil {
+			return err
+		}
+
+		err = tx.Model(&domain.LoginAttempt{}).Where("user_id=?", userID).Updates(map[string]any{
+			"email":      "",
+			"ip":         "",
+			"user_agent": "",
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		// ratings keep counting towards the product, the text and images go
+		var reviews []domain.Review
+		if err = tx.Where("user_id=?", userID).Find(&reviews).Error; err != nil {
+			return err
+		}
+		for _, review := range reviews {
+			blobs = append(blobs, review.ImageKeys...)
+		}
+		err = tx.Model(&domain.Review{}).Where("user_id=?", userID).Updates(map[string]any{
+			"title":      "",
+			"body":       "",
+			"images":     "[]",
+			"image_keys": "[]",
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		applications := tx.Model(&domain.SellerApplication{}).Select("id").Where("user_id=?", userID)
+
+		var documents []domain.SellerDocument
+		if err = tx.Where("application_id IN (?)", applications).Find(&documents).Error; err != nil {
+			return err
+		}
+		for _, document := range documents {
+			blobs = append(blobs, document.StoragePath)
+		}
+		if err = tx.Where("application_id IN (?)", applications).Delete(&domain.SellerDocument{}).Error; err != nil {
+			return err
+		}
+
+		wishlists := tx.Model(&domain.Wishlist{}).Select("id").Where("user_id=?", userID)
+		if err = tx.Where("wishlist_id IN (?)", wishlists).Delete(&domain.WishlistItem{}).Error; err != nil {
+			return err
+		}
+
+		for _, model := range []any{
+			&domain.SellerApplication{},
+			&domain.BankAccount{},
+			&domain.Wishlist{},
+			&domain.ProductAlert{},
+			&domain.Address{},
+			&domain.Cart{},
+			&domain.VerificationCode{},
+			&domain.RecoveryCode{},
+			&domain.UserIdentity{},
+			&domain.OAuthState{},
+			&domain.ApiKey{},
+		} {
+			if err = tx.Where("user_id=?", userID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return blobs, nil
+}
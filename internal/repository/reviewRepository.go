@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"go-ecommerce-app/internal/domain"
+	"go-ecommerce-app/internal/dto"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var reviewOrders = map[string]string{
+	"newest":      "created_at desc, id desc",
+	"oldest":      "created_at, id",
+	"helpful":     "helpful_count desc, created_at desc",
+	"rating_desc": "rating desc, created_at desc",
+	"rating_asc":  "rating asc, created_at desc",
+}
+
+type ReviewRepository interface {
+	FindDeliveredOrderItem(userID, productID uint) (domain.OrderItem, error)
+	CreateReview(e *domain.Review) error
+	FindReview(id uint) (domain.Review, error)
+	FindUserReview(productID, userID uint) (domain.Review, error)
+	FindReviews(productID uint, filter dto.ReviewFilter) ([]domain.Review, int64, error)
+	UpdateReview(id uint, fields map[string]any) error
+	UpdateReviewStatus(id uint, from []string, fields map[string]any) (bool, error)
+	DeleteReview(id uint) error
+	AddVote(reviewID, userID uint) (bool, error)
+	RemoveVote(reviewID, userID uint) (bool, error)
+	RefreshProductRating(productID uint) error
+}
+
+type reviewRepository struct {
+	db *gorm.DB
+}
+
+func NewReviewRepository(db *gorm.DB) ReviewRepository {
+	return &reviewRepository{
+		db: db,
+	}
+}
+
+// FindDeliveredOrderItem finds an item of a delivered order of the user for the product.
+func (r *reviewRepository) FindDeliveredOrderItem(userID, productID uint) (domain.OrderItem, error) {
+	var item domain.OrderItem
+
+	err := r.db.Joins("JOIN orders ON orders.id = order_items.order_id").
+		Where("orders.user_id=? AND orders.status=? AND order_items.product_id=?", userID, domain.OrderStatusDelivered, productID).
+		Order("orders.delivered_at desc").
+		First(&item).Error
+
+	return item, err
+}
+
+func (r *reviewRepository) CreateReview(e *domain.Review) error {
+	return r.db.Create(e).Error
+}
+
+func (r *reviewRepository) FindReview(id uint) (domain.Review, error) {
+	var review domain.Review
+
+	err := r.db.First(&review, id).Error
+
+	return review, err
+}
+
+func (r *reviewRepository) FindUserReview(productID, userID uint) (domain.Review, error) {
+	var review domain.Review
+
+	err := r.db.Where("product_id=? AND user_id=?", productID, userID).First(&review).Error
+
+	return review, err
+}
+
+// FindReviews lists the reviews of a product, or of every product when productID is 0.
+func (r *reviewRepository) FindReviews(productID uint, filter dto.ReviewFilter) ([]domain.Review, int64, error) {
+	var reviews []domain.Review
+	var total int64
+
+	query := r.db.Model(&domain.Review{})
+	if productID > 0 {
+		query = query.Where("product_id=?", productID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status=?", filter.Status)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	order, ok := reviewOrders[filter.Sort]
+	if !ok {
+		order = reviewOrders["newest"]
+	}
+
+	err := query.Order(order).Offset((filter.Page - 1) * filter.Limit).Limit(filter.Limit).Find(&reviews).Error
+
+	return reviews, total, err
+}
+
+func (r *reviewRepository) UpdateReview(id uint, fields map[string]any) error {
+	return r.db.Model(&domain.Review{}).Where("id=?", id).Updates(fields).Error
+}
+
+// UpdateReviewStatus only updates a review in one of the from statuses, it
+// reports false when another moderator got there first.
+func (r *reviewRepository) UpdateReviewStatus(id uint, from []string, fields map[string]any) (bool, error) {
+	result := r.db.Model(&domain.Review{}).Where("id=? AND status IN ?", id, from).Updates(fields)
+
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *reviewRepository) DeleteReview(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("review_id=?", id).Delete(&domain.ReviewVote{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&domain.Review{}, id).Error
+	})
+}
+
+// AddVote reports false when the user already voted for the review.
+func (r *reviewRepository) AddVote(reviewID, userID uint) (bool, error) {
+	added := false
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&domain.ReviewVote{ReviewID: reviewID, UserID: userID})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		added = true
+		return tx.Model(&domain.Review{}).Where("id=?", reviewID).
+			UpdateColumn("helpful_count", gorm.Expr("helpful_count + 1")).Error
+	})
+
+	return added, err
+}
+
+func (r *reviewRepository) RemoveVote(reviewID, userID uint) (bool, error) {
+	removed := false
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("review_id=? AND user_id=?", reviewID, userID).Delete(&domain.ReviewVote{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		removed = true
+		return tx.Model(&domain.Review{}).Where("id=?", reviewID).
+			UpdateColumn("helpful_count", gorm.Expr("GREATEST(helpful_count - 1, 0)")).Error
+	})
+
+	return removed, err
+}
+
+// RefreshProductRating recomputes the denormalized rating of the product from
+// its approved reviews.
+func (r *reviewRepository) RefreshProductRating(productID uint) error {
+	return r.db.Exec(`UPDATE products SET
+		rating_average = COALESCE((SELECT ROUND(AVG(rating)::numeric, 2) FROM reviews WHERE product_id = @id AND status = @status), 0),
+		rating_count = (SELECT COUNT(*) FROM reviews WHERE product_id = @id AND status = @status)
+		WHERE id = @id`,
+		map[string]any{"id": productID, "status": domain.ReviewApproved}).Error
+}
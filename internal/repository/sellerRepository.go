@@ -0,0 +1,244 @@
+package repository
+
+import (
+	"errors"
+	"go-ecommerce-app/internal/domain"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPendingApplication = errors.New("you already have a pending seller application")
+	ErrApplicantNotBuyer  = errors.New("the applicant is no longer a buyer")
+)
+
+type SellerRepository interface {
+	CreateApplication(e *domain.SellerApplication) error
+	FindLatestApplication(userID uint) (domain.SellerApplication, error)
+	FindApplicationByID(id uint) (domain.SellerApplication, error)
+	FindApplications(status string, page, limit int) ([]domain.SellerApplication, int64, error)
+	UpdateApplicationStatus(id uint, from []string, fields map[string]any) (bool, error)
+	ApproveApplication(e domain.SellerApplication, reviewerID uint) (bool, error)
+	CreateDocument(e *domain.SellerDocument) error
+	FindDocument(applicationID, id uint) (domain.SellerDocument, error)
+	ReleaseDocumentFiles(applicationID uint) ([]string, error)
+	AccountInUse(accountIndex string, userID uint) (bool, error)
+}
+
+// MigrateLegacyBankAccounts turns the numeric account numbers of the former
+// instant upgrade into text and drops their unique constraint, run it before
+// AutoMigrate. Numbers are compared on the blind index now, which the key
+// rotation job fills while encrypting them.
+func MigrateLegacyBankAccounts(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&domain.BankAccount{}) {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var accountType string
+		err := tx.Raw(`SELECT data_type FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = 'bank_accounts' AND column_name = 'bank_account'`).
+			Scan(&accountType).Error
+		if err != nil {
+			return err
+		}
+
+		if accountType == "bigint" || accountType == "integer" {
+			err = tx.Exec("ALTER TABLE bank_accounts ALTER COLUMN bank_account TYPE text USING COALESCE(NULLIF(bank_account, 0)::text, '')").Error
+			if err != nil {
+				return err
+			}
+		}
+
+		// named by gorm, or by postgres for tables created by older gorm versions
+		for _, constraint := range []string{"uni_bank_accounts_bank_account", "bank_accounts_bank_account_key"} {
+			if err = tx.Exec("ALTER TABLE bank_accounts DROP CONSTRAINT IF EXISTS " + constraint).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// pendingApplicationsSQL allows one open application per user, the older
+// duplicates that slipped in before are rejected first.
+const pendingApplicationsSQL = `
+UPDATE seller_applications a
+SET status = 'rejected', rejection_reason = 'superseded by a newer application', reviewed_at = now()
+WHERE a.status IN ('submitted', 'under_review') AND EXISTS (
+	SELECT 1 FROM seller_applications b
+	WHERE b.user_id = a.user_id AND b.status IN ('submitted', 'under_review') AND b.id > a.id
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_seller_applications_pending
+	ON seller_applications (user_id) WHERE status IN ('submitted', 'under_review');
+`
+
+// MigrateSellers adds the pending application index, run it after AutoMigrate.
+func MigrateSellers(db *gorm.DB) error {
+	return db.Exec(pendingApplicationsSQL).Error
+}
+
+type sellerRepository struct {
+	db *gorm.DB
+}
+
+func NewSellerRepository(db *gorm.DB) SellerRepository {
+	return &sellerRepository{
+		db: db,
+	}
+}
+
+// CreateApplication stores the application together with its payout account.
+// It returns ErrPendingApplication when a concurrent request got there first.
+func (r *sellerRepository) CreateApplication(e *domain.SellerApplication) error {
+	err := r.db.Create(e).Error
+	if err != nil && strings.Contains(err.Error(), "idx_seller_applications_pending") {
+		return ErrPendingApplication
+	}
+
+	return err
+}
+
+func (r *sellerRepository) FindLatestApplication(userID uint) (domain.SellerApplication, error) {
+	var application domain.SellerApplication
+
+	err := r.db.Preload("BankAccount").Preload("Documents").
+		Where("user_id=?", userID).Order("created_at desc, id desc").First(&application).Error
+
+	return application, err
+}
+
+func (r *sellerRepository) FindApplicationByID(id uint) (domain.SellerApplication, error) {
+	var application domain.SellerApplication
+
+	err := r.db.Preload("BankAccount").Preload("Documents").First(&application, id).Error
+
+	return application, err
+}
+
+func (r *sellerRepository) FindApplications(status string, page, limit int) ([]domain.SellerApplication, int64, error) {
+	var applications []domain.SellerApplication
+	var total int64
+
+	query := r.db.Model(&domain.SellerApplication{})
+	if status != "" {
+		query = query.Where("status=?", status)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := query.Preload("Documents").Order("created_at").
+		Offset((page - 1) * limit).Limit(limit).Find(&applications).Error
+
+	return applications, total, err
+}
+
+// UpdateApplicationStatus only updates an application that is in one of the
+// from states, it reports false when another reviewer got there first.
+func (r *sellerRepository) UpdateApplicationStatus(id uint, from []string, fields map[string]any) (bool, error) {
+	result := r.db.Model(&domain.SellerApplication{}).
+		Where("id=? AND status IN ?", id, from).
+		Updates(fields)
+
+	return result.RowsAffected > 0, result.Error
+}
+
+// ApproveApplication grants the seller role and marks the payout account as
+// verified in the same transaction as the status change.
+func (r *sellerRepository) ApproveApplication(e domain.SellerApplication, reviewerID uint) (bool, error) {
+	approved := false
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		result := tx.Model(&domain.SellerApplication{}).
+			Where("id=? AND status=?", e.ID, domain.ApplicationUnderReview).
+			Updates(map[string]any{
+				"status":      domain.ApplicationApproved,
+				"reviewer_id": reviewerID,
+				"reviewed_at": now,
+			})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		// the role may have changed since the application was submitted
+		result = tx.Model(&domain.User{}).
+			Where("id=? AND user_type=? AND anonymized_at IS NULL", e.UserID, domain.BUYER).
+			Updates(map[string]any{
+				"first_name": e.FirstName,
+				"last_name":  e.LastName,
+				"user_type":  domain.SELLER,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrApplicantNotBuyer
+		}
+
+		err := tx.Model(&domain.BankAccount{}).Where("id=?", e.BankAccountID).Updates(map[string]any{
+			"verified":    true,
+			"verified_at": now,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		approved = true
+		return nil
+	})
+
+	return approved, err
+}
+
+func (r *sellerRepository) CreateDocument(e *domain.SellerDocument) error {
+	return r.db.Create(e).Error
+}
+
+func (r *sellerRepository) FindDocument(applicationID, id uint) (domain.SellerDocument, error) {
+	var document domain.SellerDocument
+
+	err := r.db.Where("id=? AND application_id=?", id, applicationID).First(&document).Error
+
+	return document, err
+}
+
+// ReleaseDocumentFiles unlinks the files of the application documents once it
+// is decided and returns their blob store keys, the records stay as evidence.
+func (r *sellerRepository) ReleaseDocumentFiles(applicationID uint) ([]string, error) {
+	var keys []string
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&domain.SellerDocument{}).
+			Where("application_id=? AND storage_path <> ''", applicationID).
+			Pluck("storage_path", &keys).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&domain.SellerDocument{}).
+			Where("application_id=?", applicationID).
+			Update("storage_path", "").Error
+	})
+
+	return keys, err
+}
+
+// AccountInUse reports whether a verified payout account of another user has
+// the same number, matched on the blind index since the number is encrypted.
+func (r *sellerRepository) AccountInUse(accountIndex string, userID uint) (bool, error) {
+	var count int64
+
+	err := r.db.Model(&domain.BankAccount{}).
+		Where("account_index=? AND user_id<>? AND verified=?", accountIndex, userID, true).
+		Count(&count).Error
+
+	return count > 0, err
+}
@@ -3,15 +3,34 @@ package repository
 import (
 	"go-ecommerce-app/internal/domain"
 	"go-ecommerce-app/internal/dto"
+	"log"
 
 	"gorm.io/gorm"
 )
 
+// MigrateOrders gives orders placed before statuses were tracked the
+// pending status, the transitions don't start from an empty one.
+func MigrateOrders(db *gorm.DB) error {
+	result := db.Model(&domain.Order{}).
+		Where("status IS NULL OR status = ''").
+		Update("status", domain.OrderStatusPending)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("set the status of %d orders to pending", result.RowsAffected)
+	}
+
+	return nil
+}
+
 type TransactionRepository interface {
 	CreatePayment(payment *domain.Payment) error
 	FindInitialPayment(userID uint) (*domain.Payment, error)
 	FindOrders(userID uint) ([]domain.OrderItem, error)
 	FindOrderByID(userID, orderID uint) (dto.SellerOrderDetails, error)
+	FindOrder(id uint) (domain.Order, error)
+	UpdateOrderStatus(id uint, from string, fields map[string]any) (bool, error)
 }
 
 type transactionRepository struct {
@@ -29,9 +48,9 @@ func (r *transactionRepository) CreatePayment(payment *domain.Payment) error {
 }
 
 func (r *transactionRepository) FindInitialPayment(userID uint) (*domain.Payment, error) {
-	var payment *domain.Payment
-	err := r.db.First(&payment, "user_id=? AND status=initial", userID).Order("created_at desc").Error
-	return payment, err
+	var payment domain.Payment
+	err := r.db.Where("user_id=? AND status=?", userID, domain.PaymentStatusInitial).Order("created_at desc").First(&payment).Error
+	return &payment, err
 }
 
 func (r *transactionRepository) FindOrders(userID uint) ([]domain.OrderItem, error) {
@@ -42,3 +61,18 @@ func (r *transactionRepository) FindOrderByID(userID, orderID uint) (dto.SellerO
 	panic("")
 }
 
+func (r *transactionRepository) FindOrder(id uint) (domain.Order, error) {
+	var order domain.Order
+
+	err := r.db.Preload("Items.Allocations").First(&order, id).Error
+
+	return order, err
+}
+
+// UpdateOrderStatus only changes an order still in the from status, it
+// reports false when the order was changed in the meantime.
+func (r *transactionRepository) UpdateOrderStatus(id uint, from string, fields map[string]any) (bool, error) {
+	result := r.db.Model(&domain.Order{}).Where("id=? AND COALESCE(status, '')=?", id, from).Updates(fields)
+
+	return result.RowsAffected > 0, result.Error
+}
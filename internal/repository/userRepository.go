@@ -2,6 +2,9 @@ package repository
 
 import (
 	"go-ecommerce-app/internal/domain"
+	"go-ecommerce-app/pkg/address"
+	"log"
+	"time"
 
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -12,11 +15,33 @@ type UserRepository interface {
 	FindUser(email string) (domain.User, error)
 	FindUserByID(id uint) (domain.User, error)
 	UpdateUser(id uint, u domain.User) (domain.User, error)
-	CreateBankAccount(e domain.BankAccount) error
+	UpdateUserFields(id uint, fields map[string]any) error
+	TokensRevokedAt(id uint) (*time.Time, error)
+
+	// Verification
+	CreateVerificationCode(e domain.VerificationCode) error
+	FindLatestVerificationCode(userID uint, purpose string) (domain.VerificationCode, error)
+	FindVerificationCodeByHash(purpose, codeHash string) (domain.VerificationCode, error)
+	IncrementVerificationAttempts(id uint) (int, error)
+	MarkVerificationCodeUsed(id uint) error
+	CountVerificationCodesByUser(userID uint, purpose string, since time.Time) (int64, error)
+	CountVerificationCodesByTarget(targetIndex string, since time.Time) (int64, error)
+
+	// Security
+	CreateLoginAttempt(e domain.LoginAttempt) error
+	FindRecentLoginAttempts(email, ip string, since time.Time) ([]domain.LoginAttempt, error)
+	FindLoginHistory(userID uint, limit int) ([]domain.LoginAttempt, error)
+	ReplaceRecoveryCodes(userID uint, codes []domain.RecoveryCode) error
+	FindUnusedRecoveryCodes(userID uint) ([]domain.RecoveryCode, error)
+	MarkRecoveryCodeUsed(id uint) (bool, error)
+	DeleteRecoveryCodes(userID uint) error
 
 	// Cart
 	FindCartItems(userID uint) ([]domain.Cart, error)
 	FindCartItem(userID, productID uint) (domain.Cart, error)
+	FindCartItemByID(userID, id uint) (domain.Cart, error)
+	FindSavedItems(userID uint) ([]domain.Cart, error)
+	SetCartSaved(id uint, saved bool, qty uint, price float64) error
 	CreateCart(c domain.Cart) error
 	UpdateCart(c domain.Cart) error
 	DeleteCartByID(id uint) error
@@ -27,9 +52,13 @@ type UserRepository interface {
 	FindOrders(userID uint) ([]domain.Order, error)
 	FindOrderByID(orderID, userID uint) (domain.Order, error)
 
-	// Profile
-	CreateProfile(e domain.Address) error
-	UpdateProfile(e domain.Address) error
+	// Address
+	CreateAddress(e *domain.Address) error
+	FindAddresses(userID uint) ([]domain.Address, error)
+	FindAddress(id, userID uint) (domain.Address, error)
+	UpdateAddress(e *domain.Address) error
+	DeleteAddress(id, userID uint) error
+	SetDefaultAddress(id, userID uint, shipping, billing bool) error
 }
 
 type userRepository struct {
@@ -42,6 +71,120 @@ func NewUserRepository(db *gorm.DB) UserRepository {
 	}
 }
 
+// lowercaseEmailsSQL lowercases the emails stored before sign up and login
+// normalized them, unless another account already owns the lowercase form.
+const lowercaseEmailsSQL = `
+UPDATE users SET email = lower(email)
+WHERE email <> lower(email)
+	AND NOT EXISTS (SELECT 1 FROM users other WHERE other.id <> users.id AND lower(other.email) = lower(users.email))
+`
+
+// MigrateUsers normalizes the stored user data, run it after AutoMigrate.
+func MigrateUsers(db *gorm.DB) error {
+	result := db.Exec(lowercaseEmailsSQL)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	var conflicts int64
+	err := db.Model(&domain.User{}).Where("email <> lower(email)").Count(&conflicts).Error
+	if err != nil {
+		return err
+	}
+
+	if conflicts > 0 {
+		log.Printf("%d users keep a mixed case email, another account owns the lowercase one", conflicts)
+	}
+
+	return nil
+}
+
+// MigrateLegacyAddresses converts the addresses stored before countries were
+// ISO codes and postal codes text, run it before AutoMigrate. Country names are
+// mapped to their alpha-2 code, values no country matches are cleared since
+// they don't fit the two letter column, and the 0 of unset postal codes is dropped.
+func MigrateLegacyAddresses(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&domain.Address{}) {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var postCodeType string
+		err := tx.Raw(`SELECT data_type FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = 'addresses' AND column_name = 'post_code'`).
+			Scan(&postCodeType).Error
+		if err != nil {
+			return err
+		}
+
+		if postCodeType == "bigint" || postCodeType == "integer" {
+			err = tx.Exec("ALTER TABLE addresses ALTER COLUMN post_code TYPE text USING COALESCE(NULLIF(post_code, 0)::text, '')").Error
+			if err != nil {
+				return err
+			}
+		}
+
+		var legacy []string
+		err = tx.Model(&domain.Address{}).Distinct("country").Where("country !~ '^[A-Z]{2}$'").Pluck("country", &legacy).Error
+		if err != nil {
+			return err
+		}
+
+		cleared := 0
+		for _, value := range legacy {
+			code := ""
+			if country, ok := address.Lookup(value); ok {
+				code = country.Code
+			} else if value != "" {
+				cleared++
+			}
+
+			if err = tx.Model(&domain.Address{}).Where("country=?", value).UpdateColumn("country", code).Error; err != nil {
+				return err
+			}
+		}
+
+		if cleared > 0 {
+			log.Printf("cleared %d unknown address countries, the users have to pick them again", cleared)
+		}
+
+		return nil
+	})
+}
+
+// MigrateVerificationCodes renames the phone column of the codes sent before
+// email codes existed, run it before AutoMigrate. The phone numbers are
+// encrypted and indexed by the key rotation job.
+func MigrateVerificationCodes(db *gorm.DB) error {
+	migrator := db.Migrator()
+
+	if !migrator.HasTable(&domain.VerificationCode{}) || !migrator.HasColumn(&domain.VerificationCode{}, "phone") {
+		return nil
+	}
+
+	// the plaintext index is of no use for ciphertext
+	if migrator.HasIndex(&domain.VerificationCode{}, "idx_verification_codes_phone") {
+		if err := migrator.DropIndex(&domain.VerificationCode{}, "idx_verification_codes_phone"); err != nil {
+			return err
+		}
+	}
+
+	return migrator.RenameColumn(&domain.VerificationCode{}, "phone", "target")
+}
+
+// PromoteAdmins makes the registered users with the given emails admins.
+func PromoteAdmins(db *gorm.DB, emails []string) (int64, error) {
+	if len(emails) == 0 {
+		return 0, nil
+	}
+
+	result := db.Model(&domain.User{}).
+		Where("email IN ? AND user_type <> ? AND anonymized_at IS NULL", emails, domain.ADMIN).
+		Update("user_type", domain.ADMIN)
+
+	return result.RowsAffected, result.Error
+}
+
 func (r userRepository) CreateUser(u domain.User) (domain.User, error) {
 	if err := r.db.Create(&u).Error; err != nil {
 		return domain.User{}, err
@@ -53,7 +196,7 @@ func (r userRepository) CreateUser(u domain.User) (domain.User, error) {
 func (r userRepository) FindUser(email string) (domain.User, error) {
 	var user domain.User
 
-	if err := r.db.Preload("Address").First(&user, "email=?", email).Error; err != nil {
+	if err := r.db.Preload("Addresses").First(&user, "email=?", email).Error; err != nil {
 		return domain.User{}, err
 	}
 
@@ -64,7 +207,7 @@ func (r userRepository) FindUserByID(id uint) (domain.User, error) {
 	var user domain.User
 
 	err := r.db.
-		Preload("Address").
+		Preload("Addresses").
 		Preload("Cart").
 		Preload("Orders").
 		First(&user, id).Error
@@ -86,14 +229,130 @@ func (r userRepository) UpdateUser(id uint, u domain.User) (domain.User, error)
 	return user, nil
 }
 
-func (r userRepository) CreateBankAccount(e domain.BankAccount) error {
+// UpdateUserFields updates the given columns, including zero values which Updates(struct) skips.
+func (r userRepository) UpdateUserFields(id uint, fields map[string]any) error {
+	return r.db.Model(&domain.User{}).Where("id=?", id).Updates(fields).Error
+}
+
+// TokensRevokedAt is checked on every authenticated request, see helper.TokenRevocations.
+func (r userRepository) TokensRevokedAt(id uint) (*time.Time, error) {
+	var user domain.User
+
+	err := r.db.Select("tokens_revoked_at").First(&user, id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return user.TokensRevokedAt, nil
+}
+
+// Verification
+func (r userRepository) CreateVerificationCode(e domain.VerificationCode) error {
 	return r.db.Create(&e).Error
 }
 
+func (r userRepository) FindLatestVerificationCode(userID uint, purpose string) (domain.VerificationCode, error) {
+	var code domain.VerificationCode
+
+	err := r.db.Where("user_id=? AND purpose=?", userID, purpose).Order("created_at desc").First(&code).Error
+
+	return code, err
+}
+
+func (r userRepository) FindVerificationCodeByHash(purpose, codeHash string) (domain.VerificationCode, error) {
+	var code domain.VerificationCode
+
+	err := r.db.Where("purpose=? AND code_hash=?", purpose, codeHash).First(&code).Error
+
+	return code, err
+}
+
+func (r userRepository) IncrementVerificationAttempts(id uint) (int, error) {
+	var code domain.VerificationCode
+
+	err := r.db.Model(&code).Clauses(clause.Returning{}).Where("id=?", id).
+		Update("attempts", gorm.Expr("attempts + 1")).Error
+	if err != nil {
+		return 0, err
+	}
+
+	return code.Attempts, nil
+}
+
+func (r userRepository) MarkVerificationCodeUsed(id uint) error {
+	return r.db.Model(&domain.VerificationCode{}).Where("id=?", id).Update("used_at", time.Now()).Error
+}
+
+func (r userRepository) CountVerificationCodesByUser(userID uint, purpose string, since time.Time) (int64, error) {
+	var count int64
+
+	err := r.db.Model(&domain.VerificationCode{}).Where("user_id=? AND purpose=? AND created_at > ?", userID, purpose, since).Count(&count).Error
+
+	return count, err
+}
+
+func (r userRepository) CountVerificationCodesByTarget(targetIndex string, since time.Time) (int64, error) {
+	var count int64
+
+	err := r.db.Model(&domain.VerificationCode{}).Where("target_index=? AND created_at > ?", targetIndex, since).Count(&count).Error
+
+	return count, err
+}
+
+// Security
+func (r userRepository) CreateLoginAttempt(e domain.LoginAttempt) error {
+	return r.db.Create(&e).Error
+}
+
+func (r userRepository) FindRecentLoginAttempts(email, ip string, since time.Time) ([]domain.LoginAttempt, error) {
+	var attempts []domain.LoginAttempt
+
+	err := r.db.Where("email=? AND ip=? AND created_at > ?", email, ip, since).Order("created_at desc").Find(&attempts).Error
+
+	return attempts, err
+}
+
+func (r userRepository) FindLoginHistory(userID uint, limit int) ([]domain.LoginAttempt, error) {
+	var attempts []domain.LoginAttempt
+
+	err := r.db.Where("user_id=? AND success=?", userID, true).Order("created_at desc").Limit(limit).Find(&attempts).Error
+
+	return attempts, err
+}
+
+func (r userRepository) ReplaceRecoveryCodes(userID uint, codes []domain.RecoveryCode) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id=?", userID).Delete(&domain.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&codes).Error
+	})
+}
+
+func (r userRepository) FindUnusedRecoveryCodes(userID uint) ([]domain.RecoveryCode, error) {
+	var codes []domain.RecoveryCode
+
+	err := r.db.Where("user_id=? AND used_at IS NULL", userID).Find(&codes).Error
+
+	return codes, err
+}
+
+// MarkRecoveryCodeUsed reports false when the code was already used by a concurrent request.
+func (r userRepository) MarkRecoveryCodeUsed(id uint) (bool, error) {
+	result := r.db.Model(&domain.RecoveryCode{}).Where("id=? AND used_at IS NULL", id).Update("used_at", time.Now())
+
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r userRepository) DeleteRecoveryCodes(userID uint) error {
+	return r.db.Where("user_id=?", userID).Delete(&domain.RecoveryCode{}).Error
+}
+
 // Cart
 func (r userRepository) FindCartItems(userID uint) ([]domain.Cart, error) {
 	var carts []domain.Cart
-	err := r.db.Where("user_id=?", userID).Find(&carts).Error
+	err := r.db.Where("user_id=? AND saved_for_later=?", userID, false).Find(&carts).Error
 
 	return carts, err
 }
@@ -105,6 +364,31 @@ func (r userRepository) FindCartItem(userID, productID uint) (domain.Cart, error
 	return cartItem, err
 }
 
+func (r userRepository) FindCartItemByID(userID, id uint) (domain.Cart, error) {
+	cartItem := domain.Cart{}
+	err := r.db.Where("id=? AND user_id=?", id, userID).First(&cartItem).Error
+
+	return cartItem, err
+}
+
+func (r userRepository) FindSavedItems(userID uint) ([]domain.Cart, error) {
+	var carts []domain.Cart
+	err := r.db.Where("user_id=? AND saved_for_later=?", userID, true).Order("updated_at desc").Find(&carts).Error
+
+	return carts, err
+}
+
+// SetCartSaved moves an item between the cart and the saved for later list,
+// struct updates would skip the false flag.
+func (r userRepository) SetCartSaved(id uint, saved bool, qty uint, price float64) error {
+	return r.db.Model(&domain.Cart{}).Where("id=?", id).Updates(map[string]any{
+		"saved_for_later": saved,
+		"qty":             qty,
+		"price":           price,
+		"updated_at":      time.Now(),
+	}).Error
+}
+
 func (r userRepository) CreateCart(c domain.Cart) error {
 	return r.db.Create(&c).Error
 }
@@ -121,7 +405,7 @@ func (r userRepository) DeleteCartByID(id uint) error {
 }
 
 func (r userRepository) DeleteCartItems(userID uint) error {
-	err := r.db.Where("user_id=?", userID).Delete(&domain.Cart{}).Error
+	err := r.db.Where("user_id=? AND saved_for_later=?", userID, false).Delete(&domain.Cart{}).Error
 	return err
 }
 
@@ -141,17 +425,55 @@ func (r userRepository) FindOrders(userID uint) ([]domain.Order, error) {
 func (r userRepository) FindOrderByID(orderID, userID uint) (domain.Order, error) {
 	var order domain.Order
 
-	err := r.db.Preload("Items").Where("id=? AND user_id=?", orderID, userID).First(&order).Error
+	err := r.db.Preload("Items.Allocations").Where("id=? AND user_id=?", orderID, userID).First(&order).Error
 
 	return order, err
 }
 
-// Profile
-func (r userRepository) CreateProfile(e domain.Address) error {
-	return r.db.Create(&e).Error
+// Address
+func (r userRepository) CreateAddress(e *domain.Address) error {
+	return r.db.Create(e).Error
 }
 
-func (r userRepository) UpdateProfile(e domain.Address) error {
-	err := r.db.Where("user_id=?", e.UserID).Updates(e).Error
-	return err
+func (r userRepository) FindAddresses(userID uint) ([]domain.Address, error) {
+	var addresses []domain.Address
+
+	err := r.db.Where("user_id=?", userID).Order("created_at").Find(&addresses).Error
+
+	return addresses, err
+}
+
+func (r userRepository) FindAddress(id, userID uint) (domain.Address, error) {
+	var address domain.Address
+
+	err := r.db.Where("id=? AND user_id=?", id, userID).First(&address).Error
+
+	return address, err
+}
+
+func (r userRepository) UpdateAddress(e *domain.Address) error {
+	return r.db.Save(e).Error
+}
+
+func (r userRepository) DeleteAddress(id, userID uint) error {
+	return r.db.Where("id=? AND user_id=?", id, userID).Delete(&domain.Address{}).Error
+}
+
+// SetDefaultAddress moves the default shipping and/or billing flag to the address.
+func (r userRepository) SetDefaultAddress(id, userID uint, shipping, billing bool) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for column, set := range map[string]bool{"is_default_shipping": shipping, "is_default_billing": billing} {
+			if !set {
+				continue
+			}
+
+			err := tx.Model(&domain.Address{}).Where("user_id=?", userID).
+				Update(column, gorm.Expr("id = ?", id)).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
 }
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"go-ecommerce-app/internal/domain"
+
+	"gorm.io/gorm"
+)
+
+type WarehouseRepository interface {
+	CreateWarehouse(e *domain.Warehouse) error
+	FindWarehouses(userID uint) ([]domain.Warehouse, error)
+	FindWarehouse(id, userID uint) (domain.Warehouse, error)
+	FindActiveWarehouses(userIDs []uint) ([]domain.Warehouse, error)
+	UpdateWarehouse(e *domain.Warehouse) error
+	DeleteWarehouse(id uint) error
+	WarehouseHoldsStock(id uint) (bool, error)
+}
+
+type warehouseRepository struct {
+	db *gorm.DB
+}
+
+func NewWarehouseRepository(db *gorm.DB) WarehouseRepository {
+	return &warehouseRepository{
+		db: db,
+	}
+}
+
+func (r *warehouseRepository) CreateWarehouse(e *domain.Warehouse) error {
+	return r.db.Create(e).Error
+}
+
+func (r *warehouseRepository) FindWarehouses(userID uint) ([]domain.Warehouse, error) {
+	var warehouses []domain.Warehouse
+
+	err := r.db.Where("user_id=?", userID).Order("priority, id").Find(&warehouses).Error
+
+	return warehouses, err
+}
+
+func (r *warehouseRepository) FindWarehouse(id, userID uint) (domain.Warehouse, error) {
+	var warehouse domain.Warehouse
+
+	err := r.db.Where("id=? AND user_id=?", id, userID).First(&warehouse).Error
+
+	return warehouse, err
+}
+
+func (r *warehouseRepository) FindActiveWarehouses(userIDs []uint) ([]domain.Warehouse, error) {
+	var warehouses []domain.Warehouse
+	if len(userIDs) == 0 {
+		return warehouses, nil
+	}
+
+	err := r.db.Where("user_id IN ? AND active=?", userIDs, true).Order("priority, id").Find(&warehouses).Error
+
+	return warehouses, err
+}
+
+func (r *warehouseRepository) UpdateWarehouse(e *domain.Warehouse) error {
+	// Select keeps the false active flag and the zero priority
+	return r.db.Model(e).Select("*").Omit("id", "user_id", "created_at").Updates(e).Error
+}
+
+func (r *warehouseRepository) DeleteWarehouse(id uint) error {
+	return r.db.Delete(&domain.Warehouse{}, id).Error
+}
+
+// WarehouseHoldsStock reports whether any product has stock in the warehouse.
+func (r *warehouseRepository) WarehouseHoldsStock(id uint) (bool, error) {
+	var productIDs []uint
+
+	err := r.db.Model(&domain.InventoryMovement{}).
+		Where("warehouse_id=?", id).
+		Group("product_id").
+		Having("SUM(on_hand_delta) <> 0").
+		Limit(1).
+		Pluck("product_id", &productIDs).Error
+
+	return len(productIDs) > 0, err
+}
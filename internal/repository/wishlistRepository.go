@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"go-ecommerce-app/internal/domain"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type WishlistRepository interface {
+	CreateWishlist(e *domain.Wishlist) error
+	FindWishlists(userID uint) ([]domain.Wishlist, error)
+	FindWishlist(id, userID uint) (domain.Wishlist, error)
+	FindPublicWishlist(token string) (domain.Wishlist, error)
+	CountWishlists(userID uint) (int64, error)
+	UpdateWishlist(id uint, fields map[string]any) error
+	DeleteWishlist(id uint) error
+
+	AddWishlistItem(e *domain.WishlistItem) (bool, error)
+	CountWishlistItems(wishlistID uint) (int64, error)
+	DeleteWishlistItem(wishlistID, id uint) (bool, error)
+}
+
+type wishlistRepository struct {
+	db *gorm.DB
+}
+
+func NewWishlistRepository(db *gorm.DB) WishlistRepository {
+	return &wishlistRepository{
+		db: db,
+	}
+}
+
+func orderedWishlistItems(db *gorm.DB) *gorm.DB {
+	return db.Order("created_at desc, id desc")
+}
+
+func (r *wishlistRepository) CreateWishlist(e *domain.Wishlist) error {
+	return r.db.Create(e).Error
+}
+
+func (r *wishlistRepository) FindWishlists(userID uint) ([]domain.Wishlist, error) {
+	var wishlists []domain.Wishlist
+
+	err := r.db.Preload("Items", orderedWishlistItems).
+		Where("user_id=?", userID).Order("created_at, id").Find(&wishlists).Error
+
+	return wishlists, err
+}
+
+func (r *wishlistRepository) FindWishlist(id, userID uint) (domain.Wishlist, error) {
+	var wishlist domain.Wishlist
+
+	err := r.db.Preload("Items", orderedWishlistItems).
+		Where("id=? AND user_id=?", id, userID).First(&wishlist).Error
+
+	return wishlist, err
+}
+
+// FindPublicWishlist finds a shared wishlist, the token stops working once the
+// owner makes the list private.
+func (r *wishlistRepository) FindPublicWishlist(token string) (domain.Wishlist, error) {
+	var wishlist domain.Wishlist
+
+	err := r.db.Preload("Items", orderedWishlistItems).
+		Where("share_token=? AND is_public=?", token, true).First(&wishlist).Error
+
+	return wishlist, err
+}
+
+func (r *wishlistRepository) CountWishlists(userID uint) (int64, error) {
+	var count int64
+
+	err := r.db.Model(&domain.Wishlist{}).Where("user_id=?", userID).Count(&count).Error
+
+	return count, err
+}
+
+func (r *wishlistRepository) UpdateWishlist(id uint, fields map[string]any) error {
+	return r.db.Model(&domain.Wishlist{}).Where("id=?", id).Updates(fields).Error
+}
+
+func (r *wishlistRepository) DeleteWishlist(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("wishlist_id=?", id).Delete(&domain.WishlistItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&domain.Wishlist{}, id).Error
+	})
+}
+
+// AddWishlistItem reports false when the product is already on the list.
+func (r *wishlistRepository) AddWishlistItem(e *domain.WishlistItem) (bool, error) {
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(e)
+
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *wishlistRepository) CountWishlistItems(wishlistID uint) (int64, error) {
+	var count int64
+
+	err := r.db.Model(&domain.WishlistItem{}).Where("wishlist_id=?", wishlistID).Count(&count).Error
+
+	return count, err
+}
+
+func (r *wishlistRepository) DeleteWishlistItem(wishlistID, id uint) (bool, error) {
+	result := r.db.Where("id=? AND wishlist_id=?", id, wishlistID).Delete(&domain.WishlistItem{})
+
+	return result.RowsAffected > 0, result.Error
+}
@@ -0,0 +1,267 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"go-ecommerce-app/config"
+	"go-ecommerce-app/internal/domain"
+	"go-ecommerce-app/internal/dto"
+	"go-ecommerce-app/internal/repository"
+	"go-ecommerce-app/pkg/notification"
+	"log"
+	"strings"
+	"time"
+)
+
+const alertLimit = 100
+
+type alertNotice struct {
+	alert domain.ProductAlert
+	price float64
+	line  string
+}
+
+// AlertService queues the product changes reported by the catalog and sends
+// the alerts in batches, one email per subscriber and batch. The queue is
+// kept in the database so it survives restarts and is shared by instances.
+type AlertService struct {
+	Repo     repository.AlertRepository
+	Catalog  repository.CatalogRepository
+	Notifier notification.NotificationClient
+	Config   config.AppConfig
+}
+
+func NewAlertService(repo repository.AlertRepository, catalog repository.CatalogRepository, notifier notification.NotificationClient, config config.AppConfig) *AlertService {
+	return &AlertService{
+		Repo:     repo,
+		Catalog:  catalog,
+		Notifier: notifier,
+		Config:   config,
+	}
+}
+
+// ProductChanged is called by the catalog after a product was saved, it only
+// queues the change. A nil service ignores it.
+func (s *AlertService) ProductChanged(before, after domain.Product) {
+	if s == nil {
+		return
+	}
+
+	backInStock := before.Stock == 0 && after.Stock > 0
+	priceDrop := after.Price < before.Price
+	if !backInStock && !priceDrop {
+		return
+	}
+
+	err := s.Repo.QueueProductChange(domain.ProductAlertChange{
+		ProductID:   after.ID,
+		BackInStock: backInStock,
+		PriceDrop:   priceDrop,
+		UpdatedAt:   time.Now(),
+	})
+	if err != nil {
+		log.Printf("queueing alerts of product %d failed: %v", after.ID, err)
+	}
+}
+
+func (s *AlertService) Subscribe(productID uint, user domain.User, input dto.CreateAlertRequest) (*domain.ProductAlert, error) {
+	product, err := s.Catalog.FindPublicProductByID(int(productID))
+	if err != nil {
+		return nil, errors.New("product does not exist")
+	}
+
+	alert := domain.ProductAlert{
+		UserID:    user.ID,
+		ProductID: product.ID,
+		Kind:      input.Kind,
+	}
+
+	switch input.Kind {
+	case domain.AlertBackInStock:
+		if product.Stock > 0 {
+			return nil, errors.New("product is in stock")
+		}
+	case domain.AlertPriceDrop:
+		if input.TargetPrice < 0 || input.TargetPrice >= product.Price {
+			return nil, errors.New("target price must be below the current price")
+		}
+		alert.TargetPrice = input.TargetPrice
+		// drops are measured from the price when subscribing
+		alert.LastNotifiedPrice = product.Price
+	default:
+		return nil, fmt.Errorf("kind must be %s or %s", domain.AlertBackInStock, domain.AlertPriceDrop)
+	}
+
+	alerts, err := s.Repo.FindUserAlerts(user.ID)
+	if err != nil {
+		return nil, errors.New("unable to save alert")
+	}
+	if len(alerts) >= alertLimit {
+		return nil, fmt.Errorf("you can have at most %d alerts", alertLimit)
+	}
+
+	if err = s.Repo.CreateAlert(&alert); err != nil {
+		return nil, errors.New("unable to save alert")
+	}
+
+	return &alert, nil
+}
+
+func (s *AlertService) GetAlerts(user domain.User) ([]domain.ProductAlert, error) {
+	alerts, err := s.Repo.FindUserAlerts(user.ID)
+	if err != nil {
+		return nil, errors.New("unable to find alerts")
+	}
+
+	return alerts, nil
+}
+
+func (s *AlertService) Unsubscribe(id uint, user domain.User) error {
+	deleted, err := s.Repo.DeleteAlert(id, user.ID)
+	if err != nil {
+		return errors.New("unable to delete alert")
+	}
+	if !deleted {
+		return errors.New("alert not found")
+	}
+
+	return nil
+}
+
+// Flush sends the alerts of the queued changes and reports the number of
+// emails sent. The current product is checked again, a product that ran out
+// of stock before the batch does not alert.
+func (s *AlertService) Flush() (int, error) {
+	changes, err := s.Repo.TakeProductChanges()
+	if err != nil {
+		return 0, err
+	}
+
+	notices := map[uint][]alertNotice{}
+
+	for i, change := range changes {
+		// products taken off sale notify nobody
+		product, err := s.Catalog.FindPublicProductByID(int(change.ProductID))
+		if err != nil {
+			continue
+		}
+
+		link := fmt.Sprintf("%s/products/%d", s.Config.AppBaseURL, product.ID)
+
+		if change.BackInStock && product.Stock > 0 {
+			alerts, err := s.Repo.FindProductAlerts(product.ID, domain.AlertBackInStock)
+			if err != nil {
+				s.requeue(changes[i:])
+				return 0, err
+			}
+			for _, alert := range alerts {
+				notices[alert.UserID] = append(notices[alert.UserID], alertNotice{
+					alert: alert,
+					price: product.Price,
+					line:  fmt.Sprintf("%s is back in stock: %s", product.Name, link),
+				})
+			}
+		}
+
+		if change.PriceDrop {
+			alerts, err := s.Repo.FindProductAlerts(product.ID, domain.AlertPriceDrop)
+			if err != nil {
+				s.requeue(changes[i:])
+				return 0, err
+			}
+			for _, alert := range alerts {
+				// a price that is not below the last alerted one was already reported
+				if product.Price >= alert.LastNotifiedPrice {
+					continue
+				}
+				if alert.TargetPrice > 0 && product.Price > alert.TargetPrice {
+					continue
+				}
+				notices[alert.UserID] = append(notices[alert.UserID], alertNotice{
+					alert: alert,
+					price: product.Price,
+					line: fmt.Sprintf("%s dropped to %.2f from %.2f: %s",
+						product.Name, product.Price, alert.LastNotifiedPrice, link),
+				})
+			}
+		}
+	}
+
+	if len(notices) == 0 {
+		return 0, nil
+	}
+
+	userIDs := make([]uint, 0, len(notices))
+	for userID := range notices {
+		userIDs = append(userIDs, userID)
+	}
+
+	emails, err := s.Repo.FindUserEmails(userIDs)
+	if err != nil {
+		s.requeue(changes)
+		return 0, err
+	}
+
+	sent := 0
+	for userID, userNotices := range notices {
+		email, ok := emails[userID]
+		if !ok || email == "" {
+			continue
+		}
+
+		if err = s.send(email, userNotices); err != nil {
+			// the alerts stay unchanged and go out with the next change
+			log.Printf("sending product alerts to user %d failed: %v", userID, err)
+			continue
+		}
+		sent++
+
+		s.markSent(userNotices)
+	}
+
+	return sent, nil
+}
+
+// requeue puts back the changes a failed batch did not get to, the next
+// batch sends their alerts.
+func (s *AlertService) requeue(changes []domain.ProductAlertChange) {
+	for _, change := range changes {
+		if err := s.Repo.QueueProductChange(change); err != nil {
+			log.Printf("queueing alerts of product %d failed: %v", change.ProductID, err)
+		}
+	}
+}
+
+func (s *AlertService) send(email string, notices []alertNotice) error {
+	subject := "Products you are watching have changed"
+	if len(notices) == 1 {
+		subject = "A product you are watching has changed"
+	}
+
+	lines := make([]string, 0, len(notices))
+	for _, n := range notices {
+		lines = append(lines, "- "+n.line)
+	}
+
+	body := fmt.Sprintf("Good news:\n\n%s\n\nYou can manage your alerts in your account.", strings.Join(lines, "\n"))
+
+	return s.Notifier.SendEmail(email, subject, body)
+}
+
+// markSent removes the one time back in stock alerts and remembers the price
+// a price drop alert was sent for.
+func (s *AlertService) markSent(notices []alertNotice) {
+	now := time.Now()
+
+	for _, n := range notices {
+		var err error
+		if n.alert.Kind == domain.AlertBackInStock {
+			err = s.Repo.DeleteAlerts([]uint{n.alert.ID})
+		} else {
+			err = s.Repo.MarkNotified([]uint{n.alert.ID}, n.price, now)
+		}
+		if err != nil {
+			log.Printf("updating product alert %d failed: %v", n.alert.ID, err)
+		}
+	}
+}
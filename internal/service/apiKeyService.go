@@ -0,0 +1,142 @@
+package service
+
+import (
+	"errors"
+	"go-ecommerce-app/internal/domain"
+	"go-ecommerce-app/internal/dto"
+	"go-ecommerce-app/internal/helper"
+	"go-ecommerce-app/internal/repository"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	apiKeyPrefix         = "sk"
+	apiKeyTouchInterval  = time.Minute
+	maxActiveApiKeyCount = 20
+)
+
+var ErrInvalidApiKey = errors.New("invalid api key")
+
+type ApiKeyService struct {
+	Repo     repository.ApiKeyRepository
+	UserRepo repository.UserRepository
+	Auth     helper.Auth
+	Audit    AuditService
+}
+
+// CreateApiKey returns the stored key and the plaintext key, which is only shown once.
+func (s ApiKeyService) CreateApiKey(input dto.CreateApiKeyRequest, user domain.User, meta dto.RequestMeta) (*domain.ApiKey, string, error) {
+	if strings.TrimSpace(input.Name) == "" {
+		return nil, "", errors.New("api key name is required")
+	}
+
+	if len(input.Scopes) == 0 {
+		return nil, "", errors.New("at least one scope is required")
+	}
+
+	for _, scope := range input.Scopes {
+		if !slices.Contains(domain.ApiKeyScopes, scope) {
+			return nil, "", errors.New("unknown scope " + scope)
+		}
+	}
+
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		return nil, "", errors.New("expiry must be in the future")
+	}
+
+	keys, err := s.Repo.FindUserApiKeys(user.ID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	active := 0
+	for _, key := range keys {
+		if key.RevokedAt == nil {
+			active++
+		}
+	}
+
+	if active >= maxActiveApiKeyCount {
+		return nil, "", errors.New("api key limit reached, please revoke unused keys")
+	}
+
+	prefix, err := helper.RandomString(8)
+	if err != nil {
+		return nil, "", err
+	}
+
+	secret, err := helper.RandomString(40)
+	if err != nil {
+		return nil, "", err
+	}
+
+	plaintext := apiKeyPrefix + "_" + prefix + "_" + secret
+
+	key := &domain.ApiKey{
+		UserID:    user.ID,
+		Name:      input.Name,
+		Prefix:    prefix,
+		KeyHash:   s.Auth.HashCode(plaintext),
+		Scopes:    input.Scopes,
+		ExpiresAt: input.ExpiresAt,
+	}
+
+	if err = s.Repo.CreateApiKey(key); err != nil {
+		return nil, "", errors.New("unable to create api key")
+	}
+
+	s.Audit.Record(meta, domain.AuditApiKeyCreate, "api_key", key.ID, nil, key)
+
+	return key, plaintext, nil
+}
+
+func (s ApiKeyService) GetApiKeys(user domain.User) ([]domain.ApiKey, error) {
+	return s.Repo.FindUserApiKeys(user.ID)
+}
+
+func (s ApiKeyService) RevokeApiKey(id uint, user domain.User, meta dto.RequestMeta) error {
+	if err := s.Repo.RevokeApiKey(id, user.ID); err != nil {
+		return errors.New("api key not found")
+	}
+
+	s.Audit.Record(meta, domain.AuditApiKeyRevoke, "api_key", id,
+		map[string]any{"revoked_at": nil}, map[string]any{"revoked_at": time.Now()})
+
+	return nil
+}
+
+// VerifyAPIKey implements helper.APIKeyVerifier.
+func (s ApiKeyService) VerifyAPIKey(plaintext string) (domain.User, []string, error) {
+	parts := strings.Split(plaintext, "_")
+	if len(parts) != 3 || parts[0] != apiKeyPrefix {
+		return domain.User{}, nil, ErrInvalidApiKey
+	}
+
+	key, err := s.Repo.FindApiKeyByPrefix(parts[1])
+	if err != nil || !s.Auth.VerifyCode(plaintext, key.KeyHash) {
+		return domain.User{}, nil, ErrInvalidApiKey
+	}
+
+	now := time.Now()
+
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return domain.User{}, nil, ErrInvalidApiKey
+	}
+
+	user, err := s.UserRepo.FindUserByID(key.UserID)
+	if err != nil || user.UserType != domain.SELLER {
+		return domain.User{}, nil, ErrInvalidApiKey
+	}
+
+	// avoid a write on every request
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyTouchInterval {
+		if err = s.Repo.TouchApiKey(key.ID, now); err != nil {
+			log.Printf("error updating api key usage: %v", err)
+		}
+	}
+
+	return domain.User{ID: user.ID, Email: user.Email, UserType: user.UserType}, key.Scopes, nil
+}
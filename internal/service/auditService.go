@@ -0,0 +1,215 @@
+package service
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"go-ecommerce-app/internal/domain"
+	"go-ecommerce-app/internal/dto"
+	"go-ecommerce-app/internal/repository"
+	"go-ecommerce-app/pkg/fieldcrypt"
+	"io"
+	"log"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+const (
+	auditDefaultLimit = 50
+	auditMaxLimit     = 500
+)
+
+// fields that change on every write and only add noise to a diff
+var auditIgnoredFields = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+	"CreatedAt":  true,
+	"UpdatedAt":  true,
+}
+
+type AuditService struct {
+	Repo repository.AuditRepository
+}
+
+// Record appends an event for the action. before and after are the resource
+// states, nil for creations and deletions; fields hidden from json never end up
+// in the log and personal fields are masked, see domain.AuditPersonalFields.
+// The client address is kept encrypted next to its blind index, the user
+// agent not at all.
+//
+// Record is called once the action is committed, so a failed write can't undo
+// it. Failing the request would make the client retry an action that already
+// happened; instead the whole event is written to the app log to be restored
+// from there.
+func (s AuditService) Record(meta dto.RequestMeta, action, resourceType string, resourceID any, before, after any) {
+	if s.Repo == nil {
+		return
+	}
+
+	event := &domain.AuditEvent{
+		ActorID:      meta.ActorID,
+		ActorRole:    meta.ActorRole,
+		ApiKey:       meta.ApiKey,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   fmt.Sprint(resourceID),
+		Changes:      auditDiff(before, after),
+		IP:           fieldcrypt.Secret(meta.IP),
+		IPHash:       fieldcrypt.BlindIndex(meta.IP),
+		RequestID:    meta.RequestID,
+	}
+
+	if err := s.Repo.CreateAuditEvent(event); err != nil {
+		data, _ := json.Marshal(auditEventDetails(*event))
+		log.Printf("AUDIT EVENT NOT RECORDED: %v: %s", err, data)
+	}
+}
+
+func auditEventDetails(e domain.AuditEvent) dto.AuditEventDetails {
+	return dto.AuditEventDetails{
+		ID:           e.ID,
+		ActorID:      e.ActorID,
+		ActorRole:    e.ActorRole,
+		ApiKey:       e.ApiKey,
+		Action:       e.Action,
+		ResourceType: e.ResourceType,
+		ResourceID:   e.ResourceID,
+		Changes:      e.Changes,
+		IP:           e.IP.String(),
+		IPHash:       e.IPHash,
+		RequestID:    e.RequestID,
+		CreatedAt:    e.CreatedAt,
+	}
+}
+
+func (s AuditService) FindEvents(filter dto.AuditEventFilter) ([]dto.AuditEventDetails, int64, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+
+	if filter.Limit < 1 {
+		filter.Limit = auditDefaultLimit
+	}
+
+	if filter.Limit > auditMaxLimit {
+		filter.Limit = auditMaxLimit
+	}
+
+	events, total, err := s.Repo.FindAuditEvents(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	details := make([]dto.AuditEventDetails, 0, len(events))
+	for _, e := range events {
+		details = append(details, auditEventDetails(e))
+	}
+
+	return details, total, nil
+}
+
+// ExportCSV writes every event matching the filter, oldest first.
+func (s AuditService) ExportCSV(filter dto.AuditEventFilter, w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	err := cw.Write([]string{"id", "created_at", "actor_id", "actor_role", "api_key", "action",
+		"resource_type", "resource_id", "changes", "ip", "ip_hash", "request_id"})
+	if err != nil {
+		return err
+	}
+
+	err = s.Repo.FindAuditEventsInBatches(filter, func(events []domain.AuditEvent) error {
+		for _, e := range events {
+			changes, err := json.Marshal(e.Changes)
+			if err != nil {
+				return err
+			}
+
+			err = cw.Write([]string{
+				strconv.FormatUint(uint64(e.ID), 10),
+				e.CreatedAt.UTC().Format(time.RFC3339),
+				strconv.FormatUint(uint64(e.ActorID), 10),
+				e.ActorRole,
+				strconv.FormatBool(e.ApiKey),
+				e.Action,
+				e.ResourceType,
+				csvSafe(e.ResourceID),
+				csvSafe(string(changes)),
+				csvSafe(e.IP.String()),
+				e.IPHash,
+				e.RequestID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		cw.Flush()
+		return cw.Error()
+	})
+	if err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvSafe keeps spreadsheet apps from evaluating user controlled values as formulas.
+func csvSafe(value string) string {
+	if value != "" && (value[0] == '=' || value[0] == '+' || value[0] == '-' || value[0] == '@') {
+		return "'" + value
+	}
+	return value
+}
+
+// auditDiff compares the json form of both states and returns the changed fields.
+func auditDiff(before, after any) map[string]domain.AuditChange {
+	from := auditFields(before)
+	to := auditFields(after)
+
+	changes := map[string]domain.AuditChange{}
+
+	for key, value := range from {
+		if auditIgnoredFields[key] {
+			continue
+		}
+		if next, ok := to[key]; !ok || !reflect.DeepEqual(value, next) {
+			changes[key] = domain.AuditChange{From: value, To: to[key]}
+		}
+	}
+
+	for key, value := range to {
+		if _, ok := from[key]; ok || auditIgnoredFields[key] {
+			continue
+		}
+		changes[key] = domain.AuditChange{To: value}
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	domain.MaskAuditChanges(changes)
+
+	return changes
+}
+
+func auditFields(state any) map[string]any {
+	if state == nil || (reflect.ValueOf(state).Kind() == reflect.Pointer && reflect.ValueOf(state).IsNil()) {
+		return nil
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil
+	}
+
+	fields := map[string]any{}
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+
+	return fields
+}
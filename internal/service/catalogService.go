@@ -1,29 +1,74 @@
 package service
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"go-ecommerce-app/config"
 	"go-ecommerce-app/internal/domain"
 	"go-ecommerce-app/internal/dto"
 	"go-ecommerce-app/internal/helper"
+	"go-ecommerce-app/internal/policy"
 	"go-ecommerce-app/internal/repository"
+	"go-ecommerce-app/pkg/blobstore"
+	"log"
+	"mime/multipart"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	productImageMaxSize = 10 << 20
+	productImageLimit   = 10
+	productSkuMaxLength = 64
+)
+
+var productImageSizes = []imageSize{
+	{"thumbnail", 160},
+	{"small", 400},
+	{"medium", 800},
+	{"large", 1600},
+}
+
+var (
+	ErrProductNotFound      = errors.New("product does not exist")
+	ErrProductStatusChanged = errors.New("the product status changed meanwhile, please reload the product")
 )
 
 type CatalogService struct {
 	Repo   repository.CatalogRepository
 	Auth   helper.Auth
 	Config config.AppConfig
+	Audit  AuditService
+	Blobs  blobstore.BlobStore
+	Alerts *AlertService
+	// stock changes are booked in the inventory ledger
+	Inventory InventoryService
 }
 
-func (s CatalogService) CreateCategory(input dto.CreateCategoryRequest) error {
-	err := s.Repo.CreateCategory(&domain.Category{
+func (s CatalogService) CreateCategory(input dto.CreateCategoryRequest, meta dto.RequestMeta) error {
+	category := &domain.Category{
 		Name:         input.Name,
 		ImageUrl:     input.ImageUrl,
 		DisplayOrder: input.DisplayOrder,
-	})
+	}
+
+	slug, err := resourceSlug(s.Repo, domain.SlugCategory, input.Slug, input.Name, 0)
+	if err != nil {
+		return err
+	}
+	category.Slug = slug
+
+	if err := s.Repo.CreateCategory(category); err != nil {
+		return err
+	}
+
+	s.Audit.Record(meta, domain.AuditCategoryCreate, "category", category.ID, nil, category)
 
-	return err
+	return nil
 }
 
 func (s CatalogService) GetCategories() ([]*domain.Category, error) {
@@ -32,6 +77,8 @@ func (s CatalogService) GetCategories() ([]*domain.Category, error) {
 		return nil, err
 	}
 
+	s.withCategoryURLs(categories...)
+
 	return categories, err
 }
 
@@ -41,15 +88,41 @@ func (s CatalogService) GetCategory(id int) (*domain.Category, error) {
 		return nil, err
 	}
 
+	s.withCategoryURLs(category)
+
 	return category, err
 }
 
-func (s CatalogService) EditCategory(id int, input dto.CreateCategoryRequest) (*domain.Category, error) {
+// GetCategoryBySlug finds the category by its current slug, or by a former one
+// reported as moved.
+func (s CatalogService) GetCategoryBySlug(slug string) (*domain.Category, bool, error) {
+	category, err := s.Repo.FindCategoryBySlug(slug)
+	moved := false
+
+	if err != nil {
+		redirect, rerr := s.Repo.FindSlugRedirect(domain.SlugCategory, slug)
+		if rerr != nil {
+			return nil, false, errors.New("category does not exist")
+		}
+		if category, err = s.Repo.FindCategoryByID(int(redirect.ResourceID)); err != nil {
+			return nil, false, errors.New("category does not exist")
+		}
+		moved = true
+	}
+
+	s.withCategoryURLs(category)
+
+	return category, moved, nil
+}
+
+func (s CatalogService) EditCategory(id int, input dto.CreateCategoryRequest, meta dto.RequestMeta) (*domain.Category, error) {
 	category, err := s.Repo.FindCategoryByID(id)
 	if err != nil {
 		return nil, err
 	}
 
+	before := *category
+
 	if len(input.Name) > 0 {
 		category.Name = input.Name
 	}
@@ -67,44 +140,112 @@ func (s CatalogService) EditCategory(id int, input dto.CreateCategoryRequest) (*
 		category.DisplayOrder = input.DisplayOrder
 	}
 
+	// the slug only changes on request, links to the category keep working
+	if len(input.Slug) > 0 || len(category.Slug) == 0 {
+		if category.Slug, err = resourceSlug(s.Repo, domain.SlugCategory, input.Slug, category.Name, category.ID); err != nil {
+			return nil, err
+		}
+	}
+
 	updated, err := s.Repo.EditCategory(category)
 	if err != nil {
 		return nil, err
 	}
 
+	recordSlugChange(s.Repo, domain.SlugCategory, category.ID, before.Slug, updated.Slug)
+	s.withCategoryURLs(updated)
+
+	s.Audit.Record(meta, domain.AuditCategoryUpdate, "category", id, before, updated)
+
 	return updated, nil
 }
 
-func (s CatalogService) DeleteCategory(id int) error {
-	return s.Repo.DeleteCategory(id)
+func (s CatalogService) DeleteCategory(id int, meta dto.RequestMeta) error {
+	category, err := s.Repo.FindCategoryByID(id)
+	if err != nil {
+		return err
+	}
+
+	if err = s.Repo.DeleteCategory(id); err != nil {
+		return err
+	}
+
+	s.Audit.Record(meta, domain.AuditCategoryDelete, "category", id, category, nil)
+
+	return nil
 }
 
 // Products
 
-func (s CatalogService) CreateProduct(input dto.CreateProductRequest, user domain.User) error {
-	err := s.Repo.CreateProduct(&domain.Product{
+func (s CatalogService) CreateProduct(input dto.CreateProductRequest, user domain.User, meta dto.RequestMeta) error {
+	product := &domain.Product{
 		Name:        input.Name,
 		Description: input.Description,
 		Price:       input.Price,
 		CategoryID:  input.CategoryID,
 		ImageUrl:    input.ImageUrl,
 		UserID:      user.ID,
-		Stock:       uint(input.Stock),
-	})
-	return err
+		Sku:         strings.TrimSpace(input.Sku),
+	}
+
+	if input.Stock < 0 {
+		return errors.New("stock must not be negative")
+	}
+
+	status := input.Status
+	if status == "" {
+		status = domain.ProductStatusDraft
+	}
+	if err := applyProductStatus(product, status, input.PublishAt, input.UnpublishAt, time.Now()); err != nil {
+		return err
+	}
+
+	if err := s.checkSku(product); err != nil {
+		return err
+	}
+
+	slug, err := resourceSlug(s.Repo, domain.SlugProduct, input.Slug, input.Name, 0)
+	if err != nil {
+		return err
+	}
+	product.Slug = slug
+
+	// saved with the product
+	attributes, err := productAttributes(s.Repo, product.CategoryID, nil, input.Attributes)
+	if err != nil {
+		return err
+	}
+	product.Attributes = attributes
+
+	if err := s.Repo.CreateProduct(product); err != nil {
+		return err
+	}
+
+	if input.Stock > 0 {
+		if err := s.Inventory.Receive(product.ID, input.Stock, user.ID, "initial stock"); err != nil {
+			return err
+		}
+		product.Stock = uint(input.Stock)
+	}
+
+	s.Audit.Record(meta, domain.AuditProductCreate, "product", product.ID, nil, product)
+
+	return nil
 }
 
-func (s CatalogService) EditProduct(id int, input dto.CreateProductRequest, user domain.User) (*domain.Product, error) {
+func (s CatalogService) EditProduct(id int, input dto.CreateProductRequest, user domain.User, meta dto.RequestMeta) (*domain.Product, error) {
 	product, err := s.Repo.FindProductByID(id)
 	if err != nil {
 		return nil, errors.New("product does not exist")
 	}
 
 	// verify owner
-	if product.UserID != user.ID {
+	if !policy.CanManage(user, policy.CatalogProductManage, product.UserID) {
 		return nil, errors.New("you dont have manage rights of this product")
 	}
 
+	before := *product
+
 	if len(input.Name) > 0 {
 		product.Name = input.Name
 	}
@@ -121,41 +262,158 @@ func (s CatalogService) EditProduct(id int, input dto.CreateProductRequest, user
 		product.CategoryID = input.CategoryID
 	}
 
-	return s.Repo.EditProduct(product)
+	if sku := strings.TrimSpace(input.Sku); len(sku) > 0 {
+		product.Sku = sku
+		if err = s.checkSku(product); err != nil {
+			return nil, err
+		}
+	}
+
+	// the status and its times are set together
+	updateStatus := input.Status != "" || input.PublishAt != nil || input.UnpublishAt != nil
+	if updateStatus {
+		status := input.Status
+		if status == "" {
+			status = product.Status
+		}
+		if err = applyProductStatus(product, status, input.PublishAt, input.UnpublishAt, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	// the slug only changes on request, links to the product keep working
+	if len(input.Slug) > 0 || len(product.Slug) == 0 {
+		if product.Slug, err = resourceSlug(s.Repo, domain.SlugProduct, input.Slug, product.Name, product.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	// the values are checked again when the category changes
+	var attributes []domain.ProductAttribute
+	updateAttributes := input.Attributes != nil || product.CategoryID != before.CategoryID
+	if updateAttributes {
+		if attributes, err = productAttributes(s.Repo, product.CategoryID, product.Attributes, input.Attributes); err != nil {
+			return nil, err
+		}
+	}
+
+	if updateStatus {
+		if err = saveProductStatus(s.Repo, product, before.Status); err != nil {
+			return nil, err
+		}
+	}
+
+	updated, err := s.Repo.EditProduct(product)
+	if err != nil {
+		return nil, err
+	}
+
+	if updateAttributes {
+		if err = s.Repo.ReplaceProductAttributes(product.ID, attributes); err != nil {
+			return nil, err
+		}
+		updated.Attributes = attributes
+	}
+
+	recordSlugChange(s.Repo, domain.SlugProduct, product.ID, before.Slug, updated.Slug)
+	s.withProductURLs(updated)
+
+	s.Audit.Record(meta, domain.AuditProductUpdate, "product", id, before, updated)
+	s.Alerts.ProductChanged(before, *updated)
+
+	return updated, nil
 }
 
-func (s CatalogService) DeleteProduct(id int, user domain.User) error {
+func (s CatalogService) DeleteProduct(id int, user domain.User, meta dto.RequestMeta) error {
 	product, err := s.Repo.FindProductByID(id)
 	if err != nil {
 		return errors.New("product does not exist")
 	}
 
-	if product.UserID != user.ID {
+	if !policy.CanManage(user, policy.CatalogProductManage, product.UserID) {
 		return errors.New("you dont have manage right of product")
 	}
 
+	// soft deleted, carts and orders still show the name and images
 	if err = s.Repo.DeleteProduct(product); err != nil {
 		return errors.New("product cant delete")
 	}
 
+	s.Audit.Record(meta, domain.AuditProductDelete, "product", id, product, nil)
+
 	return nil
 }
 
-func (s CatalogService) GetProducts() ([]*domain.Product, error) {
-	products, err := s.Repo.FindProducts()
+// GetProducts lists the active products of the query with the facets for
+// filtering them further, attribute facets need a category.
+func (s CatalogService) GetProducts(query dto.ProductQuery) ([]*domain.Product, dto.ProductFacets, error) {
+	filter, filterable, err := s.productFilter(query)
 	if err != nil {
-		return nil, errors.New("products does not exist")
+		return nil, dto.ProductFacets{}, err
 	}
 
-	return products, nil
+	products, err := s.Repo.FindProducts(filter)
+	if err != nil {
+		return nil, dto.ProductFacets{}, errors.New("products does not exist")
+	}
+
+	facets, err := s.Repo.FindProductFacets(filter, filterable)
+	if err != nil {
+		return nil, dto.ProductFacets{}, errors.New("products does not exist")
+	}
+
+	s.withProductURLs(products...)
+
+	return products, facets, nil
 }
 
+// GetProductByID finds an active product for the public catalog.
 func (s CatalogService) GetProductByID(id int) (*domain.Product, error) {
+	product, err := s.Repo.FindPublicProductByID(id)
+	if err != nil {
+		return nil, ErrProductNotFound
+	}
+
+	s.withProductURLs(product)
+
+	return product, nil
+}
+
+// GetProductBySlug finds an active product by its current slug, or by a former
+// one reported as moved.
+func (s CatalogService) GetProductBySlug(slug string) (*domain.Product, bool, error) {
+	product, err := s.Repo.FindPublicProductBySlug(slug)
+	moved := false
+
+	if err != nil {
+		redirect, rerr := s.Repo.FindSlugRedirect(domain.SlugProduct, slug)
+		if rerr != nil {
+			return nil, false, ErrProductNotFound
+		}
+		if product, err = s.Repo.FindPublicProductByID(int(redirect.ResourceID)); err != nil {
+			return nil, false, ErrProductNotFound
+		}
+		moved = true
+	}
+
+	s.withProductURLs(product)
+
+	return product, moved, nil
+}
+
+// GetSellerProduct finds a product of the seller in any status.
+func (s CatalogService) GetSellerProduct(id int, user domain.User) (*domain.Product, error) {
 	product, err := s.Repo.FindProductByID(id)
 	if err != nil {
-		return nil, errors.New("product does not exist")
+		return nil, ErrProductNotFound
+	}
+
+	if product.UserID != user.ID && !policy.Can(user, policy.CatalogProductManageAny) {
+		return nil, ErrProductNotFound
 	}
 
+	s.withProductURLs(product)
+
 	return product, nil
 }
 
@@ -165,25 +423,277 @@ func (s CatalogService) GetSellerProducts(id int) ([]*domain.Product, error) {
 		return nil, errors.New("product does not exist")
 	}
 
+	s.withProductURLs(products...)
+
 	return products, nil
 }
 
-func (s CatalogService) UpdateProductStock(e domain.Product) (*domain.Product, error) {
+func (s CatalogService) UpdateProductStock(e domain.Product, user domain.User, meta dto.RequestMeta) (*domain.Product, error) {
 	product, err := s.Repo.FindProductByID(int(e.ID))
 	if err != nil {
 		return nil, errors.New("product not found")
 	}	
 
 	// verify owner
-	if product.UserID != e.UserID {
+	if !policy.CanManage(user, policy.CatalogProductManage, product.UserID) {
 		return nil, errors.New("you dont have manage right of product")
 	}
 
-	product.Stock = e.Stock 
-	editProduct, err := s.Repo.EditProduct(product)
+	before := *product
+
+	// the seller sets the available stock, the difference is booked as an adjustment
+	if _, err = s.Inventory.SetAvailable(product.ID, int(e.Stock), user.ID, "stock set by seller"); err != nil {
+		return nil, err
+	}
+
+	editProduct, err := s.Repo.FindProductByID(int(product.ID))
 	if err != nil {
 		return nil, err
 	}
 
+	s.withProductURLs(editProduct)
+
+	s.Audit.Record(meta, domain.AuditProductStock, "product", product.ID, before, editProduct)
+
 	return editProduct, nil
-}
\ No newline at end of file
+}
+
+// ApplyProductSchedules publishes and archives the products whose scheduled
+// time has come.
+func (s CatalogService) ApplyProductSchedules() (int64, int64, error) {
+	return s.Repo.ApplyProductSchedules(time.Now())
+}
+
+// applyProductStatus sets the lifecycle of the product. Scheduled products
+// need a publish time, active and scheduled products may have an unpublish
+// time after which they are archived.
+func applyProductStatus(product *domain.Product, status string, publishAt, unpublishAt *time.Time, now time.Time) error {
+	switch status {
+	case domain.ProductStatusDraft, domain.ProductStatusActive, domain.ProductStatusArchived:
+		if publishAt != nil {
+			return errors.New("publish_at is only used by scheduled products")
+		}
+	case domain.ProductStatusScheduled:
+		if publishAt == nil || !publishAt.After(now) {
+			return errors.New("scheduled products need a publish_at in the future")
+		}
+	default:
+		return fmt.Errorf("status must be %s, %s, %s or %s", domain.ProductStatusDraft,
+			domain.ProductStatusActive, domain.ProductStatusScheduled, domain.ProductStatusArchived)
+	}
+
+	if unpublishAt != nil {
+		switch {
+		case status != domain.ProductStatusActive && status != domain.ProductStatusScheduled:
+			return errors.New("unpublish_at is only used by active and scheduled products")
+		case !unpublishAt.After(now), publishAt != nil && !unpublishAt.After(*publishAt):
+			return errors.New("unpublish_at must be after the product is published")
+		}
+	}
+
+	product.Status = status
+	product.PublishAt = publishAt
+	product.UnpublishAt = unpublishAt
+
+	return nil
+}
+
+// saveProductStatus writes the status set by applyProductStatus unless the
+// schedule or another edit changed it since the product was read.
+func saveProductStatus(repo repository.CatalogRepository, product *domain.Product, from string) error {
+	updated, err := repo.UpdateProductStatus(product, from)
+	if err != nil {
+		return errors.New("unable to update product status")
+	}
+	if !updated {
+		return ErrProductStatusChanged
+	}
+
+	return nil
+}
+
+// checkSku rejects a sku another product of the seller already uses.
+func (s CatalogService) checkSku(product *domain.Product) error {
+	if product.Sku == "" {
+		return nil
+	}
+
+	if len(product.Sku) > productSkuMaxLength {
+		return fmt.Errorf("sku must be at most %d characters", productSkuMaxLength)
+	}
+
+	existing, err := s.Repo.FindProductBySku(product.UserID, product.Sku)
+	if err != nil {
+		return errors.New("unable to check the sku")
+	}
+	if existing != nil && existing.ID != product.ID {
+		return errors.New("sku is already used by another product")
+	}
+
+	return nil
+}
+
+// Product images
+
+// AddProductImages stores the uploads after the existing images, in the order given.
+func (s CatalogService) AddProductImages(id int, files []*multipart.FileHeader, user domain.User, meta dto.RequestMeta) ([]domain.ProductImage, error) {
+	product, err := s.Repo.FindProductByID(id)
+	if err != nil {
+		return nil, errors.New("product does not exist")
+	}
+
+	if !policy.CanManage(user, policy.CatalogProductManage, product.UserID) {
+		return nil, errors.New("you dont have manage right of product")
+	}
+
+	if len(files) == 0 {
+		return nil, errors.New("please provide at least one image")
+	}
+
+	if len(product.Images)+len(files) > productImageLimit {
+		return nil, fmt.Errorf("a product can have at most %d images", productImageLimit)
+	}
+
+	position := 0
+	if n := len(product.Images); n > 0 {
+		position = product.Images[n-1].Position + 1
+	}
+
+	var added []domain.ProductImage
+	for i, file := range files {
+		image, err := s.storeProductImage(product.ID, position+i, file)
+		if err != nil {
+			return added, fmt.Errorf("%s: %w", file.Filename, err)
+		}
+		added = append(added, *image)
+		s.Audit.Record(meta, domain.AuditProductImageAdd, "product", product.ID, nil, image)
+	}
+
+	s.syncCoverImage(product, append(product.Images, added...))
+
+	return added, nil
+}
+
+func (s CatalogService) storeProductImage(productID uint, position int, file *multipart.FileHeader) (*domain.ProductImage, error) {
+	data, decoded, err := readImageUpload(file, productImageMaxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	image := &domain.ProductImage{
+		ProductID:   productID,
+		Position:    position,
+		ContentType: decoded.ContentType,
+		Width:       decoded.Width,
+		Height:      decoded.Height,
+		Size:        int64(len(data)),
+		Checksum:    hex.EncodeToString(sum[:]),
+	}
+
+	image.StorageKeys, image.Urls, err = storeImage(s.Blobs, s.Config.AppBaseURL,
+		fmt.Sprintf("products/%d", productID), data, decoded, productImageSizes)
+	if err == nil {
+		if err = s.Repo.CreateProductImage(image); err != nil {
+			deleteBlobs(s.Blobs, image.StorageKeys)
+		}
+	}
+
+	if err != nil {
+		log.Printf("storing image of product %d failed: %v", productID, err)
+		return nil, errors.New("unable to store image")
+	}
+
+	return image, nil
+}
+
+func (s CatalogService) DeleteProductImage(id, imageID int, user domain.User, meta dto.RequestMeta) error {
+	product, err := s.Repo.FindProductByID(id)
+	if err != nil {
+		return errors.New("product does not exist")
+	}
+
+	if !policy.CanManage(user, policy.CatalogProductManage, product.UserID) {
+		return errors.New("you dont have manage right of product")
+	}
+
+	image, err := s.Repo.FindProductImage(product.ID, uint(imageID))
+	if err != nil {
+		return errors.New("image does not exist")
+	}
+
+	if err = s.Repo.DeleteProductImage(image.ID); err != nil {
+		return errors.New("unable to delete image")
+	}
+
+	deleteBlobs(s.Blobs, image.StorageKeys)
+	s.Audit.Record(meta, domain.AuditProductImageDelete, "product", product.ID, image, nil)
+
+	images := slices.DeleteFunc(product.Images, func(e domain.ProductImage) bool {
+		return e.ID == image.ID
+	})
+	s.syncCoverImage(product, images)
+
+	return nil
+}
+
+// ReorderProductImages takes the ids of all images of the product in the new order.
+func (s CatalogService) ReorderProductImages(id int, input dto.ReorderImagesRequest, user domain.User, meta dto.RequestMeta) ([]domain.ProductImage, error) {
+	product, err := s.Repo.FindProductByID(id)
+	if err != nil {
+		return nil, errors.New("product does not exist")
+	}
+
+	if !policy.CanManage(user, policy.CatalogProductManage, product.UserID) {
+		return nil, errors.New("you dont have manage right of product")
+	}
+
+	current := make([]uint, 0, len(product.Images))
+	for _, image := range product.Images {
+		current = append(current, image.ID)
+	}
+
+	requested, existing := slices.Clone(input.ImageIDs), slices.Clone(current)
+	slices.Sort(requested)
+	slices.Sort(existing)
+	if !slices.Equal(requested, existing) {
+		return nil, errors.New("image ids must list every image of the product once")
+	}
+
+	if err = s.Repo.UpdateImagePositions(product.ID, input.ImageIDs); err != nil {
+		return nil, errors.New("unable to reorder images")
+	}
+
+	images, err := s.Repo.FindProductImages(product.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Audit.Record(meta, domain.AuditProductImageOrder, "product", product.ID,
+		map[string]any{"image_ids": current}, map[string]any{"image_ids": input.ImageIDs})
+
+	s.syncCoverImage(product, images)
+
+	return images, nil
+}
+
+// syncCoverImage keeps image_url pointing at the first uploaded image for
+// clients that only read the single url. Urls set by hand are kept when the
+// product has no uploads.
+func (s CatalogService) syncCoverImage(product *domain.Product, images []domain.ProductImage) {
+	cover := ""
+	if len(images) > 0 {
+		cover = images[0].Urls["medium"]
+	} else if !strings.HasPrefix(product.ImageUrl, mediaURL(s.Config.AppBaseURL, "")) {
+		return
+	}
+
+	if product.ImageUrl == cover {
+		return
+	}
+
+	product.ImageUrl = cover
+	if _, err := s.Repo.EditProduct(product); err != nil {
+		log.Printf("updating cover image of product %d failed: %v", product.ID, err)
+	}
+}
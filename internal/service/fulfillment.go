@@ -0,0 +1,219 @@
+package service
+
+import (
+	"cmp"
+	"fmt"
+	"go-ecommerce-app/internal/domain"
+	"slices"
+	"strings"
+)
+
+const (
+	FulfillmentNearest        = "nearest"
+	FulfillmentSingleLocation = "single_location"
+)
+
+// shipping distance tiers, there are no coordinates so the address fields
+// the warehouse shares with the shipping address decide
+const (
+	distancePostCode = iota
+	distanceCity
+	distanceSubdivision
+	distanceCountry
+	distanceAbroad
+	distanceUnassigned
+)
+
+type stockLocation struct {
+	warehouseID *uint
+	distance    int
+	priority    int
+}
+
+// allocateOrder picks the locations every item ships from. The single location
+// strategy ships all items of a seller from the nearest warehouse that holds
+// them, otherwise and as a fallback each item takes the nearest stock first.
+// Stock booked before warehouses were used ships from the unassigned pool, a
+// quantity no active warehouse or the pool holds fails with ErrOutOfStock.
+func allocateOrder(items []domain.OrderItem, shipping domain.OrderAddress, warehouses []domain.Warehouse, stock []domain.LocationStock, strategy string) ([]domain.OrderItem, error) {
+	byID := map[uint]domain.Warehouse{}
+	for _, w := range warehouses {
+		byID[w.ID] = w
+	}
+
+	// remaining on hand stock by product and warehouse, 0 is the unassigned pool
+	remaining := map[uint]map[uint]int{}
+	for _, s := range stock {
+		if s.OnHand <= 0 {
+			continue
+		}
+		if remaining[s.ProductID] == nil {
+			remaining[s.ProductID] = map[uint]int{}
+		}
+		remaining[s.ProductID][warehouseKey(s.WarehouseID)] += s.OnHand
+	}
+
+	allocated := slices.Clone(items)
+	done := make([]bool, len(allocated))
+
+	if strategy == FulfillmentSingleLocation {
+		sellers := map[uint][]int{}
+		for i, item := range allocated {
+			sellers[item.SellerID] = append(sellers[item.SellerID], i)
+		}
+
+		for sellerID, indexes := range sellers {
+			warehouse, ok := singleLocation(allocated, indexes, sellerID, shipping, warehouses, remaining)
+			if !ok {
+				continue
+			}
+
+			id := warehouse.ID
+			for _, i := range indexes {
+				remaining[allocated[i].ProductID][id] -= int(allocated[i].Qty)
+				allocated[i].Allocations = []domain.OrderItemAllocation{{WarehouseID: &id, Qty: allocated[i].Qty}}
+				done[i] = true
+			}
+		}
+	}
+
+	for i, item := range allocated {
+		if done[i] {
+			continue
+		}
+
+		locations := productLocations(item, shipping, byID, remaining[item.ProductID])
+		need := int(item.Qty)
+		var allocations []domain.OrderItemAllocation
+
+		for _, location := range locations {
+			if need == 0 {
+				break
+			}
+
+			key := warehouseKey(location.warehouseID)
+			qty := min(remaining[item.ProductID][key], need)
+			if qty <= 0 {
+				continue
+			}
+
+			remaining[item.ProductID][key] -= qty
+			need -= qty
+			allocations = append(allocations, domain.OrderItemAllocation{WarehouseID: location.warehouseID, Qty: uint(qty)})
+		}
+
+		if need > 0 {
+			return nil, fmt.Errorf("%w for some items, please update the quantities", ErrOutOfStock)
+		}
+
+		allocated[i].Allocations = allocations
+	}
+
+	return allocated, nil
+}
+
+// singleLocation finds the nearest active warehouse of the seller holding
+// every item of the seller.
+func singleLocation(items []domain.OrderItem, indexes []int, sellerID uint, shipping domain.OrderAddress, warehouses []domain.Warehouse, remaining map[uint]map[uint]int) (domain.Warehouse, bool) {
+	var candidates []domain.Warehouse
+
+	for _, w := range warehouses {
+		if w.UserID != sellerID || !w.Active {
+			continue
+		}
+
+		needed := map[uint]int{}
+		for _, i := range indexes {
+			needed[items[i].ProductID] += int(items[i].Qty)
+		}
+
+		holdsAll := true
+		for productID, qty := range needed {
+			if remaining[productID][w.ID] < qty {
+				holdsAll = false
+				break
+			}
+		}
+
+		if holdsAll {
+			candidates = append(candidates, w)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return domain.Warehouse{}, false
+	}
+
+	slices.SortFunc(candidates, func(a, b domain.Warehouse) int {
+		return cmp.Or(
+			cmp.Compare(shippingDistance(a, shipping), shippingDistance(b, shipping)),
+			cmp.Compare(a.Priority, b.Priority),
+			cmp.Compare(a.ID, b.ID),
+		)
+	})
+
+	return candidates[0], true
+}
+
+// productLocations lists the locations holding the product nearest first, the
+// unassigned pool comes last.
+func productLocations(item domain.OrderItem, shipping domain.OrderAddress, warehouses map[uint]domain.Warehouse, remaining map[uint]int) []stockLocation {
+	var locations []stockLocation
+
+	for key := range remaining {
+		if key == 0 {
+			locations = append(locations, stockLocation{distance: distanceUnassigned})
+			continue
+		}
+
+		w, ok := warehouses[key]
+		// stock of inactive or foreign warehouses cannot ship
+		if !ok || !w.Active || w.UserID != item.SellerID {
+			continue
+		}
+
+		id := w.ID
+		locations = append(locations, stockLocation{
+			warehouseID: &id,
+			distance:    shippingDistance(w, shipping),
+			priority:    w.Priority,
+		})
+	}
+
+	slices.SortFunc(locations, func(a, b stockLocation) int {
+		return cmp.Or(
+			cmp.Compare(a.distance, b.distance),
+			cmp.Compare(a.priority, b.priority),
+			cmp.Compare(warehouseKey(a.warehouseID), warehouseKey(b.warehouseID)),
+		)
+	})
+
+	return locations
+}
+
+func shippingDistance(w domain.Warehouse, shipping domain.OrderAddress) int {
+	same := func(a, b string) bool {
+		a, b = strings.TrimSpace(a), strings.TrimSpace(b)
+		return a != "" && strings.EqualFold(a, b)
+	}
+
+	switch {
+	case !same(w.Country, shipping.Country):
+		return distanceAbroad
+	case same(strings.ReplaceAll(w.PostCode, " ", ""), strings.ReplaceAll(shipping.PostCode, " ", "")):
+		return distancePostCode
+	case same(w.City, shipping.City):
+		return distanceCity
+	case same(w.Subdivision, shipping.Subdivision):
+		return distanceSubdivision
+	default:
+		return distanceCountry
+	}
+}
+
+func warehouseKey(id *uint) uint {
+	if id == nil {
+		return 0
+	}
+	return *id
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"go-ecommerce-app/internal/domain"
+	"go-ecommerce-app/internal/dto"
+	"go-ecommerce-app/internal/repository"
+	"go-ecommerce-app/pkg/oidc"
+	"log"
+	"strings"
+	"time"
+)
+
+// OAuthStateTTL is how long an authorization request can be completed.
+const OAuthStateTTL = 10 * time.Minute
+
+var ErrProviderNotFound = errors.New("login provider not found")
+
+type IdentityService struct {
+	Repo      repository.IdentityRepository
+	Users     UserService
+	Providers map[string]*oidc.Provider
+}
+
+func (s IdentityService) provider(name string) (*oidc.Provider, error) {
+	provider, ok := s.Providers[name]
+	if !ok {
+		return nil, ErrProviderNotFound
+	}
+
+	return provider, nil
+}
+
+// StartLogin creates an authorization request. userID is set when a signed in
+// user links a provider to the account. It returns the authorization url and a
+// binding value the caller keeps in the browser, the callback must present it.
+func (s IdentityService) StartLogin(ctx context.Context, providerName string, userID uint) (string, string, error) {
+	provider, err := s.provider(providerName)
+	if err != nil {
+		return "", "", err
+	}
+
+	verifier, challenge, err := oidc.GeneratePKCE()
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := oidc.RandomString(24)
+	if err != nil {
+		return "", "", err
+	}
+
+	nonce, err := oidc.RandomString(24)
+	if err != nil {
+		return "", "", err
+	}
+
+	binding, err := oidc.RandomString(24)
+	if err != nil {
+		return "", "", err
+	}
+
+	err = s.Repo.CreateState(&domain.OAuthState{
+		State:     state,
+		Provider:  providerName,
+		Verifier:  verifier,
+		Nonce:     nonce,
+		UserID:    userID,
+		Binding:   hashBinding(binding),
+		ExpiresAt: time.Now().Add(OAuthStateTTL),
+	})
+	if err != nil {
+		return "", "", errors.New("unable to start login")
+	}
+
+	url, err := provider.AuthCodeURL(ctx, state, nonce, challenge)
+	if err != nil {
+		return "", "", err
+	}
+
+	return url, binding, nil
+}
+
+// FinishLogin handles the provider callback. It links the identity to the user
+// that started a link request, to an existing account with the same verified
+// email, or to a new account, and completes the login for that user. binding
+// is the value StartLogin handed to the browser, so a callback url forged by
+// someone else cannot sign the victim in or link into their account.
+func (s IdentityService) FinishLogin(ctx context.Context, providerName, code, state, binding string, meta dto.RequestMeta) (dto.LoginResult, error) {
+	provider, err := s.provider(providerName)
+	if err != nil {
+		return dto.LoginResult{}, err
+	}
+
+	pending, err := s.Repo.ConsumeState(state)
+	if err != nil || pending.Provider != providerName {
+		return dto.LoginResult{}, errors.New("login request expired, please try again")
+	}
+
+	if binding == "" || subtle.ConstantTimeCompare([]byte(hashBinding(binding)), []byte(pending.Binding)) != 1 {
+		return dto.LoginResult{}, errors.New("login request was started in another browser, please try again")
+	}
+
+	claims, err := provider.Exchange(ctx, code, pending.Verifier, pending.Nonce)
+	if err != nil {
+		log.Printf("oidc exchange error: %v", err)
+		return dto.LoginResult{}, errors.New("unable to sign in with provider")
+	}
+
+	email := strings.ToLower(strings.TrimSpace(claims.Email))
+
+	identity, err := s.Repo.FindIdentity(providerName, claims.Subject)
+	if err == nil {
+		if pending.UserID > 0 && pending.UserID != identity.UserID {
+			return dto.LoginResult{}, errors.New("this account is already linked to another user")
+		}
+
+		user, err := s.Users.Repo.FindUserByID(identity.UserID)
+		if err != nil {
+			return dto.LoginResult{}, err
+		}
+
+		return s.Users.CompleteLogin(user, meta)
+	}
+
+	var user domain.User
+
+	switch {
+	case pending.UserID > 0:
+		user, err = s.Users.Repo.FindUserByID(pending.UserID)
+		if err != nil {
+			return dto.LoginResult{}, err
+		}
+	case email == "":
+		return dto.LoginResult{}, errors.New("provider did not share an email address")
+	default:
+		user, err = s.Users.Repo.FindUser(email)
+		if err == nil && !claims.EmailVerified {
+			// linking on an unverified email would let anyone take over the account
+			return dto.LoginResult{}, errors.New("an account with this email already exists, please sign in and link the provider from your account")
+		}
+
+		if err != nil {
+			// the address would be taken from its owner, who could not register anymore
+			if !claims.EmailVerified {
+				return dto.LoginResult{}, errors.New("the provider has not verified your email address, please verify it there or register with your email")
+			}
+
+			user, err = s.Users.Repo.CreateUser(domain.User{
+				Email:     email,
+				FirstName: claims.GivenName,
+				LastName:  claims.FamilyName,
+			})
+			if err != nil {
+				return dto.LoginResult{}, errors.New("unable to create account")
+			}
+		}
+	}
+
+	err = s.Repo.CreateIdentity(&domain.UserIdentity{
+		UserID:   user.ID,
+		Provider: providerName,
+		Subject:  claims.Subject,
+		Email:    email,
+	})
+	if err != nil {
+		return dto.LoginResult{}, errors.New("unable to link account")
+	}
+
+	return s.Users.CompleteLogin(user, meta)
+}
+
+func hashBinding(binding string) string {
+	sum := sha256.Sum256([]byte(binding))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s IdentityService) GetIdentities(userID uint) ([]domain.UserIdentity, error) {
+	return s.Repo.FindUserIdentities(userID)
+}
+
+func (s IdentityService) Unlink(id, userID uint) error {
+	user, err := s.Users.Repo.FindUserByID(userID)
+	if err != nil {
+		return err
+	}
+
+	identities, err := s.Repo.FindUserIdentities(userID)
+	if err != nil {
+		return err
+	}
+
+	// keep at least one way to sign in
+	if user.Password == "" && len(identities) <= 1 {
+		return errors.New("please set a password before removing your last sign in method")
+	}
+
+	return s.Repo.DeleteIdentity(id, userID)
+}
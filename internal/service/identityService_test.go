@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"go-ecommerce-app/internal/domain"
+	"go-ecommerce-app/internal/dto"
+	"go-ecommerce-app/internal/helper"
+	"go-ecommerce-app/internal/repository"
+	"go-ecommerce-app/pkg/oidc"
+	"go-ecommerce-app/pkg/oidc/oidctest"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type memoryIdentityRepository struct {
+	identities []domain.UserIdentity
+	states     map[string]domain.OAuthState
+}
+
+func (r *memoryIdentityRepository) CreateIdentity(e *domain.UserIdentity) error {
+	e.ID = uint(len(r.identities) + 1)
+	r.identities = append(r.identities, *e)
+	return nil
+}
+
+func (r *memoryIdentityRepository) FindIdentity(provider, subject string) (domain.UserIdentity, error) {
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return domain.UserIdentity{}, gorm.ErrRecordNotFound
+}
+
+func (r *memoryIdentityRepository) FindUserIdentities(userID uint) ([]domain.UserIdentity, error) {
+	var found []domain.UserIdentity
+	for _, identity := range r.identities {
+		if identity.UserID == userID {
+			found = append(found, identity)
+		}
+	}
+	return found, nil
+}
+
+func (r *memoryIdentityRepository) DeleteIdentity(id, userID uint) error {
+	return nil
+}
+
+func (r *memoryIdentityRepository) CreateState(e *domain.OAuthState) error {
+	r.states[e.State] = *e
+	return nil
+}
+
+func (r *memoryIdentityRepository) ConsumeState(state string) (domain.OAuthState, error) {
+	pending, ok := r.states[state]
+	if !ok {
+		return domain.OAuthState{}, gorm.ErrRecordNotFound
+	}
+	delete(r.states, state)
+	return pending, nil
+}
+
+// memoryUserRepository implements the lookups of the login flow, the other
+// methods of the embedded interface are not called.
+type memoryUserRepository struct {
+	repository.UserRepository
+	users []domain.User
+}
+
+func (r *memoryUserRepository) CreateUser(u domain.User) (domain.User, error) {
+	u.ID = uint(len(r.users) + 1)
+	if u.UserType == "" {
+		u.UserType = domain.BUYER
+	}
+	r.users = append(r.users, u)
+	return u, nil
+}
+
+func (r *memoryUserRepository) FindUser(email string) (domain.User, error) {
+	for _, user := range r.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return domain.User{}, gorm.ErrRecordNotFound
+}
+
+func (r *memoryUserRepository) FindUserByID(id uint) (domain.User, error) {
+	for _, user := range r.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return domain.User{}, gorm.ErrRecordNotFound
+}
+
+func (r *memoryUserRepository) CreateLoginAttempt(e domain.LoginAttempt) error {
+	return nil
+}
+
+func (r *memoryUserRepository) UpdateUserFields(id uint, fields map[string]any) error {
+	return nil
+}
+
+func newIdentityTestService(t *testing.T, issuer *oidctest.Issuer) (IdentityService, *memoryIdentityRepository, *memoryUserRepository) {
+	keys, err := helper.LoadKeySet("", "", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identities := &memoryIdentityRepository{states: map[string]domain.OAuthState{}}
+	users := &memoryUserRepository{}
+
+	svc := IdentityService{
+		Repo: identities,
+		Users: UserService{
+			Repo: users,
+			Auth: helper.Auth{Secret: "secret", Keys: keys, Issuer: "test", Audience: "test"},
+		},
+		Providers: map[string]*oidc.Provider{
+			"mock": oidc.NewProvider(oidc.ProviderConfig{
+				Name:        "mock",
+				Issuer:      issuer.URL,
+				ClientID:    "client",
+				RedirectURL: "http://localhost/auth/oidc/mock/callback",
+			}),
+		},
+	}
+
+	return svc, identities, users
+}
+
+func TestFinishLoginCreatesAccount(t *testing.T) {
+	issuer := oidctest.NewIssuer(t)
+	svc, identities, users := newIdentityTestService(t, issuer)
+	ctx := context.Background()
+
+	url, binding, err := svc.StartLogin(ctx, "mock", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, state := issuer.Authorize(t, url, oidctest.Identity{Subject: "sub-1", Email: "Jane@Example.com", EmailVerified: true})
+
+	result, err := svc.FinishLogin(ctx, "mock", code, state, binding, dto.RequestMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Token == "" {
+		t.Fatal("login returned no token")
+	}
+
+	if len(users.users) != 1 || users.users[0].Email != "jane@example.com" {
+		t.Fatalf("unexpected users %+v", users.users)
+	}
+
+	if len(identities.identities) != 1 || identities.identities[0].UserID != users.users[0].ID {
+		t.Fatalf("unexpected identities %+v", identities.identities)
+	}
+}
+
+func TestFinishLoginRefusesUnverifiedEmail(t *testing.T) {
+	issuer := oidctest.NewIssuer(t)
+	svc, identities, users := newIdentityTestService(t, issuer)
+	ctx := context.Background()
+
+	url, binding, err := svc.StartLogin(ctx, "mock", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, state := issuer.Authorize(t, url, oidctest.Identity{Subject: "sub-1", Email: "victim@example.com"})
+
+	if _, err = svc.FinishLogin(ctx, "mock", code, state, binding, dto.RequestMeta{}); err == nil {
+		t.Fatal("account created with an unverified email")
+	}
+
+	if len(users.users) != 0 || len(identities.identities) != 0 {
+		t.Fatalf("unexpected users %+v, identities %+v", users.users, identities.identities)
+	}
+}
+
+func TestFinishLoginRequiresTheStartingBrowser(t *testing.T) {
+	issuer := oidctest.NewIssuer(t)
+	svc, identities, users := newIdentityTestService(t, issuer)
+	ctx := context.Background()
+
+	victim, _ := users.CreateUser(domain.User{Email: "victim@example.com"})
+
+	// the victim is signed in and starts linking a provider, the attacker
+	// sends them a callback url carrying the attacker's code for that state
+	url, _, err := svc.StartLogin(ctx, "mock", victim.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, state := issuer.Authorize(t, url, oidctest.Identity{Subject: "attacker", Email: "attacker@example.com", EmailVerified: true})
+
+	for _, binding := range []string{"", "forged"} {
+		if _, err = svc.FinishLogin(ctx, "mock", code, state, binding, dto.RequestMeta{}); err == nil {
+			t.Fatalf("callback with binding %q was accepted", binding)
+		}
+	}
+
+	if len(identities.identities) != 0 {
+		t.Fatalf("identity linked without the browser binding: %+v", identities.identities)
+	}
+}
+
+func TestFinishLoginLinksSignedInUser(t *testing.T) {
+	issuer := oidctest.NewIssuer(t)
+	svc, identities, users := newIdentityTestService(t, issuer)
+	ctx := context.Background()
+
+	user, _ := users.CreateUser(domain.User{Email: "jane@example.com"})
+
+	url, binding, err := svc.StartLogin(ctx, "mock", user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, state := issuer.Authorize(t, url, oidctest.Identity{Subject: "sub-1", Email: "other@example.com"})
+
+	if _, err = svc.FinishLogin(ctx, "mock", code, state, binding, dto.RequestMeta{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(identities.identities) != 1 || identities.identities[0].UserID != user.ID {
+		t.Fatalf("unexpected identities %+v", identities.identities)
+	}
+
+	// the state is single use
+	if _, err = svc.FinishLogin(ctx, "mock", code, state, binding, dto.RequestMeta{}); err == nil {
+		t.Fatal("state was accepted twice")
+	}
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"go-ecommerce-app/internal/helper"
+	"go-ecommerce-app/pkg/blobstore"
+	"go-ecommerce-app/pkg/imaging"
+	"io"
+	"log"
+	"mime/multipart"
+	"strings"
+)
+
+// imageSize is generated for every upload, the name is part of the url.
+type imageSize struct {
+	name string
+	size int
+}
+
+// readImageUpload checks the size and the format of an uploaded image.
+func readImageUpload(file *multipart.FileHeader, maxSize int) ([]byte, imaging.Image, error) {
+	tooLarge := fmt.Errorf("image must be smaller than %d MB", maxSize>>20)
+
+	if file.Size > int64(maxSize) {
+		return nil, imaging.Image{}, tooLarge
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return nil, imaging.Image{}, err
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(io.LimitReader(src, int64(maxSize)+1))
+	if err != nil {
+		return nil, imaging.Image{}, err
+	}
+
+	if len(data) > maxSize {
+		return nil, imaging.Image{}, tooLarge
+	}
+
+	decoded, err := imaging.Decode(data)
+	if err != nil {
+		return nil, imaging.Image{}, err
+	}
+
+	return data, decoded, nil
+}
+
+// storeImage puts the original and the resized versions below dir and returns
+// the keys and the urls by size name. Nothing is left behind on failure.
+func storeImage(blobs blobstore.BlobStore, baseURL, dir string, data []byte, decoded imaging.Image, sizes []imageSize) ([]string, map[string]string, error) {
+	// a random segment keeps the urls cacheable forever, a new upload gets new urls
+	token, err := helper.RandomString(16)
+	if err != nil {
+		return nil, nil, err
+	}
+	prefix := dir + "/" + strings.ToLower(token) + "/"
+
+	var keys []string
+	urls := map[string]string{}
+
+	put := func(name string, data []byte, contentType, ext string) error {
+		key := prefix + name + ext
+		if err := blobs.Put(context.Background(), key, data, contentType); err != nil {
+			return err
+		}
+		keys = append(keys, key)
+		urls[name] = mediaURL(baseURL, key)
+		return nil
+	}
+
+	err = put("original", data, decoded.ContentType, decoded.Ext)
+	for _, size := range sizes {
+		if err != nil {
+			break
+		}
+
+		var resized []byte
+		var contentType, ext string
+		resized, contentType, ext, err = imaging.Encode(imaging.Thumbnail(decoded.Image, size.size), decoded.ContentType)
+		if err == nil {
+			err = put(size.name, resized, contentType, ext)
+		}
+	}
+
+	if err != nil {
+		deleteBlobs(blobs, keys)
+		return nil, nil, err
+	}
+
+	return keys, urls, nil
+}
+
+func mediaURL(baseURL, key string) string {
+	return baseURL + "/media/" + key
+}
+
+func deleteBlobs(blobs blobstore.BlobStore, keys []string) {
+	for _, key := range keys {
+		if err := blobs.Delete(context.Background(), key); err != nil {
+			log.Printf("deleting blob %s failed: %v", key, err)
+		}
+	}
+}
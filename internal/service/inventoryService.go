@@ -0,0 +1,321 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"go-ecommerce-app/internal/domain"
+	"go-ecommerce-app/internal/dto"
+	"go-ecommerce-app/internal/policy"
+	"go-ecommerce-app/internal/repository"
+	"go-ecommerce-app/pkg/payment"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	// the stock is held a little longer than the checkout session can be
+	// paid, the session is created after the reservation
+	reservationTTL        = payment.SessionTTL + 5*time.Minute
+	stockHistoryPageLimit = 100
+	stockNoteMaxLength    = 500
+)
+
+var (
+	ErrOutOfStock         = errors.New("not enough stock")
+	ErrProductUnavailable = errors.New("some items are no longer available, please update your cart")
+)
+
+type InventoryService struct {
+	Repo        repository.InventoryRepository
+	Catalog     repository.CatalogRepository
+	Warehouses  repository.WarehouseRepository
+	Audit       AuditService
+	Alerts      *AlertService
+	Fulfillment string // FulfillmentNearest or FulfillmentSingleLocation
+}
+
+// RecordMovement books a receipt, a return or a signed adjustment of the on
+// hand stock. Sales and reservations are booked by the checkout only.
+func (s InventoryService) RecordMovement(id int, user domain.User, input dto.StockMovementRequest, meta dto.RequestMeta) (domain.StockLevel, error) {
+	product, err := s.Catalog.FindProductByID(id)
+	if err != nil {
+		return domain.StockLevel{}, errors.New("product does not exist")
+	}
+
+	if !policy.CanManage(user, policy.CatalogProductManage, product.UserID) {
+		return domain.StockLevel{}, errors.New("you dont have manage right of product")
+	}
+
+	note := strings.TrimSpace(input.Note)
+	if len(note) > stockNoteMaxLength {
+		return domain.StockLevel{}, fmt.Errorf("note must be at most %d characters", stockNoteMaxLength)
+	}
+
+	switch input.Kind {
+	case domain.MovementReceipt, domain.MovementReturn:
+		if input.Quantity <= 0 {
+			return domain.StockLevel{}, errors.New("quantity must be greater than 0")
+		}
+	case domain.MovementAdjustment:
+		if input.Quantity == 0 {
+			return domain.StockLevel{}, errors.New("quantity must not be 0")
+		}
+	default:
+		return domain.StockLevel{}, fmt.Errorf("kind must be %s, %s or %s",
+			domain.MovementReceipt, domain.MovementReturn, domain.MovementAdjustment)
+	}
+
+	if input.WarehouseID != nil {
+		warehouse, err := s.Warehouses.FindWarehouse(*input.WarehouseID, product.UserID)
+		if err != nil {
+			return domain.StockLevel{}, errors.New("warehouse does not exist")
+		}
+
+		// an inactive warehouse can still be emptied
+		if !warehouse.Active && input.Quantity > 0 {
+			return domain.StockLevel{}, errors.New("warehouse is not active")
+		}
+	}
+
+	change, err := s.Repo.AddMovement(domain.InventoryMovement{
+		ProductID:   product.ID,
+		WarehouseID: input.WarehouseID,
+		Kind:        input.Kind,
+		OnHandDelta: input.Quantity,
+		ActorID:     user.ID,
+		Note:        note,
+	})
+	if err != nil {
+		return domain.StockLevel{}, stockError(err)
+	}
+
+	s.Audit.Record(meta, domain.AuditProductStock, "product", product.ID, change.Before, change.After)
+	s.notify(change)
+
+	return change.After, nil
+}
+
+// Receive books stock arriving for a new product.
+func (s InventoryService) Receive(productID uint, qty int, actorID uint, note string) error {
+	change, err := s.Repo.AddMovement(domain.InventoryMovement{
+		ProductID:   productID,
+		Kind:        domain.MovementReceipt,
+		OnHandDelta: qty,
+		ActorID:     actorID,
+		Note:        note,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.notify(change)
+
+	return nil
+}
+
+// SetAvailable books the adjustment that makes the given quantity available.
+func (s InventoryService) SetAvailable(productID uint, available int, actorID uint, note string) (dto.StockChange, error) {
+	if available < 0 {
+		return dto.StockChange{}, errors.New("stock must not be negative")
+	}
+
+	change, err := s.Repo.SetAvailable(productID, available, actorID, note)
+	if err != nil {
+		return dto.StockChange{}, stockError(err)
+	}
+
+	s.notify(change)
+
+	return change, nil
+}
+
+// Reserve holds the cart for a checkout until the reservation expires.
+func (s InventoryService) Reserve(userID uint, reference string, cart []domain.Cart) error {
+	items := make([]dto.StockItem, 0, len(cart))
+	productIDs := make([]uint, 0, len(cart))
+	for _, item := range cart {
+		items = append(items, dto.StockItem{ProductID: item.ProductID, Qty: int(item.Qty)})
+		productIDs = append(productIDs, item.ProductID)
+	}
+
+	if err := s.checkOnSale(productIDs); err != nil {
+		return err
+	}
+
+	changes, err := s.Repo.Reserve(userID, reference, items, time.Now().Add(reservationTTL))
+	if err != nil {
+		return stockError(err)
+	}
+
+	s.notify(changes...)
+
+	return nil
+}
+
+func (s InventoryService) Release(reference string) error {
+	changes, err := s.Repo.ReleaseReservations(reference)
+	if err != nil {
+		return err
+	}
+
+	s.notify(changes...)
+
+	return nil
+}
+
+// ReleaseExpired gives back the stock of abandoned checkouts and reports the
+// number of released checkouts.
+func (s InventoryService) ReleaseExpired() (int, error) {
+	references, err := s.Repo.FindExpiredReservations(time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	released := 0
+	for _, reference := range references {
+		if err = s.Release(reference); err != nil {
+			log.Printf("releasing reservations of checkout %s failed: %v", reference, err)
+			continue
+		}
+		released++
+	}
+
+	return released, nil
+}
+
+// CommitSale picks the warehouses the items ship from and takes the items off
+// their stock, using the reservations of the checkout first. The items are
+// returned with their allocations.
+func (s InventoryService) CommitSale(userID uint, reference string, shipping domain.OrderAddress, items []domain.OrderItem) ([]domain.OrderItem, error) {
+	productIDs := make([]uint, 0, len(items))
+	sellerIDs := make([]uint, 0, len(items))
+	for _, item := range items {
+		productIDs = append(productIDs, item.ProductID)
+		sellerIDs = append(sellerIDs, item.SellerID)
+	}
+
+	if err := s.checkOnSale(productIDs); err != nil {
+		return nil, err
+	}
+
+	stock, err := s.Repo.FindLocationStock(productIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	warehouses, err := s.Warehouses.FindActiveWarehouses(sellerIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	allocated, err := allocateOrder(items, shipping, warehouses, stock, s.Fulfillment)
+	if err != nil {
+		return nil, err
+	}
+
+	var stockItems []dto.StockItem
+	for _, item := range allocated {
+		for _, allocation := range item.Allocations {
+			stockItems = append(stockItems, dto.StockItem{
+				ProductID:   item.ProductID,
+				WarehouseID: allocation.WarehouseID,
+				Qty:         int(allocation.Qty),
+			})
+		}
+	}
+
+	changes, err := s.Repo.CommitSale(userID, reference, stockItems)
+	if err != nil {
+		return nil, stockError(err)
+	}
+
+	s.notify(changes...)
+
+	return allocated, nil
+}
+
+// ReverseSale books the sold items of a cancelled order back as returns.
+func (s InventoryService) ReverseSale(reference string, actorID uint) error {
+	changes, err := s.Repo.ReverseSale(reference, actorID)
+	if err != nil {
+		return err
+	}
+
+	s.notify(changes...)
+
+	return nil
+}
+
+// GetStockHistory lists the ledger of the product, newest first, with the
+// stock held in each location.
+func (s InventoryService) GetStockHistory(id int, user domain.User, filter dto.StockHistoryFilter) (dto.StockHistory, error) {
+	product, err := s.Catalog.FindProductByID(id)
+	if err != nil {
+		return dto.StockHistory{}, errors.New("product does not exist")
+	}
+
+	if !policy.CanManage(user, policy.CatalogProductManage, product.UserID) {
+		return dto.StockHistory{}, errors.New("you dont have manage right of product")
+	}
+
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.Limit < 1 || filter.Limit > stockHistoryPageLimit {
+		filter.Limit = stockHistoryPageLimit
+	}
+
+	level, err := s.Repo.FindStockLevel(product.ID)
+	if err != nil {
+		return dto.StockHistory{}, err
+	}
+
+	locations, err := s.Repo.FindLocationStock([]uint{product.ID})
+	if err != nil {
+		return dto.StockHistory{}, err
+	}
+
+	movements, total, err := s.Repo.FindMovements(product.ID, filter)
+	if err != nil {
+		return dto.StockHistory{}, err
+	}
+
+	return dto.StockHistory{Stock: level, Locations: locations, Movements: movements, Total: total}, nil
+}
+
+// notify reports products that became available again to the alerts.
+func (s InventoryService) notify(changes ...dto.StockChange) {
+	for _, change := range changes {
+		s.Alerts.ProductChanged(
+			domain.Product{ID: change.ProductID, Stock: uint(max(change.Before.Available, 0))},
+			domain.Product{ID: change.ProductID, Stock: uint(max(change.After.Available, 0))},
+		)
+	}
+}
+
+// checkOnSale fails with ErrProductUnavailable unless every product is active.
+func (s InventoryService) checkOnSale(productIDs []uint) error {
+	unique := map[uint]bool{}
+	for _, id := range productIDs {
+		unique[id] = true
+	}
+
+	count, err := s.Catalog.CountPublicProducts(productIDs)
+	if err != nil {
+		return err
+	}
+	if count < int64(len(unique)) {
+		return ErrProductUnavailable
+	}
+
+	return nil
+}
+
+func stockError(err error) error {
+	if errors.Is(err, repository.ErrInsufficientStock) {
+		return fmt.Errorf("%w for some items, please update the quantities", ErrOutOfStock)
+	}
+
+	return err
+}
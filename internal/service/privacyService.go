@@ -0,0 +1,324 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"go-ecommerce-app/config"
+	"go-ecommerce-app/internal/domain"
+	"go-ecommerce-app/internal/dto"
+	"go-ecommerce-app/internal/repository"
+	"go-ecommerce-app/pkg/blobstore"
+	"log"
+	"time"
+)
+
+var (
+	ErrAccountDeleted     = errors.New("account has already been deleted")
+	ErrDeletionNotPending = errors.New("account is not scheduled for deletion")
+)
+
+type PrivacyService struct {
+	Repo   repository.PrivacyRepository
+	Users  UserService
+	Config config.AppConfig
+	Audit  AuditService
+	Blobs  blobstore.BlobStore // KYC documents and review images of deleted accounts
+}
+
+func (s PrivacyService) ExportData(id uint) (dto.UserExport, error) {
+	user, err := s.Users.Repo.FindUserByID(id)
+	if err != nil {
+		return dto.UserExport{}, errors.New("user not found")
+	}
+
+	orders, err := s.Repo.FindOrdersWithItems(id)
+	if err != nil {
+		return dto.UserExport{}, err
+	}
+
+	payments, err := s.Repo.FindPayments(id)
+	if err != nil {
+		return dto.UserExport{}, err
+	}
+
+	logins, err := s.Repo.FindLoginAttempts(id)
+	if err != nil {
+		return dto.UserExport{}, err
+	}
+
+	identities, err := s.Repo.FindIdentities(id)
+	if err != nil {
+		return dto.UserExport{}, err
+	}
+
+	wishlists, err := s.Repo.FindWishlists(id)
+	if err != nil {
+		return dto.UserExport{}, err
+	}
+
+	// the checkout secret of a payment session is a credential, not user data
+	for i := range payments {
+		payments[i].ClientSecret = ""
+	}
+
+	addresses := make([]dto.ExportAddress, 0, len(user.Addresses))
+	for _, a := range user.Addresses {
+		addresses = append(addresses, exportAddress(a))
+	}
+
+	exportOrders := make([]dto.ExportOrder, 0, len(orders))
+	for _, o := range orders {
+		exportOrders = append(exportOrders, exportOrder(o))
+	}
+
+	return dto.UserExport{
+		ExportedAt:   time.Now(),
+		Profile:      exportProfile(user),
+		Addresses:    addresses,
+		Orders:       exportOrders,
+		Payments:     payments,
+		LoginHistory: logins,
+		Identities:   identities,
+		Wishlists:    wishlists,
+	}, nil
+}
+
+// the export writes the plain text of the encrypted fields, their json
+// encoding is masked
+
+func exportProfile(u domain.User) dto.ExportProfile {
+	return dto.ExportProfile{
+		ID:               u.ID,
+		FirstName:        u.FirstName,
+		LastName:         u.LastName,
+		Email:            u.Email,
+		Phone:            u.Phone.String(),
+		Verified:         u.Verified,
+		UserType:         u.UserType,
+		TwoFactorEnabled: u.TwoFactorEnabled,
+		DeletionDueAt:    u.DeletionDueAt,
+		CreatedAt:        u.CreatedAt,
+		UpdatedAt:        u.UpdatedAt,
+	}
+}
+
+func exportAddress(a domain.Address) dto.ExportAddress {
+	return dto.ExportAddress{
+		ID:                a.ID,
+		Label:             a.Label,
+		AddressInput1:     a.AddressInput1,
+		AddressInput2:     a.AddressInput2,
+		City:              a.City,
+		PostCode:          a.PostCode,
+		Subdivision:       a.Subdivision,
+		Country:           a.Country,
+		Phone:             a.Phone.String(),
+		IsDefaultShipping: a.IsDefaultShipping,
+		IsDefaultBilling:  a.IsDefaultBilling,
+		CreatedAt:         a.CreatedAt,
+		UpdatedAt:         a.UpdatedAt,
+	}
+}
+
+func exportOrder(o domain.Order) dto.ExportOrder {
+	return dto.ExportOrder{
+		ID:              o.ID,
+		Status:          o.Status,
+		Amount:          o.Amount,
+		TransactionID:   o.TransactionID,
+		OrderRefNumber:  o.OrderRefNumber,
+		PaymentID:       o.PaymentID,
+		ShippingAddress: exportOrderAddress(o.ShippingAddress),
+		BillingAddress:  exportOrderAddress(o.BillingAddress),
+		Items:           o.Items,
+		DeliveredAt:     o.DeliveredAt,
+		CreatedAt:       o.CreatedAt,
+	}
+}
+
+func exportOrderAddress(a domain.OrderAddress) dto.ExportOrderAddress {
+	return dto.ExportOrderAddress{
+		Name:          a.Name,
+		Phone:         a.Phone.String(),
+		AddressInput1: a.AddressInput1,
+		AddressInput2: a.AddressInput2,
+		City:          a.City,
+		PostCode:      a.PostCode,
+		Subdivision:   a.Subdivision,
+		Country:       a.Country,
+	}
+}
+
+// ExportArchive packs the export into a zip with one json file per section.
+func (s PrivacyService) ExportArchive(id uint) ([]byte, error) {
+	export, err := s.ExportData(id)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", export.Profile},
+		{"addresses.json", export.Addresses},
+		{"orders.json", export.Orders},
+		{"payments.json", export.Payments},
+		{"login_history.json", export.LoginHistory},
+		{"identities.json", export.Identities},
+		{"wishlists.json", export.Wishlists},
+	}
+
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+
+	for _, f := range files {
+		fw, err := w.CreateHeader(&zip.FileHeader{
+			Name:     f.name,
+			Method:   zip.Deflate,
+			Modified: export.ExportedAt,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(f.data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// RequestDeletion schedules the account for anonymization after the grace
+// period. The user confirms with the password and, if enabled, a second factor.
+func (s PrivacyService) RequestDeletion(id uint, input dto.DeleteAccountInput, meta dto.RequestMeta) (*time.Time, error) {
+	user, err := s.Users.Repo.FindUserByID(id)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	if user.AnonymizedAt != nil {
+		return nil, ErrAccountDeleted
+	}
+
+	// accounts created through a login provider have no password
+	if user.Password != "" {
+		if err = s.Users.Auth.VerifyPassword(input.Password, user.Password); err != nil {
+			return nil, ErrInvalidCredentials
+		}
+	}
+
+	if user.TwoFactorEnabled {
+		if err = s.Users.verifySecondFactor(user, input.Code, input.RecoveryCode); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.scheduleDeletion(user, s.Config.DeletionGrace, meta)
+}
+
+func (s PrivacyService) CancelDeletion(id uint, meta dto.RequestMeta) error {
+	user, err := s.Users.Repo.FindUserByID(id)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	if user.AnonymizedAt != nil {
+		return ErrAccountDeleted
+	}
+
+	if user.DeletionDueAt == nil {
+		return ErrDeletionNotPending
+	}
+
+	if err = s.Users.Repo.UpdateUserFields(id, map[string]any{"deletion_due_at": nil}); err != nil {
+		return errors.New("unable to cancel account deletion")
+	}
+
+	s.Audit.Record(meta, domain.AuditDeletionCancel, "user", id,
+		map[string]any{"deletion_due_at": user.DeletionDueAt}, map[string]any{"deletion_due_at": nil})
+
+	return nil
+}
+
+// AdminDeleteUser schedules the deletion like a user request would, or skips
+// the grace period when immediate is set.
+func (s PrivacyService) AdminDeleteUser(id uint, input dto.AdminDeleteUserInput, meta dto.RequestMeta) (*time.Time, error) {
+	user, err := s.Users.Repo.FindUserByID(id)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	if user.AnonymizedAt != nil {
+		return nil, ErrAccountDeleted
+	}
+
+	grace := s.Config.DeletionGrace
+	if input.Immediate {
+		grace = 0
+	}
+
+	return s.scheduleDeletion(user, grace, meta)
+}
+
+func (s PrivacyService) scheduleDeletion(user domain.User, grace time.Duration, meta dto.RequestMeta) (*time.Time, error) {
+	if grace <= 0 {
+		if err := s.anonymize(user.ID); err != nil {
+			return nil, errors.New("unable to delete account")
+		}
+		s.Audit.Record(meta, domain.AuditAccountDelete, "user", user.ID, nil, nil)
+		return nil, nil
+	}
+
+	dueAt := time.Now().Add(grace)
+	if err := s.Users.Repo.UpdateUserFields(user.ID, map[string]any{"deletion_due_at": dueAt}); err != nil {
+		return nil, errors.New("unable to schedule account deletion")
+	}
+
+	s.Audit.Record(meta, domain.AuditDeletionRequest, "user", user.ID,
+		map[string]any{"deletion_due_at": user.DeletionDueAt}, map[string]any{"deletion_due_at": dueAt})
+
+	return &dueAt, nil
+}
+
+// PurgeDueAccounts anonymizes every account whose grace period has ended.
+func (s PrivacyService) PurgeDueAccounts() (int, error) {
+	users, err := s.Repo.FindUsersDueForDeletion(time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, user := range users {
+		if err = s.anonymize(user.ID); err != nil {
+			log.Printf("account deletion failed for user %d: %v", user.ID, err)
+			continue
+		}
+		// the job has no actor, the event keeps the zero actor id
+		s.Audit.Record(dto.RequestMeta{}, domain.AuditAccountDelete, "user", user.ID, nil, nil)
+		purged++
+	}
+
+	return purged, nil
+}
+
+// anonymize scrubs the account and removes the files it uploaded.
+func (s PrivacyService) anonymize(id uint) error {
+	blobs, err := s.Repo.AnonymizeUser(id)
+	if err != nil {
+		return err
+	}
+
+	deleteBlobs(s.Blobs, blobs)
+
+	return nil
+}
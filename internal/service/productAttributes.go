@@ -0,0 +1,386 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"go-ecommerce-app/internal/domain"
+	"go-ecommerce-app/internal/dto"
+	"go-ecommerce-app/internal/repository"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	attributeNameMaxLength  = 100
+	attributeUnitMaxLength  = 20
+	attributeOptionLimit    = 100
+	attributeValueMaxLength = 200
+)
+
+var (
+	ErrAttributeNotFound = errors.New("attribute not found")
+
+	attributeKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
+	attributeTypes      = []string{domain.AttributeText, domain.AttributeNumber, domain.AttributeBoolean, domain.AttributeEnum}
+)
+
+// Category attribute schema
+
+func (s CatalogService) GetCategoryAttributes(categoryID int) ([]domain.CategoryAttribute, error) {
+	if _, err := s.Repo.FindCategoryByID(categoryID); err != nil {
+		return nil, errors.New("category does not exist")
+	}
+
+	return s.Repo.FindCategoryAttributes(uint(categoryID))
+}
+
+func (s CatalogService) CreateCategoryAttribute(categoryID int, input dto.CategoryAttributeRequest, meta dto.RequestMeta) (*domain.CategoryAttribute, error) {
+	if _, err := s.Repo.FindCategoryByID(categoryID); err != nil {
+		return nil, errors.New("category does not exist")
+	}
+
+	key := strings.TrimSpace(input.Key)
+	if !attributeKeyPattern.MatchString(key) {
+		return nil, errors.New("key must start with a letter and use lowercase letters, digits and underscores only")
+	}
+
+	attributes, err := s.Repo.FindCategoryAttributes(uint(categoryID))
+	if err != nil {
+		return nil, errors.New("unable to create attribute")
+	}
+	if slices.ContainsFunc(attributes, func(a domain.CategoryAttribute) bool { return a.Key == key }) {
+		return nil, errors.New("the category already has an attribute with this key")
+	}
+
+	attribute := &domain.CategoryAttribute{CategoryID: uint(categoryID), Key: key}
+	if err = applyAttributeInput(attribute, input); err != nil {
+		return nil, err
+	}
+
+	if err = s.Repo.CreateCategoryAttribute(attribute); err != nil {
+		return nil, errors.New("unable to create attribute")
+	}
+
+	s.Audit.Record(meta, domain.AuditCategoryAttributeCreate, "category_attribute", attribute.ID, nil, attribute)
+
+	return attribute, nil
+}
+
+// UpdateCategoryAttribute changes the attribute, the key is fixed and the type
+// is only changed while no product has a value.
+func (s CatalogService) UpdateCategoryAttribute(categoryID, id int, input dto.CategoryAttributeRequest, meta dto.RequestMeta) (*domain.CategoryAttribute, error) {
+	attribute, err := s.Repo.FindCategoryAttribute(uint(categoryID), uint(id))
+	if err != nil {
+		return nil, ErrAttributeNotFound
+	}
+
+	if key := strings.TrimSpace(input.Key); key != "" && key != attribute.Key {
+		return nil, errors.New("the key of an attribute cannot be changed")
+	}
+
+	before := *attribute
+
+	if input.Type != attribute.Type {
+		count, err := s.Repo.CountAttributeValues(attribute.ID)
+		if err != nil {
+			return nil, errors.New("unable to update attribute")
+		}
+		if count > 0 {
+			return nil, errors.New("the type cannot be changed while products have values, add a new attribute instead")
+		}
+	}
+
+	if err = applyAttributeInput(attribute, input); err != nil {
+		return nil, err
+	}
+
+	if err = s.Repo.UpdateCategoryAttribute(attribute); err != nil {
+		return nil, errors.New("unable to update attribute")
+	}
+
+	s.Audit.Record(meta, domain.AuditCategoryAttributeUpdate, "category_attribute", attribute.ID, before, attribute)
+
+	return attribute, nil
+}
+
+// DeleteCategoryAttribute removes the attribute and its product values.
+func (s CatalogService) DeleteCategoryAttribute(categoryID, id int, meta dto.RequestMeta) error {
+	attribute, err := s.Repo.FindCategoryAttribute(uint(categoryID), uint(id))
+	if err != nil {
+		return ErrAttributeNotFound
+	}
+
+	if err = s.Repo.DeleteCategoryAttribute(attribute.ID); err != nil {
+		return errors.New("unable to delete attribute")
+	}
+
+	s.Audit.Record(meta, domain.AuditCategoryAttributeDelete, "category_attribute", attribute.ID, attribute, nil)
+
+	return nil
+}
+
+func applyAttributeInput(a *domain.CategoryAttribute, input dto.CategoryAttributeRequest) error {
+	name := strings.TrimSpace(input.Name)
+	unit := strings.TrimSpace(input.Unit)
+
+	switch {
+	case name == "":
+		return errors.New("attribute name is required")
+	case utf8.RuneCountInString(name) > attributeNameMaxLength:
+		return fmt.Errorf("attribute name must be at most %d characters", attributeNameMaxLength)
+	case utf8.RuneCountInString(unit) > attributeUnitMaxLength:
+		return fmt.Errorf("unit must be at most %d characters", attributeUnitMaxLength)
+	case !slices.Contains(attributeTypes, input.Type):
+		return fmt.Errorf("type must be one of %s", strings.Join(attributeTypes, ", "))
+	}
+
+	var options []string
+	if input.Type == domain.AttributeEnum {
+		for _, option := range input.Options {
+			option = strings.TrimSpace(option)
+			if option == "" || slices.Contains(options, option) {
+				continue
+			}
+			if utf8.RuneCountInString(option) > attributeValueMaxLength {
+				return fmt.Errorf("options must be at most %d characters", attributeValueMaxLength)
+			}
+			options = append(options, option)
+		}
+
+		if len(options) == 0 {
+			return errors.New("enum attributes need at least one option")
+		}
+		if len(options) > attributeOptionLimit {
+			return fmt.Errorf("an attribute can have at most %d options", attributeOptionLimit)
+		}
+	} else if len(input.Options) > 0 {
+		return errors.New("options are only used by enum attributes")
+	}
+
+	a.Name = name
+	a.Type = input.Type
+	a.Unit = unit
+	a.Options = options
+	a.Required = input.Required
+	a.Filterable = input.Filterable
+	a.Position = input.Position
+
+	return nil
+}
+
+// Product attribute values
+
+// productAttributes validates the values of the input against the attribute
+// schema of the category, merged over the current values of the product.
+// Current values of keys the category does not have are dropped.
+func productAttributes(repo repository.CatalogRepository, categoryID uint, current []domain.ProductAttribute, input map[string]any) ([]domain.ProductAttribute, error) {
+	var schema []domain.CategoryAttribute
+	if categoryID > 0 {
+		var err error
+		if schema, err = repo.FindCategoryAttributes(categoryID); err != nil {
+			return nil, errors.New("unable to check product attributes")
+		}
+	}
+
+	byKey := map[string]domain.CategoryAttribute{}
+	for _, a := range schema {
+		byKey[a.Key] = a
+	}
+
+	values := map[string]any{}
+	for key, value := range attributeValues(current) {
+		if _, ok := byKey[key]; ok {
+			values[key] = value
+		}
+	}
+
+	for key, value := range input {
+		if _, ok := byKey[key]; !ok {
+			return nil, fmt.Errorf("the category has no attribute %s", key)
+		}
+		// null removes the value
+		values[key] = value
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var attributes []domain.ProductAttribute
+	for _, key := range keys {
+		if values[key] == nil {
+			continue
+		}
+
+		value, err := attributeValue(byKey[key], values[key])
+		if err != nil {
+			return nil, err
+		}
+		attributes = append(attributes, value)
+	}
+
+	for _, a := range schema {
+		if a.Required && !slices.ContainsFunc(attributes, func(v domain.ProductAttribute) bool { return v.Key == a.Key }) {
+			return nil, fmt.Errorf("attribute %s is required", a.Key)
+		}
+	}
+
+	return attributes, nil
+}
+
+func attributeValue(a domain.CategoryAttribute, value any) (domain.ProductAttribute, error) {
+	attribute := domain.ProductAttribute{AttributeID: a.ID, Key: a.Key}
+
+	switch a.Type {
+	case domain.AttributeNumber:
+		number, ok := value.(float64)
+		if !ok || math.IsNaN(number) || math.IsInf(number, 0) {
+			return attribute, fmt.Errorf("attribute %s must be a number", a.Key)
+		}
+		attribute.NumberValue = &number
+	case domain.AttributeBoolean:
+		flag, ok := value.(bool)
+		if !ok {
+			return attribute, fmt.Errorf("attribute %s must be true or false", a.Key)
+		}
+		attribute.BoolValue = &flag
+	default:
+		text, ok := value.(string)
+		text = strings.TrimSpace(text)
+		switch {
+		case !ok || text == "":
+			return attribute, fmt.Errorf("attribute %s must be a text", a.Key)
+		case utf8.RuneCountInString(text) > attributeValueMaxLength:
+			return attribute, fmt.Errorf("attribute %s must be at most %d characters", a.Key, attributeValueMaxLength)
+		case a.Type == domain.AttributeEnum && !slices.Contains(a.Options, text):
+			return attribute, fmt.Errorf("attribute %s must be one of %s", a.Key, strings.Join(a.Options, ", "))
+		}
+		attribute.TextValue = &text
+	}
+
+	return attribute, nil
+}
+
+// attributeValues maps the stored values of a product by key.
+func attributeValues(attributes []domain.ProductAttribute) map[string]any {
+	values := map[string]any{}
+	for _, a := range attributes {
+		switch {
+		case a.NumberValue != nil:
+			values[a.Key] = *a.NumberValue
+		case a.BoolValue != nil:
+			values[a.Key] = *a.BoolValue
+		case a.TextValue != nil:
+			values[a.Key] = *a.TextValue
+		}
+	}
+	return values
+}
+
+// Product listing
+
+// productFilter checks the attribute parameters of the query against the
+// schema of the category and returns the filterable attributes for facets.
+func (s CatalogService) productFilter(query dto.ProductQuery) (dto.ProductFilter, []domain.CategoryAttribute, error) {
+	filter := dto.ProductFilter{Sort: query.Sort, CategoryID: query.CategoryID}
+
+	if query.CategoryID == 0 {
+		if len(query.Attributes) > 0 {
+			return filter, nil, errors.New("attribute filters need a category_id")
+		}
+		return filter, nil, nil
+	}
+
+	schema, err := s.Repo.FindCategoryAttributes(query.CategoryID)
+	if err != nil {
+		return filter, nil, errors.New("unable to find products")
+	}
+
+	byKey := map[string]domain.CategoryAttribute{}
+	var filterable []domain.CategoryAttribute
+	for _, a := range schema {
+		byKey[a.Key] = a
+		if a.Filterable {
+			filterable = append(filterable, a)
+		}
+	}
+
+	filters := map[string]*dto.AttributeFilter{}
+	params := make([]string, 0, len(query.Attributes))
+	for param := range query.Attributes {
+		params = append(params, param)
+	}
+	sort.Strings(params)
+
+	for _, param := range params {
+		raw := strings.TrimSpace(query.Attributes[param])
+		key, bound := param, ""
+		if i := strings.LastIndex(param, "."); i > 0 {
+			key, bound = param[:i], param[i+1:]
+		}
+
+		attribute, ok := byKey[key]
+		if !ok || !attribute.Filterable {
+			return filter, nil, fmt.Errorf("products cannot be filtered by %s", key)
+		}
+
+		f := filters[key]
+		if f == nil {
+			f = &dto.AttributeFilter{Key: key, Type: attribute.Type}
+			filters[key] = f
+		}
+
+		if bound != "" && (attribute.Type != domain.AttributeNumber || (bound != "min" && bound != "max")) {
+			return filter, nil, fmt.Errorf("%s is not a valid filter", param)
+		}
+
+		switch attribute.Type {
+		case domain.AttributeNumber:
+			number, err := strconv.ParseFloat(raw, 64)
+			if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+				return filter, nil, fmt.Errorf("%s must be a number", param)
+			}
+			if bound != "max" {
+				f.Min = &number
+			}
+			if bound != "min" {
+				f.Max = &number
+			}
+		case domain.AttributeBoolean:
+			flag, err := strconv.ParseBool(raw)
+			if err != nil {
+				return filter, nil, fmt.Errorf("%s must be true or false", param)
+			}
+			f.Bool = &flag
+		default:
+			for _, value := range strings.Split(raw, ",") {
+				if value = strings.TrimSpace(value); value != "" {
+					f.Values = append(f.Values, value)
+				}
+			}
+			if len(f.Values) == 0 {
+				return filter, nil, fmt.Errorf("%s needs a value", param)
+			}
+		}
+	}
+
+	for _, param := range params {
+		key := param
+		if i := strings.LastIndex(param, "."); i > 0 {
+			key = param[:i]
+		}
+		if f, ok := filters[key]; ok {
+			filter.Attributes = append(filter.Attributes, *f)
+			delete(filters, key)
+		}
+	}
+
+	return filter, filterable, nil
+}
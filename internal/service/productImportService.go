@@ -0,0 +1,519 @@
+package service
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-ecommerce-app/internal/domain"
+	"go-ecommerce-app/internal/dto"
+	"go-ecommerce-app/internal/repository"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ImportFormatCSV   = "csv"
+	ImportFormatJSONL = "jsonl"
+
+	importMaxRows = 10000
+	// larger files are processed in the background, poll the job for the result
+	importSyncRows = 200
+	// the job keeps the first errors only
+	importMaxErrors = 500
+	// running jobs save their progress every importSyncRows rows, one without
+	// progress for this long has stopped
+	importStaleAfter = 15 * time.Minute
+)
+
+var importColumns = []string{"sku", "name", "description", "category_id", "price", "stock", "image_url", "status"}
+
+var ErrImportJobNotFound = errors.New("import job not found")
+
+type ProductImportService struct {
+	Repo      repository.CatalogRepository
+	Jobs      repository.ImportRepository
+	Audit     AuditService
+	Alerts    *AlertService
+	Inventory InventoryService
+}
+
+type importRow struct {
+	line int
+	row  dto.ProductImportRow
+	err  error
+}
+
+// Import validates the file and upserts the products of the seller by sku.
+// The returned job is finished unless the file was too large to process
+// within the request.
+func (s ProductImportService) Import(user domain.User, format string, dryRun bool, file io.Reader, meta dto.RequestMeta) (*domain.ImportJob, error) {
+	var rows []importRow
+	var err error
+
+	switch format {
+	case ImportFormatCSV:
+		rows, err = parseImportCSV(file)
+	case ImportFormatJSONL:
+		rows, err = parseImportJSONL(file)
+	default:
+		return nil, errors.New("format must be csv or jsonl")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rows) == 0 {
+		return nil, errors.New("the file has no product rows")
+	}
+
+	job := &domain.ImportJob{
+		UserID:    user.ID,
+		Format:    format,
+		DryRun:    dryRun,
+		Status:    domain.ImportPending,
+		TotalRows: len(rows),
+	}
+
+	if err = s.Jobs.CreateImportJob(job); err != nil {
+		return nil, errors.New("unable to start import")
+	}
+
+	if dryRun || len(rows) <= importSyncRows {
+		s.run(job, rows, user, meta)
+		return job, nil
+	}
+
+	// the caller gets the pending state, the copy is updated in the background
+	background := *job
+	go s.run(&background, rows, user, meta)
+
+	return job, nil
+}
+
+func (s ProductImportService) GetJob(id, userID uint) (domain.ImportJob, error) {
+	job, err := s.Jobs.FindImportJob(id, userID)
+	if err != nil {
+		return domain.ImportJob{}, ErrImportJobNotFound
+	}
+
+	return job, nil
+}
+
+// FailStaleJobs fails the jobs whose import stopped, e.g. with a restart,
+// so they don't show as running forever.
+func (s ProductImportService) FailStaleJobs() (int64, error) {
+	return s.Jobs.FailStaleImportJobs(time.Now().Add(-importStaleAfter),
+		"the import was interrupted, please upload the file again")
+}
+
+func (s ProductImportService) run(job *domain.ImportJob, rows []importRow, user domain.User, meta dto.RequestMeta) {
+	now := time.Now()
+	job.Status = domain.ImportRunning
+	job.StartedAt = &now
+	s.saveJob(job)
+
+	categories := map[uint]bool{}
+	seen := map[string]int{}
+
+	for i, r := range rows {
+		err := r.err
+		if err == nil {
+			if line, ok := seen[r.row.Sku]; ok {
+				err = fmt.Errorf("sku is repeated, first seen on row %d", line)
+			} else {
+				seen[r.row.Sku] = r.line
+				err = s.importRow(r.row, user, job, categories, meta)
+			}
+		}
+
+		if err != nil {
+			job.Failed++
+			if len(job.Errors) < importMaxErrors {
+				job.Errors = append(job.Errors, domain.ImportRowError{Row: r.line, Sku: r.row.Sku, Message: err.Error()})
+			}
+		}
+
+		job.Processed++
+		// report progress of background imports
+		if (i+1)%importSyncRows == 0 {
+			s.saveJob(job)
+		}
+	}
+
+	finished := time.Now()
+	job.Status = domain.ImportCompleted
+	job.FinishedAt = &finished
+	s.saveJob(job)
+}
+
+func (s ProductImportService) saveJob(job *domain.ImportJob) {
+	if err := s.Jobs.UpdateImportJob(job); err != nil {
+		log.Printf("updating import job %d failed: %v", job.ID, err)
+	}
+}
+
+func (s ProductImportService) importRow(row dto.ProductImportRow, user domain.User, job *domain.ImportJob, categories map[uint]bool, meta dto.RequestMeta) error {
+	if err := validateImportRow(row); err != nil {
+		return err
+	}
+
+	if row.CategoryID != nil {
+		exists, ok := categories[*row.CategoryID]
+		if !ok {
+			_, err := s.Repo.FindCategoryByID(int(*row.CategoryID))
+			exists = err == nil
+			categories[*row.CategoryID] = exists
+		}
+		if !exists {
+			return fmt.Errorf("category %d does not exist", *row.CategoryID)
+		}
+	}
+
+	product, err := s.Repo.FindProductBySku(user.ID, row.Sku)
+	if err != nil {
+		return errors.New("unable to look up the product")
+	}
+
+	if product == nil {
+		if row.Name == nil || row.Price == nil || row.CategoryID == nil {
+			return errors.New("name, price and category_id are required for new products")
+		}
+
+		product = &domain.Product{UserID: user.ID, Sku: row.Sku}
+		applyImportRow(product, row)
+
+		// like created products, imported ones are drafts unless set
+		status := domain.ProductStatusDraft
+		if row.Status != nil {
+			status = *row.Status
+		}
+		if err = applyProductStatus(product, status, nil, nil, time.Now()); err != nil {
+			return err
+		}
+
+		// saved with the product
+		if product.Attributes, err = productAttributes(s.Repo, product.CategoryID, nil, row.Attributes); err != nil {
+			return err
+		}
+
+		if !job.DryRun {
+			if product.Slug, err = resourceSlug(s.Repo, domain.SlugProduct, "", product.Name, 0); err != nil {
+				return err
+			}
+
+			// the stock is booked in the inventory ledger
+			stock := product.Stock
+			product.Stock = 0
+
+			if err = s.Repo.CreateProduct(product); err != nil {
+				return errors.New("unable to create product")
+			}
+			if stock > 0 {
+				if err = s.Inventory.Receive(product.ID, int(stock), user.ID, "product import"); err != nil {
+					return errors.New("unable to book stock")
+				}
+				product.Stock = stock
+			}
+			s.Audit.Record(meta, domain.AuditProductCreate, "product", product.ID, nil, product)
+		}
+
+		job.Created++
+		return nil
+	}
+
+	before := *product
+	applyImportRow(product, row)
+
+	updateStatus := row.Status != nil && *row.Status != product.Status
+	if updateStatus {
+		if err = applyProductStatus(product, *row.Status, nil, nil, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	// the values are checked again when the category changes
+	var attributes []domain.ProductAttribute
+	updateAttributes := row.Attributes != nil || product.CategoryID != before.CategoryID
+	if updateAttributes {
+		if attributes, err = productAttributes(s.Repo, product.CategoryID, product.Attributes, row.Attributes); err != nil {
+			return err
+		}
+	}
+
+	if !job.DryRun {
+		if updateStatus {
+			if err = saveProductStatus(s.Repo, product, before.Status); err != nil {
+				return err
+			}
+		}
+
+		updated, err := s.Repo.EditProduct(product)
+		if err != nil {
+			return errors.New("unable to update product")
+		}
+		if updateAttributes {
+			if err = s.Repo.ReplaceProductAttributes(product.ID, attributes); err != nil {
+				return errors.New("unable to update product attributes")
+			}
+			updated.Attributes = attributes
+		}
+		if row.Stock != nil {
+			if _, err = s.Inventory.SetAvailable(product.ID, *row.Stock, user.ID, "product import"); err != nil {
+				return err
+			}
+		}
+		s.Audit.Record(meta, domain.AuditProductUpdate, "product", product.ID, before, updated)
+		s.Alerts.ProductChanged(before, *updated)
+	}
+
+	job.Updated++
+	return nil
+}
+
+func validateImportRow(row dto.ProductImportRow) error {
+	switch {
+	case row.Sku == "":
+		return errors.New("sku is required")
+	case len(row.Sku) > productSkuMaxLength:
+		return fmt.Errorf("sku must be at most %d characters", productSkuMaxLength)
+	case row.Name != nil && strings.TrimSpace(*row.Name) == "":
+		return errors.New("name must not be empty")
+	case row.Price != nil && *row.Price <= 0:
+		return errors.New("price must be greater than 0")
+	case row.Stock != nil && *row.Stock < 0:
+		return errors.New("stock must not be negative")
+	}
+
+	return nil
+}
+
+func applyImportRow(product *domain.Product, row dto.ProductImportRow) {
+	if row.Name != nil {
+		product.Name = strings.TrimSpace(*row.Name)
+	}
+	if row.Description != nil {
+		product.Description = *row.Description
+	}
+	if row.CategoryID != nil {
+		product.CategoryID = *row.CategoryID
+	}
+	if row.ImageUrl != nil {
+		product.ImageUrl = *row.ImageUrl
+	}
+	if row.Price != nil {
+		product.Price = *row.Price
+	}
+	if row.Stock != nil {
+		product.Stock = uint(*row.Stock)
+	}
+}
+
+// parseImportCSV reads a file with a header row, the sku column is required
+// and empty cells keep the current value.
+func parseImportCSV(file io.Reader) ([]importRow, error) {
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, errors.New("the file must start with a header row")
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		columns[name] = i
+	}
+
+	if _, ok := columns["sku"]; !ok {
+		return nil, errors.New("the header must contain a sku column")
+	}
+
+	var rows []importRow
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// quoted cells can span lines, report the line the record starts on
+		line, _ := r.FieldPos(0)
+
+		if len(rows) == importMaxRows {
+			return nil, fmt.Errorf("a file can contain at most %d products", importMaxRows)
+		}
+
+		cell := func(name string) (string, bool) {
+			i, ok := columns[name]
+			if !ok || i >= len(record) || strings.TrimSpace(record[i]) == "" {
+				return "", false
+			}
+			return csvUnsafe(strings.TrimSpace(record[i])), true
+		}
+
+		sku, _ := cell("sku")
+		row, err := csvImportRow(sku, cell)
+		rows = append(rows, importRow{line: line, row: row, err: err})
+	}
+
+	return rows, nil
+}
+
+// csvUnsafe drops the quote csvSafe puts before formula characters, so an
+// exported file imports the values unchanged.
+func csvUnsafe(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune("=+-@", rune(value[1])) {
+		return value[1:]
+	}
+	return value
+}
+
+func csvImportRow(sku string, cell func(string) (string, bool)) (dto.ProductImportRow, error) {
+	row := dto.ProductImportRow{Sku: sku}
+
+	if value, ok := cell("name"); ok {
+		row.Name = &value
+	}
+	if value, ok := cell("description"); ok {
+		row.Description = &value
+	}
+	if value, ok := cell("image_url"); ok {
+		row.ImageUrl = &value
+	}
+	if value, ok := cell("category_id"); ok {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return row, errors.New("category_id must be a number")
+		}
+		categoryID := uint(id)
+		row.CategoryID = &categoryID
+	}
+	if value, ok := cell("price"); ok {
+		price, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return row, errors.New("price must be a number")
+		}
+		row.Price = &price
+	}
+	if value, ok := cell("stock"); ok {
+		stock, err := strconv.Atoi(value)
+		if err != nil {
+			return row, errors.New("stock must be a whole number")
+		}
+		row.Stock = &stock
+	}
+	if value, ok := cell("status"); ok {
+		status := strings.ToLower(value)
+		row.Status = &status
+	}
+
+	return row, nil
+}
+
+// parseImportJSONL reads one json object per line, missing fields keep the
+// current value.
+func parseImportJSONL(file io.Reader) ([]importRow, error) {
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+
+	var rows []importRow
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		if len(rows) == importMaxRows {
+			return nil, fmt.Errorf("a file can contain at most %d products", importMaxRows)
+		}
+
+		row := dto.ProductImportRow{}
+		err := json.Unmarshal([]byte(text), &row)
+		if err != nil {
+			err = errors.New("the line is not a valid product object")
+		}
+		row.Sku = strings.TrimSpace(row.Sku)
+
+		rows = append(rows, importRow{line: line, row: row, err: err})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+// Export writes the catalog of the seller in the import format.
+func (s ProductImportService) Export(userID uint, format string, w io.Writer) error {
+	switch format {
+	case ImportFormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(importColumns); err != nil {
+			return err
+		}
+
+		err := s.Repo.FindSellerProductsInBatches(userID, func(products []domain.Product) error {
+			for _, p := range products {
+				err := cw.Write([]string{
+					csvSafe(p.Sku),
+					csvSafe(p.Name),
+					csvSafe(p.Description),
+					strconv.FormatUint(uint64(p.CategoryID), 10),
+					strconv.FormatFloat(p.Price, 'f', -1, 64),
+					strconv.FormatUint(uint64(p.Stock), 10),
+					p.ImageUrl,
+					p.Status,
+				})
+				if err != nil {
+					return err
+				}
+			}
+
+			cw.Flush()
+			return cw.Error()
+		})
+		if err != nil {
+			return err
+		}
+
+		cw.Flush()
+		return cw.Error()
+
+	case ImportFormatJSONL:
+		enc := json.NewEncoder(w)
+
+		return s.Repo.FindSellerProductsInBatches(userID, func(products []domain.Product) error {
+			for _, p := range products {
+				stock := int(p.Stock)
+				err := enc.Encode(dto.ProductImportRow{
+					Sku:         p.Sku,
+					Name:        &p.Name,
+					Description: &p.Description,
+					CategoryID:  &p.CategoryID,
+					ImageUrl:    &p.ImageUrl,
+					Price:       &p.Price,
+					Stock:       &stock,
+					Status:      &p.Status,
+					Attributes:  attributeValues(p.Attributes),
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+	default:
+		return errors.New("format must be csv or jsonl")
+	}
+}
@@ -0,0 +1,352 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-ecommerce-app/config"
+	"go-ecommerce-app/internal/domain"
+	"go-ecommerce-app/internal/dto"
+	"go-ecommerce-app/internal/helper"
+	"go-ecommerce-app/internal/policy"
+	"go-ecommerce-app/internal/repository"
+	"go-ecommerce-app/pkg/blobstore"
+	"log"
+	"mime/multipart"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	reviewTitleMaxLength    = 120
+	reviewBodyMaxLength     = 5000
+	reviewResponseMaxLength = 2000
+	reviewImageLimit        = 4
+	reviewImageMaxSize      = 5 << 20
+	reviewPageLimit         = 50
+)
+
+var reviewImageSizes = []imageSize{
+	{"thumbnail", 160},
+	{"medium", 800},
+}
+
+var (
+	ErrReviewNotFound   = errors.New("review not found")
+	ErrReviewNotAllowed = errors.New("only buyers with a delivered order of the product can review it")
+	ErrReviewState      = errors.New("review cannot be changed in its current state")
+)
+
+type ReviewService struct {
+	Repo    repository.ReviewRepository
+	Catalog repository.CatalogRepository
+	Auth    helper.Auth
+	Blobs   blobstore.BlobStore
+	Config  config.AppConfig
+	Audit   AuditService
+}
+
+// CreateReview stores the review for moderation, it is listed once approved.
+func (s ReviewService) CreateReview(productID uint, user domain.User, input dto.CreateReviewRequest) (*domain.Review, error) {
+	if _, err := s.Catalog.FindPublicProductByID(int(productID)); err != nil {
+		return nil, errors.New("product does not exist")
+	}
+
+	title := strings.TrimSpace(input.Title)
+	body := strings.TrimSpace(input.Body)
+
+	switch {
+	case input.Rating < 1 || input.Rating > 5:
+		return nil, errors.New("rating must be between 1 and 5")
+	case utf8.RuneCountInString(title) > reviewTitleMaxLength:
+		return nil, fmt.Errorf("title must be at most %d characters", reviewTitleMaxLength)
+	case utf8.RuneCountInString(body) > reviewBodyMaxLength:
+		return nil, fmt.Errorf("review must be at most %d characters", reviewBodyMaxLength)
+	}
+
+	item, err := s.Repo.FindDeliveredOrderItem(user.ID, productID)
+	if err != nil {
+		return nil, ErrReviewNotAllowed
+	}
+
+	if _, err = s.Repo.FindUserReview(productID, user.ID); err == nil {
+		return nil, errors.New("you have already reviewed this product")
+	}
+
+	review := &domain.Review{
+		ProductID:        productID,
+		UserID:           user.ID,
+		OrderItemID:      item.ID,
+		VerifiedPurchase: true,
+		Rating:           input.Rating,
+		Title:            title,
+		Body:             body,
+		Status:           domain.ReviewPending,
+	}
+
+	if err = s.Repo.CreateReview(review); err != nil {
+		return nil, errors.New("unable to save review")
+	}
+
+	return review, nil
+}
+
+// AddReviewImages attaches photos to the own review, the review goes back to
+// moderation.
+func (s ReviewService) AddReviewImages(id uint, user domain.User, files []*multipart.FileHeader) (*domain.Review, error) {
+	review, err := s.Repo.FindReview(id)
+	if err != nil || review.UserID != user.ID {
+		return nil, ErrReviewNotFound
+	}
+
+	if len(files) == 0 {
+		return nil, errors.New("please provide at least one image")
+	}
+
+	if len(review.Images)+len(files) > reviewImageLimit {
+		return nil, fmt.Errorf("a review can have at most %d images", reviewImageLimit)
+	}
+
+	images, keys := review.Images, review.ImageKeys
+	var added []string
+
+	for _, file := range files {
+		data, decoded, err := readImageUpload(file, reviewImageMaxSize)
+		if err != nil {
+			deleteBlobs(s.Blobs, added)
+			return nil, fmt.Errorf("%s: %w", file.Filename, err)
+		}
+
+		stored, urls, err := storeImage(s.Blobs, s.Config.AppBaseURL, fmt.Sprintf("reviews/%d", review.ID), data, decoded, reviewImageSizes)
+		if err != nil {
+			log.Printf("storing image of review %d failed: %v", review.ID, err)
+			deleteBlobs(s.Blobs, added)
+			return nil, errors.New("unable to store image")
+		}
+
+		added = append(added, stored...)
+		images = append(images, urls)
+	}
+
+	// map updates skip the json serializer of the columns
+	imagesJSON, err := json.Marshal(images)
+	if err != nil {
+		return nil, err
+	}
+	keysJSON, err := json.Marshal(append(keys, added...))
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.Repo.UpdateReview(review.ID, map[string]any{
+		"images":     string(imagesJSON),
+		"image_keys": string(keysJSON),
+		"status":     domain.ReviewPending,
+	})
+	if err != nil {
+		deleteBlobs(s.Blobs, added)
+		return nil, errors.New("unable to save review")
+	}
+
+	if review.Status == domain.ReviewApproved {
+		s.refreshRating(review.ProductID)
+	}
+
+	updated, err := s.Repo.FindReview(review.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+// GetProductReviews lists the approved reviews of a product.
+func (s ReviewService) GetProductReviews(productID uint, filter dto.ReviewFilter) ([]domain.Review, int64, error) {
+	filter.Status = domain.ReviewApproved
+	return s.Repo.FindReviews(productID, pageReviews(filter))
+}
+
+// DeleteReview removes the own review, moderators can remove any review.
+func (s ReviewService) DeleteReview(id uint, user domain.User) error {
+	review, err := s.Repo.FindReview(id)
+	if err != nil {
+		return ErrReviewNotFound
+	}
+
+	if review.UserID != user.ID && !policy.Can(user, policy.ReviewsModerate) {
+		return ErrReviewNotFound
+	}
+
+	if err = s.Repo.DeleteReview(review.ID); err != nil {
+		return errors.New("unable to delete review")
+	}
+
+	deleteBlobs(s.Blobs, review.ImageKeys)
+
+	if review.Status == domain.ReviewApproved {
+		s.refreshRating(review.ProductID)
+	}
+
+	return nil
+}
+
+// Vote marks an approved review of another user as helpful, or takes the vote back.
+func (s ReviewService) Vote(id uint, user domain.User, helpful bool) (*domain.Review, error) {
+	review, err := s.Repo.FindReview(id)
+	if err != nil || review.Status != domain.ReviewApproved {
+		return nil, ErrReviewNotFound
+	}
+
+	if review.UserID == user.ID {
+		return nil, errors.New("you cannot vote for your own review")
+	}
+
+	if helpful {
+		_, err = s.Repo.AddVote(review.ID, user.ID)
+	} else {
+		_, err = s.Repo.RemoveVote(review.ID, user.ID)
+	}
+	if err != nil {
+		return nil, errors.New("unable to save vote")
+	}
+
+	updated, err := s.Repo.FindReview(review.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+// Respond sets the public answer of the seller, an empty response removes it.
+// Only approved reviews are answered, pending and rejected ones aren't shown.
+func (s ReviewService) Respond(id uint, user domain.User, input dto.ReviewResponseRequest) (*domain.Review, error) {
+	review, err := s.Repo.FindReview(id)
+	if err != nil {
+		return nil, ErrReviewNotFound
+	}
+
+	product, err := s.Catalog.FindProductByID(int(review.ProductID))
+	if err != nil || !policy.CanManage(user, policy.CatalogProductManage, product.UserID) {
+		return nil, ErrReviewNotFound
+	}
+
+	if review.Status != domain.ReviewApproved {
+		return nil, ErrReviewState
+	}
+
+	response := strings.TrimSpace(input.Response)
+	if utf8.RuneCountInString(response) > reviewResponseMaxLength {
+		return nil, fmt.Errorf("response must be at most %d characters", reviewResponseMaxLength)
+	}
+
+	var respondedAt *time.Time
+	if response != "" {
+		now := time.Now()
+		respondedAt = &now
+	}
+
+	err = s.Repo.UpdateReview(review.ID, map[string]any{
+		"seller_response": response,
+		"responded_at":    respondedAt,
+	})
+	if err != nil {
+		return nil, errors.New("unable to save response")
+	}
+
+	updated, err := s.Repo.FindReview(review.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+// Moderation
+
+// GetModerationQueue lists the reviews waiting for moderation, oldest first
+// unless another status or order is asked for.
+func (s ReviewService) GetModerationQueue(filter dto.ReviewFilter) ([]domain.Review, int64, error) {
+	if filter.Status == "" {
+		filter.Status = domain.ReviewPending
+	}
+
+	if filter.Sort == "" {
+		filter.Sort = "oldest"
+	}
+
+	return s.Repo.FindReviews(0, pageReviews(filter))
+}
+
+func (s ReviewService) Approve(id uint, moderator domain.User, meta dto.RequestMeta) (*domain.Review, error) {
+	return s.moderate(id, moderator, domain.ReviewApproved, "", meta)
+}
+
+func (s ReviewService) Reject(id uint, moderator domain.User, input dto.RejectReviewRequest, meta dto.RequestMeta) (*domain.Review, error) {
+	reason := strings.TrimSpace(input.Reason)
+	if reason == "" {
+		return nil, errors.New("please provide a rejection reason")
+	}
+
+	return s.moderate(id, moderator, domain.ReviewRejected, reason, meta)
+}
+
+func (s ReviewService) moderate(id uint, moderator domain.User, status, reason string, meta dto.RequestMeta) (*domain.Review, error) {
+	review, err := s.Repo.FindReview(id)
+	if err != nil {
+		return nil, ErrReviewNotFound
+	}
+
+	// approved reviews can still be taken down, rejected ones approved on appeal
+	from := []string{domain.ReviewPending, domain.ReviewApproved, domain.ReviewRejected}
+
+	updated, err := s.Repo.UpdateReviewStatus(review.ID, from, map[string]any{
+		"status":           status,
+		"moderator_id":     moderator.ID,
+		"rejection_reason": reason,
+		"moderated_at":     time.Now(),
+	})
+	if err != nil {
+		return nil, errors.New("unable to moderate review")
+	}
+	if !updated {
+		return nil, ErrReviewState
+	}
+
+	if review.Status == domain.ReviewApproved || status == domain.ReviewApproved {
+		s.refreshRating(review.ProductID)
+	}
+
+	action := domain.AuditReviewApprove
+	if status == domain.ReviewRejected {
+		action = domain.AuditReviewReject
+	}
+	s.Audit.Record(meta, action, "review", review.ID,
+		map[string]any{"status": review.Status}, map[string]any{"status": status, "rejection_reason": reason})
+
+	result, err := s.Repo.FindReview(review.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (s ReviewService) refreshRating(productID uint) {
+	if err := s.Repo.RefreshProductRating(productID); err != nil {
+		log.Printf("refreshing rating of product %d failed: %v", productID, err)
+	}
+}
+
+func pageReviews(filter dto.ReviewFilter) dto.ReviewFilter {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+
+	if filter.Limit < 1 || filter.Limit > reviewPageLimit {
+		filter.Limit = reviewPageLimit
+	}
+
+	return filter
+}
@@ -0,0 +1,505 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go-ecommerce-app/config"
+	"go-ecommerce-app/internal/domain"
+	"go-ecommerce-app/internal/dto"
+	"go-ecommerce-app/internal/helper"
+	"go-ecommerce-app/internal/repository"
+	"go-ecommerce-app/pkg/address"
+	"go-ecommerce-app/pkg/banking"
+	"go-ecommerce-app/pkg/blobstore"
+	"go-ecommerce-app/pkg/fieldcrypt"
+	"go-ecommerce-app/pkg/notification"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	sellerDocumentMaxSize  = 8 << 20
+	sellerApplicationLimit = 50
+)
+
+// accepted document formats, detected from the content and not the file name
+var sellerDocumentTypes = map[string]string{
+	"application/pdf": ".pdf",
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+}
+
+var (
+	ErrApplicationNotFound = errors.New("seller application not found")
+	ErrApplicationState    = errors.New("seller application cannot be changed in its current state")
+)
+
+type SellerService struct {
+	Repo   repository.SellerRepository
+	Users  repository.UserRepository
+	Auth   helper.Auth
+	Config config.AppConfig
+	Audit  AuditService
+	Blobs  blobstore.BlobStore
+}
+
+// Apply submits an application, the user stays a buyer until an admin approves it.
+func (s SellerService) Apply(id uint, input dto.SellerApplicationInput, meta dto.RequestMeta) (*domain.SellerApplication, error) {
+	user, err := s.Users.FindUserByID(id)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	if user.UserType != domain.BUYER {
+		return nil, errors.New("you have already joined seller program")
+	}
+
+	if !user.Verified {
+		return nil, errors.New("please verify your phone number before applying")
+	}
+
+	latest, err := s.Repo.FindLatestApplication(id)
+	if err == nil && (latest.Status == domain.ApplicationSubmitted || latest.Status == domain.ApplicationUnderReview) {
+		return nil, repository.ErrPendingApplication
+	}
+
+	application, err := s.newApplication(id, input)
+	if err != nil {
+		return nil, err
+	}
+
+	inUse, err := s.Repo.AccountInUse(application.BankAccount.AccountIndex, id)
+	if err != nil {
+		return nil, errors.New("unable to submit seller application")
+	}
+	if inUse {
+		return nil, errors.New("payout account: the account is registered to another seller")
+	}
+
+	if err = s.Repo.CreateApplication(application); err != nil {
+		if errors.Is(err, repository.ErrPendingApplication) {
+			return nil, err
+		}
+		return nil, errors.New("unable to submit seller application")
+	}
+
+	s.Audit.Record(meta, domain.AuditSellerApply, "seller_application", application.ID, nil, application)
+	s.Audit.Record(meta, domain.AuditBankAccountCreate, "bank_account", application.BankAccount.ID, nil, application.BankAccount)
+
+	s.notify(user, "Seller application received", fmt.Sprintf(
+		"We received your application to sell on %s. Please upload the requested documents, "+
+			"we will let you know once the review starts.\n", s.Config.AppName))
+
+	return application, nil
+}
+
+func (s SellerService) newApplication(userID uint, input dto.SellerApplicationInput) (*domain.SellerApplication, error) {
+	application := &domain.SellerApplication{
+		UserID:             userID,
+		Status:             domain.ApplicationSubmitted,
+		FirstName:          strings.TrimSpace(input.FirstName),
+		LastName:           strings.TrimSpace(input.LastName),
+		BusinessType:       strings.ToLower(strings.TrimSpace(input.BusinessType)),
+		BusinessName:       strings.TrimSpace(input.BusinessName),
+		RegistrationNumber: strings.TrimSpace(input.RegistrationNumber),
+		TaxID:              fieldcrypt.Secret(strings.TrimSpace(input.TaxID)),
+		Website:            strings.TrimSpace(input.Website),
+		AddressInput2:      strings.TrimSpace(input.AddressInput2),
+	}
+
+	if application.FirstName == "" || application.LastName == "" {
+		return nil, errors.New("first name and last name are required")
+	}
+
+	switch application.BusinessType {
+	case domain.BusinessIndividual:
+	case domain.BusinessCompany:
+		if application.BusinessName == "" || application.RegistrationNumber == "" {
+			return nil, errors.New("business name and registration number are required for companies")
+		}
+	default:
+		return nil, errors.New("business type must be individual or company")
+	}
+
+	fields, err := address.Normalize(address.Fields{
+		Address1:    input.AddressInput1,
+		City:        input.City,
+		PostCode:    input.PostCode,
+		Subdivision: input.Subdivision,
+		Country:     input.Country,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	application.AddressInput1 = fields.Address1
+	application.City = fields.City
+	application.PostCode = fields.PostCode
+	application.Subdivision = fields.Subdivision
+	application.Country = fields.Country
+
+	account, err := payoutAccount(userID, input.PayoutAccount, application.Country)
+	if err != nil {
+		return nil, err
+	}
+
+	if account.AccountHolder == "" {
+		account.AccountHolder = application.FirstName + " " + application.LastName
+		if application.BusinessType == domain.BusinessCompany {
+			account.AccountHolder = application.BusinessName
+		}
+	}
+
+	application.BankAccount = account
+
+	return application, nil
+}
+
+// payoutAccount validates the account with the rules of its country, IBAN
+// countries need a valid IBAN, others an account number and a SWIFT code,
+// US accounts an ABA routing number instead.
+func payoutAccount(userID uint, input dto.PayoutAccountInput, fallbackCountry string) (domain.BankAccount, error) {
+	account := domain.BankAccount{
+		UserID:        userID,
+		AccountHolder: strings.TrimSpace(input.AccountHolder),
+		PaymentType:   strings.TrimSpace(input.PaymentType),
+	}
+
+	if account.PaymentType == "" {
+		account.PaymentType = "bank_transfer"
+	}
+
+	country := fallbackCountry
+	if input.Country != "" {
+		c, ok := address.Lookup(input.Country)
+		if !ok {
+			return account, errors.New("payout account: unknown country")
+		}
+		country = c.Code
+	}
+
+	if input.IBAN != "" {
+		iban, err := banking.NormalizeIBAN(input.IBAN)
+		if err != nil {
+			return account, fmt.Errorf("payout account: %w", err)
+		}
+		account.BankAccount = fieldcrypt.Secret(iban)
+		country = iban[:2]
+	} else {
+		if banking.UsesIBAN(country) {
+			return account, errors.New("payout account: an iban is required for accounts in " + country)
+		}
+
+		number, err := banking.NormalizeAccountNumber(input.AccountNumber)
+		if err != nil {
+			return account, fmt.Errorf("payout account: %w", err)
+		}
+		account.BankAccount = fieldcrypt.Secret(number)
+	}
+
+	account.Country = country
+	account.AccountIndex = fieldcrypt.BlindIndex(account.BankAccount.String())
+
+	if country == "US" && input.IBAN == "" {
+		routing, err := banking.ValidateRoutingNumber(input.RoutingNumber)
+		if err != nil {
+			return account, fmt.Errorf("payout account: %w", err)
+		}
+		account.RoutingNumber = fieldcrypt.Secret(routing)
+	}
+
+	if input.SwiftCode != "" || (input.IBAN == "" && country != "US") {
+		bic, err := banking.NormalizeBIC(input.SwiftCode, country)
+		if err != nil {
+			return account, fmt.Errorf("payout account: %w", err)
+		}
+		account.SwiftCode = fieldcrypt.Secret(bic)
+	}
+
+	return account, nil
+}
+
+func (s SellerService) GetApplication(id uint) (domain.SellerApplication, error) {
+	application, err := s.Repo.FindLatestApplication(id)
+	if err != nil {
+		return domain.SellerApplication{}, ErrApplicationNotFound
+	}
+
+	return application, nil
+}
+
+// UploadDocument stores a KYC document of the pending application.
+func (s SellerService) UploadDocument(id uint, docType string, file *multipart.FileHeader) (*domain.SellerDocument, error) {
+	if !slices.Contains(domain.SellerDocumentTypes, docType) {
+		return nil, fmt.Errorf("document type must be one of %s", strings.Join(domain.SellerDocumentTypes, ", "))
+	}
+
+	if file.Size > sellerDocumentMaxSize {
+		return nil, fmt.Errorf("document must be smaller than %d MB", sellerDocumentMaxSize>>20)
+	}
+
+	application, err := s.Repo.FindLatestApplication(id)
+	if err != nil {
+		return nil, ErrApplicationNotFound
+	}
+
+	if application.Status != domain.ApplicationSubmitted && application.Status != domain.ApplicationUnderReview {
+		return nil, ErrApplicationState
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(io.LimitReader(src, sellerDocumentMaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > sellerDocumentMaxSize {
+		return nil, fmt.Errorf("document must be smaller than %d MB", sellerDocumentMaxSize>>20)
+	}
+
+	contentType := http.DetectContentType(data)
+	ext, ok := sellerDocumentTypes[contentType]
+	if !ok {
+		return nil, errors.New("document must be a pdf, jpeg or png file")
+	}
+
+	name, err := helper.RandomString(24)
+	if err != nil {
+		return nil, err
+	}
+
+	key := fmt.Sprintf("seller-documents/%d/%s%s", application.ID, name, ext)
+	if err = s.Blobs.Put(context.Background(), key, data, contentType); err != nil {
+		log.Printf("storing document of application %d failed: %v", application.ID, err)
+		return nil, errors.New("unable to store document")
+	}
+
+	sum := sha256.Sum256(data)
+
+	document := &domain.SellerDocument{
+		ApplicationID: application.ID,
+		Type:          docType,
+		FileName:      filepath.Base(file.Filename),
+		ContentType:   contentType,
+		Size:          int64(len(data)),
+		Checksum:      hex.EncodeToString(sum[:]),
+		StoragePath:   key,
+	}
+
+	if err = s.Repo.CreateDocument(document); err != nil {
+		_ = s.Blobs.Delete(context.Background(), key)
+		return nil, errors.New("unable to store document")
+	}
+
+	return document, nil
+}
+
+// Review
+
+func (s SellerService) GetApplications(status string, page, limit int) ([]domain.SellerApplication, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+
+	if limit < 1 || limit > sellerApplicationLimit {
+		limit = sellerApplicationLimit
+	}
+
+	return s.Repo.FindApplications(status, page, limit)
+}
+
+func (s SellerService) GetApplicationByID(id uint) (domain.SellerApplication, error) {
+	application, err := s.Repo.FindApplicationByID(id)
+	if err != nil {
+		return domain.SellerApplication{}, ErrApplicationNotFound
+	}
+
+	return application, nil
+}
+
+func (s SellerService) GetDocument(applicationID, id uint) (domain.SellerDocument, io.ReadCloser, error) {
+	document, err := s.Repo.FindDocument(applicationID, id)
+	if err != nil {
+		return domain.SellerDocument{}, nil, errors.New("document not found")
+	}
+
+	if document.StoragePath == "" {
+		return domain.SellerDocument{}, nil, errors.New("document was deleted after the review")
+	}
+
+	// documents uploaded before the blob store kept the path below the uploads dir
+	key := strings.TrimPrefix(filepath.ToSlash(document.StoragePath), filepath.ToSlash(s.Config.UploadsDir)+"/")
+
+	reader, _, err := s.Blobs.Get(context.Background(), key)
+	if err != nil {
+		return domain.SellerDocument{}, nil, errors.New("document not found")
+	}
+
+	return document, reader, nil
+}
+
+func (s SellerService) StartReview(id uint, reviewer domain.User, meta dto.RequestMeta) (*domain.SellerApplication, error) {
+	application, err := s.GetApplicationByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := s.Repo.UpdateApplicationStatus(id, []string{domain.ApplicationSubmitted}, map[string]any{
+		"status":      domain.ApplicationUnderReview,
+		"reviewer_id": reviewer.ID,
+	})
+	if err != nil {
+		return nil, errors.New("unable to update seller application")
+	}
+
+	if !ok {
+		return nil, ErrApplicationState
+	}
+
+	s.Audit.Record(meta, domain.AuditSellerReview, "seller_application", id,
+		map[string]any{"status": application.Status}, map[string]any{"status": domain.ApplicationUnderReview})
+
+	s.notifyApplicant(application.UserID, "Seller application under review",
+		"Your seller application is now being reviewed. We will contact you once a decision is made.\n")
+
+	return s.reload(id)
+}
+
+// Approve requires the identity document, and the business registration for
+// companies, before the seller role is granted.
+func (s SellerService) Approve(id uint, reviewer domain.User, meta dto.RequestMeta) (*domain.SellerApplication, error) {
+	application, err := s.GetApplicationByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if application.Status != domain.ApplicationUnderReview {
+		return nil, ErrApplicationState
+	}
+
+	required := []string{domain.DocumentIdentity}
+	if application.BusinessType == domain.BusinessCompany {
+		required = append(required, domain.DocumentBusinessRegistration)
+	}
+
+	for _, docType := range required {
+		if !slices.ContainsFunc(application.Documents, func(d domain.SellerDocument) bool { return d.Type == docType }) {
+			return nil, fmt.Errorf("the %s document is missing", strings.ReplaceAll(docType, "_", " "))
+		}
+	}
+
+	ok, err := s.Repo.ApproveApplication(application, reviewer.ID)
+	if err != nil {
+		if errors.Is(err, repository.ErrApplicantNotBuyer) {
+			return nil, err
+		}
+		return nil, errors.New("unable to approve seller application")
+	}
+
+	if !ok {
+		return nil, ErrApplicationState
+	}
+
+	s.Audit.Record(meta, domain.AuditSellerApprove, "seller_application", id,
+		map[string]any{"status": application.Status, "user_type": domain.BUYER},
+		map[string]any{"status": domain.ApplicationApproved, "user_type": domain.SELLER})
+
+	s.notifyApplicant(application.UserID, "Seller application approved", fmt.Sprintf(
+		"Your seller application was approved, welcome to %s! Please sign in again to access the seller tools.\n",
+		s.Config.AppName))
+
+	s.releaseDocuments(id)
+
+	return s.reload(id)
+}
+
+func (s SellerService) Reject(id uint, input dto.RejectApplicationInput, reviewer domain.User, meta dto.RequestMeta) (*domain.SellerApplication, error) {
+	reason := strings.TrimSpace(input.Reason)
+	if reason == "" {
+		return nil, errors.New("please provide a reason for the rejection")
+	}
+
+	application, err := s.GetApplicationByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := s.Repo.UpdateApplicationStatus(id, []string{domain.ApplicationSubmitted, domain.ApplicationUnderReview}, map[string]any{
+		"status":           domain.ApplicationRejected,
+		"reviewer_id":      reviewer.ID,
+		"rejection_reason": reason,
+		"reviewed_at":      time.Now(),
+	})
+	if err != nil {
+		return nil, errors.New("unable to update seller application")
+	}
+
+	if !ok {
+		return nil, ErrApplicationState
+	}
+
+	s.Audit.Record(meta, domain.AuditSellerReject, "seller_application", id,
+		map[string]any{"status": application.Status},
+		map[string]any{"status": domain.ApplicationRejected, "rejection_reason": reason})
+
+	s.notifyApplicant(application.UserID, "Seller application rejected", fmt.Sprintf(
+		"Your seller application was not approved.\n\nReason: %s\n\nYou can submit a new application at any time.\n", reason))
+
+	s.releaseDocuments(id)
+
+	return s.reload(id)
+}
+
+// releaseDocuments deletes the KYC files of a decided application, they are
+// only kept for as long as the review needs them.
+func (s SellerService) releaseDocuments(id uint) {
+	keys, err := s.Repo.ReleaseDocumentFiles(id)
+	if err != nil {
+		log.Printf("releasing documents of application %d failed: %v", id, err)
+		return
+	}
+
+	deleteBlobs(s.Blobs, keys)
+}
+
+func (s SellerService) reload(id uint) (*domain.SellerApplication, error) {
+	application, err := s.GetApplicationByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &application, nil
+}
+
+func (s SellerService) notifyApplicant(userID uint, subject, body string) {
+	user, err := s.Users.FindUserByID(userID)
+	if err != nil {
+		log.Printf("seller notification for user %d failed: %v", userID, err)
+		return
+	}
+
+	s.notify(user, subject, body)
+}
+
+// notify mails the user, a failed notification does not undo the step.
+func (s SellerService) notify(user domain.User, subject, body string) {
+	notiClient := notification.NewNotificationClient(s.Config)
+
+	if err := notiClient.SendEmail(user.Email, subject, body); err != nil {
+		log.Printf("seller notification for user %d failed: %v", user.ID, err)
+	}
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"errors"
+	"go-ecommerce-app/internal/domain"
+	"go-ecommerce-app/internal/repository"
+	"go-ecommerce-app/pkg/slug"
+	"log"
+)
+
+// resourceSlug checks the requested slug, or makes a free one from the name
+// when none is requested.
+func resourceSlug(repo repository.CatalogRepository, resourceType, requested, name string, id uint) (string, error) {
+	if requested != "" {
+		value := slug.Make(requested)
+		if value == "" {
+			return "", errors.New("slug must contain letters or digits")
+		}
+
+		taken, err := repo.SlugTaken(resourceType, value, id)
+		if err != nil {
+			return "", errors.New("unable to check slug")
+		}
+		if taken {
+			return "", errors.New("slug is already used")
+		}
+
+		return value, nil
+	}
+
+	base := slug.Make(name)
+	if base == "" {
+		base = resourceType
+	}
+
+	value, err := slug.Unique(base, func(base, prefix string) (bool, int, error) {
+		return repo.SlugUsage(resourceType, base, prefix, id)
+	})
+	if err != nil {
+		return "", errors.New("unable to check slug")
+	}
+
+	return value, nil
+}
+
+// recordSlugChange keeps the former slug for redirects, the change itself is
+// already saved.
+func recordSlugChange(repo repository.CatalogRepository, resourceType string, id uint, from, to string) {
+	if from == to {
+		return
+	}
+
+	if err := repo.RecordSlugChange(resourceType, id, from, to); err != nil {
+		log.Printf("keeping former slug %s of %s %d failed: %v", from, resourceType, id, err)
+	}
+}
+
+func productCanonicalURL(baseURL string, p *domain.Product) string {
+	if p.Slug == "" {
+		return ""
+	}
+	return baseURL + "/products/by-slug/" + p.Slug
+}
+
+func categoryCanonicalURL(baseURL string, c *domain.Category) string {
+	if c.Slug == "" {
+		return ""
+	}
+	return baseURL + "/categories/by-slug/" + c.Slug
+}
+
+// withProductURLs sets the canonical url of the products for the response.
+func (s CatalogService) withProductURLs(products ...*domain.Product) {
+	for _, p := range products {
+		if p != nil {
+			p.CanonicalUrl = productCanonicalURL(s.Config.AppBaseURL, p)
+		}
+	}
+}
+
+func (s CatalogService) withCategoryURLs(categories ...*domain.Category) {
+	for _, c := range categories {
+		if c != nil {
+			c.CanonicalUrl = categoryCanonicalURL(s.Config.AppBaseURL, c)
+		}
+	}
+}
@@ -1,17 +1,31 @@
 package service
 
 import (
+	"errors"
 	"go-ecommerce-app/internal/domain"
 	"go-ecommerce-app/internal/dto"
 	"go-ecommerce-app/internal/helper"
+	"go-ecommerce-app/internal/policy"
 	"go-ecommerce-app/internal/repository"
+	"log"
+	"slices"
+	"time"
 
 	"github.com/stripe/stripe-go/v82"
 )
 
+var (
+	ErrOrderNotFound   = errors.New("order not found")
+	ErrOrderTransition = errors.New("order cannot move to this status")
+	ErrOrderNotOwned   = errors.New("the order has items of other sellers, please ask an admin")
+)
+
 type TransactionService struct {
-	Repo repository.TransactionRepository
-	Auth helper.Auth
+	Repo  repository.TransactionRepository
+	Auth  helper.Auth
+	Audit AuditService
+	// cancelled orders book their stock back
+	Inventory InventoryService
 }
 
 func NewTransactionService(repo repository.TransactionRepository, auth helper.Auth) *TransactionService {
@@ -55,3 +69,61 @@ func (s TransactionService) StoreCreatePayment(userID uint, ps *stripe.CheckoutS
 func (s TransactionService) GetActivePayment(userID uint) (*domain.Payment, error) {
 	return s.Repo.FindInitialPayment(userID)
 }
+
+// GetOrder returns any order with its items, for support and admins.
+func (s TransactionService) GetOrder(id uint) (domain.Order, error) {
+	order, err := s.Repo.FindOrder(id)
+	if err != nil {
+		return domain.Order{}, ErrOrderNotFound
+	}
+
+	return order, nil
+}
+
+// UpdateOrderStatus moves the order along the fulfilment flow, see
+// domain.OrderStatusTransitions. Sellers move orders whose items are all
+// theirs, an order shared with other sellers is moved by an admin.
+func (s TransactionService) UpdateOrderStatus(id uint, status string, user domain.User, meta dto.RequestMeta) (domain.Order, error) {
+	order, err := s.Repo.FindOrder(id)
+	if err != nil {
+		return domain.Order{}, ErrOrderNotFound
+	}
+
+	if len(order.Items) == 0 && !policy.Can(user, policy.OrdersManage) {
+		return domain.Order{}, ErrOrderNotOwned
+	}
+
+	for _, item := range order.Items {
+		if !policy.CanManage(user, policy.OrdersFulfil, item.SellerID) {
+			return domain.Order{}, ErrOrderNotOwned
+		}
+	}
+
+	if !slices.Contains(domain.OrderStatusTransitions[order.Status], status) {
+		return domain.Order{}, ErrOrderTransition
+	}
+
+	fields := map[string]any{"status": status}
+	if status == domain.OrderStatusDelivered {
+		fields["delivered_at"] = time.Now()
+	}
+
+	updated, err := s.Repo.UpdateOrderStatus(id, order.Status, fields)
+	if err != nil {
+		return domain.Order{}, errors.New("unable to update order status")
+	}
+	if !updated {
+		return domain.Order{}, ErrOrderTransition
+	}
+
+	if status == domain.OrderStatusCancelled {
+		if err = s.Inventory.ReverseSale(order.OrderRefNumber, meta.ActorID); err != nil {
+			log.Printf("returning stock of cancelled order %d failed: %v", id, err)
+		}
+	}
+
+	s.Audit.Record(meta, domain.AuditOrderStatus, "order", id,
+		map[string]any{"status": order.Status}, map[string]any{"status": status})
+
+	return s.Repo.FindOrder(id)
+}
@@ -8,16 +8,67 @@ import (
 	"go-ecommerce-app/internal/dto"
 	"go-ecommerce-app/internal/helper"
 	"go-ecommerce-app/internal/repository"
+	"go-ecommerce-app/pkg/address"
+	"go-ecommerce-app/pkg/fieldcrypt"
 	"go-ecommerce-app/pkg/notification"
 	"log"
+	"math"
+	"net/mail"
+	"slices"
+	"strings"
 	"time"
 )
 
+const (
+	otpExpiry          = 10 * time.Minute
+	otpMaxAttempts     = 5
+	otpResendCooldown  = time.Minute
+	otpDailyUserLimit  = 5 // per purpose, a phone change doesn't use up the email changes
+	otpDailyPhoneLimit = 10
+	emailChangeExpiry  = 24 * time.Hour
+)
+
+const (
+	loginWindow           = 15 * time.Minute
+	loginDelayThreshold   = 3
+	loginMaxDelay         = time.Minute
+	loginLockoutThreshold = 10
+	loginHistoryLimit     = 50
+
+	// compared against when the email is unknown so both paths cost the same
+	dummyPasswordHash = "$2a$10$Kz719SB2sJhqt4XIEmWeeekvxFK5KKk5dSybtj5f5fSFjoy4H4uvC"
+
+	recoveryCodeCount = 10
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrInvalidTwoFactor   = errors.New("invalid two-factor authentication code")
+	ErrOtpCooldown        = errors.New("please wait before requesting a new verification code")
+	ErrOtpDailyLimit      = errors.New("verification code limit reached, please try again later")
+	ErrOtpTooManyAttempts = errors.New("too many invalid attempts, please request a new verification code")
+	ErrEmailTaken         = errors.New("email already exists")
+	ErrShippingAddress    = errors.New("please provide a valid shipping address")
+	ErrBillingAddress     = errors.New("please provide a valid billing address")
+)
+
+// LoginThrottledError is returned while an email is locked out or in a progressive delay.
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e LoginThrottledError) Error() string {
+	return "too many failed login attempts, please try again later"
+}
+
 type UserService struct {
 	Repo   repository.UserRepository
 	CRepo  repository.CatalogRepository
 	Auth   helper.Auth
 	Config config.AppConfig
+	Audit  AuditService
+	// orders take their items off the stock
+	Inventory InventoryService
 }
 
 func (s UserService) Register(input dto.UserSignup) (string, error) {
@@ -27,21 +78,21 @@ func (s UserService) Register(input dto.UserSignup) (string, error) {
 	}
 
 	user, err := s.Repo.CreateUser(domain.User{
-		Email:    input.Email,
+		Email:    strings.ToLower(strings.TrimSpace(input.Email)),
 		Password: hashedPassword,
-		Phone:    input.Phone,
+		Phone:    fieldcrypt.Secret(strings.TrimSpace(input.Phone)),
 	})
 	if err != nil {
 		switch {
 		case err.Error() == `ERROR: duplicate key value violates unique constraint "uni_users_email" (SQLSTATE 23505)`:
-			return "", errors.New("email already exists")
+			return "", ErrEmailTaken
 		default:
 			return "", err
 		}
 	}
 
 	// generate token
-	return s.Auth.GenerateToken(user.ID, user.Email, user.UserType)
+	return s.issueToken(user, false)
 }
 
 func (s UserService) findUserByEmail(email string) (*domain.User, error) {
@@ -50,19 +101,149 @@ func (s UserService) findUserByEmail(email string) (*domain.User, error) {
 	return &user, err
 }
 
-func (s UserService) Login(email, password string) (string, error) {
+func (s UserService) Login(email, password string, meta dto.RequestMeta) (dto.LoginResult, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	if err := s.checkLoginThrottle(email, meta.IP); err != nil {
+		return dto.LoginResult{}, err
+	}
+
+	attempt := domain.LoginAttempt{
+		Email:     email,
+		IP:        meta.IP,
+		UserAgent: meta.UserAgent,
+	}
+
 	user, err := s.findUserByEmail(email)
 	if err != nil {
-		return "", errors.New("user not found")
+		_ = s.Auth.VerifyPassword(password, dummyPasswordHash)
+		s.recordLoginAttempt(attempt)
+		return dto.LoginResult{}, ErrInvalidCredentials
 	}
 
+	attempt.UserID = user.ID
+
 	// vertify password
 	if err = s.Auth.VerifyPassword(password, user.Password); err != nil {
-		return "", err
+		s.recordLoginAttempt(attempt)
+		return dto.LoginResult{}, ErrInvalidCredentials
 	}
 
+	return s.CompleteLogin(*user, meta)
+}
+
+// CompleteLogin is called once the first factor (password or external identity)
+// is verified. It returns a two-factor challenge when enabled, otherwise a token.
+func (s UserService) CompleteLogin(user domain.User, meta dto.RequestMeta) (dto.LoginResult, error) {
+	// second step required, the login is recorded once it completes
+	if user.TwoFactorEnabled {
+		challenge, err := s.Auth.GenerateChallengeToken(user.ID)
+		if err != nil {
+			return dto.LoginResult{}, err
+		}
+
+		return dto.LoginResult{TwoFactorRequired: true, ChallengeToken: challenge}, nil
+	}
+
+	s.recordLoginAttempt(domain.LoginAttempt{
+		UserID:    user.ID,
+		Email:     user.Email,
+		IP:        meta.IP,
+		UserAgent: meta.UserAgent,
+		Success:   true,
+	})
+
 	// generate token
-	return s.Auth.GenerateToken(user.ID, user.Email, user.UserType)
+	token, err := s.issueToken(user, false)
+	if err != nil {
+		return dto.LoginResult{}, err
+	}
+
+	return dto.LoginResult{Token: token}, nil
+}
+
+func (s UserService) LoginTwoFactor(input dto.TwoFactorLoginInput, meta dto.RequestMeta) (string, error) {
+	id, err := s.Auth.VerifyChallengeToken(input.ChallengeToken)
+	if err != nil {
+		return "", err
+	}
+
+	user, err := s.Repo.FindUserByID(id)
+	if err != nil || !user.TwoFactorEnabled {
+		return "", ErrInvalidCredentials
+	}
+
+	if err = s.checkLoginThrottle(user.Email, meta.IP); err != nil {
+		return "", err
+	}
+
+	attempt := domain.LoginAttempt{
+		UserID:    user.ID,
+		Email:     user.Email,
+		IP:        meta.IP,
+		UserAgent: meta.UserAgent,
+	}
+
+	if err = s.verifySecondFactor(user, input.Code, input.RecoveryCode); err != nil {
+		s.recordLoginAttempt(attempt)
+		return "", err
+	}
+
+	attempt.Success = true
+	s.recordLoginAttempt(attempt)
+
+	return s.issueToken(user, true)
+}
+
+// checkLoginThrottle counts consecutive failures of the email from the ip since
+// the last success within the login window: after loginDelayThreshold the wait
+// doubles per failure, after loginLockoutThreshold the email is locked for that
+// ip until the window passes. Failures from other addresses don't lock the owner out.
+func (s UserService) checkLoginThrottle(email, ip string) error {
+	attempts, err := s.Repo.FindRecentLoginAttempts(email, ip, time.Now().Add(-loginWindow))
+	if err != nil {
+		return err
+	}
+
+	failures := 0
+	for _, attempt := range attempts {
+		if attempt.Success {
+			break
+		}
+		failures++
+	}
+
+	if failures < loginDelayThreshold {
+		return nil
+	}
+
+	lastFailure := attempts[0].CreatedAt
+
+	if failures >= loginLockoutThreshold {
+		oldestFailure := attempts[failures-1].CreatedAt
+		return LoginThrottledError{RetryAfter: time.Until(oldestFailure.Add(loginWindow))}
+	}
+
+	delay := time.Duration(math.Pow(2, float64(failures-loginDelayThreshold))) * time.Second
+	if delay > loginMaxDelay {
+		delay = loginMaxDelay
+	}
+
+	if wait := time.Until(lastFailure.Add(delay)); wait > 0 {
+		return LoginThrottledError{RetryAfter: wait}
+	}
+
+	return nil
+}
+
+func (s UserService) recordLoginAttempt(attempt domain.LoginAttempt) {
+	if err := s.Repo.CreateLoginAttempt(attempt); err != nil {
+		log.Printf("error recording login attempt: %v", err)
+	}
+}
+
+func (s UserService) GetLoginHistory(id uint) ([]domain.LoginAttempt, error) {
+	return s.Repo.FindLoginHistory(id, loginHistoryLimit)
 }
 
 func (s UserService) isVerifiedUser(id uint) bool {
@@ -77,28 +258,66 @@ func (s UserService) GetVerificationCode(e domain.User) error {
 		return errors.New("user already verified")
 	}
 
-	code, err := s.Auth.GenerateCode()
+	user, err := s.Repo.FindUserByID(e.ID)
 	if err != nil {
 		return err
 	}
 
-	user := domain.User{
-		Expiry: time.Now().Add(30 * time.Minute),
-		Code:   code,
+	if user.Phone == "" {
+		return errors.New("phone number is required to send verification code")
 	}
 
-	// update user
-	if _, err = s.Repo.UpdateUser(e.ID, user); err != nil {
-		return errors.New("unable to update verification code")
+	return s.sendPhoneCode(user.ID, domain.PurposeVerifyPhone, user.Phone.String())
+}
+
+// sendPhoneCode texts a one-time code to phone, applying the resend cooldown and
+// the daily limits per user and purpose and per phone number.
+func (s UserService) sendPhoneCode(userID uint, purpose, phone string) error {
+	// check resend cooldown
+	latest, err := s.Repo.FindLatestVerificationCode(userID, purpose)
+	if err == nil && time.Since(latest.CreatedAt) < otpResendCooldown {
+		return ErrOtpCooldown
 	}
 
-	user, _ = s.Repo.FindUserByID(e.ID)
+	// check daily limits per user and purpose and per phone number
+	since := time.Now().Add(-24 * time.Hour)
+
+	userCount, err := s.Repo.CountVerificationCodesByUser(userID, purpose, since)
+	if err != nil {
+		return err
+	}
+
+	phoneCount, err := s.Repo.CountVerificationCodesByTarget(fieldcrypt.BlindIndex(phone), since)
+	if err != nil {
+		return err
+	}
+
+	if userCount >= otpDailyUserLimit || phoneCount >= otpDailyPhoneLimit {
+		return ErrOtpDailyLimit
+	}
+
+	code, err := s.Auth.GenerateCode()
+	if err != nil {
+		return err
+	}
+
+	err = s.Repo.CreateVerificationCode(domain.VerificationCode{
+		UserID:      userID,
+		Purpose:     purpose,
+		Target:      fieldcrypt.Secret(phone),
+		TargetIndex: fieldcrypt.BlindIndex(phone),
+		CodeHash:    s.Auth.HashCode(code),
+		ExpiresAt:   time.Now().Add(otpExpiry),
+	})
+	if err != nil {
+		return errors.New("unable to update verification code")
+	}
 
 	msg := fmt.Sprintf("Your verification code is %s", code)
 
 	notiClient := notification.NewNotificationClient(s.Config)
 	// send SMS
-	if err = notiClient.SendSMS(user.Phone, msg); err != nil {
+	if err = notiClient.SendSMS(phone, msg); err != nil {
 		return errors.New("error on sending sms")
 	}
 
@@ -110,19 +329,10 @@ func (s UserService) VerifyCode(id uint, code string) error {
 		return errors.New("user already verified")
 	}
 
-	user, err := s.Repo.FindUserByID(id)
-	if err != nil {
+	if _, err := s.checkPhoneCode(id, domain.PurposeVerifyPhone, code); err != nil {
 		return err
 	}
 
-	if user.Code != code {
-		return errors.New("verification code does not match")
-	}
-
-	if !time.Now().Before(user.Expiry) {
-		return errors.New("verification code expired")
-	}
-
 	updateUser := domain.User{
 		Verified: true,
 	}
@@ -134,44 +344,302 @@ func (s UserService) VerifyCode(id uint, code string) error {
 	return nil
 }
 
-func (s UserService) CreateProfile(id uint, input dto.ProfileInput) error {
-	// find user
+// checkPhoneCode validates the latest code of the purpose and marks it used.
+func (s UserService) checkPhoneCode(id uint, purpose, code string) (domain.VerificationCode, error) {
+	verification, err := s.Repo.FindLatestVerificationCode(id, purpose)
+	if err != nil || verification.UsedAt != nil {
+		return domain.VerificationCode{}, errors.New("verification code not found, please request a new one")
+	}
+
+	if !time.Now().Before(verification.ExpiresAt) {
+		return domain.VerificationCode{}, errors.New("verification code expired")
+	}
+
+	// count the attempt before comparing so concurrent guesses are limited too
+	attempts, err := s.Repo.IncrementVerificationAttempts(verification.ID)
+	if err != nil {
+		return domain.VerificationCode{}, errors.New("unable to verify user")
+	}
+
+	if attempts > otpMaxAttempts {
+		return domain.VerificationCode{}, ErrOtpTooManyAttempts
+	}
+
+	if !s.Auth.VerifyCode(code, verification.CodeHash) {
+		return domain.VerificationCode{}, errors.New("verification code does not match")
+	}
+
+	if err = s.Repo.MarkVerificationCodeUsed(verification.ID); err != nil {
+		return domain.VerificationCode{}, errors.New("unable to verify user")
+	}
+
+	return verification, nil
+}
+
+// Contact changes, the current value is kept until the new one is confirmed.
+func (s UserService) RequestPhoneChange(id uint, input dto.ChangePhoneInput) error {
+	phone := strings.TrimSpace(input.Phone)
+	if phone == "" {
+		return errors.New("please provide a phone number")
+	}
+
 	user, err := s.Repo.FindUserByID(id)
 	if err != nil {
-		return err
+		return errors.New("user not found")
 	}
 
-	if input.FirstName != "" {
-		user.FirstName = input.FirstName
+	if phone == user.Phone.String() && user.Verified {
+		return errors.New("phone number is already verified")
 	}
 
-	if input.LastName != "" {
-		user.LastName = input.LastName
+	return s.sendPhoneCode(user.ID, domain.PurposeChangePhone, phone)
+}
+
+// ConfirmPhoneChange switches to the number the code was sent to. The number has
+// just been proven, so the user is verified afterwards.
+func (s UserService) ConfirmPhoneChange(u domain.User, code string, meta dto.RequestMeta) (string, error) {
+	verification, err := s.checkPhoneCode(u.ID, domain.PurposeChangePhone, code)
+	if err != nil {
+		return "", err
 	}
 
-	// update user
-	_, err = s.Repo.UpdateUser(id, user)
+	user, err := s.Repo.FindUserByID(u.ID)
+	if err != nil {
+		return "", errors.New("user not found")
+	}
+
+	phone, err := fieldcrypt.Encrypt(verification.Target.String())
+	if err != nil {
+		return "", errors.New("unable to update phone number")
+	}
+
+	err = s.Repo.UpdateUserFields(u.ID, map[string]any{
+		"phone":    phone,
+		"verified": true,
+	})
+	if err != nil {
+		return "", errors.New("unable to update phone number")
+	}
+
+	s.Audit.Record(meta, domain.AuditPhoneChange, "user", u.ID,
+		map[string]any{"phone": user.Phone, "verified": user.Verified},
+		map[string]any{"phone": verification.Target, "verified": true})
+
+	return s.reissueToken(u.ID, u.SessionMFA)
+}
+
+// RequestEmailChange mails a confirmation link to the new address and a notice
+// to the current one.
+func (s UserService) RequestEmailChange(id uint, input dto.ChangeEmailInput) error {
+	email := strings.ToLower(strings.TrimSpace(input.Email))
+	if _, err := mail.ParseAddress(email); err != nil || strings.ContainsAny(email, "<> ") {
+		return errors.New("please provide a valid email address")
+	}
+
+	user, err := s.Repo.FindUserByID(id)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	if email == user.Email {
+		return errors.New("this is already your email address")
+	}
+
+	// accounts created through a login provider have no password
+	if user.Password != "" {
+		if err = s.Auth.VerifyPassword(input.Password, user.Password); err != nil {
+			return ErrInvalidCredentials
+		}
+	}
+
+	if _, err = s.Repo.FindUser(email); err == nil {
+		return ErrEmailTaken
+	}
+
+	latest, err := s.Repo.FindLatestVerificationCode(user.ID, domain.PurposeChangeEmail)
+	if err == nil && time.Since(latest.CreatedAt) < otpResendCooldown {
+		return ErrOtpCooldown
+	}
+
+	since := time.Now().Add(-24 * time.Hour)
+	count, err := s.Repo.CountVerificationCodesByUser(user.ID, domain.PurposeChangeEmail, since)
 	if err != nil {
 		return err
 	}
 
-	// create address
-	address := domain.Address{
-		AddressInput1: input.AddressInput.AddressInput1,
-		AddressInput2: input.AddressInput.AddressInput2,
-		City:          input.AddressInput.City,
-		PostCode:      input.AddressInput.PostCode,
-		Country:       input.AddressInput.Country,
-		UserID:        id,
+	if count >= otpDailyUserLimit {
+		return ErrOtpDailyLimit
 	}
 
-	if err = s.Repo.CreateProfile(address); err != nil {
+	token, err := helper.RandomString(40)
+	if err != nil {
 		return err
 	}
 
+	err = s.Repo.CreateVerificationCode(domain.VerificationCode{
+		UserID:      user.ID,
+		Purpose:     domain.PurposeChangeEmail,
+		Target:      fieldcrypt.Secret(email),
+		TargetIndex: fieldcrypt.BlindIndex(email),
+		CodeHash:    s.Auth.HashCode(token),
+		ExpiresAt:   time.Now().Add(emailChangeExpiry),
+	})
+	if err != nil {
+		return errors.New("unable to create confirmation link")
+	}
+
+	notiClient := notification.NewNotificationClient(s.Config)
+
+	link := fmt.Sprintf("%s/users/email/confirm?token=%s", s.Config.AppBaseURL, token)
+	body := fmt.Sprintf("Confirm your new email address for %s by opening the link below. The link expires in %d hours.\n\n%s\n",
+		s.Config.AppName, int(emailChangeExpiry.Hours()), link)
+
+	if err = notiClient.SendEmail(email, "Confirm your new email address", body); err != nil {
+		return errors.New("error on sending email")
+	}
+
+	notice := fmt.Sprintf("A change of the email address of your %s account to %s was requested. "+
+		"Your address stays unchanged until the new one is confirmed. If this was not you, change your password.\n",
+		s.Config.AppName, email)
+
+	// the change goes on if the notice fails, the old address keeps working
+	if err = notiClient.SendEmail(user.Email, "Email change requested", notice); err != nil {
+		log.Printf("email change notice for user %d failed: %v", user.ID, err)
+	}
+
+	return nil
+}
+
+// ConfirmEmailChange is posted from the page of the link, so it identifies the
+// request by the token alone. No session is returned, the link may have been
+// opened by anyone with access to the mailbox.
+func (s UserService) ConfirmEmailChange(token string, meta dto.RequestMeta) error {
+	if token == "" {
+		return errors.New("confirmation link is not valid")
+	}
+
+	verification, err := s.Repo.FindVerificationCodeByHash(domain.PurposeChangeEmail, s.Auth.HashCode(token))
+	if err != nil || verification.UsedAt != nil {
+		return errors.New("confirmation link is not valid")
+	}
+
+	if !time.Now().Before(verification.ExpiresAt) {
+		return errors.New("confirmation link expired")
+	}
+
+	// only the latest request of the user counts
+	latest, err := s.Repo.FindLatestVerificationCode(verification.UserID, domain.PurposeChangeEmail)
+	if err != nil || latest.ID != verification.ID {
+		return errors.New("confirmation link is not valid")
+	}
+
+	email := verification.Target.String()
+
+	if _, err = s.Repo.FindUser(email); err == nil {
+		return ErrEmailTaken
+	}
+
+	user, err := s.Repo.FindUserByID(verification.UserID)
+	if err != nil {
+		return errors.New("confirmation link is not valid")
+	}
+
+	if err = s.Repo.MarkVerificationCodeUsed(verification.ID); err != nil {
+		return errors.New("unable to update email address")
+	}
+
+	if err = s.Repo.UpdateUserFields(verification.UserID, map[string]any{"email": email}); err != nil {
+		return errors.New("unable to update email address")
+	}
+
+	// the link is opened without a session, the owner of the request is the actor
+	meta.ActorID = user.ID
+	meta.ActorRole = user.UserType
+	s.Audit.Record(meta, domain.AuditEmailChange, "user", user.ID,
+		map[string]any{"email": user.Email}, map[string]any{"email": email})
+
 	return nil
 }
 
+// assignableRoles can be given by an admin, sellers are approved through an application.
+var assignableRoles = []string{domain.BUYER, domain.ADMIN}
+
+// ChangeRole sets the role of another user, the change applies to their next token.
+func (s UserService) ChangeRole(id uint, role string, meta dto.RequestMeta) (domain.User, error) {
+	if !slices.Contains(assignableRoles, role) {
+		return domain.User{}, errors.New("role must be buyer or admin")
+	}
+
+	if id == meta.ActorID {
+		return domain.User{}, errors.New("you cannot change your own role")
+	}
+
+	user, err := s.Repo.FindUserByID(id)
+	if err != nil || user.AnonymizedAt != nil {
+		return domain.User{}, errors.New("user not found")
+	}
+
+	// tokens carry the role, the ones issued before the change stop working
+	fields := map[string]any{"user_type": role}
+	if role != user.UserType {
+		fields["tokens_revoked_at"] = time.Now()
+	}
+
+	if err = s.Repo.UpdateUserFields(id, fields); err != nil {
+		return domain.User{}, errors.New("unable to change role")
+	}
+
+	s.Audit.Record(meta, domain.AuditRoleChange, "user", id,
+		map[string]any{"user_type": user.UserType}, map[string]any{"user_type": role})
+
+	user.UserType = role
+	return user, nil
+}
+
+// reissueToken returns a token carrying the current email and role.
+func (s UserService) reissueToken(id uint, mfa bool) (string, error) {
+	user, err := s.Repo.FindUserByID(id)
+	if err != nil {
+		return "", err
+	}
+
+	return s.issueToken(user, mfa)
+}
+
+// issueToken signs an access token. A user the two-factor policy applies to,
+// who has not enrolled yet, gets TwoFactorGrace to do so from the first token.
+func (s UserService) issueToken(user domain.User, mfa bool) (string, error) {
+	if s.Auth.RequiresTwoFactor(user.UserType) && !user.TwoFactorEnabled && user.TwoFactorDueAt == nil {
+		due := time.Now().Add(s.Config.TwoFactorGrace)
+		if err := s.Repo.UpdateUserFields(user.ID, map[string]any{"two_factor_due_at": due}); err != nil {
+			return "", err
+		}
+		user.TwoFactorDueAt = &due
+	}
+
+	return s.Auth.GenerateToken(user, mfa)
+}
+
+func (s UserService) CreateProfile(id uint, input dto.ProfileInput) error {
+	// update user
+	_, err := s.Repo.UpdateUser(id, domain.User{
+		FirstName: input.FirstName,
+		LastName:  input.LastName,
+	})
+	if err != nil {
+		return err
+	}
+
+	if input.AddressInput.AddressInput1 == "" {
+		return nil
+	}
+
+	// create address
+	_, err = s.CreateAddress(id, input.AddressInput)
+
+	return err
+}
+
 func (s UserService) GetProfile(id uint) (*domain.User, error) {
 	user, err := s.Repo.FindUserByID(id)
 	if err != nil {
@@ -182,76 +650,446 @@ func (s UserService) GetProfile(id uint) (*domain.User, error) {
 }
 
 func (s UserService) UpdateProfile(id uint, input dto.ProfileInput) error {
-	// find user
-	user, err := s.Repo.FindUserByID(id)
+	// update user
+	_, err := s.Repo.UpdateUser(id, domain.User{
+		FirstName: input.FirstName,
+		LastName:  input.LastName,
+	})
 	if err != nil {
 		return err
 	}
 
-	if input.FirstName != "" {
-		user.FirstName = input.FirstName
+	if input.AddressInput.AddressInput1 == "" {
+		return nil
 	}
 
-	if input.LastName != "" {
-		user.LastName = input.LastName
+	// update the default shipping address, or create the first one
+	addresses, err := s.Repo.FindAddresses(id)
+	if err != nil {
+		return err
 	}
 
-	// update user
-	_, err = s.Repo.UpdateUser(id, user)
+	for _, address := range addresses {
+		if address.IsDefaultShipping {
+			_, err = s.UpdateAddress(id, address.ID, input.AddressInput)
+			return err
+		}
+	}
+
+	_, err = s.CreateAddress(id, input.AddressInput)
+
+	return err
+}
+
+// Address book
+func (s UserService) GetAddresses(id uint) ([]domain.Address, error) {
+	return s.Repo.FindAddresses(id)
+}
+
+func (s UserService) GetAddress(id, addressID uint) (domain.Address, error) {
+	address, err := s.Repo.FindAddress(addressID, id)
 	if err != nil {
-		return err
+		return domain.Address{}, errors.New("address not found")
+	}
+
+	return address, nil
+}
+
+func (s UserService) CreateAddress(id uint, input dto.AddressInput) (*domain.Address, error) {
+	if input.AddressInput1 == "" || input.City == "" || input.Country == "" {
+		return nil, errors.New("address, city and country are required")
 	}
 
-	address := domain.Address{
-		AddressInput1: input.AddressInput.AddressInput1,
-		AddressInput2: input.AddressInput.AddressInput2,
-		City:          input.AddressInput.City,
-		PostCode:      input.AddressInput.PostCode,
-		Country:       input.AddressInput.Country,
+	addresses, err := s.Repo.FindAddresses(id)
+	if err != nil {
+		return nil, err
+	}
+
+	address := &domain.Address{
+		Label:         input.Label,
+		AddressInput1: input.AddressInput1,
+		AddressInput2: input.AddressInput2,
+		City:          input.City,
+		PostCode:      input.PostCode,
+		Subdivision:   input.Subdivision,
+		Country:       input.Country,
+		Phone:         fieldcrypt.Secret(input.Phone),
 		UserID:        id,
 	}
 
-	// update profile
-	if err = s.Repo.UpdateProfile(address); err != nil {
+	if err = normalizeAddress(address); err != nil {
+		return nil, err
+	}
+
+	if err = s.Repo.CreateAddress(address); err != nil {
+		return nil, errors.New("unable to create address")
+	}
+
+	// the first address becomes the default for both
+	first := len(addresses) == 0
+	if err = s.setDefaultAddress(address, first || input.IsDefaultShipping, first || input.IsDefaultBilling); err != nil {
+		return nil, err
+	}
+
+	return address, nil
+}
+
+func (s UserService) UpdateAddress(id, addressID uint, input dto.AddressInput) (*domain.Address, error) {
+	address, err := s.Repo.FindAddress(addressID, id)
+	if err != nil {
+		return nil, errors.New("address not found")
+	}
+
+	if input.Label != "" {
+		address.Label = input.Label
+	}
+
+	if input.AddressInput1 != "" {
+		address.AddressInput1 = input.AddressInput1
+	}
+
+	if input.AddressInput2 != "" {
+		address.AddressInput2 = input.AddressInput2
+	}
+
+	if input.City != "" {
+		address.City = input.City
+	}
+
+	if input.PostCode != "" {
+		address.PostCode = input.PostCode
+	}
+
+	if input.Subdivision != "" {
+		address.Subdivision = input.Subdivision
+	}
+
+	if input.Country != "" {
+		address.Country = input.Country
+	}
+
+	if input.Phone != "" {
+		address.Phone = fieldcrypt.Secret(input.Phone)
+	}
+
+	if err = normalizeAddress(&address); err != nil {
+		return nil, err
+	}
+
+	if err = s.Repo.UpdateAddress(&address); err != nil {
+		return nil, errors.New("unable to update address")
+	}
+
+	if err = s.setDefaultAddress(&address, input.IsDefaultShipping, input.IsDefaultBilling); err != nil {
+		return nil, err
+	}
+
+	return &address, nil
+}
+
+func (s UserService) SetDefaultAddress(id, addressID uint, input dto.DefaultAddressInput) (*domain.Address, error) {
+	address, err := s.Repo.FindAddress(addressID, id)
+	if err != nil {
+		return nil, errors.New("address not found")
+	}
+
+	if err = s.setDefaultAddress(&address, input.Shipping, input.Billing); err != nil {
+		return nil, err
+	}
+
+	return &address, nil
+}
+
+func (s UserService) setDefaultAddress(address *domain.Address, shipping, billing bool) error {
+	if !shipping && !billing {
+		return nil
+	}
+
+	if err := s.Repo.SetDefaultAddress(address.ID, address.UserID, shipping, billing); err != nil {
+		return errors.New("unable to set default address")
+	}
+
+	address.IsDefaultShipping = address.IsDefaultShipping || shipping
+	address.IsDefaultBilling = address.IsDefaultBilling || billing
+
+	return nil
+}
+
+func (s UserService) DeleteAddress(id, addressID uint) error {
+	address, err := s.Repo.FindAddress(addressID, id)
+	if err != nil {
+		return errors.New("address not found")
+	}
+
+	if err = s.Repo.DeleteAddress(addressID, id); err != nil {
+		return errors.New("unable to delete address")
+	}
+
+	if !address.IsDefaultShipping && !address.IsDefaultBilling {
+		return nil
+	}
+
+	// hand the default flags over to the most recent remaining address
+	addresses, err := s.Repo.FindAddresses(id)
+	if err != nil || len(addresses) == 0 {
 		return err
 	}
 
+	return s.setDefaultAddress(&addresses[len(addresses)-1], address.IsDefaultShipping, address.IsDefaultBilling)
+}
+
+// orderAddresses resolves the requested or default addresses into order snapshots.
+func (s UserService) orderAddresses(u domain.User, input dto.CreateOrderRequest) (domain.OrderAddress, domain.OrderAddress, error) {
+	addresses, err := s.Repo.FindAddresses(u.ID)
+	if err != nil {
+		return domain.OrderAddress{}, domain.OrderAddress{}, err
+	}
+
+	var shipping, billing *domain.Address
+
+	for i := range addresses {
+		address := &addresses[i]
+
+		if address.ID == input.ShippingAddressID || (input.ShippingAddressID == 0 && address.IsDefaultShipping) {
+			shipping = address
+		}
+
+		if address.ID == input.BillingAddressID || (input.BillingAddressID == 0 && address.IsDefaultBilling) {
+			billing = address
+		}
+	}
+
+	if shipping == nil {
+		return domain.OrderAddress{}, domain.OrderAddress{}, ErrShippingAddress
+	}
+
+	// only an omitted billing address falls back to the shipping one
+	if billing == nil && input.BillingAddressID > 0 {
+		return domain.OrderAddress{}, domain.OrderAddress{}, ErrBillingAddress
+	}
+
+	if billing == nil {
+		billing = shipping
+	}
+
+	user, err := s.Repo.FindUserByID(u.ID)
+	if err != nil {
+		return domain.OrderAddress{}, domain.OrderAddress{}, err
+	}
+
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+
+	return snapshotAddress(name, *shipping), snapshotAddress(name, *billing), nil
+}
+
+func snapshotAddress(name string, address domain.Address) domain.OrderAddress {
+	return domain.OrderAddress{
+		Name:          name,
+		Phone:         address.Phone,
+		AddressInput1: address.AddressInput1,
+		AddressInput2: address.AddressInput2,
+		City:          address.City,
+		PostCode:      address.PostCode,
+		Subdivision:   address.Subdivision,
+		Country:       address.Country,
+	}
+}
+
+// normalizeAddress validates the address against the rules of its country and
+// stores the canonical country, subdivision and postal code.
+func normalizeAddress(a *domain.Address) error {
+	fields, err := address.Normalize(address.Fields{
+		Address1:    a.AddressInput1,
+		City:        a.City,
+		PostCode:    a.PostCode,
+		Subdivision: a.Subdivision,
+		Country:     a.Country,
+	})
+	if err != nil {
+		return err
+	}
+
+	a.AddressInput1 = fields.Address1
+	a.City = fields.City
+	a.PostCode = fields.PostCode
+	a.Subdivision = fields.Subdivision
+	a.Country = fields.Country
 	return nil
 }
 
-func (s UserService) BecomeSeller(id uint, input dto.SellerInput) (string, error) {
-	user, _ := s.Repo.FindUserByID(id)
+// Two-factor
+func (s UserService) SetupTwoFactor(id uint) (string, string, error) {
+	user, err := s.Repo.FindUserByID(id)
+	if err != nil {
+		return "", "", err
+	}
 
-	if user.UserType == domain.SELLER {
-		return "", errors.New("you have already joined seller program")
+	if user.TwoFactorEnabled {
+		return "", "", errors.New("two-factor authentication is already enabled")
 	}
 
-	// update user
-	seller, err := s.Repo.UpdateUser(id, domain.User{
-		FirstName: input.FirstName,
-		LastName:  input.LastName,
-		Phone:     input.Phone,
-		UserType:  domain.SELLER,
+	secret, err := helper.GenerateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	sealed, err := fieldcrypt.Encrypt(secret)
+	if err != nil {
+		return "", "", errors.New("unable to setup two-factor authentication")
+	}
+
+	// stored as pending until the first code is confirmed
+	if err = s.Repo.UpdateUserFields(id, map[string]any{"two_factor_secret": sealed}); err != nil {
+		return "", "", errors.New("unable to setup two-factor authentication")
+	}
+
+	return secret, helper.TOTPProvisioningURI(s.Config.AppName, user.Email, secret), nil
+}
+
+func (s UserService) EnableTwoFactor(id uint, code string, meta dto.RequestMeta) (string, []string, error) {
+	user, err := s.Repo.FindUserByID(id)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if user.TwoFactorEnabled {
+		return "", nil, errors.New("two-factor authentication is already enabled")
+	}
+
+	if user.TwoFactorSecret == "" {
+		return "", nil, errors.New("please setup two-factor authentication first")
+	}
+
+	step, ok := helper.ValidateTOTP(user.TwoFactorSecret.String(), code, time.Now())
+	if !ok {
+		return "", nil, ErrInvalidTwoFactor
+	}
+
+	err = s.Repo.UpdateUserFields(id, map[string]any{
+		"two_factor_enabled":   true,
+		"two_factor_last_step": step,
 	})
 	if err != nil {
-		return "", err
+		return "", nil, errors.New("unable to enable two-factor authentication")
 	}
 
-	// generate token
-	token, err := s.Auth.GenerateToken(user.ID, user.Email, seller.UserType)
+	s.Audit.Record(meta, domain.AuditTwoFactorEnable, "user", id,
+		map[string]any{"two_factor_enabled": false}, map[string]any{"two_factor_enabled": true})
+
+	codes, err := s.createRecoveryCodes(id)
 	if err != nil {
-		return "", err
+		return "", nil, err
+	}
+
+	// re-issue token so the current session satisfies the two-factor policy
+	token, err := s.issueToken(user, true)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return token, codes, nil
+}
+
+func (s UserService) DisableTwoFactor(id uint, input dto.TwoFactorLoginInput, meta dto.RequestMeta) error {
+	user, err := s.Repo.FindUserByID(id)
+	if err != nil {
+		return err
 	}
 
-	// create bank account information
-	err = s.Repo.CreateBankAccount(domain.BankAccount{
-		BankAccount: input.BankAccountNumber,
-		SwiftCode:   input.SwiftCode,
-		PaymentType: input.PaymentType,
-		UserID:      id,
+	if !user.TwoFactorEnabled {
+		return errors.New("two-factor authentication is not enabled")
+	}
+
+	if s.Auth.RequiresTwoFactor(user.UserType) {
+		return errors.New("two-factor authentication is required for your account")
+	}
+
+	if err = s.verifySecondFactor(user, input.Code, input.RecoveryCode); err != nil {
+		return err
+	}
+
+	err = s.Repo.UpdateUserFields(id, map[string]any{
+		"two_factor_enabled":   false,
+		"two_factor_secret":    "",
+		"two_factor_last_step": 0,
 	})
+	if err != nil {
+		return errors.New("unable to disable two-factor authentication")
+	}
+
+	s.Audit.Record(meta, domain.AuditTwoFactorDisable, "user", id,
+		map[string]any{"two_factor_enabled": true}, map[string]any{"two_factor_enabled": false})
+
+	return s.Repo.DeleteRecoveryCodes(id)
+}
+
+func (s UserService) RegenerateRecoveryCodes(id uint, code string) ([]string, error) {
+	user, err := s.Repo.FindUserByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.TwoFactorEnabled {
+		return nil, errors.New("two-factor authentication is not enabled")
+	}
 
-	return token, err
+	if err = s.verifySecondFactor(user, code, ""); err != nil {
+		return nil, err
+	}
+
+	return s.createRecoveryCodes(id)
+}
+
+func (s UserService) createRecoveryCodes(id uint) ([]string, error) {
+	codes, err := helper.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]domain.RecoveryCode, len(codes))
+	for i, code := range codes {
+		records[i] = domain.RecoveryCode{
+			UserID:   id,
+			CodeHash: s.Auth.HashCode(code),
+		}
+	}
+
+	if err = s.Repo.ReplaceRecoveryCodes(id, records); err != nil {
+		return nil, errors.New("unable to create recovery codes")
+	}
+
+	return codes, nil
+}
+
+// verifySecondFactor accepts either a TOTP code, which must not reuse an already
+// accepted time step, or a single-use recovery code.
+func (s UserService) verifySecondFactor(user domain.User, code, recoveryCode string) error {
+	if recoveryCode != "" {
+		codes, err := s.Repo.FindUnusedRecoveryCodes(user.ID)
+		if err != nil {
+			return err
+		}
+
+		recoveryCode = strings.ToLower(strings.TrimSpace(recoveryCode))
+
+		for _, c := range codes {
+			if s.Auth.VerifyCode(recoveryCode, c.CodeHash) {
+				if ok, err := s.Repo.MarkRecoveryCodeUsed(c.ID); err != nil || !ok {
+					return ErrInvalidTwoFactor
+				}
+				return nil
+			}
+		}
+
+		return ErrInvalidTwoFactor
+	}
+
+	step, ok := helper.ValidateTOTP(user.TwoFactorSecret.String(), code, time.Now())
+	if !ok || step <= user.TwoFactorLastStep {
+		return ErrInvalidTwoFactor
+	}
+
+	return s.Repo.UpdateUserFields(user.ID, map[string]any{"two_factor_last_step": step})
 }
 
 func (s UserService) FindCart(id uint) ([]domain.Cart, float64, error) {
@@ -283,6 +1121,16 @@ func (s UserService) CreateCart(input dto.CreateCartRequest, u domain.User) ([]d
 				log.Printf("error deleting cart item: %v", err)
 				return nil, errors.New("error deleting cart item")
 			}
+		} else if cart.SavedForLater {
+			// adding a saved item moves it back to the cart at the current price
+			product, err := s.CRepo.FindPublicProductByID(int(cart.ProductID))
+			if err != nil {
+				return nil, errors.New("product is no longer available")
+			}
+			if err = s.Repo.SetCartSaved(cart.ID, false, input.Qty, product.Price); err != nil {
+				log.Printf("error moving saved item to cart: %v", err)
+				return nil, errors.New("error updating cart items")
+			}
 		} else {
 			// update cart item
 			cart.Qty = input.Qty
@@ -294,13 +1142,13 @@ func (s UserService) CreateCart(input dto.CreateCartRequest, u domain.User) ([]d
 
 	} else {
 		// check if product exist
-		product, _ := s.CRepo.FindProductByID(int(input.ProductID))
-		if product.ID < 1 {
+		product, err := s.CRepo.FindPublicProductByID(int(input.ProductID))
+		if err != nil || product.ID < 1 {
 			return nil, errors.New("product not found to create cart items")
 		}
 
 		// create cart
-		err := s.Repo.CreateCart(domain.Cart{
+		err = s.Repo.CreateCart(domain.Cart{
 			UserID:    u.ID,
 			ProductID: input.ProductID,
 			Name:      product.Name,
@@ -318,7 +1166,81 @@ func (s UserService) CreateCart(input dto.CreateCartRequest, u domain.User) ([]d
 	return s.Repo.FindCartItems(u.ID)
 }
 
-func (s UserService) CreateOrder(u domain.User) (string, error) {
+// SaveForLater takes the item out of the checkout, it keeps the quantity and
+// the price it was added at.
+func (s UserService) SaveForLater(u domain.User, id uint) ([]domain.Cart, error) {
+	cart, err := s.Repo.FindCartItemByID(u.ID, id)
+	if err != nil || cart.SavedForLater {
+		return nil, errors.New("cart item not found")
+	}
+
+	if err = s.Repo.SetCartSaved(cart.ID, true, cart.Qty, cart.Price); err != nil {
+		return nil, errors.New("error saving item for later")
+	}
+
+	return s.Repo.FindCartItems(u.ID)
+}
+
+func (s UserService) MoveSavedToCart(u domain.User, id uint) ([]domain.Cart, error) {
+	cart, err := s.Repo.FindCartItemByID(u.ID, id)
+	if err != nil || !cart.SavedForLater {
+		return nil, errors.New("saved item not found")
+	}
+
+	product, err := s.CRepo.FindPublicProductByID(int(cart.ProductID))
+	if err != nil {
+		return nil, errors.New("product is no longer available")
+	}
+
+	qty := max(cart.Qty, 1)
+	if product.Stock < qty {
+		return nil, fmt.Errorf("%w, %d left", ErrOutOfStock, product.Stock)
+	}
+
+	// the item goes back at the current price, checkout charges the cart price
+	if err = s.Repo.SetCartSaved(cart.ID, false, qty, product.Price); err != nil {
+		return nil, errors.New("error moving item to cart")
+	}
+
+	return s.Repo.FindCartItems(u.ID)
+}
+
+// GetSavedItems lists the saved for later items with the price change since
+// they were added.
+func (s UserService) GetSavedItems(u domain.User) ([]dto.SavedItemDetails, error) {
+	items, err := s.Repo.FindSavedItems(u.ID)
+	if err != nil {
+		return nil, errors.New("error finding saved items")
+	}
+
+	productIDs := make([]uint, 0, len(items))
+	for _, item := range items {
+		productIDs = append(productIDs, item.ProductID)
+	}
+
+	prices, err := s.CRepo.FindProductPrices(productIDs)
+	if err != nil {
+		return nil, errors.New("error finding saved items")
+	}
+
+	details := make([]dto.SavedItemDetails, 0, len(items))
+	for _, item := range items {
+		current, ok := prices[item.ProductID]
+		details = append(details, dto.SavedItemDetails{
+			Cart:      item,
+			PriceDrop: priceDrop(item.Price, current, ok),
+		})
+	}
+
+	return details, nil
+}
+
+func (s UserService) CreateOrder(u domain.User, input dto.CreateOrderRequest) (string, error) {
+	shippingAddress, billingAddress, err := s.orderAddresses(u, input)
+	if err != nil {
+		return "", err
+	}
+
 	// find user cart cartItems
 	cartItems, err := s.Repo.FindCartItems(u.ID)
 	if err != nil {
@@ -350,16 +1272,28 @@ func (s UserService) CreateOrder(u domain.User) (string, error) {
 		})
 	}
 
+	// the stock reserved at checkout is sold, the rest must still be available
+	orderItems, err = s.Inventory.CommitSale(u.ID, orderRef, shippingAddress, orderItems)
+	if err != nil {
+		return "", err
+	}
+
 	order := domain.Order{
-		UserID:         u.ID,
-		PaymentID:      paymentID,
-		TransactionID:  txnID,
-		OrderRefNumber: orderRef,
-		Amount:         amount,
-		Items:          orderItems,
+		UserID:          u.ID,
+		Status:          domain.OrderStatusPending,
+		PaymentID:       paymentID,
+		TransactionID:   txnID,
+		OrderRefNumber:  orderRef,
+		Amount:          amount,
+		ShippingAddress: shippingAddress,
+		BillingAddress:  billingAddress,
+		Items:           orderItems,
 	}
 
 	if err = s.Repo.CreateOrder(order); err != nil {
+		if rerr := s.Inventory.ReverseSale(orderRef, u.ID); rerr != nil {
+			log.Printf("returning stock of failed order %s failed: %v", orderRef, rerr)
+		}
 		return "", err
 	}
 
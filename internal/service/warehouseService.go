@@ -0,0 +1,134 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"go-ecommerce-app/internal/domain"
+	"go-ecommerce-app/internal/dto"
+	"go-ecommerce-app/internal/helper"
+	"go-ecommerce-app/internal/repository"
+	"go-ecommerce-app/pkg/address"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	warehouseLimit         = 50
+	warehouseNameMaxLength = 100
+)
+
+var ErrWarehouseNotFound = errors.New("warehouse not found")
+
+type WarehouseService struct {
+	Repo repository.WarehouseRepository
+	Auth helper.Auth
+}
+
+func (s WarehouseService) GetWarehouses(user domain.User) ([]domain.Warehouse, error) {
+	warehouses, err := s.Repo.FindWarehouses(user.ID)
+	if err != nil {
+		return nil, errors.New("unable to find warehouses")
+	}
+
+	return warehouses, nil
+}
+
+func (s WarehouseService) CreateWarehouse(user domain.User, input dto.WarehouseInput) (domain.Warehouse, error) {
+	warehouses, err := s.Repo.FindWarehouses(user.ID)
+	if err != nil {
+		return domain.Warehouse{}, errors.New("unable to create warehouse")
+	}
+	if len(warehouses) >= warehouseLimit {
+		return domain.Warehouse{}, fmt.Errorf("you can have at most %d warehouses", warehouseLimit)
+	}
+
+	warehouse := domain.Warehouse{UserID: user.ID, Active: true}
+	if err = applyWarehouseInput(&warehouse, input); err != nil {
+		return domain.Warehouse{}, err
+	}
+
+	if err = s.Repo.CreateWarehouse(&warehouse); err != nil {
+		return domain.Warehouse{}, errors.New("unable to create warehouse")
+	}
+
+	return warehouse, nil
+}
+
+func (s WarehouseService) UpdateWarehouse(id uint, user domain.User, input dto.WarehouseInput) (domain.Warehouse, error) {
+	warehouse, err := s.Repo.FindWarehouse(id, user.ID)
+	if err != nil {
+		return domain.Warehouse{}, ErrWarehouseNotFound
+	}
+
+	if err = applyWarehouseInput(&warehouse, input); err != nil {
+		return domain.Warehouse{}, err
+	}
+
+	if err = s.Repo.UpdateWarehouse(&warehouse); err != nil {
+		return domain.Warehouse{}, errors.New("unable to update warehouse")
+	}
+
+	return warehouse, nil
+}
+
+// DeleteWarehouse removes an empty warehouse, the stock must be moved or
+// written off first so the ledger stays complete.
+func (s WarehouseService) DeleteWarehouse(id uint, user domain.User) error {
+	warehouse, err := s.Repo.FindWarehouse(id, user.ID)
+	if err != nil {
+		return ErrWarehouseNotFound
+	}
+
+	holdsStock, err := s.Repo.WarehouseHoldsStock(warehouse.ID)
+	if err != nil {
+		return errors.New("unable to delete warehouse")
+	}
+	if holdsStock {
+		return errors.New("warehouse still holds stock, deactivate it or move the stock first")
+	}
+
+	if err = s.Repo.DeleteWarehouse(warehouse.ID); err != nil {
+		return errors.New("unable to delete warehouse")
+	}
+
+	return nil
+}
+
+func applyWarehouseInput(w *domain.Warehouse, input dto.WarehouseInput) error {
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return errors.New("warehouse name is required")
+	}
+	if utf8.RuneCountInString(name) > warehouseNameMaxLength {
+		return fmt.Errorf("warehouse name must be at most %d characters", warehouseNameMaxLength)
+	}
+
+	// the allocator compares the fields with the shipping address
+	fields, err := address.Normalize(address.Fields{
+		Address1:    input.AddressInput1,
+		City:        input.City,
+		PostCode:    input.PostCode,
+		Subdivision: input.Subdivision,
+		Country:     input.Country,
+	})
+	if err != nil {
+		return err
+	}
+
+	w.Name = name
+	w.AddressInput1 = fields.Address1
+	w.AddressInput2 = strings.TrimSpace(input.AddressInput2)
+	w.City = fields.City
+	w.PostCode = fields.PostCode
+	w.Subdivision = fields.Subdivision
+	w.Country = fields.Country
+
+	if input.Priority != nil {
+		w.Priority = *input.Priority
+	}
+	if input.Active != nil {
+		w.Active = *input.Active
+	}
+
+	return nil
+}
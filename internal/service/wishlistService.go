@@ -0,0 +1,362 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"go-ecommerce-app/config"
+	"go-ecommerce-app/internal/domain"
+	"go-ecommerce-app/internal/dto"
+	"go-ecommerce-app/internal/helper"
+	"go-ecommerce-app/internal/repository"
+	"log"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	wishlistLimit         = 20
+	wishlistItemLimit     = 200
+	wishlistNameMaxLength = 100
+	wishlistTokenLength   = 32
+)
+
+var ErrWishlistNotFound = errors.New("wishlist not found")
+
+type WishlistService struct {
+	Repo    repository.WishlistRepository
+	Users   repository.UserRepository
+	Catalog repository.CatalogRepository
+	Auth    helper.Auth
+	Config  config.AppConfig
+}
+
+func (s WishlistService) GetWishlists(user domain.User) ([]dto.WishlistDetails, error) {
+	wishlists, err := s.Repo.FindWishlists(user.ID)
+	if err != nil {
+		return nil, errors.New("unable to find wishlists")
+	}
+
+	var productIDs []uint
+	for _, w := range wishlists {
+		for _, item := range w.Items {
+			productIDs = append(productIDs, item.ProductID)
+		}
+	}
+
+	prices, err := s.Catalog.FindProductPrices(productIDs)
+	if err != nil {
+		return nil, errors.New("unable to find wishlists")
+	}
+
+	details := make([]dto.WishlistDetails, 0, len(wishlists))
+	for _, w := range wishlists {
+		details = append(details, s.wishlistDetails(w, prices))
+	}
+
+	return details, nil
+}
+
+func (s WishlistService) GetWishlist(id uint, user domain.User) (*dto.WishlistDetails, error) {
+	wishlist, err := s.Repo.FindWishlist(id, user.ID)
+	if err != nil {
+		return nil, ErrWishlistNotFound
+	}
+
+	return s.details(wishlist)
+}
+
+// GetSharedWishlist opens a public wishlist by its share token without the owner.
+func (s WishlistService) GetSharedWishlist(token string) (*dto.WishlistDetails, error) {
+	if token == "" {
+		return nil, ErrWishlistNotFound
+	}
+
+	wishlist, err := s.Repo.FindPublicWishlist(token)
+	if err != nil {
+		return nil, ErrWishlistNotFound
+	}
+
+	details, err := s.details(wishlist)
+	if err != nil {
+		return nil, err
+	}
+
+	details.UserID = 0
+	details.ShareUrl = ""
+
+	return details, nil
+}
+
+func (s WishlistService) CreateWishlist(user domain.User, input dto.CreateWishlistRequest) (*dto.WishlistDetails, error) {
+	name, err := wishlistName(input.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := s.Repo.CountWishlists(user.ID)
+	if err != nil {
+		return nil, errors.New("unable to create wishlist")
+	}
+	if count >= wishlistLimit {
+		return nil, fmt.Errorf("you can have at most %d wishlists", wishlistLimit)
+	}
+
+	wishlist := domain.Wishlist{
+		UserID:   user.ID,
+		Name:     name,
+		IsPublic: input.IsPublic,
+	}
+
+	if input.IsPublic {
+		if wishlist.ShareToken, err = helper.RandomString(wishlistTokenLength); err != nil {
+			return nil, errors.New("unable to create wishlist")
+		}
+	}
+
+	if err = s.Repo.CreateWishlist(&wishlist); err != nil {
+		return nil, errors.New("unable to create wishlist")
+	}
+
+	return s.details(wishlist)
+}
+
+// UpdateWishlist renames the list or changes its visibility, making a list
+// private revokes the share link and publishing it again creates a new one.
+func (s WishlistService) UpdateWishlist(id uint, user domain.User, input dto.UpdateWishlistRequest) (*dto.WishlistDetails, error) {
+	wishlist, err := s.Repo.FindWishlist(id, user.ID)
+	if err != nil {
+		return nil, ErrWishlistNotFound
+	}
+
+	fields := map[string]any{}
+
+	if input.Name != nil {
+		if fields["name"], err = wishlistName(*input.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	if input.IsPublic != nil && *input.IsPublic != wishlist.IsPublic {
+		fields["is_public"] = *input.IsPublic
+		fields["share_token"] = ""
+
+		if *input.IsPublic {
+			if fields["share_token"], err = helper.RandomString(wishlistTokenLength); err != nil {
+				return nil, errors.New("unable to update wishlist")
+			}
+		}
+	}
+
+	if len(fields) > 0 {
+		if err = s.Repo.UpdateWishlist(wishlist.ID, fields); err != nil {
+			return nil, errors.New("unable to update wishlist")
+		}
+	}
+
+	return s.GetWishlist(wishlist.ID, user)
+}
+
+func (s WishlistService) DeleteWishlist(id uint, user domain.User) error {
+	wishlist, err := s.Repo.FindWishlist(id, user.ID)
+	if err != nil {
+		return ErrWishlistNotFound
+	}
+
+	if err = s.Repo.DeleteWishlist(wishlist.ID); err != nil {
+		return errors.New("unable to delete wishlist")
+	}
+
+	return nil
+}
+
+// AddItem saves the product with its current price, adding it again keeps the
+// original saved price.
+func (s WishlistService) AddItem(id uint, user domain.User, input dto.AddWishlistItemRequest) (*dto.WishlistDetails, error) {
+	wishlist, err := s.Repo.FindWishlist(id, user.ID)
+	if err != nil {
+		return nil, ErrWishlistNotFound
+	}
+
+	product, err := s.Catalog.FindPublicProductByID(int(input.ProductID))
+	if err != nil {
+		return nil, errors.New("product does not exist")
+	}
+
+	if len(wishlist.Items) >= wishlistItemLimit {
+		return nil, fmt.Errorf("a wishlist can have at most %d items", wishlistItemLimit)
+	}
+
+	_, err = s.Repo.AddWishlistItem(&domain.WishlistItem{
+		WishlistID: wishlist.ID,
+		ProductID:  product.ID,
+		Name:       product.Name,
+		ImageUrl:   product.ImageUrl,
+		SellerID:   product.UserID,
+		SavedPrice: product.Price,
+	})
+	if err != nil {
+		return nil, errors.New("unable to add item to wishlist")
+	}
+
+	return s.GetWishlist(wishlist.ID, user)
+}
+
+func (s WishlistService) RemoveItem(id, itemID uint, user domain.User) error {
+	wishlist, err := s.Repo.FindWishlist(id, user.ID)
+	if err != nil {
+		return ErrWishlistNotFound
+	}
+
+	removed, err := s.Repo.DeleteWishlistItem(wishlist.ID, itemID)
+	if err != nil {
+		return errors.New("unable to remove item from wishlist")
+	}
+	if !removed {
+		return errors.New("item is not on the wishlist")
+	}
+
+	return nil
+}
+
+// MoveToCart puts the product in the cart at its current price and takes it off
+// the wishlist.
+func (s WishlistService) MoveToCart(id, itemID uint, user domain.User, input dto.MoveToCartRequest) ([]domain.Cart, error) {
+	wishlist, err := s.Repo.FindWishlist(id, user.ID)
+	if err != nil {
+		return nil, ErrWishlistNotFound
+	}
+
+	var item *domain.WishlistItem
+	for i := range wishlist.Items {
+		if wishlist.Items[i].ID == itemID {
+			item = &wishlist.Items[i]
+			break
+		}
+	}
+	if item == nil {
+		return nil, errors.New("item is not on the wishlist")
+	}
+
+	qty := max(input.Qty, 1)
+
+	if err = s.addToCart(user, item.ProductID, qty); err != nil {
+		return nil, err
+	}
+
+	if _, err = s.Repo.DeleteWishlistItem(wishlist.ID, item.ID); err != nil {
+		log.Printf("removing moved item %d from wishlist failed: %v", item.ID, err)
+	}
+
+	return s.Users.FindCartItems(user.ID)
+}
+
+func (s WishlistService) addToCart(user domain.User, productID, qty uint) error {
+	product, err := s.Catalog.FindPublicProductByID(int(productID))
+	if err != nil {
+		return errors.New("product is no longer available")
+	}
+
+	cart, err := s.Users.FindCartItem(user.ID, product.ID)
+	if err == nil && !cart.SavedForLater {
+		qty += cart.Qty
+	}
+
+	if product.Stock < qty {
+		return fmt.Errorf("%w, %d left", ErrOutOfStock, product.Stock)
+	}
+
+	if err != nil {
+		err = s.Users.CreateCart(domain.Cart{
+			UserID:    user.ID,
+			ProductID: product.ID,
+			Name:      product.Name,
+			ImageUrl:  product.ImageUrl,
+			Qty:       qty,
+			Price:     product.Price,
+			SellerID:  product.UserID,
+		})
+	} else {
+		err = s.Users.SetCartSaved(cart.ID, false, qty, product.Price)
+	}
+
+	if err != nil {
+		return errors.New("error adding item to cart")
+	}
+
+	return nil
+}
+
+func (s WishlistService) details(wishlist domain.Wishlist) (*dto.WishlistDetails, error) {
+	productIDs := make([]uint, 0, len(wishlist.Items))
+	for _, item := range wishlist.Items {
+		productIDs = append(productIDs, item.ProductID)
+	}
+
+	prices, err := s.Catalog.FindProductPrices(productIDs)
+	if err != nil {
+		return nil, errors.New("unable to find wishlist")
+	}
+
+	details := s.wishlistDetails(wishlist, prices)
+
+	return &details, nil
+}
+
+func (s WishlistService) wishlistDetails(wishlist domain.Wishlist, prices map[uint]float64) dto.WishlistDetails {
+	details := dto.WishlistDetails{
+		ID:        wishlist.ID,
+		UserID:    wishlist.UserID,
+		Name:      wishlist.Name,
+		IsPublic:  wishlist.IsPublic,
+		Items:     make([]dto.WishlistItemDetails, 0, len(wishlist.Items)),
+		CreatedAt: wishlist.CreatedAt,
+		UpdatedAt: wishlist.UpdatedAt,
+	}
+
+	if wishlist.IsPublic && wishlist.ShareToken != "" {
+		details.ShareUrl = fmt.Sprintf("%s/wishlists/shared/%s", s.Config.AppBaseURL, wishlist.ShareToken)
+	}
+
+	for _, item := range wishlist.Items {
+		current, ok := prices[item.ProductID]
+		details.Items = append(details.Items, dto.WishlistItemDetails{
+			WishlistItem: item,
+			PriceDrop:    priceDrop(item.SavedPrice, current, ok),
+		})
+	}
+
+	return details
+}
+
+func wishlistName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+
+	switch {
+	case name == "":
+		return "", errors.New("please provide a wishlist name")
+	case utf8.RuneCountInString(name) > wishlistNameMaxLength:
+		return "", fmt.Errorf("name must be at most %d characters", wishlistNameMaxLength)
+	}
+
+	return name, nil
+}
+
+// priceDrop compares the saved price with the current one, available is false
+// when the product no longer exists.
+func priceDrop(saved, current float64, available bool) dto.PriceDrop {
+	drop := dto.PriceDrop{
+		CurrentPrice: current,
+		Available:    available,
+	}
+
+	if !available || current >= saved || saved <= 0 {
+		return drop
+	}
+
+	drop.PriceDrop = math.Round((saved-current)*100) / 100
+	drop.PriceDropPercent = math.Round((saved-current)/saved*1000) / 10
+	drop.PriceDropped = true
+
+	return drop
+}
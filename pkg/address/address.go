@@ -0,0 +1,205 @@
+package address
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// countries.json holds ISO 3166-1 countries with postal code patterns and
+// ISO 3166-2 subdivisions, so validation works without any external service.
+//
+//go:embed countries.json
+var countriesJSON []byte
+
+type Country struct {
+	Code               string            `json:"code"`
+	Alpha3             string            `json:"alpha3"`
+	Name               string            `json:"name"`
+	PostalPattern      string            `json:"postal_pattern,omitempty"`
+	PostalSeparator    string            `json:"postal_separator,omitempty"`
+	PostalSuffixLength int               `json:"postal_suffix_length,omitempty"`
+	Subdivisions       map[string]string `json:"subdivisions,omitempty"`
+	Required           []string          `json:"required"`
+
+	postal *regexp.Regexp
+}
+
+// Fields is the part of an address that is validated and normalized.
+type Fields struct {
+	Address1    string
+	City        string
+	PostCode    string
+	Subdivision string
+	Country     string
+}
+
+// ValidationError lists every field that failed, keyed by its json name.
+type ValidationError struct {
+	Fields map[string]string
+}
+
+func (e *ValidationError) Error() string {
+	keys := make([]string, 0, len(e.Fields))
+	for k := range e.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	msgs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", k, e.Fields[k]))
+	}
+	return "invalid address: " + strings.Join(msgs, ", ")
+}
+
+var ErrUnknownCountry = errors.New("unknown country")
+
+var (
+	countries []*Country
+	byKey     = map[string]*Country{}
+)
+
+func init() {
+	if err := json.Unmarshal(countriesJSON, &countries); err != nil {
+		panic("address: invalid countries.json: " + err.Error())
+	}
+
+	for _, c := range countries {
+		if c.PostalPattern != "" {
+			c.postal = regexp.MustCompile(c.PostalPattern)
+		}
+		byKey[c.Code] = c
+		byKey[c.Alpha3] = c
+		byKey[strings.ToUpper(c.Name)] = c
+	}
+}
+
+// Countries returns the reference data, sorted by alpha-2 code.
+func Countries() []Country {
+	list := make([]Country, len(countries))
+	for i, c := range countries {
+		list[i] = *c
+	}
+	return list
+}
+
+// Lookup finds a country by alpha-2 code, alpha-3 code or English name.
+func Lookup(value string) (Country, bool) {
+	c, ok := byKey[strings.ToUpper(strings.TrimSpace(value))]
+	if !ok {
+		return Country{}, false
+	}
+	return *c, true
+}
+
+// Normalize validates the fields against the rules of the country and returns
+// them in canonical form: alpha-2 country, ISO 3166-2 subdivision ("US-CA") and
+// the postal code in its local format.
+func Normalize(f Fields) (Fields, error) {
+	out := Fields{
+		Address1: strings.TrimSpace(f.Address1),
+		City:     strings.TrimSpace(f.City),
+	}
+
+	c, ok := Lookup(f.Country)
+	if !ok {
+		return out, &ValidationError{Fields: map[string]string{"country": ErrUnknownCountry.Error()}}
+	}
+	out.Country = c.Code
+
+	problems := map[string]string{}
+
+	if postCode := strings.TrimSpace(f.PostCode); postCode != "" {
+		if c.postal == nil {
+			out.PostCode = strings.ToUpper(postCode)
+		} else if formatted, ok := c.formatPostCode(postCode); ok {
+			out.PostCode = formatted
+		} else {
+			problems["post_code"] = fmt.Sprintf("not a valid postal code for %s", c.Name)
+		}
+	}
+
+	if subdivision := strings.TrimSpace(f.Subdivision); subdivision != "" {
+		if len(c.Subdivisions) == 0 {
+			out.Subdivision = strings.ToUpper(subdivision)
+		} else if code, ok := c.subdivision(subdivision); ok {
+			out.Subdivision = code
+		} else {
+			problems["subdivision"] = fmt.Sprintf("not a valid subdivision of %s", c.Name)
+		}
+	}
+
+	for _, field := range c.Required {
+		if _, failed := problems[field]; failed {
+			continue
+		}
+		if out.value(field) == "" {
+			problems[field] = "is required"
+		}
+	}
+
+	if len(problems) > 0 {
+		return out, &ValidationError{Fields: problems}
+	}
+
+	return out, nil
+}
+
+func (f Fields) value(field string) string {
+	switch field {
+	case "address1":
+		return f.Address1
+	case "city":
+		return f.City
+	case "post_code":
+		return f.PostCode
+	case "subdivision":
+		return f.Subdivision
+	}
+	return ""
+}
+
+// formatPostCode uppercases the code, strips spaces and dashes and re-inserts
+// the local separator before checking it against the pattern.
+func (c Country) formatPostCode(value string) (string, bool) {
+	value = strings.ToUpper(strings.Join(strings.Fields(value), " "))
+	if c.postal.MatchString(value) {
+		return value, true
+	}
+
+	if c.PostalSeparator == "" {
+		return value, false
+	}
+
+	compact := strings.NewReplacer(" ", "", "-", "").Replace(value)
+	if len(compact) <= c.PostalSuffixLength {
+		return value, false
+	}
+
+	split := len(compact) - c.PostalSuffixLength
+	formatted := compact[:split] + c.PostalSeparator + compact[split:]
+	return formatted, c.postal.MatchString(formatted)
+}
+
+// subdivision accepts "CA", "US-CA" or "California" and returns "US-CA".
+func (c Country) subdivision(value string) (string, bool) {
+	code := strings.ToUpper(value)
+	code = strings.TrimPrefix(code, c.Code+"-")
+
+	if _, ok := c.Subdivisions[code]; ok {
+		return c.Code + "-" + code, true
+	}
+
+	for k, name := range c.Subdivisions {
+		if strings.EqualFold(name, value) {
+			return c.Code + "-" + k, true
+		}
+	}
+
+	return "", false
+}
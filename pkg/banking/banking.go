@@ -0,0 +1,136 @@
+package banking
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrInvalidIBAN          = errors.New("invalid iban")
+	ErrInvalidBIC           = errors.New("invalid swift/bic code")
+	ErrInvalidAccountNumber = errors.New("invalid account number")
+	ErrInvalidRoutingNumber = errors.New("invalid routing number")
+)
+
+// ibanLengths holds the IBAN length of every country in the SWIFT IBAN registry.
+var ibanLengths = map[string]int{
+	"AD": 24, "AE": 23, "AL": 28, "AT": 20, "AZ": 28, "BA": 20, "BE": 16, "BG": 22,
+	"BH": 22, "BI": 27, "BR": 29, "BY": 28, "CH": 21, "CR": 22, "CY": 28, "CZ": 24,
+	"DE": 22, "DJ": 27, "DK": 18, "DO": 28, "EE": 20, "EG": 29, "ES": 24, "FI": 18,
+	"FK": 18, "FO": 18, "FR": 27, "GB": 22, "GE": 22, "GI": 23, "GL": 18, "GR": 27,
+	"GT": 28, "HR": 21, "HU": 28, "IE": 22, "IL": 23, "IQ": 23, "IS": 26, "IT": 27,
+	"JO": 30, "KW": 30, "KZ": 20, "LB": 28, "LC": 32, "LI": 21, "LT": 20, "LU": 20,
+	"LV": 21, "LY": 25, "MC": 27, "MD": 24, "ME": 22, "MK": 19, "MN": 20, "MR": 27,
+	"MT": 31, "MU": 30, "NI": 28, "NL": 18, "NO": 15, "OM": 23, "PK": 24, "PL": 28,
+	"PS": 29, "PT": 25, "QA": 29, "RO": 24, "RS": 22, "RU": 33, "SA": 24, "SC": 31,
+	"SD": 18, "SE": 24, "SI": 19, "SK": 24, "SM": 27, "SO": 23, "ST": 25, "SV": 28,
+	"TL": 23, "TN": 24, "TR": 26, "UA": 29, "VA": 22, "VG": 24, "XK": 20, "YE": 30,
+}
+
+var (
+	bicPattern     = regexp.MustCompile(`^[A-Z]{4}[A-Z]{2}[A-Z0-9]{2}([A-Z0-9]{3})?$`)
+	accountPattern = regexp.MustCompile(`^[A-Z0-9]{4,34}$`)
+	routingPattern = regexp.MustCompile(`^\d{9}$`)
+)
+
+func compact(value string) string {
+	return strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(value)))
+}
+
+// UsesIBAN reports whether bank accounts of the country are identified by IBAN.
+func UsesIBAN(country string) bool {
+	_, ok := ibanLengths[strings.ToUpper(country)]
+	return ok
+}
+
+// NormalizeIBAN removes spaces, uppercases and validates the length for the
+// country and the ISO 13616 mod-97 check digits.
+func NormalizeIBAN(value string) (string, error) {
+	iban := compact(value)
+
+	if len(iban) < 15 || iban[0] < 'A' || iban[0] > 'Z' || iban[1] < 'A' || iban[1] > 'Z' {
+		return "", ErrInvalidIBAN
+	}
+
+	if length, ok := ibanLengths[iban[:2]]; !ok || length != len(iban) {
+		return "", ErrInvalidIBAN
+	}
+
+	// move the country code and check digits to the end, letters become 10..35
+	rearranged := iban[4:] + iban[:4]
+	remainder := 0
+	for _, r := range rearranged {
+		switch {
+		case r >= '0' && r <= '9':
+			remainder = (remainder*10 + int(r-'0')) % 97
+		case r >= 'A' && r <= 'Z':
+			remainder = (remainder*100 + int(r-'A'+10)) % 97
+		default:
+			return "", ErrInvalidIBAN
+		}
+	}
+
+	if remainder != 1 {
+		return "", ErrInvalidIBAN
+	}
+
+	return iban, nil
+}
+
+// NormalizeBIC validates a SWIFT/BIC code, its country part must match country
+// when one is given.
+func NormalizeBIC(value, country string) (string, error) {
+	bic := compact(value)
+
+	if !bicPattern.MatchString(bic) {
+		return "", ErrInvalidBIC
+	}
+
+	if country != "" && bic[4:6] != strings.ToUpper(country) {
+		return "", ErrInvalidBIC
+	}
+
+	return bic, nil
+}
+
+// NormalizeAccountNumber checks a domestic account number of a country without IBAN.
+func NormalizeAccountNumber(value string) (string, error) {
+	account := compact(value)
+
+	if !accountPattern.MatchString(account) {
+		return "", ErrInvalidAccountNumber
+	}
+
+	return account, nil
+}
+
+// ValidateRoutingNumber checks a US ABA routing number with its 3-7-1 checksum.
+func ValidateRoutingNumber(value string) (string, error) {
+	routing := compact(value)
+
+	if !routingPattern.MatchString(routing) {
+		return "", ErrInvalidRoutingNumber
+	}
+
+	weights := []int{3, 7, 1, 3, 7, 1, 3, 7, 1}
+	sum := 0
+	for i, r := range routing {
+		sum += int(r-'0') * weights[i]
+	}
+
+	if sum%10 != 0 {
+		return "", ErrInvalidRoutingNumber
+	}
+
+	return routing, nil
+}
+
+// Mask keeps the last four characters, for display and notifications.
+func Mask(value string) string {
+	if len(value) <= 4 {
+		return strings.Repeat("*", len(value))
+	}
+
+	return strings.Repeat("*", len(value)-4) + value[len(value)-4:]
+}
@@ -0,0 +1,213 @@
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// values are stored as v1:<kid>:<wrapped data key>:<nonce and ciphertext>, both
+// parts in unpadded base64url
+const version = "v1"
+
+var (
+	ErrNotConfigured = errors.New("field encryption is not configured")
+	ErrMalformed     = errors.New("malformed encrypted value")
+)
+
+var (
+	mu       sync.RWMutex
+	provider KeyProvider
+)
+
+// SetKeyProvider configures the keys used by the serializer and the helpers.
+func SetKeyProvider(p KeyProvider) {
+	mu.Lock()
+	defer mu.Unlock()
+	provider = p
+}
+
+func keys() (KeyProvider, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if provider == nil {
+		return nil, ErrNotConfigured
+	}
+	return provider, nil
+}
+
+// IsEncrypted tells stored ciphertext from values written before encryption
+// was enabled, which are read as they are until the rotation job encrypts them.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, version+":")
+}
+
+// Encrypt seals the value with a fresh data key wrapped by the current key.
+// Empty values stay empty.
+func Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	p, err := keys()
+	if err != nil {
+		return "", err
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err = rand.Read(dataKey); err != nil {
+		return "", err
+	}
+
+	kid := p.CurrentKeyID()
+
+	wrapped, err := p.WrapKey(kid, dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := seal(dataKey, []byte(plaintext), []byte(kid))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join([]string{
+		version,
+		kid,
+		base64.RawURLEncoding.EncodeToString(wrapped),
+		base64.RawURLEncoding.EncodeToString(sealed),
+	}, ":"), nil
+}
+
+func Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	parts := strings.Split(value, ":")
+	if len(parts) != 4 {
+		return "", ErrMalformed
+	}
+
+	p, err := keys()
+	if err != nil {
+		return "", err
+	}
+
+	wrapped, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrMalformed
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(parts[3])
+	if err != nil {
+		return "", ErrMalformed
+	}
+
+	dataKey, err := p.UnwrapKey(parts[1], wrapped)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := open(dataKey, sealed, []byte(parts[1]))
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// NeedsRotation reports whether the stored value is plaintext or sealed with
+// another key than the current one.
+func NeedsRotation(value string) bool {
+	if value == "" {
+		return false
+	}
+
+	if !IsEncrypted(value) {
+		return true
+	}
+
+	p, err := keys()
+	if err != nil {
+		return false
+	}
+
+	parts := strings.SplitN(value, ":", 3)
+	return len(parts) < 3 || parts[1] != p.CurrentKeyID()
+}
+
+// BlindIndex is a deterministic keyed hash of the value, it allows equality
+// lookups on encrypted columns without revealing the value.
+func BlindIndex(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	p, err := keys()
+	if err != nil {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, p.IndexKey())
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Mask keeps the last four characters, e.g. ****1234.
+func Mask(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	runes := []rune(value)
+	if len(runes) <= 4 {
+		return strings.Repeat("*", len(runes))
+	}
+
+	return "****" + string(runes[len(runes)-4:])
+}
+
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(key, sealed, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrMalformed
+	}
+
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
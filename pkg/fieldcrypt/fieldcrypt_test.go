@@ -0,0 +1,237 @@
+package fieldcrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testIndexKey = bytes.Repeat([]byte{0x5a}, 32)
+
+// useTestKeys writes a key file holding the given kids and configures a
+// provider read from it, the way the server does at startup.
+func useTestKeys(t *testing.T, current string, kids ...string) {
+	t.Helper()
+
+	file := keyFile{
+		Current:  current,
+		Keys:     map[string]string{},
+		IndexKey: base64.StdEncoding.EncodeToString(testIndexKey),
+	}
+	for i, kid := range kids {
+		file.Keys[kid] = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{byte(i + 1)}, 32))
+	}
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err = os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewLocalKeyProvider(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	SetKeyProvider(p)
+	t.Cleanup(func() { SetKeyProvider(nil) })
+}
+
+func mustEncrypt(t *testing.T, plaintext string) string {
+	t.Helper()
+
+	value, err := Encrypt(plaintext)
+	if err != nil {
+		t.Fatalf("encrypt %q: %v", plaintext, err)
+	}
+	return value
+}
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	useTestKeys(t, "k1", "k1")
+
+	for _, plaintext := range []string{"+49 170 1234567", "JBSWY3DPEHPK3PXP", "DE89 3704 0044 0532 0130 00", "üñïçødé:with:colons", ""} {
+		value := mustEncrypt(t, plaintext)
+
+		if plaintext == "" {
+			if value != "" {
+				t.Errorf("encrypt of an empty value = %q, want it empty", value)
+			}
+			continue
+		}
+
+		if !IsEncrypted(value) || strings.Contains(value, plaintext) {
+			t.Errorf("encrypt %q = %q, want sealed ciphertext", plaintext, value)
+		}
+
+		if again := mustEncrypt(t, plaintext); again == value {
+			t.Errorf("encrypt %q twice gave the same ciphertext", plaintext)
+		}
+
+		got, err := Decrypt(value)
+		if err != nil || got != plaintext {
+			t.Errorf("decrypt %q = %q, %v, want %q", value, got, err, plaintext)
+		}
+
+		if NeedsRotation(value) {
+			t.Errorf("value sealed with the current key needs rotation")
+		}
+	}
+}
+
+func TestDecryptAcrossKeyRotation(t *testing.T) {
+	useTestKeys(t, "k1", "k1")
+	old := mustEncrypt(t, "+49 170 1234567")
+
+	tests := []struct {
+		name         string
+		current      string
+		kids         []string
+		wantErr      error
+		wantRotation bool
+	}{
+		{name: "old key still configured", current: "k2", kids: []string{"k1", "k2"}, wantRotation: true},
+		{name: "old key is still current", current: "k1", kids: []string{"k1", "k2"}},
+		{name: "old key removed", current: "k2", kids: []string{"k2"}, wantErr: ErrKeyNotFound, wantRotation: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestKeys(t, tt.current, tt.kids...)
+
+			got, err := Decrypt(old)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("decrypt = %q, %v, want %v", got, err, tt.wantErr)
+				}
+			} else if err != nil || got != "+49 170 1234567" {
+				t.Errorf("decrypt = %q, %v", got, err)
+			}
+
+			if NeedsRotation(old) != tt.wantRotation {
+				t.Errorf("needs rotation = %v, want %v", !tt.wantRotation, tt.wantRotation)
+			}
+
+			rotated := mustEncrypt(t, "+49 170 1234567")
+			if !strings.HasPrefix(rotated, version+":"+tt.current+":") || NeedsRotation(rotated) {
+				t.Errorf("re-encrypted value %q is not sealed with the current key %s", rotated, tt.current)
+			}
+		})
+	}
+}
+
+func TestDecryptLegacyPlaintext(t *testing.T) {
+	useTestKeys(t, "k1", "k1")
+
+	for _, value := range []string{"+49 170 1234567", "v2:not-ours", "1234:5678"} {
+		if IsEncrypted(value) {
+			t.Errorf("legacy value %q is reported as encrypted", value)
+		}
+
+		got, err := Decrypt(value)
+		if err != nil || got != value {
+			t.Errorf("decrypt legacy %q = %q, %v, want it unchanged", value, got, err)
+		}
+
+		if !NeedsRotation(value) {
+			t.Errorf("legacy value %q does not need rotation", value)
+		}
+	}
+
+	if NeedsRotation("") {
+		t.Errorf("empty value needs rotation")
+	}
+}
+
+func TestDecryptTampered(t *testing.T) {
+	useTestKeys(t, "k2", "k1", "k2")
+	value := mustEncrypt(t, "+49 170 1234567")
+	parts := strings.Split(value, ":")
+
+	flip := func(encoded string) string {
+		raw, _ := base64.RawURLEncoding.DecodeString(encoded)
+		raw[len(raw)-1] ^= 0x01
+		return base64.RawURLEncoding.EncodeToString(raw)
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		wantErr error
+	}{
+		{name: "ciphertext modified", value: strings.Join([]string{parts[0], parts[1], parts[2], flip(parts[3])}, ":")},
+		{name: "wrapped key modified", value: strings.Join([]string{parts[0], parts[1], flip(parts[2]), parts[3]}, ":")},
+		{name: "kid swapped", value: strings.Join([]string{parts[0], "k1", parts[2], parts[3]}, ":")},
+		{name: "unknown kid", value: strings.Join([]string{parts[0], "k9", parts[2], parts[3]}, ":"), wantErr: ErrKeyNotFound},
+		{name: "part missing", value: strings.Join(parts[:3], ":"), wantErr: ErrMalformed},
+		{name: "not base64", value: strings.Join([]string{parts[0], parts[1], parts[2], "***"}, ":"), wantErr: ErrMalformed},
+		{name: "truncated", value: strings.Join([]string{parts[0], parts[1], parts[2], parts[3][:8]}, ":"), wantErr: ErrMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decrypt(tt.value)
+			if err == nil {
+				t.Fatalf("decrypt of a tampered value = %q, want an error", got)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("decrypt = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBlindIndexIsStable(t *testing.T) {
+	useTestKeys(t, "k1", "k1")
+	before := BlindIndex("+49 170 1234567")
+
+	// the index key is not rotated with the encryption keys
+	useTestKeys(t, "k2", "k1", "k2")
+
+	tests := []struct {
+		name  string
+		value string
+		equal bool
+	}{
+		{name: "same value after rotation", value: "+49 170 1234567", equal: true},
+		{name: "different value", value: "+49 170 1234568"},
+		{name: "trailing space", value: "+49 170 1234567 "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := BlindIndex(tt.value)
+			if got != BlindIndex(tt.value) {
+				t.Errorf("blind index of %q is not deterministic", tt.value)
+			}
+			if (got == before) != tt.equal {
+				t.Errorf("blind index of %q = %s, equal to the original = %v, want %v", tt.value, got, got == before, tt.equal)
+			}
+		})
+	}
+
+	if got := BlindIndex(""); got != "" {
+		t.Errorf("blind index of an empty value = %q, want it empty", got)
+	}
+}
+
+func TestNotConfigured(t *testing.T) {
+	SetKeyProvider(nil)
+
+	if _, err := Encrypt("+49 170 1234567"); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("encrypt without keys: %v, want ErrNotConfigured", err)
+	}
+
+	if got := BlindIndex("+49 170 1234567"); got != "" {
+		t.Errorf("blind index without keys = %q, want it empty", got)
+	}
+}
@@ -0,0 +1,160 @@
+package fieldcrypt
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var ErrKeyNotFound = errors.New("encryption key not found")
+
+// KeyProvider hands out the key encryption keys. Implement it on top of a KMS
+// in production, the keys never leave the provider there.
+type KeyProvider interface {
+	// CurrentKeyID is the key new values are encrypted with.
+	CurrentKeyID() string
+	// WrapKey encrypts a data key with the key encryption key kid.
+	WrapKey(kid string, dataKey []byte) ([]byte, error)
+	// UnwrapKey decrypts a data key wrapped with kid.
+	UnwrapKey(kid string, wrapped []byte) ([]byte, error)
+	// IndexKey is the stable HMAC key of the blind indexes, it is not rotated
+	// with the encryption keys since the indexes would have to be rebuilt.
+	IndexKey() []byte
+}
+
+// keyFile is the format of the local key file:
+//
+//	{"current": "k2", "keys": {"k1": "<base64>", "k2": "<base64>"}, "index_key": "<base64>"}
+//
+// Rotate by adding a key and pointing current at it, the rotation job then
+// re-encrypts the stored values. Remove old keys only after it has finished.
+type keyFile struct {
+	Current  string            `json:"current"`
+	Keys     map[string]string `json:"keys"`
+	IndexKey string            `json:"index_key"`
+}
+
+type localKeyProvider struct {
+	current  string
+	keys     map[string][]byte
+	indexKey []byte
+}
+
+// NewLocalKeyProvider reads the key file. A missing file is created with fresh
+// keys if allowGenerate is set, which only suits development: anywhere else it
+// means a misconfigured path, and new keys could not decrypt the stored data.
+func NewLocalKeyProvider(path string, allowGenerate bool) (KeyProvider, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if !allowGenerate {
+			return nil, fmt.Errorf("encryption key file %s not found, set ENCRYPTION_KEY_FILE", path)
+		}
+		log.Printf("encryption key file %s not found, generating a new one", path)
+		if data, err = generateKeyFile(path); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	var file keyFile
+	if err = json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("encryption key file: %w", err)
+	}
+
+	p := &localKeyProvider{
+		current: file.Current,
+		keys:    map[string][]byte{},
+	}
+
+	for kid, encoded := range file.Keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("encryption key %q must be 32 bytes in base64", kid)
+		}
+		p.keys[kid] = key
+	}
+
+	if _, ok := p.keys[p.current]; !ok {
+		return nil, fmt.Errorf("current encryption key %q not found", p.current)
+	}
+
+	if p.indexKey, err = base64.StdEncoding.DecodeString(file.IndexKey); err != nil || len(p.indexKey) < 32 {
+		return nil, errors.New("encryption index_key must be at least 32 bytes in base64")
+	}
+
+	return p, nil
+}
+
+func generateKeyFile(path string) ([]byte, error) {
+	key := make([]byte, 32)
+	indexKey := make([]byte, 32)
+
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	if _, err := rand.Read(indexKey); err != nil {
+		return nil, err
+	}
+
+	kid := time.Now().UTC().Format("20060102")
+
+	data, err := json.MarshalIndent(keyFile{
+		Current:  kid,
+		Keys:     map[string]string{kid: base64.StdEncoding.EncodeToString(key)},
+		IndexKey: base64.StdEncoding.EncodeToString(indexKey),
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+
+	// O_EXCL, two instances starting at once must not overwrite each other's keys
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if _, err = f.Write(data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (p *localKeyProvider) CurrentKeyID() string {
+	return p.current
+}
+
+func (p *localKeyProvider) WrapKey(kid string, dataKey []byte) ([]byte, error) {
+	key, ok := p.keys[kid]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	return seal(key, dataKey, []byte(kid))
+}
+
+func (p *localKeyProvider) UnwrapKey(kid string, wrapped []byte) ([]byte, error) {
+	key, ok := p.keys[kid]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	return open(key, wrapped, []byte(kid))
+}
+
+func (p *localKeyProvider) IndexKey() []byte {
+	return p.indexKey
+}
@@ -0,0 +1,76 @@
+package fieldcrypt
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm/schema"
+)
+
+// Secret is a string stored encrypted and shown masked in json.
+//
+//	Phone fieldcrypt.Secret `json:"phone" gorm:"serializer:encrypted"`
+type Secret string
+
+func (s Secret) String() string {
+	return string(s)
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(Mask(string(s)))
+}
+
+// ErrSecretValue is returned when a Secret is passed to a query directly.
+var ErrSecretValue = errors.New("fieldcrypt: secrets are written through the serializer or Encrypt and looked up by their BlindIndex")
+
+// Value fails: every encryption uses a fresh nonce, so a Secret passed as a
+// query argument would silently match nothing. Map updates write the result
+// of Encrypt, lookups compare the BlindIndex column.
+func (s Secret) Value() (driver.Value, error) {
+	return nil, ErrSecretValue
+}
+
+// Serializer is registered as "encrypted".
+type Serializer struct{}
+
+func init() {
+	schema.RegisterSerializer("encrypted", Serializer{})
+}
+
+func (Serializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var stored string
+
+	switch v := dbValue.(type) {
+	case nil:
+	case string:
+		stored = v
+	case []byte:
+		stored = string(v)
+	default:
+		return fmt.Errorf("encrypted field %s: unsupported value %T", field.Name, dbValue)
+	}
+
+	plaintext, err := Decrypt(stored)
+	if err != nil {
+		return fmt.Errorf("encrypted field %s: %w", field.Name, err)
+	}
+
+	return field.Set(ctx, dst, Secret(plaintext))
+}
+
+func (Serializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	switch v := fieldValue.(type) {
+	case Secret:
+		return Encrypt(string(v))
+	case string:
+		return Encrypt(v)
+	case nil:
+		return "", nil
+	default:
+		return nil, fmt.Errorf("encrypted field %s: unsupported type %T", field.Name, fieldValue)
+	}
+}
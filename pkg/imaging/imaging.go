@@ -0,0 +1,154 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("image must be a jpeg, png or gif file")
+	ErrTooLarge          = errors.New("image dimensions are too large")
+)
+
+// MaxPixels bounds the decoded size, a small file can describe a huge image.
+const MaxPixels = 40_000_000
+
+// Image is a decoded upload.
+type Image struct {
+	Image       *image.RGBA // converted once, every thumbnail is scaled from it
+	ContentType string
+	Ext         string
+	Width       int
+	Height      int
+}
+
+var formats = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// Decode sniffs the content type, checks the dimensions before decoding the
+// pixels and decodes the image into RGBA.
+func Decode(data []byte) (Image, error) {
+	contentType := http.DetectContentType(data)
+
+	ext, ok := formats[contentType]
+	if !ok {
+		return Image{}, ErrUnsupportedFormat
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, ErrUnsupportedFormat
+	}
+
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > MaxPixels {
+		return Image{}, ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, ErrUnsupportedFormat
+	}
+
+	return Image{
+		Image:       toRGBA(img),
+		ContentType: contentType,
+		Ext:         ext,
+		Width:       config.Width,
+		Height:      config.Height,
+	}, nil
+}
+
+// toRGBA returns the image as RGBA with its origin at 0,0, copying it only
+// when it is stored differently.
+func toRGBA(src image.Image) *image.RGBA {
+	if rgba, ok := src.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+
+	bounds := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+
+	return rgba
+}
+
+// Thumbnail scales the image down so its longer side is at most size pixels,
+// smaller images are returned as they are. It allocates the thumbnail only.
+func Thumbnail(src *image.RGBA, size int) image.Image {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+
+	if w <= size && h <= size {
+		return src
+	}
+
+	dw, dh := size, h*size/w
+	if h > w {
+		dw, dh = w*size/h, size
+	}
+	dw, dh = max(dw, 1), max(dh, 1)
+
+	return boxResize(toRGBA(src), dw, dh)
+}
+
+// boxResize averages the source pixels covered by each target pixel, good
+// enough for downscaling and free of extra dependencies.
+func boxResize(src *image.RGBA, dw, dh int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, max((y+1)*sh/dh, y*sh/dh+1)
+
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, max((x+1)*sw/dw, x*sw/dw+1)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint64(p[0])
+					g += uint64(p[1])
+					b += uint64(p[2])
+					a += uint64(p[3])
+					n++
+				}
+			}
+
+			i := y*dst.Stride + x*4
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
+
+// Encode writes png sources as png to keep transparency, everything else as jpeg.
+func Encode(img image.Image, contentType string) ([]byte, string, string, error) {
+	buf := new(bytes.Buffer)
+
+	if contentType == "image/png" {
+		if err := png.Encode(buf, img); err != nil {
+			return nil, "", "", err
+		}
+		return buf.Bytes(), "image/png", ".png", nil
+	}
+
+	if err := jpeg.Encode(buf, img, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, "", "", err
+	}
+
+	return buf.Bytes(), "image/jpeg", ".jpg", nil
+}
@@ -0,0 +1,49 @@
+package notification
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+func (c notificationClient) SendEmail(to, subject, body string) error {
+	if c.config.SMTPHost == "" {
+		// development setups without a mail server
+		log.Printf("smtp is not configured, email to %s not sent: %s", to, subject)
+		return nil
+	}
+
+	if c.config.SMTPFrom == "" {
+		return errors.New("smtp from address is not configured")
+	}
+
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return errors.New("invalid email header")
+	}
+
+	msg := strings.Join([]string{
+		"From: " + c.config.SMTPFrom,
+		"To: " + to,
+		"Subject: " + subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	var auth smtp.Auth
+	if c.config.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", c.config.SMTPUsername, c.config.SMTPPassword, c.config.SMTPHost)
+	}
+
+	addr := fmt.Sprintf("%s:%s", c.config.SMTPHost, c.config.SMTPPort)
+	if err := smtp.SendMail(addr, auth, c.config.SMTPFrom, []string{to}, []byte(msg)); err != nil {
+		return fmt.Errorf("sending email: %w", err)
+	}
+
+	return nil
+}
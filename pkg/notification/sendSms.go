@@ -11,6 +11,7 @@ import (
 
 type NotificationClient interface {
 	SendSMS(phone, message string) error
+	SendEmail(to, subject, body string) error
 }
 
 type notificationClient struct {
@@ -0,0 +1,172 @@
+// Package oidctest runs a local OpenID Connect issuer for tests.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const keyID = "test-key"
+
+// Identity is the user the issuer signs in on the next authorization.
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+}
+
+type pendingCode struct {
+	clientID  string
+	nonce     string
+	challenge string
+	identity  Identity
+}
+
+// Issuer serves discovery, jwks and the token endpoint. Authorization is done
+// without a browser: Authorize reads the authorization url and returns the
+// code the provider would redirect back with.
+type Issuer struct {
+	URL string
+
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]pendingCode
+}
+
+func NewIssuer(t *testing.T) *Issuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuer := &Issuer{key: key, codes: map[string]pendingCode{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", issuer.discovery)
+	mux.HandleFunc("/jwks", issuer.jwks)
+	mux.HandleFunc("/token", issuer.token)
+
+	issuer.server = httptest.NewServer(mux)
+	issuer.URL = issuer.server.URL
+	t.Cleanup(issuer.server.Close)
+
+	return issuer
+}
+
+// Authorize accepts the authorization url for identity and returns the code
+// and the state of the redirect back to the client.
+func (i *Issuer) Authorize(t *testing.T, authorizationURL string, identity Identity) (code, state string) {
+	t.Helper()
+
+	u, err := url.Parse(authorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := u.Query()
+	if query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("authorization request without S256 challenge: %s", authorizationURL)
+	}
+
+	buffer := make([]byte, 16)
+	if _, err = rand.Read(buffer); err != nil {
+		t.Fatal(err)
+	}
+	code = base64.RawURLEncoding.EncodeToString(buffer)
+
+	i.mu.Lock()
+	i.codes[code] = pendingCode{
+		clientID:  query.Get("client_id"),
+		nonce:     query.Get("nonce"),
+		challenge: query.Get("code_challenge"),
+		identity:  identity,
+	}
+	i.mu.Unlock()
+
+	return code, query.Get("state")
+}
+
+func (i *Issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]string{
+		"issuer":                 i.URL,
+		"authorization_endpoint": i.URL + "/authorize",
+		"token_endpoint":         i.URL + "/token",
+		"jwks_uri":               i.URL + "/jwks",
+	})
+}
+
+func (i *Issuer) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(i.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(i.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (i *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "authorization_code" {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+
+	i.mu.Lock()
+	pending, ok := i.codes[r.Form.Get("code")]
+	delete(i.codes, r.Form.Get("code"))
+	i.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != pending.challenge || r.Form.Get("client_id") != pending.clientID {
+		http.Error(w, "invalid_grant", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            i.URL,
+		"aud":            pending.clientID,
+		"sub":            pending.identity.Subject,
+		"email":          pending.identity.Email,
+		"email_verified": pending.identity.EmailVerified,
+		"given_name":     pending.identity.GivenName,
+		"family_name":    pending.identity.FamilyName,
+		"nonce":          pending.nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+	})
+	token.Header["kid"] = keyID
+
+	idToken, err := token.SignedString(i.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]string{"access_token": "access", "token_type": "Bearer", "id_token": idToken})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
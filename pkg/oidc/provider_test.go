@@ -0,0 +1,100 @@
+package oidc_test
+
+import (
+	"context"
+	"go-ecommerce-app/pkg/oidc"
+	"go-ecommerce-app/pkg/oidc/oidctest"
+	"testing"
+)
+
+func TestExchangeAgainstIssuer(t *testing.T) {
+	issuer := oidctest.NewIssuer(t)
+	provider := oidc.NewProvider(oidc.ProviderConfig{
+		Name:        "test",
+		Issuer:      issuer.URL,
+		ClientID:    "client",
+		RedirectURL: "http://localhost/auth/oidc/test/callback",
+	})
+	ctx := context.Background()
+
+	start := func(nonce string) (string, string) {
+		verifier, challenge, err := oidc.GeneratePKCE()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		url, err := provider.AuthCodeURL(ctx, "state", nonce, challenge)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		code, state := issuer.Authorize(t, url, oidctest.Identity{Subject: "sub-1", Email: "jane@example.com", EmailVerified: true})
+		if state != "state" {
+			t.Fatalf("state = %q, want state", state)
+		}
+
+		return code, verifier
+	}
+
+	t.Run("valid code", func(t *testing.T) {
+		code, verifier := start("nonce")
+
+		claims, err := provider.Exchange(ctx, code, verifier, "nonce")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if claims.Subject != "sub-1" || claims.Email != "jane@example.com" || !bool(claims.EmailVerified) {
+			t.Fatalf("unexpected claims %+v", claims)
+		}
+	})
+
+	t.Run("wrong verifier", func(t *testing.T) {
+		code, _ := start("nonce")
+		other, _, _ := oidc.GeneratePKCE()
+
+		if _, err := provider.Exchange(ctx, code, other, "nonce"); err == nil {
+			t.Fatal("exchange accepted a foreign code verifier")
+		}
+	})
+
+	t.Run("wrong nonce", func(t *testing.T) {
+		code, verifier := start("nonce")
+
+		if _, err := provider.Exchange(ctx, code, verifier, "other"); err == nil {
+			t.Fatal("exchange accepted an id token for another nonce")
+		}
+	})
+
+	t.Run("code used twice", func(t *testing.T) {
+		code, verifier := start("nonce")
+
+		if _, err := provider.Exchange(ctx, code, verifier, "nonce"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := provider.Exchange(ctx, code, verifier, "nonce"); err == nil {
+			t.Fatal("exchange accepted a used code")
+		}
+	})
+}
+
+func TestExchangeRejectsCodeOfOtherClient(t *testing.T) {
+	issuer := oidctest.NewIssuer(t)
+	ctx := context.Background()
+
+	// the issuer signs for the client named in the authorization url
+	other := oidc.NewProvider(oidc.ProviderConfig{Name: "other", Issuer: issuer.URL, ClientID: "other"})
+	provider := oidc.NewProvider(oidc.ProviderConfig{Name: "test", Issuer: issuer.URL, ClientID: "client"})
+
+	verifier, challenge, _ := oidc.GeneratePKCE()
+	url, err := other.AuthCodeURL(ctx, "state", "nonce", challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, _ := issuer.Authorize(t, url, oidctest.Identity{Subject: "sub-1"})
+
+	if _, err = provider.Exchange(ctx, code, verifier, "nonce"); err == nil {
+		t.Fatal("exchange accepted a code issued to another client")
+	}
+}
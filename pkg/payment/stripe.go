@@ -4,11 +4,16 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/stripe/stripe-go/v82"
 	"github.com/stripe/stripe-go/v82/checkout/session"
 )
 
+// SessionTTL is how long a checkout session can be paid, the shortest
+// expiry stripe accepts.
+const SessionTTL = 30 * time.Minute
+
 type PaymentClient interface {
 	CreatePayment(amount float64, userID uint, orderID string) (*stripe.CheckoutSession, error)
 	GetPaymentStatus(paymentID string) (*stripe.CheckoutSession, error)
@@ -49,6 +54,7 @@ func (p *payment) CreatePayment(amount float64, userID uint, orderID string) (*s
 		Mode:       stripe.String(string(stripe.CheckoutSessionModePayment)),
 		SuccessURL: stripe.String(string(p.successUrl)),
 		CancelURL:  stripe.String(string(p.cancelUrl)),
+		ExpiresAt:  stripe.Int64(time.Now().Add(SessionTTL).Unix()),
 	}
 
 	params.AddMetadata("order_id", orderID)
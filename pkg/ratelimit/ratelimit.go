@@ -0,0 +1,108 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit allows Requests per Period, refilled continuously (token bucket).
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	ResetAfter time.Duration
+	RetryAfter time.Duration
+}
+
+// Store keeps bucket state. Implement it on top of a shared cache (e.g. redis)
+// when the app runs on more than one instance.
+type Store interface {
+	Take(key string, limit Limit) (Result, error)
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	period  time.Duration
+}
+
+type memoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	// now is the clock, replaced in the tests
+	now func() time.Time
+}
+
+func NewMemoryStore(cleanupInterval time.Duration) Store {
+	s := &memoryStore{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+
+	go s.cleanup(cleanupInterval)
+
+	return s
+}
+
+func (s *memoryStore) Take(key string, limit Limit) (Result, error) {
+	now := s.now()
+	capacity := float64(limit.Requests)
+	perToken := limit.Period / time.Duration(limit.Requests)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, updated: now}
+		s.buckets[key] = b
+	}
+	b.period = limit.Period
+
+	// refill tokens for the elapsed time
+	elapsed := now.Sub(b.updated)
+	b.tokens = math.Min(capacity, b.tokens+elapsed.Seconds()/perToken.Seconds())
+	b.updated = now
+
+	result := Result{Limit: limit.Requests}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - b.tokens) * float64(perToken))
+	}
+
+	result.Remaining = int(b.tokens)
+	result.ResetAfter = time.Duration((capacity - b.tokens) * float64(perToken))
+
+	return result, nil
+}
+
+func (s *memoryStore) cleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.removeIdle(s.now())
+	}
+}
+
+// removeIdle drops the buckets that have refilled completely.
+func (s *memoryStore) removeIdle(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, b := range s.buckets {
+		// a bucket idle for a whole period is full again
+		if now.Sub(b.updated) > b.period {
+			delete(s.buckets, key)
+		}
+	}
+}
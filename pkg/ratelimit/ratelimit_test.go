@@ -0,0 +1,173 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is advanced by hand so refills don't depend on wall time.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestStore() (*memoryStore, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	return &memoryStore{buckets: make(map[string]*bucket), now: clock.Now}, clock
+}
+
+func take(t *testing.T, s Store, key string, limit Limit) Result {
+	t.Helper()
+
+	result, err := s.Take(key, limit)
+	if err != nil {
+		t.Fatalf("take %q: %v", key, err)
+	}
+	return result
+}
+
+func TestTakeBurst(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit Limit
+	}{
+		{name: "one per minute", limit: Limit{Requests: 1, Period: time.Minute}},
+		{name: "five per minute", limit: Limit{Requests: 5, Period: time.Minute}},
+		{name: "hundred per hour", limit: Limit{Requests: 100, Period: time.Hour}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestStore()
+
+			// a new bucket is full, the whole limit can be spent at once
+			for i := 1; i <= tt.limit.Requests; i++ {
+				result := take(t, s, "ip:1.2.3.4", tt.limit)
+				if !result.Allowed || result.Limit != tt.limit.Requests || result.Remaining != tt.limit.Requests-i {
+					t.Fatalf("request %d = %+v, want allowed with %d remaining", i, result, tt.limit.Requests-i)
+				}
+			}
+
+			result := take(t, s, "ip:1.2.3.4", tt.limit)
+			if result.Allowed || result.Remaining != 0 {
+				t.Errorf("request over the burst = %+v, want it denied", result)
+			}
+
+			if want := tt.limit.Period; result.ResetAfter != want {
+				t.Errorf("reset after = %v, want %v", result.ResetAfter, want)
+			}
+		})
+	}
+}
+
+func TestTakeRefill(t *testing.T) {
+	s, clock := newTestStore()
+	limit := Limit{Requests: 4, Period: time.Minute}
+
+	for i := 0; i < 4; i++ {
+		take(t, s, "ip:1.2.3.4", limit)
+	}
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		allowed bool
+	}{
+		{name: "before a token refilled", advance: 14 * time.Second},
+		{name: "one token refilled", advance: time.Second, allowed: true},
+		{name: "token just spent", advance: 0},
+		{name: "idle longer than the period", advance: time.Hour, allowed: true},
+	}
+
+	for _, tt := range tests {
+		clock.Advance(tt.advance)
+
+		if result := take(t, s, "ip:1.2.3.4", limit); result.Allowed != tt.allowed {
+			t.Errorf("%s: allowed = %v, want %v", tt.name, result.Allowed, tt.allowed)
+		}
+	}
+
+	// refilling is capped at the limit, an hour idle does not allow more than a burst
+	allowed := 1
+	for take(t, s, "ip:1.2.3.4", limit).Allowed {
+		allowed++
+	}
+	if allowed != limit.Requests {
+		t.Errorf("%d requests allowed after idling, want %d", allowed, limit.Requests)
+	}
+}
+
+func TestTakeRetryAfter(t *testing.T) {
+	s, clock := newTestStore()
+	limit := Limit{Requests: 3, Period: 30 * time.Second}
+
+	for i := 0; i < 3; i++ {
+		take(t, s, "email:a@example.com", limit)
+	}
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		want    time.Duration
+	}{
+		{name: "right after the burst", advance: 0, want: 10 * time.Second},
+		{name: "part of a token refilled", advance: 4 * time.Second, want: 6 * time.Second},
+		{name: "denied requests don't spend tokens", advance: 0, want: 6 * time.Second},
+	}
+
+	for _, tt := range tests {
+		clock.Advance(tt.advance)
+
+		result := take(t, s, "email:a@example.com", limit)
+		if result.Allowed || result.RetryAfter != tt.want {
+			t.Errorf("%s: %+v, want denied with retry after %v", tt.name, result, tt.want)
+		}
+	}
+
+	// retrying after the announced wait succeeds
+	clock.Advance(6 * time.Second)
+	if result := take(t, s, "email:a@example.com", limit); !result.Allowed {
+		t.Errorf("request after retry after = %+v, want it allowed", result)
+	}
+}
+
+func TestTakeSeparatesKeys(t *testing.T) {
+	s, _ := newTestStore()
+	limit := Limit{Requests: 1, Period: time.Minute}
+
+	take(t, s, "login:ip:1.2.3.4", limit)
+
+	if result := take(t, s, "login:ip:1.2.3.4", limit); result.Allowed {
+		t.Errorf("second request of the same key allowed")
+	}
+
+	for _, key := range []string{"login:ip:5.6.7.8", "register:ip:1.2.3.4", "login:email:a@example.com"} {
+		if result := take(t, s, key, limit); !result.Allowed {
+			t.Errorf("%q throttled by another key's bucket", key)
+		}
+	}
+}
+
+func TestRemoveIdle(t *testing.T) {
+	s, clock := newTestStore()
+
+	take(t, s, "short", Limit{Requests: 1, Period: time.Minute})
+	take(t, s, "long", Limit{Requests: 1, Period: time.Hour})
+
+	clock.Advance(2 * time.Minute)
+	s.removeIdle(clock.Now())
+
+	if _, ok := s.buckets["short"]; ok {
+		t.Errorf("bucket idle for longer than its period was kept")
+	}
+	if _, ok := s.buckets["long"]; !ok {
+		t.Errorf("bucket still refilling was removed")
+	}
+}
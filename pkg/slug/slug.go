@@ -0,0 +1,83 @@
+// Package slug makes url path segments out of names.
+package slug
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxLength keeps slugs short enough for urls and indexes.
+const MaxLength = 100
+
+// room left after a long base for the hyphen and the numeric suffix
+const suffixRoom = 10
+
+// latin letters that do not decompose into an ascii letter and a mark
+var transliterations = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'ø': "o", 'œ': "oe", 'ð': "d", 'þ': "th", 'ł': "l", 'đ': "d", 'ı': "i",
+	'ħ': "h", 'ŧ': "t", 'ŋ': "n", 'ĸ': "k",
+}
+
+// Make lowercases the name, folds latin accents and joins the letters and
+// digits with single hyphens. Other scripts are dropped, the result may be
+// empty.
+func Make(name string) string {
+	var b strings.Builder
+	hyphen := false
+
+	// the compatibility decomposition splits accented letters into the base
+	// letter and its marks, and ligatures into their letters
+	for _, r := range norm.NFKD.String(strings.ToLower(name)) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+
+		s, ok := transliterations[r]
+		if !ok && r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			s = string(r)
+		}
+
+		if s == "" {
+			hyphen = b.Len() > 0
+			continue
+		}
+
+		if hyphen {
+			b.WriteByte('-')
+			hyphen = false
+		}
+		b.WriteString(s)
+	}
+
+	slug := b.String()
+	if len(slug) > MaxLength {
+		slug = strings.TrimRight(slug[:MaxLength], "-")
+	}
+
+	return slug
+}
+
+// Unique returns base when it is free, otherwise base with the next numeric
+// suffix from 2 on. used reports in one lookup whether base is taken and the
+// highest number used after prefix, a long base is shortened in the prefix to
+// leave room for the suffix.
+func Unique(base string, used func(base, prefix string) (bool, int, error)) (string, error) {
+	stem := base
+	if len(stem) > MaxLength-suffixRoom {
+		stem = strings.TrimRight(stem[:MaxLength-suffixRoom], "-")
+	}
+	prefix := stem + "-"
+
+	taken, suffix, err := used(base, prefix)
+	if err != nil {
+		return "", err
+	}
+	if !taken {
+		return base, nil
+	}
+
+	return prefix + strconv.Itoa(max(suffix, 1)+1), nil
+}